@@ -7,6 +7,8 @@ type AppConfig struct {
 	OIDC   *OIDCConfig        `json:"OIDC"`   // OIDC配置（可选）
 	GitHub *GitHubOAuthConfig `json:"GitHub"` // GitHub OAuth配置（可选）
 	GeoIP  *GeoIPConfig       `json:"GeoIP"`  // GeoIP配置（可选）
+
+	Enrichment *EnrichmentConfig `json:"Enrichment"` // 登录记录补充配置（可选）
 }
 
 // JWTConfig JWT配置
@@ -36,6 +38,30 @@ type GitHubOAuthConfig struct {
 // GeoIPConfig GeoIP配置
 type GeoIPConfig struct {
 	Enabled    bool   `json:"Enabled"`    // 是否启用GeoIP查询
-	DBPath     string `json:"DBPath"`     // GeoIP数据库文件路径（如：GeoLite2-City.mmdb）
+	DBPath     string `json:"DBPath"`     // GeoIP数据库文件路径，支持城市、企业和国家数据库（如：GeoLite2-City.mmdb、GeoLite2-Country.mmdb）
 	DBLanguage string `json:"DBLanguage"` // 数据库语言（如：zh-CN、en）
+	ASNDBPath  string `json:"ASNDBPath"`  // ASN数据库文件路径（如：GeoLite2-ASN.mmdb，可选）
+	CacheSize  int    `json:"CacheSize"`  // 查询结果缓存条目数，未命中的结果同样缓存（默认1024）
+	WatchDB    bool   `json:"WatchDB"`    // 监控数据库文件，更新后自动重新加载
+
+	DBLanguageFallbacks []string `json:"DBLanguageFallbacks"` // DBLanguage 没有名称时依次尝试的语言（如：["zh-CN", "en"]），最后总是回退到英文
+
+	ExtraPrivateRanges []string `json:"ExtraPrivateRanges"` // 额外视为内网IP的网段 (CIDR，如VPN出口、云NAT网关)
+
+	FallbackAPIURL        string `json:"FallbackAPIURL"`        // 本地数据库未加载或未命中时使用的在线查询接口，{ip} 会被替换为查询的IP（可选）
+	FallbackMaxInflight   int    `json:"FallbackMaxInflight"`   // 在线查询最大并发数，超出时只返回本地结果（默认4）
+	FallbackRatePerMinute int    `json:"FallbackRatePerMinute"` // 在线查询每分钟请求数上限，超出时只返回本地结果（默认45）
+
+	PrivacyLevel string `json:"PrivacyLevel"` // 归属地输出精度：full（国家-省份-城市及经纬度）、country（只输出国家）、none（不输出），默认 full
+}
+
+// EnrichmentConfig 登录记录补充配置
+type EnrichmentConfig struct {
+	Workers         int  `json:"Workers"`         // 并发查询的IP数（默认8）
+	LookupTimeoutMs int  `json:"LookupTimeoutMs"` // 单个IP的查询超时毫秒数（默认2000）
+	ReverseDNS      bool `json:"ReverseDNS"`      // 是否反向解析来源IP的主机名
+
+	CacheSize          int `json:"CacheSize"`          // 跨周期缓存的条目数上限（默认10000）
+	LocationCacheHours int `json:"LocationCacheHours"` // 归属地缓存小时数（默认168）
+	HostnameCacheHours int `json:"HostnameCacheHours"` // 主机名缓存小时数（默认24）
 }
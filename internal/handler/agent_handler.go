@@ -229,8 +229,9 @@ func (h *AgentHandler) handleWebSocketMessage(ctx context.Context, agentID strin
 // sendRegisterSuccess 发送注册成功响应
 func (h *AgentHandler) sendRegisterSuccess(conn *websocket.Conn, agentID string) error {
 	resp := protocol.RegisterResponse{
-		AgentID: agentID,
-		Status:  "success",
+		AgentID:   agentID,
+		Status:    "success",
+		Encodings: []string{protocol.LoginAssetsEncodingProtobuf},
 	}
 	respData, err := json.Marshal(resp)
 	if err != nil {
@@ -0,0 +1,66 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+)
+
+// 登录事件类型，用于事件输出和 NDJSON 导出
+const (
+	LoginEventTypeSuccess = "success_login"
+	LoginEventTypeFailed  = "failed_login"
+	LoginEventTypeSession = "session"
+)
+
+// ndjsonLoginRecord NDJSON 中的一条登录记录，记录的字段与 type 位于同一层
+type ndjsonLoginRecord struct {
+	Type string `json:"type"`
+	LoginRecord
+}
+
+// ndjsonLoginSession NDJSON 中的一个会话
+type ndjsonLoginSession struct {
+	Type string `json:"type"`
+	LoginSession
+}
+
+// WriteNDJSON 以换行分隔的 JSON (NDJSON) 输出登录资产，每条登录记录和每个会话一行，
+// 以 type 字段区分 success_login/failed_login/session，便于直接导入 Elasticsearch、Loki 等。
+// 统计信息等汇总内容不输出；记录中已补充的归属地、认证方式等字段存在时一并输出
+func (a *LoginAssets) WriteNDJSON(w io.Writer) error {
+	if a == nil {
+		return nil
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+
+	for _, group := range []struct {
+		eventType string
+		records   []LoginRecord
+	}{
+		{LoginEventTypeSuccess, a.SuccessfulLogins},
+		{LoginEventTypeFailed, a.FailedLogins},
+	} {
+		for _, record := range group.records {
+			if err := encoder.Encode(ndjsonLoginRecord{Type: group.eventType, LoginRecord: record}); err != nil {
+				return err
+			}
+		}
+	}
+	for _, session := range a.CurrentSessions {
+		if err := encoder.Encode(ndjsonLoginSession{Type: LoginEventTypeSession, LoginSession: session}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MarshalNDJSON 返回 WriteNDJSON 的输出
+func (a *LoginAssets) MarshalNDJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := a.WriteNDJSON(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,53 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestLoginAssetsMarshalNDJSON(t *testing.T) {
+	assets := &LoginAssets{
+		SuccessfulLogins: []LoginRecord{{Username: "alice", IP: "203.0.113.7", Location: "中国-上海", AuthMethod: "publickey", Terminal: "pts/0", Timestamp: 1000, Status: "success"}},
+		FailedLogins:     []LoginRecord{{Username: "root", IP: "45.148.10.81", Terminal: "ssh:notty", Timestamp: 2000, Status: "failed"}},
+		CurrentSessions:  []LoginSession{{Username: "alice", Terminal: "pts/0", IP: "203.0.113.7", LoginTime: 1000}},
+		Statistics:       &LoginStatistics{TotalLogins: 1},
+	}
+
+	data, err := assets.MarshalNDJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("应每条记录和会话一行: %s", data)
+	}
+
+	var events []map[string]any
+	for _, line := range lines {
+		var event map[string]any
+		if err := json.Unmarshal([]byte(line), &event); err != nil {
+			t.Fatalf("%s: %v", line, err)
+		}
+		events = append(events, event)
+	}
+	if events[0]["type"] != LoginEventTypeSuccess || events[0]["username"] != "alice" ||
+		events[0]["location"] != "中国-上海" || events[0]["authMethod"] != "publickey" {
+		t.Errorf("成功登录 = %v", events[0])
+	}
+	if events[1]["type"] != LoginEventTypeFailed || events[1]["ip"] != "45.148.10.81" {
+		t.Errorf("失败登录 = %v", events[1])
+	}
+	if _, ok := events[1]["location"]; ok {
+		t.Errorf("没有归属地时不应输出: %v", events[1])
+	}
+	if events[2]["type"] != LoginEventTypeSession || events[2]["terminal"] != "pts/0" {
+		t.Errorf("会话 = %v", events[2])
+	}
+
+	var buf bytes.Buffer
+	if err := (*LoginAssets)(nil).WriteNDJSON(&buf); err != nil || buf.Len() != 0 {
+		t.Errorf("nil 应输出为空: %q %v", buf.String(), err)
+	}
+}
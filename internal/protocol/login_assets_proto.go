@@ -0,0 +1,452 @@
+package protocol
+
+import (
+	_ "embed"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+//go:generate go run ./protogen
+
+// LoginAssetsEncodingProtobuf 登录资产的 protobuf 编码，服务端在注册响应中声明支持后探针才会使用
+const LoginAssetsEncodingProtobuf = "protobuf"
+
+// loginAssetsProtoSource 由 protogen 根据 Go 结构体生成，字段编号以该文件为准
+//
+//go:embed login_assets.proto
+var loginAssetsProtoSource string
+
+// protoSchema .proto 文件中各消息的字段编号
+type protoSchema struct {
+	messages map[string]*protoMessage
+}
+
+// protoMessage 单个消息的字段编号
+type protoMessage struct {
+	fields   map[string]protowire.Number // 字段名 -> 编号
+	reserved []protowire.Number          // 已删除字段的编号，不再分配
+}
+
+// parseProtoSchema 解析 protogen 生成的 .proto 文件
+// 只支持生成器输出的格式：每行一个字段或 reserved 声明，不支持嵌套消息
+func parseProtoSchema(src string) (*protoSchema, error) {
+	schema := &protoSchema{messages: make(map[string]*protoMessage)}
+
+	var current *protoMessage
+	for i, line := range strings.Split(src, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "" || strings.HasPrefix(line, "//"):
+		case strings.HasPrefix(line, "message "):
+			name := strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(line, "message "), "{"))
+			current = &protoMessage{fields: make(map[string]protowire.Number)}
+			schema.messages[name] = current
+		case line == "}":
+			current = nil
+		case current == nil:
+			// syntax/package/option 等文件级声明
+		case strings.HasPrefix(line, "reserved "):
+			for _, value := range strings.Split(strings.TrimSuffix(strings.TrimPrefix(line, "reserved "), ";"), ",") {
+				num, err := strconv.Atoi(strings.TrimSpace(value))
+				if err != nil {
+					return nil, fmt.Errorf("line %d: invalid reserved number %q", i+1, value)
+				}
+				current.reserved = append(current.reserved, protowire.Number(num))
+			}
+		default:
+			decl, value, ok := strings.Cut(strings.TrimSuffix(line, ";"), " = ")
+			if !ok {
+				return nil, fmt.Errorf("line %d: invalid field %q", i+1, line)
+			}
+			num, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid field number %q", i+1, value)
+			}
+			parts := strings.Fields(decl)
+			current.fields[parts[len(parts)-1]] = protowire.Number(num)
+		}
+	}
+	return schema, nil
+}
+
+// goProtoField Go 结构体字段与 .proto 字段的对应关系
+type goProtoField struct {
+	index int
+	name  string // .proto 字段名 (json 名称转为 snake_case)
+	typ   reflect.Type
+}
+
+// goProtoFields 参与编码的字段，与 JSON 编码相同：导出且 json 标签不为 "-"
+func goProtoFields(t reflect.Type) []goProtoField {
+	var fields []goProtoField
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		fields = append(fields, goProtoField{index: i, name: snakeCase(name), typ: field.Type})
+	}
+	return fields
+}
+
+// snakeCase successfulLogins -> successful_logins, uniqueIPs -> unique_ips
+func snakeCase(name string) string {
+	var b strings.Builder
+	for i, r := range name {
+		if r >= 'A' && r <= 'Z' {
+			if i > 0 {
+				prev := name[i-1]
+				if (prev >= 'a' && prev <= 'z') || (prev >= '0' && prev <= '9') {
+					b.WriteByte('_')
+				}
+			}
+			r += 'a' - 'A'
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// protoCodec 单个结构体类型的编解码信息
+type protoCodec struct {
+	fields []protoCodecField
+	byNum  map[protowire.Number]int // 编号 -> 结构体字段下标
+}
+
+type protoCodecField struct {
+	index int
+	num   protowire.Number
+}
+
+var (
+	loginProtoSchemaOnce sync.Once
+	loginProtoSchema     *protoSchema
+	loginProtoSchemaErr  error
+
+	// reflect.Type -> *protoCodec
+	loginProtoCodecs sync.Map
+)
+
+func loadLoginProtoSchema() (*protoSchema, error) {
+	loginProtoSchemaOnce.Do(func() {
+		loginProtoSchema, loginProtoSchemaErr = parseProtoSchema(loginAssetsProtoSource)
+	})
+	return loginProtoSchema, loginProtoSchemaErr
+}
+
+// codecFor 根据 .proto 中的字段编号构建结构体的编解码信息
+func codecFor(t reflect.Type) (*protoCodec, error) {
+	if codec, ok := loginProtoCodecs.Load(t); ok {
+		return codec.(*protoCodec), nil
+	}
+
+	schema, err := loadLoginProtoSchema()
+	if err != nil {
+		return nil, err
+	}
+	message, ok := schema.messages[t.Name()]
+	if !ok {
+		return nil, fmt.Errorf("message %s not found in login_assets.proto", t.Name())
+	}
+
+	codec := &protoCodec{byNum: make(map[protowire.Number]int)}
+	for _, field := range goProtoFields(t) {
+		num, ok := message.fields[field.name]
+		if !ok {
+			return nil, fmt.Errorf("field %s.%s not found in login_assets.proto", t.Name(), field.name)
+		}
+		codec.fields = append(codec.fields, protoCodecField{index: field.index, num: num})
+		codec.byNum[num] = field.index
+	}
+
+	loginProtoCodecs.Store(t, codec)
+	return codec, nil
+}
+
+// MarshalLoginAssetsProto 将登录资产编码为 protobuf
+func MarshalLoginAssetsProto(assets *LoginAssets) ([]byte, error) {
+	if assets == nil {
+		return nil, nil
+	}
+	return appendProtoMessage(nil, reflect.ValueOf(assets).Elem())
+}
+
+// UnmarshalLoginAssetsProto 解码 protobuf 编码的登录资产，未知字段会被忽略
+func UnmarshalLoginAssetsProto(data []byte) (*LoginAssets, error) {
+	assets := &LoginAssets{}
+	if err := consumeProtoMessage(data, reflect.ValueOf(assets).Elem()); err != nil {
+		return nil, err
+	}
+	return assets, nil
+}
+
+func appendProtoMessage(b []byte, v reflect.Value) ([]byte, error) {
+	codec, err := codecFor(v.Type())
+	if err != nil {
+		return nil, err
+	}
+	for _, field := range codec.fields {
+		if b, err = appendProtoField(b, field.num, v.Field(field.index), false); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+// appendProtoField 编码单个字段，proto3 标量为零值时省略，repeated 元素 (force) 始终编码
+func appendProtoField(b []byte, num protowire.Number, v reflect.Value, force bool) ([]byte, error) {
+	switch v.Kind() {
+	case reflect.String:
+		if v.Len() > 0 || force {
+			b = protowire.AppendTag(b, num, protowire.BytesType)
+			b = protowire.AppendString(b, v.String())
+		}
+	case reflect.Bool:
+		if v.Bool() || force {
+			b = protowire.AppendTag(b, num, protowire.VarintType)
+			b = protowire.AppendVarint(b, protowire.EncodeBool(v.Bool()))
+		}
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		if v.Int() != 0 || force {
+			b = protowire.AppendTag(b, num, protowire.VarintType)
+			b = protowire.AppendVarint(b, uint64(v.Int()))
+		}
+	case reflect.Float64:
+		if v.Float() != 0 || force {
+			b = protowire.AppendTag(b, num, protowire.Fixed64Type)
+			b = protowire.AppendFixed64(b, math.Float64bits(v.Float()))
+		}
+	case reflect.Pointer:
+		if v.IsNil() {
+			return b, nil
+		}
+		return appendProtoField(b, num, v.Elem(), true)
+	case reflect.Struct:
+		inner, err := appendProtoMessage(nil, v)
+		if err != nil {
+			return nil, err
+		}
+		b = protowire.AppendTag(b, num, protowire.BytesType)
+		b = protowire.AppendBytes(b, inner)
+	case reflect.Slice, reflect.Array:
+		// 定长数组的零值元素同样写入，以便按位置解码
+		var err error
+		for i := 0; i < v.Len(); i++ {
+			if b, err = appendProtoField(b, num, v.Index(i), true); err != nil {
+				return nil, err
+			}
+		}
+	case reflect.Map:
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+		for _, key := range keys {
+			entry, err := appendProtoField(nil, 1, key, true)
+			if err != nil {
+				return nil, err
+			}
+			if entry, err = appendProtoField(entry, 2, v.MapIndex(key), true); err != nil {
+				return nil, err
+			}
+			b = protowire.AppendTag(b, num, protowire.BytesType)
+			b = protowire.AppendBytes(b, entry)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported kind %s", v.Kind())
+	}
+	return b, nil
+}
+
+func consumeProtoMessage(b []byte, v reflect.Value) error {
+	codec, err := codecFor(v.Type())
+	if err != nil {
+		return err
+	}
+
+	arrayIndex := make(map[protowire.Number]int)
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		index, ok := codec.byNum[num]
+		if !ok {
+			// 新版本探针增加的字段
+			n = protowire.ConsumeFieldValue(num, typ, b)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			b = b[n:]
+			continue
+		}
+
+		field := v.Field(index)
+		if field.Kind() == reflect.Array {
+			// 定长数组按出现顺序填充，多出的元素丢弃
+			elem := reflect.New(field.Type().Elem()).Elem()
+			if arrayIndex[num] < field.Len() {
+				elem = field.Index(arrayIndex[num])
+			}
+			arrayIndex[num]++
+			field = elem
+		}
+		n, err := consumeProtoField(b, typ, field)
+		if err != nil {
+			return fmt.Errorf("%s field %d: %w", v.Type().Name(), num, err)
+		}
+		b = b[n:]
+	}
+	return nil
+}
+
+// consumeProtoField 解码单个字段值，返回消耗的字节数
+func consumeProtoField(b []byte, typ protowire.Type, v reflect.Value) (int, error) {
+	expect := protowire.BytesType
+	switch v.Kind() {
+	case reflect.Bool, reflect.Int, reflect.Int32, reflect.Int64:
+		expect = protowire.VarintType
+	case reflect.Float64:
+		expect = protowire.Fixed64Type
+	case reflect.Slice:
+		elem := reflect.New(v.Type().Elem()).Elem()
+		n, err := consumeProtoField(b, typ, elem)
+		if err != nil {
+			return 0, err
+		}
+		v.Set(reflect.Append(v, elem))
+		return n, nil
+	}
+	if typ != expect {
+		return 0, fmt.Errorf("unexpected wire type %d", typ)
+	}
+
+	switch v.Kind() {
+	case reflect.Bool, reflect.Int, reflect.Int32, reflect.Int64:
+		x, n := protowire.ConsumeVarint(b)
+		if n < 0 {
+			return 0, protowire.ParseError(n)
+		}
+		if v.Kind() == reflect.Bool {
+			v.SetBool(protowire.DecodeBool(x))
+		} else {
+			v.SetInt(int64(x))
+		}
+		return n, nil
+	case reflect.Float64:
+		x, n := protowire.ConsumeFixed64(b)
+		if n < 0 {
+			return 0, protowire.ParseError(n)
+		}
+		v.SetFloat(math.Float64frombits(x))
+		return n, nil
+	}
+
+	data, n := protowire.ConsumeBytes(b)
+	if n < 0 {
+		return 0, protowire.ParseError(n)
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(string(data))
+	case reflect.Pointer:
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		if err := consumeProtoMessage(data, v.Elem()); err != nil {
+			return 0, err
+		}
+	case reflect.Struct:
+		if err := consumeProtoMessage(data, v); err != nil {
+			return 0, err
+		}
+	case reflect.Map:
+		if err := consumeProtoMapEntry(data, v); err != nil {
+			return 0, err
+		}
+	default:
+		return 0, fmt.Errorf("unsupported kind %s", v.Kind())
+	}
+	return n, nil
+}
+
+// consumeProtoMapEntry 解码 map 条目 (key = 1, value = 2)
+func consumeProtoMapEntry(b []byte, v reflect.Value) error {
+	if v.IsNil() {
+		v.Set(reflect.MakeMap(v.Type()))
+	}
+	key := reflect.New(v.Type().Key()).Elem()
+	value := reflect.New(v.Type().Elem()).Elem()
+
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		var err error
+		switch num {
+		case 1:
+			n, err = consumeProtoField(b, typ, key)
+		case 2:
+			n, err = consumeProtoField(b, typ, value)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, b)
+			if n < 0 {
+				err = protowire.ParseError(n)
+			}
+		}
+		if err != nil {
+			return err
+		}
+		b = b[n:]
+	}
+
+	v.SetMapIndex(key, value)
+	return nil
+}
+
+// EncodeLoginAssetsProto 将登录资产改为 protobuf 编码传输
+// 编码结果写入 LoginAssetsProto，并清空 LoginAssets 避免重复传输
+func (inv *AssetInventory) EncodeLoginAssetsProto() error {
+	if inv.LoginAssets == nil {
+		return nil
+	}
+	data, err := MarshalLoginAssetsProto(inv.LoginAssets)
+	if err != nil {
+		return err
+	}
+	inv.LoginAssetsProto = data
+	inv.LoginAssets = nil
+	return nil
+}
+
+// DecodeLoginAssets 还原 protobuf 编码传输的登录资产，未使用 protobuf 编码时不做处理
+func (inv *AssetInventory) DecodeLoginAssets() error {
+	if len(inv.LoginAssetsProto) == 0 {
+		return nil
+	}
+	assets, err := UnmarshalLoginAssetsProto(inv.LoginAssetsProto)
+	if err != nil {
+		return err
+	}
+	inv.LoginAssets = assets
+	inv.LoginAssetsProto = nil
+	return nil
+}
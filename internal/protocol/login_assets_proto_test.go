@@ -0,0 +1,108 @@
+package protocol
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func TestLoginAssetsProtoInSync(t *testing.T) {
+	generated, err := GenerateLoginAssetsProto(loginAssetsProtoSource)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if generated != loginAssetsProtoSource {
+		t.Fatal("login_assets.proto 与 Go 结构体不一致，请执行 go generate ./internal/protocol")
+	}
+}
+
+func TestGenerateLoginAssetsProtoKeepsNumbers(t *testing.T) {
+	// 模拟旧版本：host_location 编号为 9，另有一个已删除的字段
+	old := strings.Replace(loginAssetsProtoSource, "HostLocation host_location = 6;", "HostLocation host_location = 9;\n  string removed = 6;", 1)
+
+	generated, err := GenerateLoginAssetsProto(old)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(generated, "HostLocation host_location = 9;") {
+		t.Error("已有字段的编号被修改")
+	}
+	if !strings.Contains(generated, "reserved 6;") {
+		t.Error("删除字段的编号没有保留")
+	}
+}
+
+func TestLoginAssetsProtoRoundTrip(t *testing.T) {
+	assets := &LoginAssets{
+		SuccessfulLogins: []LoginRecord{
+			{Username: "root", IP: "203.0.113.7", Location: "美国", Terminal: "pts/0", Timestamp: 1709283600000, Status: "success", EndReason: SessionEndCrash, DurationSeconds: 93780, AuthMethod: AuthMethodPublicKey},
+			{Username: "deploy", IP: "198.51.100.9", Terminal: "pts/1", Timestamp: 1709283700000, LogoutTime: 1709285500000},
+		},
+		FailedLogins:    []LoginRecord{{Username: "admin", IP: "192.0.2.1", Terminal: "ssh", Timestamp: 1709283800000, Status: "failed"}},
+		CurrentSessions: []LoginSession{{Username: "root", Terminal: "pts/0", IP: "203.0.113.7", LoginTime: 1709283600000, IdleTime: 120}},
+		AccountLockouts: []AccountLockout{{Username: "alice", Module: "pam_faillock", Source: "faillock", Attempts: 3, Locked: true, LockedAt: 1709283900000}},
+		SSHDPolicy:      &SSHDPolicy{Source: "sshd -T", PermitRootLogin: "prohibit-password", PubkeyAuthentication: true, MaxAuthTries: 6, AllowUsers: []string{"root", ""}},
+		HostLocation:    &HostLocation{IP: "192.0.2.10"},
+		Statistics: &LoginStatistics{
+			TotalLogins:     2,
+			UniqueIPs:       map[string]int{"203.0.113.7": 1, "198.51.100.9": 1},
+			ScriptedAttacks: []ScriptedAttack{{IP: "192.0.2.1", Attempts: 6, MeanIntervalMs: 30000.5, CoefficientOfVariation: 0.004}},
+			LoginsByHour:    [24]int{9: 2, 23: 1},
+		},
+	}
+
+	data, err := MarshalLoginAssetsProto(assets)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := UnmarshalLoginAssetsProto(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(assets, decoded) {
+		t.Fatalf("解码结果不一致:\n%+v\n%+v", assets, decoded)
+	}
+
+	jsonData, err := json.Marshal(assets)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) >= len(jsonData) {
+		t.Errorf("protobuf 编码 %d 字节, 不小于 JSON 的 %d 字节", len(data), len(jsonData))
+	}
+
+	inventory := AssetInventory{LoginAssets: assets}
+	if err := inventory.EncodeLoginAssetsProto(); err != nil || inventory.LoginAssets != nil {
+		t.Fatalf("EncodeLoginAssetsProto = %v, LoginAssets = %v", err, inventory.LoginAssets)
+	}
+	if err := inventory.DecodeLoginAssets(); err != nil || !reflect.DeepEqual(inventory.LoginAssets, assets) {
+		t.Fatalf("DecodeLoginAssets = %v", err)
+	}
+}
+
+func TestHighFrequencyIPsDecodesLegacyMap(t *testing.T) {
+	// 旧版本的 map<string, int64> high_frequency_ips = 6 条目
+	var entry []byte
+	entry = protowire.AppendTag(entry, 1, protowire.BytesType)
+	entry = protowire.AppendString(entry, "203.0.113.7")
+	entry = protowire.AppendTag(entry, 2, protowire.VarintType)
+	entry = protowire.AppendVarint(entry, 11)
+	var stats []byte
+	stats = protowire.AppendTag(stats, 6, protowire.BytesType)
+	stats = protowire.AppendBytes(stats, entry)
+	var data []byte
+	data = protowire.AppendTag(data, 7, protowire.BytesType)
+	data = protowire.AppendBytes(data, stats)
+
+	decoded, err := UnmarshalLoginAssetsProto(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []HighFrequencyIP{{IP: "203.0.113.7", Count: 11}}
+	if decoded.Statistics == nil || !reflect.DeepEqual(decoded.Statistics.HighFrequencyIPs, want) {
+		t.Fatalf("解码结果 = %+v", decoded.Statistics)
+	}
+}
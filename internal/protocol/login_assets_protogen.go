@@ -0,0 +1,135 @@
+package protocol
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+const loginAssetsProtoHeader = `// Code generated by protogen from the Go structs in internal/protocol. DO NOT EDIT.
+// 重新生成: go generate ./internal/protocol
+// 已分配的字段编号不会改变，删除的字段编号记录在 reserved 中
+
+syntax = "proto3";
+
+package pika.protocol;
+
+option go_package = "github.com/dushixiang/pika/internal/protocol";
+`
+
+// GenerateLoginAssetsProto 根据 Go 结构体生成 LoginAssets 的 .proto 定义
+// current 为当前的 .proto 内容，已有字段沿用原编号，新字段分配新编号，删除的字段编号保留
+func GenerateLoginAssetsProto(current string) (string, error) {
+	existing, err := parseProtoSchema(current)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	b.WriteString(loginAssetsProtoHeader)
+
+	// 从 LoginAssets 开始按字段顺序遍历全部消息类型
+	queue := []reflect.Type{reflect.TypeOf(LoginAssets{})}
+	seen := map[reflect.Type]bool{queue[0]: true}
+	for len(queue) > 0 {
+		t := queue[0]
+		queue = queue[1:]
+
+		old := existing.messages[t.Name()]
+		if old == nil {
+			old = &protoMessage{fields: make(map[string]protowire.Number)}
+		}
+
+		next := protowire.Number(1)
+		for _, num := range old.fields {
+			next = max(next, num+1)
+		}
+		for _, num := range old.reserved {
+			next = max(next, num+1)
+		}
+
+		var lines []string
+		used := make(map[string]bool)
+		for _, field := range goProtoFields(t) {
+			typ, nested, err := protoFieldType(field.typ)
+			if err != nil {
+				return "", fmt.Errorf("%s.%s: %w", t.Name(), field.name, err)
+			}
+			if nested != nil && !seen[nested] {
+				seen[nested] = true
+				queue = append(queue, nested)
+			}
+
+			num, ok := old.fields[field.name]
+			if !ok {
+				num = next
+				next++
+			}
+			used[field.name] = true
+			lines = append(lines, fmt.Sprintf("  %s %s = %d;", typ, field.name, num))
+		}
+
+		reserved := append([]protowire.Number(nil), old.reserved...)
+		for name, num := range old.fields {
+			if !used[name] {
+				reserved = append(reserved, num)
+			}
+		}
+
+		fmt.Fprintf(&b, "\nmessage %s {\n", t.Name())
+		for _, line := range lines {
+			b.WriteString(line + "\n")
+		}
+		if len(reserved) > 0 {
+			sort.Slice(reserved, func(i, j int) bool { return reserved[i] < reserved[j] })
+			values := make([]string, len(reserved))
+			for i, num := range reserved {
+				values[i] = fmt.Sprint(num)
+			}
+			fmt.Fprintf(&b, "  reserved %s;\n", strings.Join(values, ", "))
+		}
+		b.WriteString("}\n")
+	}
+
+	return b.String(), nil
+}
+
+// protoFieldType Go 类型对应的 .proto 类型，nested 为需要生成的消息类型
+func protoFieldType(t reflect.Type) (typ string, nested reflect.Type, err error) {
+	switch t.Kind() {
+	case reflect.String:
+		return "string", nil, nil
+	case reflect.Bool:
+		return "bool", nil, nil
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		return "int64", nil, nil
+	case reflect.Float64:
+		return "double", nil, nil
+	case reflect.Pointer:
+		if t.Elem().Kind() != reflect.Struct {
+			break
+		}
+		return t.Elem().Name(), t.Elem(), nil
+	case reflect.Struct:
+		return t.Name(), t, nil
+	case reflect.Slice, reflect.Array: // 定长数组同样对应 repeated
+		elem, nested, err := protoFieldType(t.Elem())
+		if err != nil || strings.HasPrefix(elem, "repeated ") || strings.HasPrefix(elem, "map<") {
+			break
+		}
+		return "repeated " + elem, nested, nil
+	case reflect.Map:
+		if t.Key().Kind() != reflect.String {
+			break
+		}
+		value, nested, err := protoFieldType(t.Elem())
+		if err != nil || nested != nil || strings.HasPrefix(value, "repeated ") {
+			break
+		}
+		return fmt.Sprintf("map<string, %s>", value), nil, nil
+	}
+	return "", nil, fmt.Errorf("unsupported type %s", t)
+}
@@ -0,0 +1,50 @@
+package protocol
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// LoginRecordID 计算登录记录的稳定标识，用于跨轮询、跨系统关联和入库去重
+//
+// 参与计算的字段及规范化规则 (服务端可据此独立复现):
+//  1. username: 原样使用
+//  2. ip: 去掉 "[" "]" 后能解析为 IP 时使用规范形式 (IPv6 压缩、IPv4 映射地址还原为 IPv4)，否则原样使用
+//  3. timestamp: 毫秒时间戳向下取整到分钟，以 Unix 秒的十进制表示 (lastb 等来源只精确到分钟)
+//  4. terminal: 去掉 "/dev/" 前缀，"ssh:notty" 视为 "ssh" (lastb 与认证日志的写法不同)
+//  5. status: 原样使用 (success/failed)
+//
+// 各字段按上述顺序以 0x1f 分隔拼接，计算 SHA-256，取前 16 字节的小写十六进制 (32 个字符)。
+// 不包含归属地、主机名、会话结束等后续补充或会变化的字段
+func LoginRecordID(record LoginRecord) string {
+	ip := strings.TrimSuffix(strings.TrimPrefix(record.IP, "["), "]")
+	if parsed := net.ParseIP(ip); parsed != nil {
+		ip = parsed.String()
+	} else {
+		ip = record.IP
+	}
+
+	minute := record.Timestamp / 60000 * 60
+	if record.Timestamp < 0 && record.Timestamp%60000 != 0 {
+		minute -= 60
+	}
+
+	terminal := strings.TrimPrefix(record.Terminal, "/dev/")
+	if terminal == "ssh:notty" {
+		terminal = "ssh"
+	}
+
+	key := strings.Join([]string{
+		record.Username,
+		ip,
+		strconv.FormatInt(minute, 10),
+		terminal,
+		record.Status,
+	}, "\x1f")
+
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:16])
+}
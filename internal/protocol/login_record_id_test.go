@@ -0,0 +1,29 @@
+package protocol
+
+import "testing"
+
+func TestLoginRecordID(t *testing.T) {
+	// lastb 与认证日志观察到的同一次失败登录: 精度、IP 写法和终端名称不同
+	lastb := LoginRecord{Username: "root", IP: "2001:0db8:0:0::1", Terminal: "ssh:notty", Timestamp: 1767225600000, Status: "failed"}
+	authLog := LoginRecord{Username: "root", IP: "[2001:db8::1]", Terminal: "ssh", Timestamp: 1767225642000, Status: "failed", Location: "局域网"}
+
+	id := LoginRecordID(lastb)
+	if got := LoginRecordID(authLog); got != id {
+		t.Errorf("同一事件的标识不同: %s != %s", got, id)
+	}
+
+	// 按文档的规则独立计算: sha256("root\x1f2001:db8::1\x1f1767225600\x1fssh\x1ffailed") 的前 16 字节
+	if id != "00fc16e971aaab310ee8df30ae7ccf28" {
+		t.Errorf("标识 = %s", id)
+	}
+
+	for name, other := range map[string]LoginRecord{
+		"user":   {Username: "admin", IP: "2001:db8::1", Terminal: "ssh", Timestamp: 1767225600000, Status: "failed"},
+		"minute": {Username: "root", IP: "2001:db8::1", Terminal: "ssh", Timestamp: 1767225660000, Status: "failed"},
+		"status": {Username: "root", IP: "2001:db8::1", Terminal: "ssh", Timestamp: 1767225600000, Status: "success"},
+	} {
+		if LoginRecordID(other) == id {
+			t.Errorf("%s 不同的记录得到相同的标识", name)
+		}
+	}
+}
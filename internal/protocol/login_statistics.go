@@ -0,0 +1,63 @@
+package protocol
+
+import "sort"
+
+// IPCount 来源IP及其成功登录次数
+type IPCount struct {
+	IP    string `json:"ip"`
+	Count int    `json:"count"`
+}
+
+// UserCount 用户及其成功登录次数
+type UserCount struct {
+	Username string `json:"username"`
+	Count    int    `json:"count"`
+}
+
+// TopIPs 按登录次数从多到少 (次数相同时按IP) 排列的唯一IP统计，n<=0 时返回全部
+// UniqueIPs 是便于累加的 map，展示和比较时应使用该方法，结果的顺序是确定的
+func (s *LoginStatistics) TopIPs(n int) []IPCount {
+	if s == nil {
+		return nil
+	}
+	var counts []IPCount
+	for _, entry := range topCounts(s.UniqueIPs, n) {
+		counts = append(counts, IPCount{IP: entry.key, Count: entry.count})
+	}
+	return counts
+}
+
+// TopUsers 按登录次数从多到少 (次数相同时按用户名) 排列的唯一用户统计，n<=0 时返回全部
+func (s *LoginStatistics) TopUsers(n int) []UserCount {
+	if s == nil {
+		return nil
+	}
+	var counts []UserCount
+	for _, entry := range topCounts(s.UniqueUsers, n) {
+		counts = append(counts, UserCount{Username: entry.key, Count: entry.count})
+	}
+	return counts
+}
+
+type keyCount struct {
+	key   string
+	count int
+}
+
+// topCounts 按次数降序、键升序排列并保留前 n 个
+func topCounts(counts map[string]int, n int) []keyCount {
+	entries := make([]keyCount, 0, len(counts))
+	for key, count := range counts {
+		entries = append(entries, keyCount{key, count})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].count != entries[j].count {
+			return entries[i].count > entries[j].count
+		}
+		return entries[i].key < entries[j].key
+	})
+	if n > 0 && len(entries) > n {
+		entries = entries[:n]
+	}
+	return entries
+}
@@ -0,0 +1,33 @@
+package protocol
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLoginStatisticsTopCounts(t *testing.T) {
+	stats := &LoginStatistics{
+		UniqueIPs:   map[string]int{"203.0.113.7": 3, "198.51.100.1": 5, "192.0.2.4": 3, "192.0.2.9": 1},
+		UniqueUsers: map[string]int{"root": 2, "deploy": 2, "alice": 7},
+	}
+
+	want := []IPCount{{"198.51.100.1", 5}, {"192.0.2.4", 3}, {"203.0.113.7", 3}}
+	for i := 0; i < 20; i++ {
+		if got := stats.TopIPs(3); !reflect.DeepEqual(got, want) {
+			t.Fatalf("TopIPs(3) = %+v", got)
+		}
+	}
+	if got := stats.TopIPs(0); len(got) != 4 || got[3].IP != "192.0.2.9" {
+		t.Errorf("TopIPs(0) = %+v", got)
+	}
+
+	wantUsers := []UserCount{{"alice", 7}, {"deploy", 2}, {"root", 2}}
+	if got := stats.TopUsers(10); !reflect.DeepEqual(got, wantUsers) {
+		t.Errorf("TopUsers(10) = %+v", got)
+	}
+
+	var empty *LoginStatistics
+	if empty.TopIPs(5) != nil || (&LoginStatistics{}).TopUsers(5) != nil {
+		t.Error("没有统计时应返回 nil")
+	}
+}
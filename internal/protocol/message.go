@@ -19,6 +19,8 @@ type RegisterResponse struct {
 	AgentID string `json:"agentId"`
 	Status  string `json:"status"`
 	Message string `json:"message,omitempty"`
+
+	Encodings []string `json:"encodings,omitempty"` // 服务端支持的登录资产编码 (JSON 始终支持)
 }
 
 // AgentInfo 探针信息
@@ -200,7 +202,7 @@ type TemperatureData struct {
 // CommandRequest 指令请求
 type CommandRequest struct {
 	ID   string `json:"id"`   // 指令ID
-	Type string `json:"type"` // 指令类型: vps_audit
+	Type string `json:"type"` // 指令类型: vps_audit, capabilities
 	Args string `json:"args,omitempty"`
 }
 
@@ -229,6 +231,68 @@ type VPSAuditResult struct {
 	CollectWarnings []string `json:"collectWarnings,omitempty"`
 }
 
+// AuditSchemaVersion 资产采集结果的结构版本，结构出现不兼容的变化时递增
+const AuditSchemaVersion = 1
+
+// 资产采集结果的输出格式
+const (
+	AuditFormatJSON     = "json"
+	AuditFormatProtobuf = LoginAssetsEncodingProtobuf
+)
+
+// AgentCapabilities 探针支持的收集器、分析器和输出格式
+// 服务端在下发请求前据此协商功能，避免请求探针不支持的内容
+type AgentCapabilities struct {
+	SchemaVersion   int                 `json:"schemaVersion"`   // 采集结果结构版本
+	Collectors      []string            `json:"collectors"`      // 资产收集器
+	LoginCollectors []string            `json:"loginCollectors"` // 登录资产的子收集器
+	LoginAnalyzers  []string            `json:"loginAnalyzers"`  // 当前启用的登录分析器
+	Formats         []string            `json:"formats"`         // 支持的输出格式
+	Databases       CapabilityDatabases `json:"databases"`       // 已加载的数据库
+}
+
+// CapabilityDatabases 探针本地已加载的补充数据库
+type CapabilityDatabases struct {
+	GeoIP     bool `json:"geoip"`     // IP 归属地
+	ASN       bool `json:"asn"`       // 自治系统
+	Anonymous bool `json:"anonymous"` // 匿名网络 (代理/Tor)
+}
+
+// DiagnosticReport 登录资产收集的诊断报告，用于排查"收集不到登录记录"等问题
+// 只探测命令和文件是否可用，不收集登录记录
+type DiagnosticReport struct {
+	GeneratedAt   int64               `json:"generatedAt"`     // 生成时间(毫秒)
+	RunningAsRoot bool                `json:"runningAsRoot"`   // 是否以 root 运行 (lastb 和 btmp 需要 root 权限)
+	Commands      []CommandDiagnostic `json:"commands"`        // 外部命令
+	Files         []FileDiagnostic    `json:"files"`           // 日志文件
+	GeoIP         *GeoIPDiagnostic    `json:"geoip,omitempty"` // 归属地数据库，未设置归属地查询时为空
+}
+
+// CommandDiagnostic 外部命令的探测结果
+type CommandDiagnostic struct {
+	Name             string `json:"name"`                       // 命令名称
+	Path             string `json:"path,omitempty"`             // PATH 中找到的路径
+	Found            bool   `json:"found"`                      // 是否在 PATH 中
+	Runnable         bool   `json:"runnable"`                   // 是否执行成功
+	PermissionDenied bool   `json:"permissionDenied,omitempty"` // 是否因权限不足失败
+	Error            string `json:"error,omitempty"`            // 查找或执行的错误
+}
+
+// FileDiagnostic 日志文件的探测结果
+type FileDiagnostic struct {
+	Path     string `json:"path"`            // 文件路径 (配置的 glob 没有匹配时为模式本身)
+	Purpose  string `json:"purpose"`         // 用途: auth_log/wtmp/btmp/utmp
+	Exists   bool   `json:"exists"`          // 是否存在
+	Readable bool   `json:"readable"`        // 是否可以读取
+	Error    string `json:"error,omitempty"` // 读取的错误
+}
+
+// GeoIPDiagnostic 归属地数据库状态
+type GeoIPDiagnostic struct {
+	Loaded bool   `json:"loaded"`          // 数据库是否已加载
+	Error  string `json:"error,omitempty"` // 未加载的原因或无法获取状态的原因
+}
+
 // VPSAuditAnalysis VPS安全分析结果(Server端分析后的结果)
 type VPSAuditAnalysis struct {
 	// 关联的审计ID
@@ -340,6 +404,8 @@ type AssetInventory struct {
 	FileAssets    *FileAssets    `json:"fileAssets,omitempty"`    // 文件资产
 	KernelAssets  *KernelAssets  `json:"kernelAssets,omitempty"`  // 内核资产
 	LoginAssets   *LoginAssets   `json:"loginAssets,omitempty"`   // 登录资产
+
+	LoginAssetsProto []byte `json:"loginAssetsProto,omitempty"` // protobuf 编码的登录资产，与服务端协商后代替 LoginAssets 传输
 }
 
 // AuditStatistics 审计统计摘要
@@ -506,19 +572,73 @@ type LoginRecord struct {
 	Username  string `json:"username"`           // 用户名
 	IP        string `json:"ip,omitempty"`       // IP地址
 	Location  string `json:"location,omitempty"` // IP归属地
+	Hostname  string `json:"hostname,omitempty"` // IP反向解析的主机名
 	Terminal  string `json:"terminal"`           // 终端
 	Timestamp int64  `json:"timestamp"`          // 时间戳(毫秒)
 	Status    string `json:"status,omitempty"`   // success/failed
+
+	LogoutTime      int64  `json:"logoutTime,omitempty"`      // 登出时间(毫秒)，crash/down 时为空
+	DurationSeconds int64  `json:"durationSeconds,omitempty"` // 会话时长(秒)
+	EndReason       string `json:"endReason,omitempty"`       // 会话结束方式: logout/crash/down/gone/still_logged_in
+
+	AuthMethod string `json:"authMethod,omitempty"` // 认证方式: password/publickey/keyboard-interactive 等 (取自 sshd 日志)
+
+	// 公钥登录使用的密钥类型 (RSA/ED25519 等) 和 SHA256 指纹 (取自 sshd 日志)，用于关联 authorized_keys 中的公钥；其他认证方式为空
+	KeyType        string `json:"keyType,omitempty"`
+	KeyFingerprint string `json:"keyFingerprint,omitempty"`
+
+	RecordID string `json:"recordId,omitempty"` // 稳定的记录标识，计算方式见 LoginRecordID
+
+	// 来源为配置的 NAT 出口，同一IP代表多个用户，按来源IP关联的分析 (高频来源、并发会话、异地登录等) 应跳过
+	BehindNAT bool `json:"behindNAT,omitempty"`
+
+	// IP 为解析并规范化后的地址 (去掉端口和 %zone 后缀)；为 false 时 IP 保持原始值 (主机名、无法识别的格式)
+	IPParseOK bool `json:"ipParseOk,omitempty"`
+
+	// Terminal 保持解析得到的原始值，以下为按别名表规范化后的终端及其类型，便于跨主机统一统计
+	NormalizedTerminal string `json:"normalizedTerminal,omitempty"` // 规范化的终端名称
+	TerminalType       string `json:"terminalType,omitempty"`       // 终端类型: network/serial-console/console/graphical/unknown
+
+	// 时间无法解析，Timestamp 为收集时的时间，按时间的统计和分析应跳过
+	TimestampEstimated bool `json:"timestampEstimated,omitempty"`
 }
 
+// SSH 认证方式
+const (
+	AuthMethodPassword            = "password"             // 密码
+	AuthMethodPublicKey           = "publickey"            // 公钥
+	AuthMethodKeyboardInteractive = "keyboard-interactive" // 键盘交互 (通常为 PAM 密码)
+)
+
+// 会话结束方式
+const (
+	SessionEndLogout        = "logout"          // 正常登出
+	SessionEndCrash         = "crash"           // 会话期间系统崩溃
+	SessionEndDown          = "down"            // 会话期间系统正常关机
+	SessionEndGone          = "gone"            // 会话进程消失但没有登出记录
+	SessionEndStillLoggedIn = "still_logged_in" // 仍在登录
+)
+
 // LoginSession 登录会话
 type LoginSession struct {
 	Username  string `json:"username"`           // 用户名
 	Terminal  string `json:"terminal"`           // 终端
 	IP        string `json:"ip"`                 // IP地址
 	Location  string `json:"location,omitempty"` // IP归属地
+	Hostname  string `json:"hostname,omitempty"` // 来源主机名 (w 显示的主机名或IP反向解析的主机名)
 	LoginTime int64  `json:"loginTime"`          // 登录时间(毫秒)
 	IdleTime  int    `json:"idleTime"`           // 空闲时间(秒)
+	IsIdle    bool   `json:"isIdle,omitempty"`   // 空闲时间超过空闲阈值 (包括长期空闲)
+	IsStale   bool   `json:"isStale,omitempty"`  // 空闲时间超过长期空闲阈值，可能是被遗忘的会话
+
+	BehindNAT bool `json:"behindNAT,omitempty"` // 来源为配置的 NAT 出口，见 LoginRecord.BehindNAT
+	IPParseOK bool `json:"ipParseOk,omitempty"` // IP 为解析后的地址，见 LoginRecord.IPParseOK
+
+	NormalizedTerminal string `json:"normalizedTerminal,omitempty"` // 规范化的终端名称，见 LoginRecord.NormalizedTerminal
+	TerminalType       string `json:"terminalType,omitempty"`       // 终端类型
+
+	CurrentProcess string `json:"currentProcess,omitempty"` // 会话中正在运行的命令 (w 的 WHAT 列)
+	PID            int    `json:"pid,omitempty"`            // 会话的首进程 PID (loginctl 的 Leader，如 sshd 的会话进程)，未知时为 0
 }
 
 // SSHKeyInfo SSH密钥信息
@@ -652,15 +772,326 @@ type LoginAssets struct {
 	SuccessfulLogins []LoginRecord    `json:"successfulLogins,omitempty"` // 成功登录记录
 	FailedLogins     []LoginRecord    `json:"failedLogins,omitempty"`     // 失败登录记录
 	CurrentSessions  []LoginSession   `json:"currentSessions,omitempty"`  // 当前登录会话
+	AccountLockouts  []AccountLockout `json:"accountLockouts,omitempty"`  // PAM 账户锁定事件
+	SSHDPolicy       *SSHDPolicy      `json:"sshdPolicy,omitempty"`       // sshd 生效的登录策略
+	HostLocation     *HostLocation    `json:"hostLocation,omitempty"`     // 主机自身的位置 (登录的目的地)
 	Statistics       *LoginStatistics `json:"statistics,omitempty"`       // 统计信息
+
+	LogTampering []LogTamperingSuspicion `json:"logTampering,omitempty"` // 登录日志可能被篡改的迹象
+
+	HostContext *HostContext `json:"hostContext,omitempty"` // 采集时的主机环境 (可选)
+
+	EndedSessions []LoginSession `json:"endedSessions,omitempty"` // 增量结果中上次存在、本次已结束的会话
+
+	LastLogins []LastLoginEntry `json:"lastLogins,omitempty"` // 每个用户最近一次登录 (lastlog)，用于发现长期不用的账户
+
+	Trimmed *PayloadTrimming `json:"trimmed,omitempty"` // 超出大小上限时裁剪掉的内容，未裁剪时为空
+
+	UserSummaries []UserLoginSummary `json:"userSummaries,omitempty"` // 按用户汇总的登录情况，按用户名排列
+}
+
+// UserLoginSummary 单个用户的登录汇总，与统计信息一样在裁剪前根据全部记录计算
+type UserLoginSummary struct {
+	Username         string   `json:"username"`                   // 用户名
+	SuccessfulLogins int      `json:"successfulLogins"`           // 成功登录次数
+	FailedLogins     int      `json:"failedLogins"`               // 失败登录次数
+	SourceIPs        []string `json:"sourceIps,omitempty"`        // 成功登录的不同来源，按字典序排列
+	FirstLogin       int64    `json:"firstLogin,omitempty"`       // 最早成功登录时间(毫秒)
+	LastLogin        int64    `json:"lastLogin,omitempty"`        // 最近成功登录时间(毫秒)
+	HasActiveSession bool     `json:"hasActiveSession,omitempty"` // 当前有未失效的会话 (空闲的会话同样计入)
+}
+
+// LastLoginEntry 用户最近一次登录 (lastlog)
+type LastLoginEntry struct {
+	Username      string `json:"username"`                // 用户名
+	Port          string `json:"port,omitempty"`          // 登录终端
+	From          string `json:"from,omitempty"`          // 来源主机或IP，本地登录时为空
+	Latest        int64  `json:"latest,omitempty"`        // 最近登录时间(毫秒)，从未登录时为 0
+	NeverLoggedIn bool   `json:"neverLoggedIn,omitempty"` // 从未登录
+}
+
+// PayloadTrimming 登录资产超出大小上限时的裁剪情况
+// 统计信息在裁剪前计算，计数和告警反映全部记录
+type PayloadTrimming struct {
+	MaxBytes                int  `json:"maxBytes"`                // 大小上限(字节)
+	OriginalBytes           int  `json:"originalBytes"`           // 裁剪前的大小(字节)
+	TrimmedBytes            int  `json:"trimmedBytes"`            // 裁剪后的大小(字节)
+	DroppedSuccessfulLogins int  `json:"droppedSuccessfulLogins"` // 丢弃的成功登录记录数 (最早的)
+	DroppedFailedLogins     int  `json:"droppedFailedLogins"`     // 丢弃的失败登录记录数 (最早的)
+	DroppedSessions         int  `json:"droppedSessions"`         // 丢弃的当前会话数 (登录最早的)
+	Exceeded                bool `json:"exceeded,omitempty"`      // 丢弃全部原始记录后仍超出上限
+}
+
+// HostContext 采集时的主机环境，使登录数据不依赖单独的资产清单也能定位来源主机
+// 各字段可单独关闭，关闭或获取失败时为空
+type HostContext struct {
+	Hostname     string `json:"hostname,omitempty"`     // 主机名
+	Distro       string `json:"distro,omitempty"`       // 发行版 (/etc/os-release)
+	Kernel       string `json:"kernel,omitempty"`       // 内核版本 (uname -r)
+	AgentVersion string `json:"agentVersion,omitempty"` // 探针版本
+	InstanceID   string `json:"instanceId,omitempty"`   // 云实例ID (cloud-init)
+}
+
+// LogTamperingSuspicion 登录日志可能被篡改的迹象
+// 判断是启发式的，每条都附带置信度和触发判断的具体观察
+type LogTamperingSuspicion struct {
+	Log         string `json:"log"`         // 日志文件
+	Kind        string `json:"kind"`        // 迹象类型
+	Confidence  string `json:"confidence"`  // 置信度: low/medium/high
+	Observation string `json:"observation"` // 触发判断的具体观察
+}
+
+// 日志篡改迹象类型
+const (
+	LogTamperMissing             = "missing"               // 日志文件不存在
+	LogTamperEmpty               = "empty"                 // 主机运行期间日志为空
+	LogTamperMisaligned          = "misaligned"            // 文件大小不是记录长度的整数倍
+	LogTamperMissingBootRecord   = "missing_boot_record"   // 未轮转但缺少本次启动以来的早期记录
+	LogTamperSessionWithoutLogin = "session_without_login" // 存在当前会话但没有对应的登录记录
+	LogTamperReplaced            = "replaced"              // 文件被替换且不是轮转
+	LogTamperTruncated           = "truncated"             // 文件变小且不是轮转
+)
+
+// 篡改判断的置信度
+const (
+	ConfidenceLow    = "low"
+	ConfidenceMedium = "medium"
+	ConfidenceHigh   = "high"
+)
+
+// HostLocation 主机位置
+type HostLocation struct {
+	IP       string `json:"ip,omitempty"`       // 主机公网IP
+	Location string `json:"location,omitempty"` // 主机归属地 (静态配置或服务端根据IP补充)
+}
+
+// AccountLockout PAM 账户锁定 (pam_faillock/pam_tally2)
+type AccountLockout struct {
+	Username   string `json:"username"`             // 用户名
+	Module     string `json:"module"`               // PAM 模块
+	Source     string `json:"source"`               // 来源: auth_log / faillock
+	Attempts   int    `json:"attempts,omitempty"`   // 失败次数
+	Locked     bool   `json:"locked"`               // 是否处于锁定状态
+	LockedAt   int64  `json:"lockedAt,omitempty"`   // 锁定时间(毫秒)
+	UnlockedAt int64  `json:"unlockedAt,omitempty"` // (预计)自动解锁时间(毫秒)，0 表示需要管理员手动解锁
+}
+
+// SSHDPolicy sshd 登录相关的生效配置
+type SSHDPolicy struct {
+	Source                 string   `json:"source"`                 // 来源: sshd -T / sshd_config
+	PermitRootLogin        string   `json:"permitRootLogin"`        // 是否允许root登录 (yes/no/prohibit-password/forced-commands-only)
+	PasswordAuthentication bool     `json:"passwordAuthentication"` // 是否允许密码认证
+	PubkeyAuthentication   bool     `json:"pubkeyAuthentication"`   // 是否允许公钥认证
+	KbdInteractiveAuth     bool     `json:"kbdInteractiveAuth"`     // 是否允许键盘交互认证
+	PermitEmptyPasswords   bool     `json:"permitEmptyPasswords"`   // 是否允许空密码
+	MaxAuthTries           int      `json:"maxAuthTries"`           // 最大认证尝试次数
+	AllowUsers             []string `json:"allowUsers,omitempty"`   // 允许登录的用户
+	AllowGroups            []string `json:"allowGroups,omitempty"`  // 允许登录的用户组
+	DenyUsers              []string `json:"denyUsers,omitempty"`    // 禁止登录的用户
+	DenyGroups             []string `json:"denyGroups,omitempty"`   // 禁止登录的用户组
+	ConfigFiles            []string `json:"configFiles,omitempty"`  // 解析过的配置文件 (仅 sshd_config 来源)
 }
 
 // LoginStatistics 登录统计
 type LoginStatistics struct {
-	TotalLogins      int            `json:"totalLogins"`                // 总登录次数
-	FailedLogins     int            `json:"failedLogins"`               // 失败登录次数
-	CurrentSessions  int            `json:"currentSessions"`            // 当前会话数
-	UniqueIPs        map[string]int `json:"uniqueIPs,omitempty"`        // 唯一IP统计
-	UniqueUsers      map[string]int `json:"uniqueUsers,omitempty"`      // 唯一用户统计
-	HighFrequencyIPs map[string]int `json:"highFrequencyIPs,omitempty"` // 高频IP (登录次数>10)
+	TotalLogins      int               `json:"totalLogins"`                // 总登录次数
+	FailedLogins     int               `json:"failedLogins"`               // 失败登录次数
+	CurrentSessions  int               `json:"currentSessions"`            // 当前会话数
+	UniqueIPs        map[string]int    `json:"uniqueIPs,omitempty"`        // 唯一IP统计
+	UniqueUsers      map[string]int    `json:"uniqueUsers,omitempty"`      // 唯一用户统计
+	HighFrequencyIPs []HighFrequencyIP `json:"highFrequencyIPs,omitempty"` // 高频IP (每小时登录次数达到阈值)
+
+	AutomationSuspicions []AutomationSuspicion `json:"automationSuspicions,omitempty"` // 疑似自动化工具的终端突发分配
+	SharedAccountAlerts  []SharedAccountAlert  `json:"sharedAccountAlerts,omitempty"`  // 共享账户来源广度超出阈值
+	ScriptedAttacks      []ScriptedAttack      `json:"scriptedAttacks,omitempty"`      // 尝试间隔过于规律的暴力破解
+
+	CrashTerminatedSessions int `json:"crashTerminatedSessions,omitempty"` // 因系统崩溃结束的会话数
+
+	UnexpectedAuthMethods []UnexpectedAuthMethod `json:"unexpectedAuthMethods,omitempty"` // 仅允许公钥的主机上出现的密码认证成功
+
+	// 当前会话按空闲时间分类，三者互不重叠
+	ActiveSessions    int `json:"activeSessions"`              // 活跃会话数
+	IdleSessions      int `json:"idleSessions"`                // 空闲会话数 (不含长期空闲)
+	StaleSessions     int `json:"staleSessions"`               // 长期空闲会话数
+	StaleRootSessions int `json:"staleRootSessions,omitempty"` // 其中 root 的长期空闲会话数
+
+	TimingPatterns []TimingPattern `json:"timingPatterns,omitempty"` // 明显集中在周末、节假日或夜间的登录
+
+	BastionBypasses []BastionBypass `json:"bastionBypasses,omitempty"` // 未经堡垒机的 SSH 登录
+
+	LongLivedSessions []LongLivedSession `json:"longLivedSessions,omitempty"` // 持续时间超过账户类别上限的当前会话
+
+	ConcurrentAccess []ConcurrentSessionAlert `json:"concurrentAccess,omitempty"` // 同一用户同时从多个来源IP登录
+
+	PostLoginFileAccesses []PostLoginFileAccess `json:"postLoginFileAccesses,omitempty"` // 登录后不久发生的敏感文件访问
+
+	BruteForceAttempts []BruteForceAlert `json:"bruteForceAttempts,omitempty"` // 短时间内大量失败登录的来源
+
+	// 成功登录按归属地国家统计，内网IP和归属地未知的分别计入 CountryPrivate 和 CountryUnknown
+	// 记录都没有归属地时为空
+	LoginsByCountry map[string]int `json:"loginsByCountry,omitempty"`
+	ForeignLogins   []LoginRecord  `json:"foreignLogins,omitempty"` // 来自预期国家以外的成功登录 (不含内网IP和归属地未知的登录)
+
+	// 成功登录按一天中的小时 (分析时区) 统计，不含时间无法解析的记录
+	LoginsByHour   [24]int       `json:"loginsByHour"`
+	OffHoursLogins []LoginRecord `json:"offHoursLogins,omitempty"` // 工作时间以外的成功登录
+
+	NewSourceLogins []LoginRecord `json:"newSourceLogins,omitempty"` // 用户从未使用过的来源IP的成功登录 (需要提供历史来源)
+
+	RootLogins []LoginRecord `json:"rootLogins,omitempty"` // 以 root 直接登录的成功记录
+	// 认证日志中提权到 root 的 sudo 和 su (含被拒绝的 sudo)，Username 为发起提权的用户，
+	// AuthMethod 为提权方式 (sudo/su)，Terminal 为 sudo 所在的终端 (su 为 "su")
+	PrivilegeEscalations []LoginRecord `json:"privilegeEscalations,omitempty"`
+}
+
+// 按国家统计登录时，内网IP和归属地未知的登录使用的国家
+const (
+	CountryPrivate = "private" // 内网IP
+	CountryUnknown = "unknown" // 归属地未知
+)
+
+// BruteForceAlert 同一来源在滑动时间窗口内的失败登录次数达到阈值 (暴力破解)
+type BruteForceAlert struct {
+	IP          string   `json:"ip"`                  // 来源IP
+	Count       int      `json:"count"`               // 窗口内的失败次数
+	WindowStart int64    `json:"windowStart"`         // 窗口内第一次失败的时间(毫秒)
+	WindowEnd   int64    `json:"windowEnd"`           // 窗口内最后一次失败的时间(毫秒)
+	Usernames   []string `json:"usernames,omitempty"` // 尝试的用户名
+}
+
+// PostLoginFileAccess 登录之后不久发生的敏感文件访问，访问事件由宿主程序 (如 auditd 监控) 提供
+type PostLoginFileAccess struct {
+	Username     string `json:"username"`            // 用户名
+	IP           string `json:"ip"`                  // 登录来源IP
+	Hostname     string `json:"hostname,omitempty"`  // 登录来源主机名
+	Terminal     string `json:"terminal"`            // 登录终端
+	LoginTime    int64  `json:"loginTime"`           // 登录时间(毫秒)
+	RecordID     string `json:"recordId,omitempty"`  // 对应的登录记录
+	Path         string `json:"path"`                // 访问的文件
+	Operation    string `json:"operation,omitempty"` // 访问方式 (read/write/exec 等)
+	Process      string `json:"process,omitempty"`   // 访问的进程
+	AccessTime   int64  `json:"accessTime"`          // 访问时间(毫秒)
+	DelaySeconds int64  `json:"delaySeconds"`        // 登录到访问的间隔(秒)
+}
+
+// 账户类别，不同类别的会话时长上限不同
+const (
+	AccountClassRoot    = "root"    // root
+	AccountClassService = "service" // 服务账户 (配置的账户名单)
+	AccountClassHuman   = "human"   // 其他账户
+)
+
+// LongLivedSession 持续时间超过上限的当前会话
+// 与空闲/长期空闲标记互补：关注会话的绝对时长而不是是否活动
+type LongLivedSession struct {
+	Username      string `json:"username"`           // 用户名
+	AccountClass  string `json:"accountClass"`       // 账户类别: root/service/human
+	Terminal      string `json:"terminal"`           // 终端
+	IP            string `json:"ip"`                 // 来源IP
+	Hostname      string `json:"hostname,omitempty"` // 来源主机名
+	LoginTime     int64  `json:"loginTime"`          // 登录时间(毫秒)
+	AgeSeconds    int64  `json:"ageSeconds"`         // 会话已持续的时间(秒)
+	MaxAgeSeconds int64  `json:"maxAgeSeconds"`      // 该账户类别的时长上限(秒)
+	IsIdle        bool   `json:"isIdle,omitempty"`   // 会话当前是否空闲
+}
+
+// ConcurrentSessionAlert 同一用户同时从多个来源IP登录 (不含本机和回环地址)
+type ConcurrentSessionAlert struct {
+	Username string                    `json:"username"` // 用户名
+	IPs      []string                  `json:"ips"`      // 同时在线的来源IP
+	Sources  []ConcurrentSessionSource `json:"sources"`  // 时间重叠的会话，按登录时间排列
+}
+
+// ConcurrentSessionSource 参与并发登录的会话
+type ConcurrentSessionSource struct {
+	IP        string `json:"ip"`                 // 来源IP
+	Location  string `json:"location,omitempty"` // IP归属地
+	Terminal  string `json:"terminal"`           // 终端
+	LoginTime int64  `json:"loginTime"`          // 登录时间(毫秒)
+	Active    bool   `json:"active,omitempty"`   // 是否为当前会话 (否则来自历史登录记录)
+}
+
+// BastionBypass 来源不是堡垒机的 SSH 登录成功 (只允许经堡垒机访问的内部主机)
+type BastionBypass struct {
+	Username   string `json:"username"`             // 用户名
+	IP         string `json:"ip"`                   // 来源IP
+	Hostname   string `json:"hostname,omitempty"`   // 来源主机名
+	Terminal   string `json:"terminal"`             // 终端
+	Timestamp  int64  `json:"timestamp"`            // 登录时间(毫秒)
+	AuthMethod string `json:"authMethod,omitempty"` // 认证方式
+}
+
+// 登录时段类型
+const (
+	TimingWeekend   = "weekend"   // 周末
+	TimingHoliday   = "holiday"   // 节假日
+	TimingOvernight = "overnight" // 夜间
+)
+
+// TimingPattern 登录 (成功或失败) 明显集中在无人值守的时段
+// 预期占比为记录覆盖的时间范围内该时段所占的时长比例，偏斜度为实际占比与预期占比之比
+type TimingPattern struct {
+	Status        string  `json:"status"`        // 登录结果: success/failed
+	Category      string  `json:"category"`      // 时段类型: weekend/holiday/overnight
+	Events        int     `json:"events"`        // 落在该时段的次数
+	TotalEvents   int     `json:"totalEvents"`   // 总次数
+	Share         float64 `json:"share"`         // 实际占比
+	ExpectedShare float64 `json:"expectedShare"` // 预期占比
+	Skew          float64 `json:"skew"`          // 偏斜度
+	ByWeekday     []int   `json:"byWeekday"`     // 按星期分布 (0 为周日)
+	ByHour        []int   `json:"byHour"`        // 按小时分布 (本地时间)
+	FirstSeen     int64   `json:"firstSeen"`     // 最早记录时间(毫秒)
+	LastSeen      int64   `json:"lastSeen"`      // 最晚记录时间(毫秒)
+}
+
+// UnexpectedAuthMethod 仅允许公钥登录的主机上出现的密码认证成功
+type UnexpectedAuthMethod struct {
+	Username            string `json:"username"`               // 用户名
+	IP                  string `json:"ip,omitempty"`           // 来源IP
+	Timestamp           int64  `json:"timestamp"`              // 登录时间(毫秒)
+	AuthMethod          string `json:"authMethod"`             // 实际的认证方式
+	PolicySource        string `json:"policySource,omitempty"` // sshd 策略来源，为空表示未能读取策略
+	PasswordAuthEnabled bool   `json:"passwordAuthEnabled"`    // sshd 策略是否实际允许密码认证
+}
+
+// ScriptedAttack 失败尝试间隔过于规律 (脚本化暴力破解)
+type ScriptedAttack struct {
+	IP                     string  `json:"ip"`                     // 来源IP
+	Attempts               int     `json:"attempts"`               // 失败尝试次数
+	MeanIntervalMs         float64 `json:"meanIntervalMs"`         // 平均间隔(毫秒)
+	StdDevIntervalMs       float64 `json:"stdDevIntervalMs"`       // 间隔标准差(毫秒)
+	CoefficientOfVariation float64 `json:"coefficientOfVariation"` // 变异系数 (标准差/平均值)
+	FirstSeen              int64   `json:"firstSeen"`              // 首次尝试时间(毫秒)
+	LastSeen               int64   `json:"lastSeen"`               // 最后尝试时间(毫秒)
+}
+
+// SharedAccountAlert 共享账户在窗口内的来源广度超出阈值
+type SharedAccountAlert struct {
+	Username     string   `json:"username"`            // 共享账户
+	Networks     []string `json:"networks,omitempty"`  // 来源网段
+	Countries    []string `json:"countries,omitempty"` // 来源国家
+	MaxNetworks  int      `json:"maxNetworks"`         // 网段数阈值
+	MaxCountries int      `json:"maxCountries"`        // 国家数阈值
+	WindowStart  int64    `json:"windowStart"`         // 窗口开始时间(毫秒)
+	WindowEnd    int64    `json:"windowEnd"`           // 窗口结束时间(毫秒)
+}
+
+// HighFrequencyIP 成功登录频率过高的来源
+// 字段顺序与旧版本 map<string, int64> 条目的编号 (key = 1, value = 2) 一致，新旧版本的 protobuf 编码可以互相解码
+type HighFrequencyIP struct {
+	IP          string  `json:"ip"`          // 来源IP
+	Count       int     `json:"count"`       // 成功登录次数
+	RatePerHour float64 `json:"ratePerHour"` // 每小时登录次数 (跨度不足1小时按1小时计)
+	FirstLogin  int64   `json:"firstLogin"`  // 最早登录时间(毫秒)
+	LastLogin   int64   `json:"lastLogin"`   // 最晚登录时间(毫秒)
+}
+
+// AutomationSuspicion 同一来源短时间内分配大量终端 (疑似自动化工具)
+type AutomationSuspicion struct {
+	IP            string   `json:"ip"`                  // 来源IP
+	TerminalCount int      `json:"terminalCount"`       // 窗口内分配的终端数
+	Terminals     []string `json:"terminals,omitempty"` // 分配的终端
+	Usernames     []string `json:"usernames,omitempty"` // 涉及的用户
+	WindowStart   int64    `json:"windowStart"`         // 窗口开始时间(毫秒)
+	WindowEnd     int64    `json:"windowEnd"`           // 窗口结束时间(毫秒)
 }
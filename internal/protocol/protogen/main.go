@@ -0,0 +1,28 @@
+// protogen 根据 internal/protocol 中的 Go 结构体重新生成 login_assets.proto
+// 已分配的字段编号保持不变，保证新旧版本的探针和服务端可以互相解码
+package main
+
+import (
+	"log"
+	"os"
+
+	"github.com/dushixiang/pika/internal/protocol"
+)
+
+const protoPath = "login_assets.proto"
+
+func main() {
+	current, err := os.ReadFile(protoPath)
+	if err != nil && !os.IsNotExist(err) {
+		log.Fatalf("读取 %s 失败: %v", protoPath, err)
+	}
+
+	generated, err := protocol.GenerateLoginAssetsProto(string(current))
+	if err != nil {
+		log.Fatalf("生成 %s 失败: %v", protoPath, err)
+	}
+
+	if err := os.WriteFile(protoPath, []byte(generated), 0644); err != nil {
+		log.Fatalf("写入 %s 失败: %v", protoPath, err)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"sort"
 	"time"
 
+	"github.com/dushixiang/pika/internal/config"
 	"github.com/dushixiang/pika/internal/models"
 	"github.com/dushixiang/pika/internal/protocol"
 	"github.com/dushixiang/pika/internal/repo"
@@ -24,10 +25,13 @@ type AgentService struct {
 	apiKeyService    *ApiKeyService
 	metricService    *MetricService
 	geoipService     *GeoIPService
+	loginEnrichment  *LoginEnrichment
+	enrichmentCache  *EnrichmentCache
+	stateStore       StateStore
 }
 
-func NewAgentService(logger *zap.Logger, db *gorm.DB, apiKeyService *ApiKeyService, metricService *MetricService, geoipService *GeoIPService) *AgentService {
-	return &AgentService{
+func NewAgentService(logger *zap.Logger, db *gorm.DB, apiKeyService *ApiKeyService, metricService *MetricService, geoipService *GeoIPService, propertyService *PropertyService, appCfg *config.AppConfig) *AgentService {
+	s := &AgentService{
 		logger:           logger,
 		Service:          orz.NewService(db),
 		AgentRepo:        repo.NewAgentRepo(db),
@@ -35,7 +39,10 @@ func NewAgentService(logger *zap.Logger, db *gorm.DB, apiKeyService *ApiKeyServi
 		apiKeyService:    apiKeyService,
 		metricService:    metricService,
 		geoipService:     geoipService,
+		stateStore:       NewPropertyStateStore(propertyService),
 	}
+	s.loginEnrichment = s.newLoginEnrichment(appCfg.Enrichment)
+	return s
 }
 
 // RegisterAgent 注册探针
@@ -174,6 +181,12 @@ func (s *AgentService) handleVPSAuditResponse(ctx context.Context, agentID strin
 			return err
 		}
 
+		// 探针协商使用 protobuf 时登录资产单独编码
+		if err := auditResult.AssetInventory.DecodeLoginAssets(); err != nil {
+			s.logger.Error("failed to decode login assets", zap.Error(err))
+			return err
+		}
+
 		// 存储审计结果
 		return s.SaveAuditResult(ctx, agentID, &auditResult)
 	}
@@ -184,7 +197,15 @@ func (s *AgentService) handleVPSAuditResponse(ctx context.Context, agentID strin
 // SaveAuditResult 保存审计结果
 func (s *AgentService) SaveAuditResult(ctx context.Context, agentID string, result *protocol.VPSAuditResult) error {
 	// 为登录记录添加 IP 归属地信息
-	s.enrichLoginRecordsWithLocation(result)
+	if s.geoipService != nil {
+		if _, err := s.geoipService.ReloadIfChanged(); err != nil {
+			s.logger.Warn("failed to reload GeoIP database", zap.Error(err))
+		}
+	}
+	s.loginEnrichment.EnrichAuditResult(ctx, result)
+	if err := s.enrichmentCache.Persist(ctx, s.stateStore); err != nil {
+		s.logger.Warn("failed to persist enrichment cache", zap.Error(err))
+	}
 
 	// 将结果序列化为JSON存储
 	resultJSON, err := json.Marshal(result)
@@ -214,47 +235,61 @@ func (s *AgentService) SaveAuditResult(ctx context.Context, agentID string, resu
 	return nil
 }
 
-// enrichLoginRecordsWithLocation 为登录记录添加IP归属地信息
-func (s *AgentService) enrichLoginRecordsWithLocation(result *protocol.VPSAuditResult) {
-	if s.geoipService == nil {
-		return
+// newLoginEnrichment 根据配置创建登录记录补充器
+// 并发查询的结果先经过 GeoIP 缓存，在线查询仍受其自身的并发上限约束
+func (s *AgentService) newLoginEnrichment(cfg *config.EnrichmentConfig) *LoginEnrichment {
+	options := EnrichOptions{
+		Workers:       defaultEnrichWorkers,
+		LookupTimeout: defaultEnrichLookupTimeout,
+	}
+	if cfg != nil && cfg.Workers > 0 {
+		options.Workers = cfg.Workers
+	}
+	if cfg != nil && cfg.LookupTimeoutMs > 0 {
+		options.LookupTimeout = time.Duration(cfg.LookupTimeoutMs) * time.Millisecond
 	}
 
-	// 处理成功登录记录
-	if result.AssetInventory.LoginAssets != nil {
-		for i := range result.AssetInventory.LoginAssets.SuccessfulLogins {
-			if result.AssetInventory.LoginAssets.SuccessfulLogins[i].IP != "" {
-				location := s.geoipService.LookupIP(result.AssetInventory.LoginAssets.SuccessfulLogins[i].IP)
-				result.AssetInventory.LoginAssets.SuccessfulLogins[i].Location = location
-			}
-		}
-
-		// 处理失败登录记录
-		for i := range result.AssetInventory.LoginAssets.FailedLogins {
-			if result.AssetInventory.LoginAssets.FailedLogins[i].IP != "" {
-				location := s.geoipService.LookupIP(result.AssetInventory.LoginAssets.FailedLogins[i].IP)
-				result.AssetInventory.LoginAssets.FailedLogins[i].Location = location
-			}
-		}
-
-		// 处理当前登录会话
-		for i := range result.AssetInventory.LoginAssets.CurrentSessions {
-			if result.AssetInventory.LoginAssets.CurrentSessions[i].IP != "" {
-				location := s.geoipService.LookupIP(result.AssetInventory.LoginAssets.CurrentSessions[i].IP)
-				result.AssetInventory.LoginAssets.CurrentSessions[i].Location = location
-			}
-		}
+	// 跨周期缓存，重启后从状态存储恢复
+	capacity := defaultEnrichmentCacheSize
+	ttls := map[string]time.Duration{
+		EnrichKindLocation: defaultLocationCacheTTL,
+		EnrichKindHostname: defaultHostnameCacheTTL,
+	}
+	if cfg != nil && cfg.CacheSize > 0 {
+		capacity = cfg.CacheSize
+	}
+	if cfg != nil && cfg.LocationCacheHours > 0 {
+		ttls[EnrichKindLocation] = time.Duration(cfg.LocationCacheHours) * time.Hour
+	}
+	if cfg != nil && cfg.HostnameCacheHours > 0 {
+		ttls[EnrichKindHostname] = time.Duration(cfg.HostnameCacheHours) * time.Hour
+	}
+	s.enrichmentCache = NewEnrichmentCache(capacity, ttls)
+	if s.geoipService != nil {
+		// 缓存的是按隐私级别输出后的归属地，隐私级别变更后不再使用之前的结果
+		s.enrichmentCache.SetVariant(EnrichKindLocation, s.geoipService.privacyLevel())
+	}
+	if err := s.enrichmentCache.Restore(context.Background(), s.stateStore); err != nil {
+		s.logger.Warn("failed to restore enrichment cache", zap.Error(err))
 	}
 
-	// 处理用户资产中的当前登录
-	if result.AssetInventory.UserAssets != nil && result.AssetInventory.UserAssets.CurrentLogins != nil {
-		for i := range result.AssetInventory.UserAssets.CurrentLogins {
-			if result.AssetInventory.UserAssets.CurrentLogins[i].IP != "" {
-				location := s.geoipService.LookupIP(result.AssetInventory.UserAssets.CurrentLogins[i].IP)
-				result.AssetInventory.UserAssets.CurrentLogins[i].Location = location
-			}
-		}
+	var enrichers []LoginEnricher
+	if s.geoipService != nil {
+		enrichers = append(enrichers, s.enrichmentCache.Wrap(NewGeoLocationEnricher(s.geoipService)))
+		// 数据库更新后归属地需要重新查询
+		s.geoipService.OnReload(func() {
+			s.enrichmentCache.Flush(EnrichKindLocation)
+		})
 	}
+	if cfg != nil && cfg.ReverseDNS {
+		enrichers = append(enrichers, s.enrichmentCache.Wrap(NewReverseDNSEnricher()))
+	}
+	return NewLoginEnrichment(options, enrichers...)
+}
+
+// EnrichmentCacheStats 登录记录补充缓存的统计，用于调整缓存时间
+func (s *AgentService) EnrichmentCacheStats() map[string]EnrichmentCacheStats {
+	return s.enrichmentCache.Stats()
 }
 
 // GetAuditResult 获取最新的审计结果(原始数据)
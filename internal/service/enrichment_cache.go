@@ -0,0 +1,328 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 补充结果类型
+const (
+	EnrichKindLocation = "location" // IP归属地
+	EnrichKindHostname = "hostname" // 反向解析的主机名
+)
+
+const (
+	// 默认缓存条目数上限
+	defaultEnrichmentCacheSize = 10000
+
+	// 默认缓存时间
+	defaultLocationCacheTTL = 7 * 24 * time.Hour
+	defaultHostnameCacheTTL = 24 * time.Hour
+
+	// 缓存在状态存储中的键
+	enrichmentCacheStateKey = "login_enrichment_cache"
+)
+
+// StateStore 持久化的运行状态存储，重启后可以恢复
+type StateStore interface {
+	// Load 读取状态，不存在时保持 target 不变并返回 nil
+	Load(ctx context.Context, key string, target any) error
+	// Save 保存状态
+	Save(ctx context.Context, key string, value any) error
+}
+
+// propertyStateStore 使用属性表保存运行状态
+type propertyStateStore struct {
+	property *PropertyService
+}
+
+func NewPropertyStateStore(property *PropertyService) StateStore {
+	return &propertyStateStore{property: property}
+}
+
+func (s *propertyStateStore) Load(ctx context.Context, key string, target any) error {
+	err := s.property.GetValue(ctx, key, target)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	return err
+}
+
+func (s *propertyStateStore) Save(ctx context.Context, key string, value any) error {
+	return s.property.Set(ctx, key, "运行状态", value)
+}
+
+// EnrichmentCache 跨收集周期的补充结果缓存，按类型和 IP 缓存，各类型有独立的过期时间
+// 重复出现的攻击来源和常用登录来源不必每次都重新查询
+type EnrichmentCache struct {
+	mu       sync.Mutex
+	ttls     map[string]time.Duration
+	capacity int
+	entries  map[string]enrichmentCacheEntry
+	stats    map[string]*EnrichmentCacheStats
+	dirty    bool
+
+	// 类型 -> 缓存结果依赖的配置 (如归属地的隐私级别)，条目记录写入时的配置，配置不同的条目不再使用
+	variants map[string]string
+
+	// 当前时间，可替换以便测试
+	now func() time.Time
+}
+
+// enrichmentCacheEntry 缓存条目，持久化时使用简短的字段名
+type enrichmentCacheEntry struct {
+	Value     string `json:"v"`
+	ExpiresAt int64  `json:"e"`           // 过期时间(毫秒)
+	Variant   string `json:"r,omitempty"` // 写入时的配置 (见 SetVariant)
+}
+
+// EnrichmentCacheStats 单个类型的缓存统计，用于调整过期时间
+type EnrichmentCacheStats struct {
+	Entries   int   `json:"entries"`   // 当前条目数
+	Hits      int64 `json:"hits"`      // 命中次数
+	Misses    int64 `json:"misses"`    // 未命中次数 (含已过期)
+	Expired   int64 `json:"expired"`   // 因过期未命中的次数
+	Evictions int64 `json:"evictions"` // 因容量不足淘汰的条目数
+}
+
+// NewEnrichmentCache 创建缓存，ttls 中没有的类型不缓存
+func NewEnrichmentCache(capacity int, ttls map[string]time.Duration) *EnrichmentCache {
+	if capacity <= 0 {
+		capacity = defaultEnrichmentCacheSize
+	}
+	return &EnrichmentCache{
+		ttls:     ttls,
+		capacity: capacity,
+		entries:  make(map[string]enrichmentCacheEntry),
+		stats:    make(map[string]*EnrichmentCacheStats),
+		variants: make(map[string]string),
+		now:      time.Now,
+	}
+}
+
+func enrichmentCacheKey(kind, ip string) string {
+	return kind + "|" + ip
+}
+
+func (c *EnrichmentCache) statsOf(kind string) *EnrichmentCacheStats {
+	stats, ok := c.stats[kind]
+	if !ok {
+		stats = &EnrichmentCacheStats{}
+		c.stats[kind] = stats
+	}
+	return stats
+}
+
+// Get 获取未过期的缓存结果
+func (c *EnrichmentCache) Get(kind, ip string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := c.statsOf(kind)
+	key := enrichmentCacheKey(kind, ip)
+	entry, ok := c.entries[key]
+	if !ok {
+		stats.Misses++
+		return "", false
+	}
+	if c.now().UnixMilli() >= entry.ExpiresAt {
+		delete(c.entries, key)
+		c.dirty = true
+		stats.Misses++
+		stats.Expired++
+		return "", false
+	}
+	stats.Hits++
+	return entry.Value, true
+}
+
+// Add 写入缓存，超出容量时先清理过期条目，再淘汰最早过期的条目
+func (c *EnrichmentCache) Add(kind, ip, value string) {
+	ttl, ok := c.ttls[kind]
+	if !ok || ttl <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	c.entries[enrichmentCacheKey(kind, ip)] = enrichmentCacheEntry{Value: value, ExpiresAt: now.Add(ttl).UnixMilli(), Variant: c.variants[kind]}
+	c.dirty = true
+
+	if len(c.entries) <= c.capacity {
+		return
+	}
+	c.removeExpired(now)
+	for len(c.entries) > c.capacity {
+		oldestKey := ""
+		var oldest int64
+		for key, entry := range c.entries {
+			if oldestKey == "" || entry.ExpiresAt < oldest {
+				oldestKey, oldest = key, entry.ExpiresAt
+			}
+		}
+		delete(c.entries, oldestKey)
+		kind, _, _ := strings.Cut(oldestKey, "|")
+		c.statsOf(kind).Evictions++
+	}
+}
+
+func (c *EnrichmentCache) removeExpired(now time.Time) {
+	ms := now.UnixMilli()
+	for key, entry := range c.entries {
+		if ms >= entry.ExpiresAt {
+			delete(c.entries, key)
+		}
+	}
+}
+
+// Flush 清空某个类型的全部缓存 (如 GeoIP 数据库更新后)
+func (c *EnrichmentCache) Flush(kind string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	prefix := kind + "|"
+	for key := range c.entries {
+		if strings.HasPrefix(key, prefix) {
+			delete(c.entries, key)
+			c.dirty = true
+		}
+	}
+}
+
+// SetVariant 设置某个类型的缓存结果依赖的配置 (如归属地的隐私级别)，应在 Restore 之前设置
+// 配置与条目写入时不同的条目被清除，恢复时也不再载入，配置变更后不会继续输出按旧配置得到的结果
+func (c *EnrichmentCache) SetVariant(kind, variant string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.variants[kind] = variant
+	prefix := kind + "|"
+	for key, entry := range c.entries {
+		if strings.HasPrefix(key, prefix) && entry.Variant != variant {
+			delete(c.entries, key)
+			c.dirty = true
+		}
+	}
+}
+
+// Stats 各类型的缓存统计
+func (c *EnrichmentCache) Stats() map[string]EnrichmentCacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	result := make(map[string]EnrichmentCacheStats)
+	for kind := range c.ttls {
+		result[kind] = *c.statsOf(kind)
+	}
+	for key := range c.entries {
+		kind, _, _ := strings.Cut(key, "|")
+		stats := result[kind]
+		stats.Entries++
+		result[kind] = stats
+	}
+	return result
+}
+
+// Restore 从状态存储恢复缓存，忽略已过期、不再缓存的类型以及配置已变更 (见 SetVariant) 的条目
+func (c *EnrichmentCache) Restore(ctx context.Context, store StateStore) error {
+	entries := make(map[string]enrichmentCacheEntry)
+	if err := store.Load(ctx, enrichmentCacheStateKey, &entries); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now().UnixMilli()
+	for key, entry := range entries {
+		kind, _, _ := strings.Cut(key, "|")
+		if _, ok := c.ttls[kind]; !ok || now >= entry.ExpiresAt || entry.Variant != c.variants[kind] {
+			c.dirty = true
+			continue
+		}
+		if len(c.entries) >= c.capacity {
+			break
+		}
+		c.entries[key] = entry
+	}
+	return nil
+}
+
+// Persist 缓存有变化时写入状态存储
+func (c *EnrichmentCache) Persist(ctx context.Context, store StateStore) error {
+	c.mu.Lock()
+	if !c.dirty {
+		c.mu.Unlock()
+		return nil
+	}
+	c.removeExpired(c.now())
+	snapshot := make(map[string]enrichmentCacheEntry, len(c.entries))
+	for key, entry := range c.entries {
+		snapshot[key] = entry
+	}
+	c.dirty = false
+	c.mu.Unlock()
+
+	if err := store.Save(ctx, enrichmentCacheStateKey, snapshot); err != nil {
+		c.mu.Lock()
+		c.dirty = true
+		c.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// fieldLookup 只补充单个字段的补充器，查询结果可以按 IP 跨周期缓存
+type fieldLookup interface {
+	LoginEnricher
+
+	// kind 补充结果类型
+	kind() string
+	// target 负责补充的字段
+	target(fields EnrichFields) *string
+	// lookup 查询单个 IP，cacheable 为 false 时结果不确定 (如在线查询暂时失败)，不应缓存
+	lookup(ctx context.Context, ip string) (value string, cacheable bool, err error)
+}
+
+// Wrap 为单字段补充器增加跨周期缓存，其他补充器原样返回
+func (c *EnrichmentCache) Wrap(enricher LoginEnricher) LoginEnricher {
+	if lookup, ok := enricher.(fieldLookup); ok && c != nil {
+		return &cachedEnricher{cache: c, lookup: lookup}
+	}
+	return enricher
+}
+
+// cachedEnricher 先查跨周期缓存，未命中时查询并写入缓存
+type cachedEnricher struct {
+	cache  *EnrichmentCache
+	lookup fieldLookup
+}
+
+func (e *cachedEnricher) Enrich(ctx context.Context, ip string, fields EnrichFields) {
+	target := e.lookup.target(fields)
+	if target == nil {
+		return
+	}
+
+	kind := e.lookup.kind()
+	if value, ok := e.cache.Get(kind, ip); ok {
+		*target = value
+		return
+	}
+
+	value, cacheable, err := e.lookup.lookup(ctx, ip)
+	if err != nil {
+		return
+	}
+	if cacheable {
+		e.cache.Add(kind, ip, value)
+	}
+	*target = value
+}
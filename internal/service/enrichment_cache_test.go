@@ -0,0 +1,185 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+// memoryStateStore 内存中的状态存储
+type memoryStateStore struct {
+	values map[string][]byte
+}
+
+func (s *memoryStateStore) Load(ctx context.Context, key string, target any) error {
+	data, ok := s.values[key]
+	if !ok {
+		return nil
+	}
+	return json.Unmarshal(data, target)
+}
+
+func (s *memoryStateStore) Save(ctx context.Context, key string, value any) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	s.values[key] = data
+	return nil
+}
+
+// countingLookup 记录查询次数的单字段补充器
+type countingLookup struct {
+	value     string
+	cacheable bool
+	calls     int
+}
+
+func (l *countingLookup) Enrich(ctx context.Context, ip string, fields EnrichFields) {}
+
+func (l *countingLookup) kind() string { return EnrichKindLocation }
+
+func (l *countingLookup) target(fields EnrichFields) *string { return fields.Location }
+
+func (l *countingLookup) lookup(ctx context.Context, ip string) (string, bool, error) {
+	l.calls++
+	return l.value, l.cacheable, nil
+}
+
+func TestEnrichmentCacheAcrossCycles(t *testing.T) {
+	now := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+	newCache := func() *EnrichmentCache {
+		cache := NewEnrichmentCache(16, map[string]time.Duration{
+			EnrichKindLocation: 24 * time.Hour,
+			EnrichKindHostname: time.Hour,
+		})
+		cache.now = func() time.Time { return now }
+		return cache
+	}
+
+	cache := newCache()
+	lookup := &countingLookup{value: "United States", cacheable: true}
+	enricher := cache.Wrap(lookup)
+
+	for i := 0; i < 3; i++ {
+		var location string
+		enricher.Enrich(context.Background(), "8.8.8.8", EnrichFields{Location: &location})
+		if location != "United States" {
+			t.Fatalf("第 %d 次归属地 = %q", i, location)
+		}
+	}
+	if lookup.calls != 1 {
+		t.Errorf("查询次数 = %d, 期望 1", lookup.calls)
+	}
+
+	// 各类型独立过期
+	cache.Add(EnrichKindHostname, "8.8.8.8", "dns.google")
+	now = now.Add(2 * time.Hour)
+	if _, ok := cache.Get(EnrichKindHostname, "8.8.8.8"); ok {
+		t.Error("主机名应已过期")
+	}
+	if _, ok := cache.Get(EnrichKindLocation, "8.8.8.8"); !ok {
+		t.Error("归属地不应过期")
+	}
+
+	// 重启后从状态存储恢复
+	store := &memoryStateStore{values: make(map[string][]byte)}
+	if err := cache.Persist(context.Background(), store); err != nil {
+		t.Fatal(err)
+	}
+	restored := newCache()
+	if err := restored.Restore(context.Background(), store); err != nil {
+		t.Fatal(err)
+	}
+	if value, ok := restored.Get(EnrichKindLocation, "8.8.8.8"); !ok || value != "United States" {
+		t.Errorf("恢复后的归属地 = %q, %v", value, ok)
+	}
+
+	// 数据库更新后清空归属地
+	restored.Flush(EnrichKindLocation)
+	if _, ok := restored.Get(EnrichKindLocation, "8.8.8.8"); ok {
+		t.Error("Flush 后不应命中")
+	}
+
+	stats := cache.Stats()[EnrichKindLocation]
+	if stats.Hits != 3 || stats.Misses != 1 || stats.Entries != 1 {
+		t.Errorf("归属地统计 = %+v", stats)
+	}
+	if stats := cache.Stats()[EnrichKindHostname]; stats.Expired != 1 {
+		t.Errorf("主机名统计 = %+v", stats)
+	}
+}
+
+func TestEnrichmentCacheSkipsUncertainResults(t *testing.T) {
+	cache := NewEnrichmentCache(16, map[string]time.Duration{EnrichKindLocation: time.Hour})
+	lookup := &countingLookup{cacheable: false}
+	enricher := cache.Wrap(lookup)
+
+	for i := 0; i < 2; i++ {
+		location := "旧值"
+		enricher.Enrich(context.Background(), "8.8.8.8", EnrichFields{Location: &location})
+	}
+	if lookup.calls != 2 {
+		t.Errorf("不确定的结果不应缓存, 查询次数 = %d", lookup.calls)
+	}
+}
+
+func TestEnrichmentCacheEvictsSoonestExpiring(t *testing.T) {
+	now := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+	cache := NewEnrichmentCache(2, map[string]time.Duration{
+		EnrichKindLocation: 24 * time.Hour,
+		EnrichKindHostname: time.Hour,
+	})
+	cache.now = func() time.Time { return now }
+
+	cache.Add(EnrichKindLocation, "1.1.1.1", "a")
+	cache.Add(EnrichKindHostname, "1.1.1.1", "b")
+	cache.Add(EnrichKindLocation, "8.8.8.8", "c")
+
+	if _, ok := cache.Get(EnrichKindHostname, "1.1.1.1"); ok {
+		t.Error("最早过期的条目应被淘汰")
+	}
+	if stats := cache.Stats()[EnrichKindHostname]; stats.Evictions != 1 {
+		t.Errorf("主机名统计 = %+v", stats)
+	}
+}
+
+func TestEnrichmentCacheVariant(t *testing.T) {
+	newCache := func(level string) *EnrichmentCache {
+		cache := NewEnrichmentCache(16, map[string]time.Duration{EnrichKindLocation: time.Hour})
+		cache.SetVariant(EnrichKindLocation, level)
+		return cache
+	}
+
+	cache := newCache(GeoIPPrivacyFull)
+	cache.Add(EnrichKindLocation, "8.8.8.8", "United States-California-Mountain View")
+	store := &memoryStateStore{values: make(map[string][]byte)}
+	if err := cache.Persist(context.Background(), store); err != nil {
+		t.Fatal(err)
+	}
+
+	// 隐私级别相同时恢复
+	restored := newCache(GeoIPPrivacyFull)
+	if err := restored.Restore(context.Background(), store); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := restored.Get(EnrichKindLocation, "8.8.8.8"); !ok {
+		t.Error("隐私级别未变时应恢复缓存")
+	}
+
+	// 隐私级别变更后不再输出完整归属地
+	restored = newCache(GeoIPPrivacyCountry)
+	if err := restored.Restore(context.Background(), store); err != nil {
+		t.Fatal(err)
+	}
+	if value, ok := restored.Get(EnrichKindLocation, "8.8.8.8"); ok {
+		t.Errorf("隐私级别变更后不应命中: %q", value)
+	}
+
+	// 运行中变更时清除已有条目
+	cache.SetVariant(EnrichKindLocation, GeoIPPrivacyNone)
+	if _, ok := cache.Get(EnrichKindLocation, "8.8.8.8"); ok {
+		t.Error("SetVariant 后不应命中旧条目")
+	}
+}
@@ -0,0 +1,152 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+const (
+	// 在线查询默认最大并发数
+	defaultFallbackMaxInflight = 4
+
+	// 在线查询默认每分钟请求数上限 (免费接口通常限制在每分钟 45 次左右)
+	defaultFallbackRatePerMinute = 45
+
+	// 在线查询超时时间
+	fallbackTimeout = 3 * time.Second
+)
+
+var (
+	// errFallbackBusy 在线查询并发已满
+	errFallbackBusy = errors.New("GeoIP online fallback busy")
+
+	// errFallbackRateLimited 在线查询超出请求频率上限
+	errFallbackRateLimited = errors.New("GeoIP online fallback rate limited")
+)
+
+// onlineFallback 本地数据库未加载或未命中时的在线查询
+// 并发数和请求频率都有上限，超出时立即放弃而不是排队，避免突发的大量新 IP 占满 goroutine 和连接，
+// 也避免超出接口的频率限制被封禁
+type onlineFallback struct {
+	url     string
+	client  *http.Client
+	sem     chan struct{}
+	limiter *rate.Limiter
+
+	inflight    atomic.Int64
+	rejected    atomic.Int64
+	rateLimited atomic.Int64
+}
+
+// fallbackResponse 在线查询接口的响应
+type fallbackResponse struct {
+	Country string `json:"country"`
+	Region  string `json:"region"`
+	City    string `json:"city"`
+}
+
+func newOnlineFallback(url string, maxInflight, ratePerMinute int) *onlineFallback {
+	if maxInflight <= 0 {
+		maxInflight = defaultFallbackMaxInflight
+	}
+	if ratePerMinute <= 0 {
+		ratePerMinute = defaultFallbackRatePerMinute
+	}
+	return &onlineFallback{
+		url:     url,
+		client:  &http.Client{Timeout: fallbackTimeout},
+		sem:     make(chan struct{}, maxInflight),
+		limiter: rate.NewLimiter(rate.Limit(float64(ratePerMinute)/60), ratePerMinute),
+	}
+}
+
+// location 国家-省份-城市，与本地数据库的归属地格式相同
+func (r fallbackResponse) location() string {
+	var parts []string
+	for _, part := range []string{r.Country, r.Region, r.City} {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, "-")
+}
+
+// Lookup 在线查询归属地，并发已满时返回 errFallbackBusy，超出频率上限时返回 errFallbackRateLimited
+func (f *onlineFallback) Lookup(ctx context.Context, ip string) (string, error) {
+	result, err := f.lookup(ctx, ip)
+	if err != nil {
+		return "", err
+	}
+	return result.location(), nil
+}
+
+// lookup 在线查询，返回接口的原始响应
+func (f *onlineFallback) lookup(ctx context.Context, ip string) (fallbackResponse, error) {
+	select {
+	case f.sem <- struct{}{}:
+	default:
+		f.rejected.Add(1)
+		return fallbackResponse{}, errFallbackBusy
+	}
+	if !f.limiter.Allow() {
+		<-f.sem
+		f.rateLimited.Add(1)
+		return fallbackResponse{}, errFallbackRateLimited
+	}
+	f.inflight.Add(1)
+	defer func() {
+		f.inflight.Add(-1)
+		<-f.sem
+	}()
+
+	var result fallbackResponse
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.ReplaceAll(f.url, "{ip}", ip), nil)
+	if err != nil {
+		return result, err
+	}
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return result, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return result, fmt.Errorf("GeoIP online fallback returned status %d", resp.StatusCode)
+	}
+
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 64*1024)).Decode(&result); err != nil {
+		return fallbackResponse{}, fmt.Errorf("decode GeoIP online fallback response failed: %w", err)
+	}
+	return result, nil
+}
+
+// GeoIPMetrics GeoIP 服务运行指标
+type GeoIPMetrics struct {
+	CacheEntries     int   `json:"cacheEntries"`     // 缓存条目数
+	FallbackInflight int64 `json:"fallbackInflight"` // 正在进行的在线查询数
+	FallbackRejected int64 `json:"fallbackRejected"` // 因并发已满而放弃的在线查询数
+
+	FallbackRateLimited int64 `json:"fallbackRateLimited"` // 因超出频率上限而放弃的在线查询数
+}
+
+// Metrics 返回当前运行指标
+func (s *GeoIPService) Metrics() GeoIPMetrics {
+	metrics := GeoIPMetrics{
+		CacheEntries: s.cache.Len(),
+	}
+	if s.fallback != nil {
+		metrics.FallbackInflight = s.fallback.inflight.Load()
+		metrics.FallbackRejected = s.fallback.rejected.Load()
+		metrics.FallbackRateLimited = s.fallback.rateLimited.Load()
+	}
+	return metrics
+}
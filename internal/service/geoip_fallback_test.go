@@ -0,0 +1,106 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestOnlineFallbackInflightLimit(t *testing.T) {
+	release := make(chan struct{})
+	arrived := make(chan struct{}, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		arrived <- struct{}{}
+		<-release
+		fmt.Fprint(w, `{"country":"Netherlands","city":"Amsterdam"}`)
+	}))
+	defer server.Close()
+
+	s := newTestGeoIPService(nil)
+	s.fallback = newOnlineFallback(server.URL+"/{ip}", 2, 0)
+
+	var wg sync.WaitGroup
+	results := make(chan error, 5)
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func(ip string) {
+			defer wg.Done()
+			_, err := s.Lookup(ip)
+			results <- err
+		}(fmt.Sprintf("45.148.10.%d", i+1))
+	}
+
+	// 两个请求到达接口后，其余请求应立即返回本地结果
+	for i := 0; i < 2; i++ {
+		select {
+		case <-arrived:
+		case <-time.After(time.Second):
+			t.Fatal("在线查询未到达接口")
+		}
+	}
+	for i := 0; i < 3; i++ {
+		select {
+		case err := <-results:
+			if !errors.Is(err, ErrDBNotLoaded) {
+				t.Errorf("超出并发上限的查询应返回本地结果, 实际错误 %v", err)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("超出并发上限的查询不应排队")
+		}
+	}
+
+	if m := s.Metrics(); m.FallbackInflight != 2 || m.FallbackRejected != 3 {
+		t.Errorf("指标 = %+v", m)
+	}
+
+	close(release)
+	wg.Wait()
+	close(results)
+	for err := range results {
+		if err != nil {
+			t.Errorf("在线查询失败: %v", err)
+		}
+	}
+	if got, _ := s.Lookup("45.148.10.1"); got != "Netherlands-Amsterdam" {
+		t.Errorf("归属地 = %q", got)
+	}
+	if m := s.Metrics(); m.FallbackInflight != 0 {
+		t.Errorf("完成后正在进行的查询数 = %d", m.FallbackInflight)
+	}
+}
+
+func TestOnlineFallbackRateLimit(t *testing.T) {
+	var requests atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		fmt.Fprint(w, `{"country":"Netherlands"}`)
+	}))
+	defer server.Close()
+
+	s := newTestGeoIPService(nil)
+	s.fallback = newOnlineFallback(server.URL+"/{ip}", 2, 3)
+
+	for i := 0; i < 5; i++ {
+		s.LookupIP(fmt.Sprintf("45.148.10.%d", i+1))
+	}
+	if got := requests.Load(); got != 3 {
+		t.Errorf("超出频率上限后不应请求接口, 实际 %d 次", got)
+	}
+	if m := s.Metrics(); m.FallbackRateLimited != 2 {
+		t.Errorf("指标 = %+v", m)
+	}
+	// 被限流的结果不缓存，之后可以重新查询
+	if _, ok := s.cache.Get("45.148.10.5"); ok {
+		t.Error("被限流的查询不应写入缓存")
+	}
+	// 内网IP不请求接口
+	s.LookupIP("10.0.0.1")
+	if got := requests.Load(); got != 3 {
+		t.Errorf("内网IP不应请求接口, 实际 %d 次", got)
+	}
+}
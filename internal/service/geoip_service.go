@@ -1,28 +1,261 @@
 package service
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/dushixiang/pika/internal/config"
+	"github.com/fsnotify/fsnotify"
 	"github.com/oschwald/geoip2-golang"
+	"github.com/oschwald/maxminddb-golang"
 	"go.uber.org/zap"
 )
 
+// defaultGeoIPCacheSize 默认的 GeoIP 查询结果缓存条目数
+const defaultGeoIPCacheSize = 1024
+
+// 归属地输出精度 (GeoIPConfig.PrivacyLevel)
+const (
+	GeoIPPrivacyFull    = "full"    // 国家-省份-城市及经纬度
+	GeoIPPrivacyCountry = "country" // 只输出国家
+	GeoIPPrivacyNone    = "none"    // 不输出归属地
+)
+
+// ErrDBNotLoaded GeoIP 数据库未加载 (未配置、加载失败或正在重新加载)
+var ErrDBNotLoaded = errors.New("GeoIP database not loaded")
+
+// ErrInMemoryDatabase 数据库来自内存，没有可重新加载的文件
+var ErrInMemoryDatabase = errors.New("GeoIP database loaded from memory cannot be reloaded")
+
+// geoIPReader GeoIP 数据库读取接口
+type geoIPReader interface {
+	// City 查询城市信息，同时返回数据库中匹配的网段 (无法获取时为 nil)
+	City(ipAddress net.IP) (*geoip2.City, *net.IPNet, error)
+	Close() error
+}
+
+// asnReader ASN 数据库读取接口
+type asnReader interface {
+	ASN(ipAddress net.IP) (*geoip2.ASN, error)
+	Close() error
+}
+
+// mmdbCityReader 直接使用 maxminddb 读取城市数据库，以便获取匹配的网段
+// 国家数据库 (GeoLite2-Country 等) 按国家记录读取，结果中没有省份、城市和经纬度
+type mmdbCityReader struct {
+	reader      *maxminddb.Reader
+	countryOnly bool
+}
+
+func (r *mmdbCityReader) City(ipAddress net.IP) (*geoip2.City, *net.IPNet, error) {
+	if r.countryOnly {
+		var country geoip2.Country
+		network, _, err := r.reader.LookupNetwork(ipAddress, &country)
+		if err != nil {
+			return nil, nil, err
+		}
+		return cityFromCountry(&country), network, nil
+	}
+
+	var city geoip2.City
+	// 数据库中不存在时 network 为不包含数据的网段，同样是确定的结果
+	network, _, err := r.reader.LookupNetwork(ipAddress, &city)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &city, network, nil
+}
+
+// cityFromCountry 将国家记录转换为城市记录，城市相关的字段为空
+func cityFromCountry(country *geoip2.Country) *geoip2.City {
+	city := &geoip2.City{}
+	city.Continent = country.Continent
+	city.Country = country.Country
+	city.RegisteredCountry = country.RegisteredCountry
+	city.RepresentedCountry = country.RepresentedCountry
+	city.Traits = country.Traits
+	return city
+}
+
+// isCountryOnlyDatabase 根据数据库元数据中的类型判断是否为只有国家数据的数据库
+// 支持城市 (GeoLite2-City、GeoIP2-City 及各区域版本)、企业 (GeoIP2-Enterprise) 和国家 (GeoLite2-Country、GeoIP2-Country) 数据库，
+// 以及 DB-IP 的兼容版本；ASN、ISP 等其他类型的数据库不包含归属地，返回错误
+func isCountryOnlyDatabase(databaseType string) (bool, error) {
+	switch {
+	case strings.Contains(databaseType, "City"), strings.Contains(databaseType, "Enterprise"),
+		strings.Contains(databaseType, "Location"):
+		return false, nil
+	case strings.Contains(databaseType, "Country"):
+		return true, nil
+	default:
+		return false, fmt.Errorf("unsupported GeoIP database type %q, a City, Enterprise or Country database is required", databaseType)
+	}
+}
+
+func (r *mmdbCityReader) Close() error {
+	return r.reader.Close()
+}
+
+// LookupDetail IP 查询的详细结果
+// 名称随 DBLanguage 变化，仅用于展示；聚合统计应使用语言无关的 ISO 代码
+type LookupDetail struct {
+	// 归属地 (国家-省份-城市，本地化名称)
+	Location string
+
+	// 大洲代码 (如 AS、EU) 及本地化名称
+	ContinentCode string
+	ContinentName string
+
+	// 国家 ISO 3166-1 alpha-2 代码及本地化名称
+	CountryCode string
+	CountryName string
+
+	// 各级行政区 ISO 3166-2 代码 (不含国家前缀) 及本地化名称，按从大到小排列
+	SubdivisionCodes []string
+	SubdivisionNames []string
+
+	// 城市本地化名称 (数据库不提供城市代码)
+	CityName string
+
+	// 经纬度 (数据库中的近似位置)
+	Latitude  float64
+	Longitude float64
+
+	// 是否为内网 IP (不查询数据库)
+	IsPrivate bool
+
+	// 数据库中匹配的网段，网段内的 IP 查询结果相同，无法获取时为 nil
+	MatchedNetwork *net.IPNet
+}
+
+// GeoLocation 结构化的 IP 归属地，可直接序列化为 JSON 下发
+// Subdivision 为第一级行政区 (省/州)
+type GeoLocation struct {
+	Country        string  `json:"country,omitempty"`
+	CountryISOCode string  `json:"countryIsoCode,omitempty"`
+	Subdivision    string  `json:"subdivision,omitempty"`
+	City           string  `json:"city,omitempty"`
+	Latitude       float64 `json:"latitude,omitempty"`
+	Longitude      float64 `json:"longitude,omitempty"`
+	IsPrivate      bool    `json:"isPrivate,omitempty"`
+}
+
+// GeoLocation 转换为结构化的归属地
+func (d *LookupDetail) GeoLocation() *GeoLocation {
+	location := &GeoLocation{
+		Country:        d.CountryName,
+		CountryISOCode: d.CountryCode,
+		City:           d.CityName,
+		Latitude:       d.Latitude,
+		Longitude:      d.Longitude,
+		IsPrivate:      d.IsPrivate,
+	}
+	if len(d.SubdivisionNames) > 0 {
+		location.Subdivision = d.SubdivisionNames[0]
+	}
+	return location
+}
+
+// GeoIPMetricsRecorder GeoIP 查询指标输出，由调用方对接到监控系统 (如 Prometheus)，实现应是并发安全且不阻塞的
+// 与 Metrics 返回的运行状态快照不同，这里按每次查询记录
+type GeoIPMetricsRecorder interface {
+	// IncCacheHit 查询命中缓存
+	IncCacheHit()
+	// IncCacheMiss 查询未命中缓存
+	IncCacheMiss()
+	// ObserveLookup 未命中缓存时查询数据库 (及在线查询) 的耗时
+	ObserveLookup(d time.Duration)
+}
+
+// geoIPCacheEntry 缓存的查询结果
+// 在线查询只返回归属地和国家，没有大洲和经纬度
+type geoIPCacheEntry struct {
+	Location       string
+	Continent      string
+	Country        string
+	Latitude       float64
+	Longitude      float64
+	HasCoordinates bool
+}
+
+// newGeoIPCacheEntry 由数据库查询结果生成缓存条目，经纬度都为 0 视为数据库中没有位置数据
+func newGeoIPCacheEntry(detail *LookupDetail) geoIPCacheEntry {
+	return geoIPCacheEntry{
+		Location:       detail.Location,
+		Continent:      detail.ContinentName,
+		Country:        detail.CountryName,
+		Latitude:       detail.Latitude,
+		Longitude:      detail.Longitude,
+		HasCoordinates: detail.Latitude != 0 || detail.Longitude != 0,
+	}
+}
+
+// noopGeoIPMetricsRecorder 未设置指标输出时使用
+type noopGeoIPMetricsRecorder struct{}
+
+func (noopGeoIPMetricsRecorder) IncCacheHit()                {}
+func (noopGeoIPMetricsRecorder) IncCacheMiss()               {}
+func (noopGeoIPMetricsRecorder) ObserveLookup(time.Duration) {}
+
 type GeoIPService struct {
 	logger *zap.Logger
 	config *config.GeoIPConfig
-	db     *geoip2.Reader
+	db     geoIPReader
 	mu     sync.RWMutex
+
+	// ASN 数据库，未配置或加载失败时为 nil
+	asn asnReader
+
+	// 配置中额外视为内网的网段 (VPN 出口、云 NAT 网关等)
+	extraPrivateRanges []*net.IPNet
+
+	// 查询结果缓存，只缓存确定的结果 (已解析或数据库中确实不存在)，不缓存错误
+	// 归属地和经纬度一起缓存，任一查询方法都会填充
+	cache *lruCache[string, geoIPCacheEntry]
+
+	// 在线查询，未配置时为 nil
+	fallback *onlineFallback
+
+	// 已加载的数据库文件修改时间，用于发现数据库更新
+	dbModTime time.Time
+
+	// 已加载的数据库类型 (元数据中的 database_type，如 GeoLite2-City)
+	dbType string
+
+	// 数据库代数，每次替换数据库时加一；查询期间数据库被替换时不缓存旧数据库的结果
+	generation uint64
+
+	// 数据库来自内存 (NewGeoIPServiceFromBytes)，没有可重新加载的文件
+	inMemory bool
+
+	// 数据库重新加载后的回调 (清空依赖查询结果的缓存)
+	reloadMu  sync.Mutex
+	onReloads []func()
+
+	// 数据库文件监控，未启用时为 nil
+	watcher *fsnotify.Watcher
+
+	// 查询指标输出，未设置时为 nil
+	recorder GeoIPMetricsRecorder
+
+	// 已关闭，之后不再加载数据库 (文件监控中尚未处理的事件)
+	closed bool
+
+	// 名称的语言优先顺序，创建时由配置计算
+	languages []string
 }
 
 func NewGeoIPService(logger *zap.Logger, appCfg *config.AppConfig) (*GeoIPService, error) {
 	cfg := appCfg.GeoIP
-	s := &GeoIPService{
-		logger: logger,
-		config: cfg,
-	}
+	s := newGeoIPService(logger, cfg)
 
 	// 如果启用了 GeoIP 且配置了数据库路径
 	if cfg != nil && cfg.Enabled && cfg.DBPath != "" {
@@ -33,7 +266,17 @@ func NewGeoIPService(logger *zap.Logger, appCfg *config.AppConfig) (*GeoIPServic
 			// 不返回错误，只是禁用服务
 			return s, nil
 		}
-		logger.Info("GeoIP service initialized successfully", zap.String("dbPath", cfg.DBPath))
+		logger.Info("GeoIP service initialized successfully",
+			zap.String("dbPath", cfg.DBPath),
+			zap.String("databaseType", s.databaseType()))
+
+		if cfg.WatchDB {
+			if err := s.watchDatabase(); err != nil {
+				logger.Warn("failed to watch GeoIP database, updates require a restart or ReloadIfChanged",
+					zap.String("path", cfg.DBPath),
+					zap.Error(err))
+			}
+		}
 	} else {
 		logger.Info("GeoIP service is disabled")
 	}
@@ -41,102 +284,743 @@ func NewGeoIPService(logger *zap.Logger, appCfg *config.AppConfig) (*GeoIPServic
 	return s, nil
 }
 
-// loadDatabase 加载 GeoIP 数据库
+// NewGeoIPServiceFromBytes 从内存中的数据库创建 GeoIP 服务 (如通过 go:embed 编译进程序)，用于只读文件系统等没有数据库文件的场景
+// 忽略 DBPath 和 WatchDB，数据库无法重新加载；数据无效时返回错误
+func NewGeoIPServiceFromBytes(logger *zap.Logger, data []byte, appCfg *config.AppConfig) (*GeoIPService, error) {
+	cfg := appCfg.GeoIP
+	s := newGeoIPService(logger, cfg)
+	s.inMemory = true
+
+	if cfg == nil || !cfg.Enabled {
+		logger.Info("GeoIP service is disabled")
+		return s, nil
+	}
+	db, err := maxminddb.FromBytes(data)
+	if err != nil {
+		return nil, fmt.Errorf("open GeoIP database failed: %w", err)
+	}
+	if err := s.installDatabase(db, time.Time{}); err != nil {
+		return nil, err
+	}
+	logger.Info("GeoIP service initialized from memory",
+		zap.Int("size", len(data)),
+		zap.String("databaseType", s.databaseType()))
+	return s, nil
+}
+
+// newGeoIPService 创建未加载数据库的服务，解析内网网段、隐私级别、名称语言和在线查询配置
+func newGeoIPService(logger *zap.Logger, cfg *config.GeoIPConfig) *GeoIPService {
+	s := &GeoIPService{
+		logger:    logger,
+		config:    cfg,
+		cache:     newLRUCache[string, geoIPCacheEntry](geoIPCacheSize(cfg)),
+		languages: languageChain(cfg),
+	}
+
+	if cfg != nil {
+		s.extraPrivateRanges = parsePrivateRanges(logger, cfg.ExtraPrivateRanges)
+		if s.privacyLevel() != cfg.PrivacyLevel && cfg.PrivacyLevel != "" {
+			logger.Warn("unknown GeoIP privacy level, locations will not be output",
+				zap.String("privacyLevel", cfg.PrivacyLevel))
+		}
+	}
+
+	if cfg != nil && cfg.Enabled && cfg.FallbackAPIURL != "" {
+		s.fallback = newOnlineFallback(cfg.FallbackAPIURL, cfg.FallbackMaxInflight, cfg.FallbackRatePerMinute)
+	}
+	return s
+}
+
+// parsePrivateRanges 解析额外的内网网段，无效的网段记录警告后跳过
+func parsePrivateRanges(logger *zap.Logger, ranges []string) []*net.IPNet {
+	var networks []*net.IPNet
+	for _, cidr := range ranges {
+		_, network, err := net.ParseCIDR(strings.TrimSpace(cidr))
+		if err != nil {
+			logger.Warn("invalid GeoIP extra private range, ignored", zap.String("cidr", cidr), zap.Error(err))
+			continue
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}
+
+// isPrivate 是否为内网IP，包括内置的私有网段和配置的额外网段
+func (s *GeoIPService) isPrivate(ip string) bool {
+	if isPrivateIP(ip) {
+		return true
+	}
+	if len(s.extraPrivateRanges) == 0 {
+		return false
+	}
+	parsedIP := net.ParseIP(ip)
+	if parsedIP == nil {
+		return false
+	}
+	for _, network := range s.extraPrivateRanges {
+		if network.Contains(parsedIP) {
+			return true
+		}
+	}
+	return false
+}
+
+// privacyLevel 归属地输出精度，未配置时输出完整归属地，无法识别的值按 none 处理，避免误配置时泄露位置
+func (s *GeoIPService) privacyLevel() string {
+	switch s.config.PrivacyLevel {
+	case "", GeoIPPrivacyFull:
+		return GeoIPPrivacyFull
+	case GeoIPPrivacyCountry:
+		return GeoIPPrivacyCountry
+	default:
+		return GeoIPPrivacyNone
+	}
+}
+
+// present 按输出精度返回缓存条目的归属地
+func (s *GeoIPService) present(entry geoIPCacheEntry) string {
+	switch s.privacyLevel() {
+	case GeoIPPrivacyFull:
+		return entry.Location
+	case GeoIPPrivacyCountry:
+		return entry.Country
+	default:
+		return ""
+	}
+}
+
+// coarsen 按输出精度裁剪详细结果，保留 MatchedNetwork 以便调用方按网段缓存
+func (s *GeoIPService) coarsen(detail *LookupDetail) *LookupDetail {
+	switch s.privacyLevel() {
+	case GeoIPPrivacyFull:
+		return detail
+	case GeoIPPrivacyCountry:
+		return &LookupDetail{
+			Location:       detail.CountryName,
+			ContinentCode:  detail.ContinentCode,
+			ContinentName:  detail.ContinentName,
+			CountryCode:    detail.CountryCode,
+			CountryName:    detail.CountryName,
+			MatchedNetwork: detail.MatchedNetwork,
+		}
+	default:
+		return &LookupDetail{MatchedNetwork: detail.MatchedNetwork}
+	}
+}
+
+// geoIPCacheSize 查询结果缓存条目数，未配置时使用默认值
+func geoIPCacheSize(cfg *config.GeoIPConfig) int {
+	if cfg != nil && cfg.CacheSize > 0 {
+		return cfg.CacheSize
+	}
+	return defaultGeoIPCacheSize
+}
+
+// loadDatabase 加载 GeoIP 数据库，已加载时替换并关闭旧数据库
 func (s *GeoIPService) loadDatabase() error {
-	db, err := geoip2.Open(s.config.DBPath)
+	info, err := os.Stat(s.config.DBPath)
+	if err != nil {
+		return fmt.Errorf("stat GeoIP database failed: %w", err)
+	}
+	db, err := maxminddb.Open(s.config.DBPath)
 	if err != nil {
 		return fmt.Errorf("open GeoIP database failed: %w", err)
 	}
-	s.db = db
+	return s.installDatabase(db, info.ModTime())
+}
+
+// installDatabase 检查数据库类型后替换已加载的数据库，类型不支持时关闭新数据库并返回错误
+// modTime 为数据库文件修改时间，内存中的数据库为零值
+func (s *GeoIPService) installDatabase(db *maxminddb.Reader, modTime time.Time) error {
+	dbType := db.Metadata.DatabaseType
+	countryOnly, err := isCountryOnlyDatabase(dbType)
+	if err != nil {
+		db.Close()
+		return err
+	}
+	if countryOnly {
+		s.logger.Info("GeoIP database is country-only, locations will not include subdivision, city or coordinates",
+			zap.String("databaseType", dbType))
+	}
+
+	asn := s.openASNDatabase()
+
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		db.Close()
+		if asn != nil {
+			asn.Close()
+		}
+		return ErrDBNotLoaded
+	}
+	old := s.db
+	s.db = &mmdbCityReader{reader: db, countryOnly: countryOnly}
+	s.dbModTime = modTime
+	s.dbType = dbType
+	s.generation++
+	var oldASN asnReader
+	if asn != nil {
+		oldASN, s.asn = s.asn, asn
+	}
+	s.mu.Unlock()
+
+	if oldASN != nil {
+		if err := oldASN.Close(); err != nil {
+			s.logger.Warn("failed to close old ASN database", zap.Error(err))
+		}
+	}
+
+	if old != nil {
+		// 新数据库已生效，关闭旧数据库失败不影响查询
+		if err := old.Close(); err != nil {
+			s.logger.Warn("failed to close old GeoIP database", zap.Error(err))
+		}
+	}
 	return nil
 }
 
-// LookupIP 查询 IP 归属地
-func (s *GeoIPService) LookupIP(ip string) string {
-	// 如果服务未启用或数据库未加载
-	if s.config == nil || !s.config.Enabled || s.db == nil {
-		return ""
+// openASNDatabase 打开 ASN 数据库，未配置或打开失败时返回 nil
+// ASN 数据库是可选的，打开失败不影响城市数据库，重新加载时继续使用旧的 ASN 数据库
+func (s *GeoIPService) openASNDatabase() asnReader {
+	if s.config.ASNDBPath == "" {
+		return nil
 	}
+	reader, err := geoip2.Open(s.config.ASNDBPath)
+	if err != nil {
+		s.logger.Warn("failed to load ASN database, ASN lookup will be disabled",
+			zap.String("path", s.config.ASNDBPath),
+			zap.Error(err))
+		return nil
+	}
+	return reader
+}
 
-	// 跳过私有IP
-	if isPrivateIP(ip) {
-		return "内网IP"
+// OnReload 注册数据库重新加载后的回调
+func (s *GeoIPService) OnReload(fn func()) {
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+	s.onReloads = append(s.onReloads, fn)
+}
+
+// Reload 重新加载数据库，用于数据库文件更新后不重启服务即可生效
+// 内存中的数据库无法重新加载，返回 ErrInMemoryDatabase
+// 新数据库打开成功后才替换旧数据库；打开失败时继续使用旧数据库并返回错误
+// 重新加载后清空查询缓存并执行 OnReload 注册的回调
+func (s *GeoIPService) Reload() error {
+	if s.inMemory {
+		return ErrInMemoryDatabase
+	}
+	if s.config == nil || !s.config.Enabled || s.config.DBPath == "" {
+		return ErrDBNotLoaded
+	}
+
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+	return s.reloadLocked()
+}
+
+// ReloadIfChanged 数据库文件被更新 (如 geoipupdate 定时任务) 后重新加载；内存中的数据库不检查
+func (s *GeoIPService) ReloadIfChanged() (bool, error) {
+	if s.inMemory || s.config == nil || !s.config.Enabled || s.config.DBPath == "" {
+		return false, nil
+	}
+
+	info, err := os.Stat(s.config.DBPath)
+	if err != nil {
+		return false, err
+	}
+
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+
+	s.mu.RLock()
+	unchanged := s.db != nil && info.ModTime().Equal(s.dbModTime)
+	s.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	if err := s.reloadLocked(); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// reloadLocked 重新加载数据库并清空依赖查询结果的缓存，调用方需持有 reloadMu
+func (s *GeoIPService) reloadLocked() error {
+	if err := s.loadDatabase(); err != nil {
+		return err
+	}
+	s.cache.Purge()
+	for _, fn := range s.onReloads {
+		fn()
 	}
 
+	s.logger.Info("GeoIP database reloaded",
+		zap.String("dbPath", s.config.DBPath),
+		zap.String("databaseType", s.databaseType()))
+	return nil
+}
+
+// SetMetricsRecorder 设置查询指标输出，为 nil 时不记录，应在开始查询前设置
+func (s *GeoIPService) SetMetricsRecorder(recorder GeoIPMetricsRecorder) {
+	s.recorder = recorder
+}
+
+func (s *GeoIPService) metricsRecorder() GeoIPMetricsRecorder {
+	if s.recorder == nil {
+		return noopGeoIPMetricsRecorder{}
+	}
+	return s.recorder
+}
+
+// databaseType 已加载的数据库类型，未加载时为空
+func (s *GeoIPService) databaseType() string {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
+	return s.dbType
+}
 
-	parsedIP := net.ParseIP(ip)
-	if parsedIP == nil {
-		return ""
+// Status 数据库状态，未启用或数据库未加载时返回 ErrDBNotLoaded
+// 用于探针的诊断报告 (audit.LocationResolverStatus)
+func (s *GeoIPService) Status() error {
+	if s.config == nil || !s.config.Enabled {
+		return fmt.Errorf("GeoIP disabled: %w", ErrDBNotLoaded)
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.db == nil {
+		return ErrDBNotLoaded
 	}
+	return nil
+}
 
-	record, err := s.db.City(parsedIP)
+// LookupIP 查询 IP 归属地，查询失败时返回空
+// 按 PrivacyLevel 输出完整归属地、只输出国家或不输出
+func (s *GeoIPService) LookupIP(ip string) string {
+	location, err := s.Lookup(ip)
 	if err != nil {
 		s.logger.Debug("failed to lookup IP",
 			zap.String("ip", ip),
 			zap.Error(err))
 		return ""
 	}
+	return location
+}
+
+// Lookup 查询 IP 归属地
+// 返回空字符串且错误为 nil 表示数据库中确实没有该 IP 的位置信息
+func (s *GeoIPService) Lookup(ip string) (string, error) {
+	return s.LookupContext(context.Background(), ip)
+}
 
-	// 获取语言设置，默认使用中文
-	lang := "zh-CN"
-	if s.config.DBLanguage != "" {
-		lang = s.config.DBLanguage
+// LookupContext 查询 IP 归属地，ctx 用于限制在线查询的耗时
+func (s *GeoIPService) LookupContext(ctx context.Context, ip string) (string, error) {
+	// 如果服务未启用
+	if s.config == nil || !s.config.Enabled {
+		return "", ErrDBNotLoaded
 	}
 
-	// 构建位置信息：国家-省份-城市
-	var location string
-
-	// 国家
-	if country, ok := record.Country.Names[lang]; ok && country != "" {
-		location = country
-	} else if record.Country.Names["en"] != "" {
-		location = record.Country.Names["en"]
-	}
-
-	// 省份/州
-	if len(record.Subdivisions) > 0 {
-		if subdivision, ok := record.Subdivisions[0].Names[lang]; ok && subdivision != "" {
-			if location != "" {
-				location += "-" + subdivision
-			} else {
-				location = subdivision
+	// 跳过私有IP
+	if s.isPrivate(ip) {
+		return "内网IP", nil
+	}
+
+	entry, err := s.cachedLookup(ctx, ip)
+	return s.present(entry), err
+}
+
+// LookupCoordinates 查询 IP 的经纬度，用于在地图上展示登录来源
+// 内网 IP、无法解析的 IP、查询失败、数据库中没有该 IP 的位置数据或 PrivacyLevel 不是 full 时 ok 为 false；
+// 与 LookupIP 共用缓存，一次查询同时缓存归属地和经纬度
+func (s *GeoIPService) LookupCoordinates(ip string) (lat, lon float64, ok bool) {
+	if s.config == nil || !s.config.Enabled || s.isPrivate(ip) || s.privacyLevel() != GeoIPPrivacyFull {
+		return 0, 0, false
+	}
+
+	entry, err := s.cachedLookup(context.Background(), ip)
+	if err != nil {
+		s.logger.Debug("failed to lookup IP coordinates",
+			zap.String("ip", ip),
+			zap.Error(err))
+		return 0, 0, false
+	}
+	return entry.Latitude, entry.Longitude, entry.HasCoordinates
+}
+
+// LookupRegion 查询 IP 所在的大洲和国家 (本地化名称，语言回退与 LookupIP 相同)，用于按地区聚合
+// 内网 IP 返回空大洲和 "内网IP"；查询失败或 PrivacyLevel 为 none 时返回空。
+// 在线查询的结果没有大洲
+func (s *GeoIPService) LookupRegion(ip string) (continent, country string) {
+	if s.config == nil || !s.config.Enabled || s.privacyLevel() == GeoIPPrivacyNone {
+		return "", ""
+	}
+	if s.isPrivate(ip) {
+		return "", "内网IP"
+	}
+
+	entry, err := s.cachedLookup(context.Background(), ip)
+	if err != nil {
+		s.logger.Debug("failed to lookup IP region",
+			zap.String("ip", ip),
+			zap.Error(err))
+		return "", ""
+	}
+	return entry.Continent, entry.Country
+}
+
+// cachedLookup 先查询缓存，未命中时查询数据库 (及在线查询)
+func (s *GeoIPService) cachedLookup(ctx context.Context, ip string) (geoIPCacheEntry, error) {
+	metrics := s.metricsRecorder()
+	if entry, ok := s.cache.Get(ip); ok {
+		metrics.IncCacheHit()
+		return entry, nil
+	}
+	metrics.IncCacheMiss()
+
+	start := time.Now()
+	defer func() { metrics.ObserveLookup(time.Since(start)) }()
+	return s.resolve(ctx, ip)
+}
+
+// resolve 查询未命中缓存的 IP，确定的结果写入缓存
+func (s *GeoIPService) resolve(ctx context.Context, ip string) (geoIPCacheEntry, error) {
+	generation := s.databaseGeneration()
+	detail, err := s.lookupDetail(ip)
+
+	// 本地数据库未加载或未命中时尝试在线查询
+	if s.fallback != nil && (err != nil || detail.Location == "") {
+		result, fallbackErr := s.fallback.lookup(ctx, ip)
+		if fallbackErr == nil {
+			entry := geoIPCacheEntry{}
+			if err == nil {
+				// 数据库中可能只有经纬度而没有名称
+				entry = newGeoIPCacheEntry(detail)
 			}
-		} else if record.Subdivisions[0].Names["en"] != "" {
-			if location != "" {
-				location += "-" + record.Subdivisions[0].Names["en"]
-			} else {
-				location = record.Subdivisions[0].Names["en"]
+			entry.Location = result.location()
+			if entry.Country == "" {
+				entry.Country = result.Country
 			}
+			s.addToCache(ip, entry, generation)
+			return entry, nil
+		}
+		s.logger.Debug("GeoIP online fallback failed", zap.String("ip", ip), zap.Error(fallbackErr))
+		if err == nil {
+			// 只返回本地结果，不缓存，以便之后重新尝试在线查询
+			return newGeoIPCacheEntry(detail), nil
+		}
+	}
+
+	if err != nil {
+		// 错误可能是暂时的 (如数据库正在重新加载)，不写入缓存，恢复后重新查询
+		return geoIPCacheEntry{}, err
+	}
+
+	entry := newGeoIPCacheEntry(detail)
+	s.addToCache(ip, entry, generation)
+	return entry, nil
+}
+
+// databaseGeneration 当前的数据库代数
+func (s *GeoIPService) databaseGeneration() uint64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.generation
+}
+
+// addToCache 写入查询结果，查询开始后数据库已被替换时不写入
+// 替换数据库之后才清空缓存，持有读锁检查代数并写入，保证旧数据库的结果不会在清空之后写入
+func (s *GeoIPService) addToCache(ip string, entry geoIPCacheEntry, generation uint64) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.generation == generation {
+		s.cache.Add(ip, entry)
+	}
+}
+
+// LookupIPBatch 批量查询 IP 归属地，返回 IP -> 归属地，查询失败的 IP 归属地为空
+// 输入去重后只获取一次数据库读锁，内网IP和缓存的处理与 LookupIP 相同；
+// 本地数据库未命中且配置了在线查询时逐个回退到 LookupIP 的查询流程
+func (s *GeoIPService) LookupIPBatch(ips []string) map[string]string {
+	results := make(map[string]string, len(ips))
+	if s.config == nil || !s.config.Enabled {
+		for _, ip := range ips {
+			results[ip] = ""
 		}
+		return results
 	}
 
-	// 城市
-	if city, ok := record.City.Names[lang]; ok && city != "" {
-		if location != "" {
-			location += "-" + city
-		} else {
-			location = city
+	metrics := s.metricsRecorder()
+	var misses []string
+	for _, ip := range ips {
+		if _, ok := results[ip]; ok {
+			continue
 		}
-	} else if record.City.Names["en"] != "" {
-		if location != "" {
-			location += "-" + record.City.Names["en"]
-		} else {
-			location = record.City.Names["en"]
+		if s.isPrivate(ip) {
+			results[ip] = "内网IP"
+			continue
 		}
+		if entry, ok := s.cache.Get(ip); ok {
+			metrics.IncCacheHit()
+			results[ip] = s.present(entry)
+			continue
+		}
+		metrics.IncCacheMiss()
+		results[ip] = ""
+		misses = append(misses, ip)
+	}
+	if len(misses) == 0 {
+		return results
 	}
 
-	return location
+	// 需要在线查询的 IP -> 本地查询的耗时，在线查询后一并记录
+	unresolved := make(map[string]time.Duration)
+	s.mu.RLock()
+	for _, ip := range misses {
+		start := time.Now()
+		parsedIP := net.ParseIP(ip)
+		if parsedIP == nil {
+			s.logger.Debug("failed to lookup IP", zap.String("ip", ip), zap.Error(fmt.Errorf("invalid IP address: %s", ip)))
+			metrics.ObserveLookup(time.Since(start))
+			continue
+		}
+		detail, err := s.lookupDetailLocked(parsedIP)
+		if s.fallback != nil && (err != nil || detail.Location == "") {
+			unresolved[ip] = time.Since(start)
+			continue
+		}
+		metrics.ObserveLookup(time.Since(start))
+		if err != nil {
+			// 错误可能是暂时的，不写入缓存
+			continue
+		}
+		entry := newGeoIPCacheEntry(detail)
+		s.cache.Add(ip, entry)
+		results[ip] = s.present(entry)
+	}
+	s.mu.RUnlock()
+
+	for ip, elapsed := range unresolved {
+		start := time.Now()
+		entry, err := s.resolve(context.Background(), ip)
+		metrics.ObserveLookup(elapsed + time.Since(start))
+		if err != nil {
+			s.logger.Debug("failed to lookup IP", zap.String("ip", ip), zap.Error(err))
+		}
+		results[ip] = s.present(entry)
+	}
+	return results
+}
+
+// LookupIPDetail 查询 IP 归属地以及数据库中匹配的网段，结果不经过缓存
+// 调用方可以按 MatchedNetwork 缓存整个网段的结果；各字段按 PrivacyLevel 裁剪
+func (s *GeoIPService) LookupIPDetail(ip string) (*LookupDetail, error) {
+	if s.config == nil || !s.config.Enabled {
+		return nil, ErrDBNotLoaded
+	}
+
+	if s.isPrivate(ip) {
+		return &LookupDetail{Location: "内网IP", IsPrivate: true}, nil
+	}
+
+	detail, err := s.lookupDetail(ip)
+	if err != nil {
+		return nil, err
+	}
+	return s.coarsen(detail), nil
+}
+
+// LookupLocation 查询结构化的 IP 归属地，查询失败时返回 nil
+// LookupIP 返回的 "国家-省份-城市" 需要调用方再拆分且不含 ISO 代码，新代码应使用该方法
+func (s *GeoIPService) LookupLocation(ip string) *GeoLocation {
+	detail, err := s.LookupIPDetail(ip)
+	if err != nil {
+		s.logger.Debug("failed to lookup IP",
+			zap.String("ip", ip),
+			zap.Error(err))
+		return nil
+	}
+	return detail.GeoLocation()
+}
+
+// lookupDetail 从数据库查询归属地
+// 归属地为空且错误为 nil 表示数据库中确实没有该 IP 的位置信息
+func (s *GeoIPService) lookupDetail(ip string) (*LookupDetail, error) {
+	parsedIP := net.ParseIP(ip)
+	if parsedIP == nil {
+		return nil, fmt.Errorf("invalid IP address: %s", ip)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.lookupDetailLocked(parsedIP)
+}
+
+// lookupDetailLocked 从数据库查询归属地，调用方需持有 mu 的读锁
+func (s *GeoIPService) lookupDetailLocked(parsedIP net.IP) (*LookupDetail, error) {
+	if s.db == nil {
+		return nil, ErrDBNotLoaded
+	}
+
+	record, network, err := s.db.City(parsedIP)
+	if err != nil {
+		return nil, err
+	}
+
+	detail := &LookupDetail{
+		Latitude:       record.Location.Latitude,
+		Longitude:      record.Location.Longitude,
+		MatchedNetwork: network,
+	}
+	s.fillNames(detail, record)
+	return detail, nil
+}
+
+// LookupASN 查询 IP 所属的自治系统编号和组织名称
+// ASN 数据库未配置、内网 IP 或查询失败时返回 0 和空字符串
+func (s *GeoIPService) LookupASN(ip string) (uint, string) {
+	if s.config == nil || !s.config.Enabled || s.isPrivate(ip) {
+		return 0, ""
+	}
+	parsedIP := net.ParseIP(ip)
+	if parsedIP == nil {
+		return 0, ""
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.asn == nil {
+		return 0, ""
+	}
+	record, err := s.asn.ASN(parsedIP)
+	if err != nil {
+		s.logger.Debug("failed to lookup ASN",
+			zap.String("ip", ip),
+			zap.Error(err))
+		return 0, ""
+	}
+	return record.AutonomousSystemNumber, record.AutonomousSystemOrganization
+}
+
+// languageChain 名称的语言优先顺序: DBLanguage (默认中文)、DBLanguageFallbacks，最后是英文
+// 返回新的切片，不修改配置中的 DBLanguageFallbacks
+func languageChain(cfg *config.GeoIPConfig) []string {
+	chain := []string{"zh-CN"}
+	var fallbacks []string
+	if cfg != nil {
+		if cfg.DBLanguage != "" {
+			chain[0] = cfg.DBLanguage
+		}
+		fallbacks = cfg.DBLanguageFallbacks
+	}
+	for _, language := range fallbacks {
+		if language != "" && !slices.Contains(chain, language) {
+			chain = append(chain, language)
+		}
+	}
+	if !slices.Contains(chain, "en") {
+		chain = append(chain, "en")
+	}
+	return chain
+}
+
+// localizedName 按语言优先顺序取第一个非空的名称，各字段 (国家、省份、城市) 分别回退
+func (s *GeoIPService) localizedName(names map[string]string) string {
+	for _, language := range s.languages {
+		if name := names[language]; name != "" {
+			return name
+		}
+	}
+	return ""
+}
+
+// fillNames 填充本地化名称和语言无关的 ISO 代码
+func (s *GeoIPService) fillNames(detail *LookupDetail, record *geoip2.City) {
+	detail.ContinentCode = record.Continent.Code
+	detail.ContinentName = s.localizedName(record.Continent.Names)
+	detail.CountryCode = record.Country.IsoCode
+	detail.CountryName = s.localizedName(record.Country.Names)
+	for _, subdivision := range record.Subdivisions {
+		detail.SubdivisionCodes = append(detail.SubdivisionCodes, subdivision.IsoCode)
+		detail.SubdivisionNames = append(detail.SubdivisionNames, s.localizedName(subdivision.Names))
+	}
+	detail.CityName = s.localizedName(record.City.Names)
+
+	// 构建位置信息：国家-省份-城市
+	var parts []string
+	if detail.CountryName != "" {
+		parts = append(parts, detail.CountryName)
+	}
+	if len(detail.SubdivisionNames) > 0 && detail.SubdivisionNames[0] != "" {
+		parts = append(parts, detail.SubdivisionNames[0])
+	}
+	if detail.CityName != "" {
+		parts = append(parts, detail.CityName)
+	}
+	detail.Location = strings.Join(parts, "-")
 }
 
-// Close 关闭数据库连接
+// watchDatabase 监控数据库文件，文件修改时间变化后自动重新加载
+// 监控所在目录而不是文件本身：geoipupdate 等工具通过重命名替换文件，文件本身的监控会失效
+func (s *GeoIPService) watchDatabase() error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	if err := watcher.Add(filepath.Dir(s.config.DBPath)); err != nil {
+		_ = watcher.Close()
+		return err
+	}
+	s.watcher = watcher
+	go s.watchLoop(watcher, filepath.Clean(s.config.DBPath))
+	return nil
+}
+
+// watchLoop 处理数据库文件的变化，监控器关闭后退出
+func (s *GeoIPService) watchLoop(watcher *fsnotify.Watcher, path string) {
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			if filepath.Clean(event.Name) != path || !event.Has(fsnotify.Create|fsnotify.Write|fsnotify.Rename|fsnotify.Chmod) {
+				continue
+			}
+			// 文件可能仍在写入，打开失败时保留旧数据库，等待后续事件重试
+			if _, err := s.ReloadIfChanged(); err != nil {
+				s.logger.Debug("GeoIP database not reloaded", zap.String("path", path), zap.Error(err))
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			s.logger.Warn("GeoIP database watcher error", zap.Error(err))
+		}
+	}
+}
+
+// Close 关闭数据库连接，之后的查询返回 ErrDBNotLoaded，数据库文件变化时也不再重新加载
 func (s *GeoIPService) Close() error {
+	if s.watcher != nil {
+		_ = s.watcher.Close()
+	}
+
+	// 在写锁内关闭并置空，查询在读锁内检查 nil，不会使用已关闭的数据库
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	s.closed = true
 
+	if s.asn != nil {
+		_ = s.asn.Close()
+		s.asn = nil
+	}
 	if s.db != nil {
-		return s.db.Close()
+		db := s.db
+		s.db = nil
+		return db.Close()
 	}
 	return nil
 }
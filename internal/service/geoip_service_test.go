@@ -0,0 +1,701 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dushixiang/pika/internal/config"
+	"github.com/oschwald/geoip2-golang"
+	"go.uber.org/zap"
+)
+
+// fakeGeoIPReader 可控制返回结果的 GeoIP 数据库
+type fakeGeoIPReader struct {
+	cities map[string]*geoip2.City
+	err    error
+	calls  int
+
+	// 按网段匹配的记录 (cities 中不存在时使用)
+	networks map[string]*geoip2.City
+}
+
+func (r *fakeGeoIPReader) City(ip net.IP) (*geoip2.City, *net.IPNet, error) {
+	r.calls++
+	if r.err != nil {
+		return nil, nil, r.err
+	}
+	if city, ok := r.cities[ip.String()]; ok {
+		return city, nil, nil
+	}
+	for cidr, city := range r.networks {
+		if _, network, err := net.ParseCIDR(cidr); err == nil && network.Contains(ip) {
+			return city, network, nil
+		}
+	}
+	// 数据库中不存在时返回空记录
+	return &geoip2.City{}, nil, nil
+}
+
+func (r *fakeGeoIPReader) Close() error {
+	return nil
+}
+
+// fakeASNReader 固定返回结果的 ASN 数据库
+type fakeASNReader struct {
+	records map[string]*geoip2.ASN
+}
+
+func (r *fakeASNReader) ASN(ip net.IP) (*geoip2.ASN, error) {
+	if record, ok := r.records[ip.String()]; ok {
+		return record, nil
+	}
+	return &geoip2.ASN{}, nil
+}
+
+func (r *fakeASNReader) Close() error {
+	return nil
+}
+
+func newTestCity(country string) *geoip2.City {
+	city := &geoip2.City{}
+	city.Country.Names = map[string]string{"en": country}
+	return city
+}
+
+func newTestGeoIPService(reader geoIPReader) *GeoIPService {
+	cfg := &config.GeoIPConfig{Enabled: true, DBLanguage: "en"}
+	s := &GeoIPService{
+		logger:    zap.NewNop(),
+		config:    cfg,
+		cache:     newLRUCache[string, geoIPCacheEntry](16),
+		languages: languageChain(cfg),
+	}
+	if reader != nil {
+		s.db = reader
+	}
+	return s
+}
+
+func TestLookupIPDoesNotCacheErrors(t *testing.T) {
+	s := newTestGeoIPService(nil)
+
+	// 数据库正在重新加载
+	if got := s.LookupIP("8.8.8.8"); got != "" {
+		t.Fatalf("数据库未加载时应返回空, 实际 %q", got)
+	}
+	if s.cache.Len() != 0 {
+		t.Fatal("ErrDBNotLoaded 不应写入缓存")
+	}
+
+	// 重新加载过程中发生 I/O 错误
+	reader := &fakeGeoIPReader{
+		cities: map[string]*geoip2.City{"8.8.8.8": newTestCity("United States")},
+		err:    errors.New("read /data/GeoLite2-City.mmdb: input/output error"),
+	}
+	s.mu.Lock()
+	s.db = reader
+	s.mu.Unlock()
+
+	if got := s.LookupIP("8.8.8.8"); got != "" {
+		t.Fatalf("查询出错时应返回空, 实际 %q", got)
+	}
+	if s.cache.Len() != 0 {
+		t.Fatal("I/O 错误不应写入缓存")
+	}
+
+	// 恢复后应重新解析
+	reader.err = nil
+	if got := s.LookupIP("8.8.8.8"); got != "United States" {
+		t.Fatalf("恢复后应解析出归属地, 实际 %q", got)
+	}
+
+	// 确定的结果 (包括数据库中不存在) 应被缓存
+	if got := s.LookupIP("203.0.113.1"); got != "" {
+		t.Fatalf("数据库中不存在的 IP 应返回空, 实际 %q", got)
+	}
+	calls := reader.calls
+	s.LookupIP("8.8.8.8")
+	s.LookupIP("203.0.113.1")
+	if reader.calls != calls {
+		t.Errorf("已缓存的结果不应再次查询数据库, 新增查询 %d 次", reader.calls-calls)
+	}
+}
+
+func TestLookupIPDetailMatchedNetwork(t *testing.T) {
+	reader := &fakeGeoIPReader{
+		networks: map[string]*geoip2.City{"45.148.0.0/16": newTestCity("Netherlands")},
+	}
+	s := newTestGeoIPService(reader)
+
+	first, err := s.LookupIPDetail("45.148.10.81")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := s.LookupIPDetail("45.148.200.3")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if first.MatchedNetwork == nil || second.MatchedNetwork == nil {
+		t.Fatal("应返回匹配的网段")
+	}
+	if first.MatchedNetwork.String() != "45.148.0.0/16" || first.MatchedNetwork.String() != second.MatchedNetwork.String() {
+		t.Errorf("同一网段的 IP 应返回相同的网段: %s, %s", first.MatchedNetwork, second.MatchedNetwork)
+	}
+	if first.Location != "Netherlands" || second.Location != first.Location {
+		t.Errorf("归属地 = %q, %q", first.Location, second.Location)
+	}
+
+	// 内网 IP 不查询数据库，没有网段
+	private, err := s.LookupIPDetail("10.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if private.MatchedNetwork != nil {
+		t.Errorf("内网 IP 不应返回网段: %s", private.MatchedNetwork)
+	}
+}
+
+func TestLookupIPDetailCodesAreLanguageInvariant(t *testing.T) {
+	city := &geoip2.City{}
+	city.Country.IsoCode = "DE"
+	city.Country.Names = map[string]string{"en": "Germany", "zh-CN": "德国"}
+	city.Subdivisions = append(city.Subdivisions, struct {
+		Names     map[string]string `maxminddb:"names"`
+		IsoCode   string            `maxminddb:"iso_code"`
+		GeoNameID uint              `maxminddb:"geoname_id"`
+	}{Names: map[string]string{"en": "Hesse", "zh-CN": "黑森州"}, IsoCode: "HE"})
+	city.City.Names = map[string]string{"en": "Frankfurt am Main"}
+
+	reader := &fakeGeoIPReader{cities: map[string]*geoip2.City{"203.0.113.1": city}}
+
+	var details []*LookupDetail
+	for _, lang := range []string{"en", "zh-CN"} {
+		s := newTestGeoIPService(reader)
+		s.config.DBLanguage = lang
+		s.languages = languageChain(s.config)
+		detail, err := s.LookupIPDetail("203.0.113.1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		details = append(details, detail)
+	}
+
+	en, zh := details[0], details[1]
+	if en.CountryCode != "DE" || zh.CountryCode != en.CountryCode {
+		t.Errorf("国家代码应与语言无关: %q, %q", en.CountryCode, zh.CountryCode)
+	}
+	if len(zh.SubdivisionCodes) != 1 || zh.SubdivisionCodes[0] != "HE" || en.SubdivisionCodes[0] != "HE" {
+		t.Errorf("行政区代码应与语言无关: %v, %v", en.SubdivisionCodes, zh.SubdivisionCodes)
+	}
+
+	if en.Location != "Germany-Hesse-Frankfurt am Main" {
+		t.Errorf("英文归属地 = %q", en.Location)
+	}
+	// 缺少对应语言的城市名称时回退到英文
+	if zh.Location != "德国-黑森州-Frankfurt am Main" {
+		t.Errorf("中文归属地 = %q", zh.Location)
+	}
+}
+
+func TestLookupLocation(t *testing.T) {
+	city := newTestCity("Germany")
+	city.Country.IsoCode = "DE"
+	city.Subdivisions = append(city.Subdivisions, struct {
+		Names     map[string]string `maxminddb:"names"`
+		IsoCode   string            `maxminddb:"iso_code"`
+		GeoNameID uint              `maxminddb:"geoname_id"`
+	}{Names: map[string]string{"en": "Hesse"}, IsoCode: "HE"})
+	city.City.Names = map[string]string{"en": "Frankfurt am Main"}
+	city.Location.Latitude = 50.1188
+	city.Location.Longitude = 8.6843
+
+	s := newTestGeoIPService(&fakeGeoIPReader{cities: map[string]*geoip2.City{"203.0.113.1": city}})
+
+	location := s.LookupLocation("203.0.113.1")
+	want := GeoLocation{
+		Country:        "Germany",
+		CountryISOCode: "DE",
+		Subdivision:    "Hesse",
+		City:           "Frankfurt am Main",
+		Latitude:       50.1188,
+		Longitude:      8.6843,
+	}
+	if location == nil || *location != want {
+		t.Fatalf("LookupLocation = %+v, 期望 %+v", location, want)
+	}
+	// 旧接口的结果不变
+	if got := s.LookupIP("203.0.113.1"); got != "Germany-Hesse-Frankfurt am Main" {
+		t.Errorf("LookupIP = %q", got)
+	}
+
+	private := s.LookupLocation("192.168.1.10")
+	if private == nil || !private.IsPrivate || private.Country != "" {
+		t.Errorf("内网 IP 应标记 IsPrivate: %+v", private)
+	}
+
+	// 数据库未加载时返回 nil
+	if got := newTestGeoIPService(nil).LookupLocation("8.8.8.8"); got != nil {
+		t.Errorf("数据库未加载时应返回 nil, 实际 %+v", got)
+	}
+}
+
+func TestGeoIPCacheSize(t *testing.T) {
+	s, err := NewGeoIPService(zap.NewNop(), &config.AppConfig{GeoIP: &config.GeoIPConfig{Enabled: true, CacheSize: 2}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader := &fakeGeoIPReader{}
+	s.db = reader
+
+	for _, ip := range []string{"203.0.113.1", "203.0.113.2", "203.0.113.3"} {
+		s.LookupIP(ip)
+	}
+	if s.cache.Len() != 2 {
+		t.Fatalf("缓存条目数应受 CacheSize 限制, 实际 %d", s.cache.Len())
+	}
+
+	// 最早的条目已被淘汰，需要重新查询
+	calls := reader.calls
+	s.LookupIP("203.0.113.1")
+	if reader.calls != calls+1 {
+		t.Error("被淘汰的条目应重新查询数据库")
+	}
+
+	if got := geoIPCacheSize(nil); got != defaultGeoIPCacheSize {
+		t.Errorf("未配置时缓存条目数 = %d", got)
+	}
+}
+
+func TestReloadKeepsOldDatabaseOnFailure(t *testing.T) {
+	reader := &fakeGeoIPReader{cities: map[string]*geoip2.City{"8.8.8.8": newTestCity("United States")}}
+	s := newTestGeoIPService(reader)
+
+	// 新的数据库文件损坏 (如下载中断)
+	s.config.DBPath = filepath.Join(t.TempDir(), "GeoLite2-City.mmdb")
+	if err := os.WriteFile(s.config.DBPath, []byte("not a maxmind database"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	reloaded := false
+	s.OnReload(func() { reloaded = true })
+
+	if err := s.Reload(); err == nil {
+		t.Fatal("数据库文件无法打开时应返回错误")
+	}
+	if reloaded {
+		t.Error("重新加载失败时不应执行回调")
+	}
+	if got := s.LookupIP("8.8.8.8"); got != "United States" {
+		t.Errorf("重新加载失败后应继续使用旧数据库, 实际 %q", got)
+	}
+}
+
+// reloadingGeoIPReader 查询之后模拟数据库被替换 (替换数据库并清空缓存)
+type reloadingGeoIPReader struct {
+	geoIPReader
+	reload func()
+}
+
+func (r *reloadingGeoIPReader) City(ip net.IP) (*geoip2.City, *net.IPNet, error) {
+	city, network, err := r.geoIPReader.City(ip)
+	if r.reload != nil {
+		r.reload()
+		r.reload = nil
+	}
+	return city, network, err
+}
+
+func TestResolveSkipsCacheAfterReload(t *testing.T) {
+	reader := &reloadingGeoIPReader{geoIPReader: &fakeGeoIPReader{cities: map[string]*geoip2.City{"8.8.8.8": newTestCity("United States")}}}
+	s := newTestGeoIPService(reader)
+	// 查询持有读锁，此处直接修改代数，等同于查询返回后 installDatabase 和 reloadLocked 完成
+	reader.reload = func() {
+		s.generation++
+		s.cache.Purge()
+	}
+
+	if got := s.LookupIP("8.8.8.8"); got != "United States" {
+		t.Fatalf("LookupIP = %q", got)
+	}
+	if s.cache.Len() != 0 {
+		t.Error("旧数据库的查询结果不应写入缓存")
+	}
+
+	// 数据库未再替换时正常缓存
+	s.LookupIP("8.8.8.8")
+	if s.cache.Len() != 1 {
+		t.Error("查询结果应写入缓存")
+	}
+}
+
+func TestLookupASN(t *testing.T) {
+	s := newTestGeoIPService(&fakeGeoIPReader{})
+
+	// 未配置 ASN 数据库
+	if number, org := s.LookupASN("8.8.8.8"); number != 0 || org != "" {
+		t.Fatalf("未配置 ASN 数据库时应返回空, 实际 %d %q", number, org)
+	}
+
+	s.asn = &fakeASNReader{records: map[string]*geoip2.ASN{
+		"8.8.8.8": {AutonomousSystemNumber: 15169, AutonomousSystemOrganization: "GOOGLE"},
+	}}
+	if number, org := s.LookupASN("8.8.8.8"); number != 15169 || org != "GOOGLE" {
+		t.Errorf("LookupASN = %d %q", number, org)
+	}
+	if number, _ := s.LookupASN("10.0.0.1"); number != 0 {
+		t.Errorf("内网 IP 不应查询 ASN, 实际 %d", number)
+	}
+	if number, _ := s.LookupASN("not-an-ip"); number != 0 {
+		t.Errorf("无效 IP 应返回 0, 实际 %d", number)
+	}
+}
+
+func TestExtraPrivateRanges(t *testing.T) {
+	cfg := &config.GeoIPConfig{Enabled: true, ExtraPrivateRanges: []string{"203.0.113.0/24", "not-a-cidr", " 2001:db8::/32 "}}
+	s, err := NewGeoIPService(zap.NewNop(), &config.AppConfig{GeoIP: cfg})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.extraPrivateRanges) != 2 {
+		t.Fatalf("无效的网段应被跳过, 实际 %v", s.extraPrivateRanges)
+	}
+	reader := &fakeGeoIPReader{}
+	s.db = reader
+
+	for _, ip := range []string{"203.0.113.9", "2001:db8::1", "10.1.2.3"} {
+		if got := s.LookupIP(ip); got != "内网IP" {
+			t.Errorf("LookupIP(%s) = %q, 期望内网IP", ip, got)
+		}
+	}
+	if reader.calls != 0 {
+		t.Errorf("内网IP不应查询数据库, 查询了 %d 次", reader.calls)
+	}
+	if s.LookupIP("198.51.100.1"); reader.calls != 1 {
+		t.Error("配置以外的公网IP应查询数据库")
+	}
+}
+
+func TestLookupIPBatch(t *testing.T) {
+	reader := &fakeGeoIPReader{cities: map[string]*geoip2.City{
+		"8.8.8.8": newTestCity("United States"),
+		"1.1.1.1": newTestCity("Australia"),
+	}}
+	s := newTestGeoIPService(reader)
+	s.LookupIP("1.1.1.1")
+	calls := reader.calls
+
+	got := s.LookupIPBatch([]string{"8.8.8.8", "8.8.8.8", "10.0.0.1", "1.1.1.1", "203.0.113.1", "bogus"})
+	want := map[string]string{
+		"8.8.8.8":     "United States",
+		"10.0.0.1":    "内网IP",
+		"1.1.1.1":     "Australia",
+		"203.0.113.1": "",
+		"bogus":       "",
+	}
+	if !maps.Equal(got, want) {
+		t.Fatalf("LookupIPBatch = %v", got)
+	}
+	// 重复的 IP 只查询一次，内网IP和已缓存的 IP 不查询数据库
+	if reader.calls-calls != 2 {
+		t.Errorf("应只查询 2 个未缓存的 IP, 实际 %d 次", reader.calls-calls)
+	}
+	// 确定的结果写入缓存，与 LookupIP 共享
+	if _, ok := s.cache.Get("8.8.8.8"); !ok {
+		t.Error("批量查询的结果应写入缓存")
+	}
+
+	// 查询出错时不缓存
+	reader.err = errors.New("input/output error")
+	if got := s.LookupIPBatch([]string{"9.9.9.9"}); got["9.9.9.9"] != "" {
+		t.Errorf("查询出错时应返回空, 实际 %q", got["9.9.9.9"])
+	}
+	if _, ok := s.cache.Get("9.9.9.9"); ok {
+		t.Error("查询出错的结果不应写入缓存")
+	}
+}
+
+type fakeGeoIPMetricsRecorder struct {
+	hits, misses, lookups int
+}
+
+func (r *fakeGeoIPMetricsRecorder) IncCacheHit()                { r.hits++ }
+func (r *fakeGeoIPMetricsRecorder) IncCacheMiss()               { r.misses++ }
+func (r *fakeGeoIPMetricsRecorder) ObserveLookup(time.Duration) { r.lookups++ }
+
+func TestGeoIPMetricsRecorder(t *testing.T) {
+	reader := &fakeGeoIPReader{cities: map[string]*geoip2.City{
+		"8.8.8.8": newTestCity("United States"),
+		"1.1.1.1": newTestCity("Australia"),
+	}}
+	s := newTestGeoIPService(reader)
+
+	// 未设置时不记录
+	s.LookupIP("8.8.8.8")
+
+	recorder := &fakeGeoIPMetricsRecorder{}
+	s.SetMetricsRecorder(recorder)
+	s.LookupIP("8.8.8.8")
+	s.LookupIP("10.0.0.1")
+	if recorder.hits != 1 || recorder.misses != 0 || recorder.lookups != 0 {
+		t.Errorf("命中缓存和内网IP不应查询: %+v", recorder)
+	}
+
+	s.LookupIPBatch([]string{"8.8.8.8", "1.1.1.1", "1.1.1.1", "203.0.113.1"})
+	if recorder.hits != 2 || recorder.misses != 2 || recorder.lookups != 2 {
+		t.Errorf("批量查询 = %+v", recorder)
+	}
+}
+
+func TestLanguageFallbackChain(t *testing.T) {
+	city := &geoip2.City{}
+	city.Country.Names = map[string]string{"en": "Japan", "ja": "日本", "zh-CN": "日本国"}
+	city.Subdivisions = append(city.Subdivisions, struct {
+		Names     map[string]string `maxminddb:"names"`
+		IsoCode   string            `maxminddb:"iso_code"`
+		GeoNameID uint              `maxminddb:"geoname_id"`
+	}{Names: map[string]string{"en": "Osaka", "zh-CN": "大阪府"}})
+	city.City.Names = map[string]string{"en": "Sakai", "fr": "Sakaï"}
+
+	s := newTestGeoIPService(&fakeGeoIPReader{cities: map[string]*geoip2.City{"203.0.113.1": city}})
+	// 容量大于长度，追加到配置切片上会改写其底层数组
+	fallbacks := make([]string, 3, 4)
+	copy(fallbacks, []string{"zh-CN", "", "ja"})
+	s.config.DBLanguage = "ja"
+	s.config.DBLanguageFallbacks = fallbacks
+	s.languages = languageChain(s.config)
+
+	// 各字段分别按 ja -> zh-CN -> en 回退
+	if got := s.LookupIP("203.0.113.1"); got != "日本-大阪府-Sakai" {
+		t.Errorf("归属地 = %q", got)
+	}
+	if got := s.languages; !slices.Equal(got, []string{"ja", "zh-CN", "en"}) {
+		t.Errorf("语言顺序 = %v", got)
+	}
+	if extra := fallbacks[:4][3]; extra != "" || len(s.config.DBLanguageFallbacks) != 3 {
+		t.Errorf("计算语言顺序不应修改配置: %q", extra)
+	}
+	if got := languageChain(nil); !slices.Equal(got, []string{"zh-CN", "en"}) {
+		t.Errorf("未配置时语言顺序 = %v", got)
+	}
+}
+
+func TestLookupCoordinates(t *testing.T) {
+	located := newTestCity("Germany")
+	located.Location.Latitude = 50.1188
+	located.Location.Longitude = 8.6843
+	reader := &fakeGeoIPReader{cities: map[string]*geoip2.City{
+		"203.0.113.1": located,
+		"203.0.113.2": newTestCity("Germany"),
+	}}
+	s := newTestGeoIPService(reader)
+
+	lat, lon, ok := s.LookupCoordinates("203.0.113.1")
+	if !ok || lat != 50.1188 || lon != 8.6843 {
+		t.Fatalf("LookupCoordinates = %v, %v, %v", lat, lon, ok)
+	}
+	// 与 LookupIP 共用缓存，不再查询数据库
+	if got := s.LookupIP("203.0.113.1"); got != "Germany" || reader.calls != 1 {
+		t.Errorf("LookupIP = %q, 数据库查询 %d 次", got, reader.calls)
+	}
+	s.LookupIP("203.0.113.2")
+	if _, _, ok := s.LookupCoordinates("203.0.113.2"); ok || reader.calls != 2 {
+		t.Errorf("数据库中没有位置数据时 ok 应为 false, 数据库查询 %d 次", reader.calls)
+	}
+
+	for _, ip := range []string{"192.168.1.10", "not-an-ip"} {
+		if _, _, ok := s.LookupCoordinates(ip); ok {
+			t.Errorf("%s: ok 应为 false", ip)
+		}
+	}
+	if _, _, ok := newTestGeoIPService(nil).LookupCoordinates("8.8.8.8"); ok {
+		t.Error("数据库未加载时 ok 应为 false")
+	}
+}
+
+// closingGeoIPReader 关闭后再查询时 panic，模拟 mmdb 读取已解除映射的文件
+type closingGeoIPReader struct {
+	closed atomic.Bool
+}
+
+func (r *closingGeoIPReader) City(ip net.IP) (*geoip2.City, *net.IPNet, error) {
+	if r.closed.Load() {
+		panic("lookup on closed GeoIP database")
+	}
+	return newTestCity("Germany"), nil, nil
+}
+
+func (r *closingGeoIPReader) Close() error {
+	r.closed.Store(true)
+	return nil
+}
+
+func TestConcurrentLookupAndClose(t *testing.T) {
+	for round := 0; round < 20; round++ {
+		reader := &closingGeoIPReader{}
+		s := newTestGeoIPService(reader)
+		s.asn = &fakeASNReader{}
+
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 50; j++ {
+					ip := fmt.Sprintf("203.0.113.%d", j)
+					s.LookupIP(ip)
+					s.LookupCoordinates(ip)
+					s.LookupASN(ip)
+					s.LookupIPBatch([]string{ip, "198.51.100.1"})
+				}
+			}()
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := s.Close(); err != nil {
+				t.Error(err)
+			}
+		}()
+		wg.Wait()
+
+		if !reader.closed.Load() {
+			t.Fatal("数据库应已关闭")
+		}
+		// 关闭后的查询返回数据库未加载
+		if _, err := s.lookupDetail("192.0.2.1"); !errors.Is(err, ErrDBNotLoaded) {
+			t.Errorf("关闭后查询的错误 = %v", err)
+		}
+	}
+}
+
+func TestLookupRegionAndPrivacyLevel(t *testing.T) {
+	city := newTestCity("Japan")
+	city.Country.IsoCode = "JP"
+	city.Continent.Code = "AS"
+	city.Continent.Names = map[string]string{"en": "Asia", "zh-CN": "亚洲"}
+	city.Subdivisions = append(city.Subdivisions, struct {
+		Names     map[string]string `maxminddb:"names"`
+		IsoCode   string            `maxminddb:"iso_code"`
+		GeoNameID uint              `maxminddb:"geoname_id"`
+	}{Names: map[string]string{"en": "Tokyo"}, IsoCode: "13"})
+	city.City.Names = map[string]string{"en": "Shinjuku"}
+	city.Location.Latitude, city.Location.Longitude = 35.69, 139.69
+	reader := &fakeGeoIPReader{cities: map[string]*geoip2.City{"203.0.113.1": city}}
+
+	s := newTestGeoIPService(reader)
+	if continent, country := s.LookupRegion("203.0.113.1"); continent != "Asia" || country != "Japan" {
+		t.Fatalf("LookupRegion = (%q, %q)", continent, country)
+	}
+	if continent, country := s.LookupRegion("10.0.0.1"); continent != "" || country != "内网IP" {
+		t.Fatalf("内网IP LookupRegion = (%q, %q)", continent, country)
+	}
+	if got := s.LookupIP("203.0.113.1"); got != "Japan-Tokyo-Shinjuku" {
+		t.Fatalf("full 应输出完整归属地, 实际 %q", got)
+	}
+
+	// 缓存的完整结果按输出精度裁剪
+	s.config.PrivacyLevel = GeoIPPrivacyCountry
+	if got := s.LookupIP("203.0.113.1"); got != "Japan" {
+		t.Fatalf("country 应只输出国家, 实际 %q", got)
+	}
+	if got := s.LookupIPBatch([]string{"203.0.113.1"})["203.0.113.1"]; got != "Japan" {
+		t.Fatalf("批量查询 country 应只输出国家, 实际 %q", got)
+	}
+	if _, _, ok := s.LookupCoordinates("203.0.113.1"); ok {
+		t.Fatal("country 不应输出经纬度")
+	}
+	location := s.LookupLocation("203.0.113.1")
+	if location == nil || location.Country != "Japan" || location.CountryISOCode != "JP" ||
+		location.Subdivision != "" || location.City != "" || location.Latitude != 0 {
+		t.Fatalf("country 结构化归属地 = %+v", location)
+	}
+	if continent, country := s.LookupRegion("203.0.113.1"); continent != "Asia" || country != "Japan" {
+		t.Fatalf("country LookupRegion = (%q, %q)", continent, country)
+	}
+
+	for _, level := range []string{GeoIPPrivacyNone, "bogus"} {
+		s.config.PrivacyLevel = level
+		if got := s.LookupIP("203.0.113.1"); got != "" {
+			t.Fatalf("%s 不应输出归属地, 实际 %q", level, got)
+		}
+		if continent, country := s.LookupRegion("203.0.113.1"); continent != "" || country != "" {
+			t.Fatalf("%s LookupRegion = (%q, %q)", level, continent, country)
+		}
+		if location := s.LookupLocation("203.0.113.1"); location == nil || location.Country != "" {
+			t.Fatalf("%s 结构化归属地 = %+v", level, location)
+		}
+	}
+	if got := s.LookupIP("10.0.0.1"); got != "内网IP" {
+		t.Fatalf("内网IP不受输出精度影响, 实际 %q", got)
+	}
+}
+
+func TestGeoIPDatabaseType(t *testing.T) {
+	for _, tt := range []struct {
+		databaseType string
+		countryOnly  bool
+		supported    bool
+	}{
+		{"GeoLite2-City", false, true},
+		{"GeoIP2-City-Asia-Pacific", false, true},
+		{"GeoIP2-Enterprise", false, true},
+		{"DBIP-Location (compat=City)", false, true},
+		{"GeoLite2-Country", true, true},
+		{"DBIP-Country-Lite", true, true},
+		{"GeoLite2-ASN", false, false},
+		{"GeoIP2-Anonymous-IP", false, false},
+	} {
+		countryOnly, err := isCountryOnlyDatabase(tt.databaseType)
+		if (err == nil) != tt.supported || countryOnly != tt.countryOnly {
+			t.Errorf("%s: countryOnly = %v, err = %v", tt.databaseType, countryOnly, err)
+		}
+	}
+
+	// 国家数据库的记录只输出国家
+	country := &geoip2.Country{}
+	country.Country.IsoCode = "JP"
+	country.Country.Names = map[string]string{"en": "Japan"}
+	country.Continent.Names = map[string]string{"en": "Asia"}
+	city := cityFromCountry(country)
+	s := newTestGeoIPService(&fakeGeoIPReader{cities: map[string]*geoip2.City{"203.0.113.1": city}})
+	detail, err := s.LookupIPDetail("203.0.113.1")
+	if err != nil || detail.Location != "Japan" || detail.CountryCode != "JP" || detail.ContinentName != "Asia" || detail.CityName != "" {
+		t.Fatalf("国家数据库查询结果 = %+v, %v", detail, err)
+	}
+}
+
+func TestGeoIPServiceFromBytes(t *testing.T) {
+	cfg := &config.AppConfig{GeoIP: &config.GeoIPConfig{Enabled: true, DBLanguage: "en"}}
+	if _, err := NewGeoIPServiceFromBytes(zap.NewNop(), []byte("not a maxmind database"), cfg); err == nil {
+		t.Fatal("数据无效时应返回错误")
+	}
+
+	// 未启用时不加载数据库
+	s, err := NewGeoIPServiceFromBytes(zap.NewNop(), nil, &config.AppConfig{GeoIP: &config.GeoIPConfig{}})
+	if err != nil || !errors.Is(s.Status(), ErrDBNotLoaded) {
+		t.Fatalf("未启用时 = %v, %v", s, err)
+	}
+
+	// 内存中的数据库无法重新加载，继续使用已加载的数据库
+	s = newTestGeoIPService(&fakeGeoIPReader{cities: map[string]*geoip2.City{"8.8.8.8": newTestCity("United States")}})
+	s.inMemory = true
+	s.config.DBPath = filepath.Join(t.TempDir(), "GeoLite2-City.mmdb")
+	if err := s.Reload(); !errors.Is(err, ErrInMemoryDatabase) {
+		t.Errorf("Reload = %v", err)
+	}
+	if changed, err := s.ReloadIfChanged(); changed || err != nil {
+		t.Errorf("ReloadIfChanged = %v, %v", changed, err)
+	}
+	if got := s.LookupIP("8.8.8.8"); got != "United States" {
+		t.Errorf("查询结果 = %q", got)
+	}
+}
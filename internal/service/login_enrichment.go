@@ -0,0 +1,278 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dushixiang/pika/internal/protocol"
+)
+
+const (
+	// 默认并发查询数
+	defaultEnrichWorkers = 8
+
+	// 默认单次查询超时
+	defaultEnrichLookupTimeout = 2 * time.Second
+)
+
+// LoginEnricher 根据来源 IP 补充登录记录的字段
+// 实现必须是幂等的：只覆盖自己负责的字段，对同一条记录重复执行结果不变；
+// 查询失败或 ctx 超时时保持字段原值，避免重新处理时破坏已补充的数据
+type LoginEnricher interface {
+	Enrich(ctx context.Context, ip string, fields EnrichFields)
+}
+
+// EnrichFields 登录记录中可被补充的字段
+type EnrichFields struct {
+	Location *string
+	Hostname *string
+}
+
+// EnrichOptions 补充阶段的并发设置
+type EnrichOptions struct {
+	Workers       int           // 最大并发查询数，<=1 时串行执行
+	LookupTimeout time.Duration // 单个 IP 的查询超时，0 表示不限制
+}
+
+// LoginEnrichment 使用有限的并发对登录记录执行补充
+// 同一 IP 的记录由同一个 worker 依次处理，第一条查询后其余记录命中缓存，
+// 不会因为并发而对同一 IP 重复发起在线查询
+type LoginEnrichment struct {
+	enrichers []LoginEnricher
+	options   EnrichOptions
+}
+
+func NewLoginEnrichment(options EnrichOptions, enrichers ...LoginEnricher) *LoginEnrichment {
+	return &LoginEnrichment{
+		enrichers: enrichers,
+		options:   options,
+	}
+}
+
+// enrichJob 单条记录的补充任务，fields 指向记录自身的字段，结果直接写回对应记录
+type enrichJob struct {
+	ip     string
+	fields EnrichFields
+}
+
+// EnrichLoginAssets 对已收集 (或从存储中反序列化) 的登录资产执行补充
+// 与收集过程分离，可在服务端使用更新后的数据库重新处理历史记录
+func EnrichLoginAssets(assets *protocol.LoginAssets, enrichers ...LoginEnricher) {
+	NewLoginEnrichment(EnrichOptions{}, enrichers...).EnrichLoginAssets(context.Background(), assets)
+}
+
+// EnrichAuditResult 补充审计结果中的全部登录记录和会话
+func EnrichAuditResult(result *protocol.VPSAuditResult, enrichers ...LoginEnricher) {
+	NewLoginEnrichment(EnrichOptions{}, enrichers...).EnrichAuditResult(context.Background(), result)
+}
+
+// EnrichLoginAssets 补充登录资产中的全部记录和会话
+func (e *LoginEnrichment) EnrichLoginAssets(ctx context.Context, assets *protocol.LoginAssets) {
+	if assets == nil || len(e.enrichers) == 0 {
+		return
+	}
+	e.run(ctx, loginAssetsJobs(assets))
+}
+
+// EnrichAuditResult 补充审计结果中的全部登录记录和会话
+func (e *LoginEnrichment) EnrichAuditResult(ctx context.Context, result *protocol.VPSAuditResult) {
+	if result == nil || len(e.enrichers) == 0 {
+		return
+	}
+
+	jobs := loginAssetsJobs(result.AssetInventory.LoginAssets)
+	if result.AssetInventory.UserAssets != nil {
+		jobs = append(jobs, sessionJobs(result.AssetInventory.UserAssets.CurrentLogins)...)
+	}
+	e.run(ctx, jobs)
+}
+
+func loginAssetsJobs(assets *protocol.LoginAssets) []enrichJob {
+	if assets == nil {
+		return nil
+	}
+
+	var jobs []enrichJob
+	for _, records := range [][]protocol.LoginRecord{assets.SuccessfulLogins, assets.FailedLogins} {
+		for i := range records {
+			jobs = append(jobs, enrichJob{
+				ip:     records[i].IP,
+				fields: EnrichFields{Location: &records[i].Location, Hostname: &records[i].Hostname},
+			})
+		}
+	}
+	jobs = append(jobs, sessionJobs(assets.CurrentSessions)...)
+
+	// 主机位置以静态配置为准，未配置时根据公网IP补充
+	if host := assets.HostLocation; host != nil && host.Location == "" {
+		jobs = append(jobs, enrichJob{ip: host.IP, fields: EnrichFields{Location: &host.Location}})
+	}
+	return jobs
+}
+
+func sessionJobs(sessions []protocol.LoginSession) []enrichJob {
+	jobs := make([]enrichJob, 0, len(sessions))
+	for i := range sessions {
+		jobs = append(jobs, enrichJob{
+			ip:     sessions[i].IP,
+			fields: EnrichFields{Location: &sessions[i].Location, Hostname: &sessions[i].Hostname},
+		})
+	}
+	return jobs
+}
+
+// run 按 IP 分组后交给有限数量的 worker 执行
+func (e *LoginEnrichment) run(ctx context.Context, jobs []enrichJob) {
+	var groups [][]enrichJob
+	index := make(map[string]int)
+	for _, job := range jobs {
+		if job.ip == "" {
+			continue
+		}
+		i, ok := index[job.ip]
+		if !ok {
+			i = len(groups)
+			index[job.ip] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], job)
+	}
+
+	workers := e.options.Workers
+	if workers > len(groups) {
+		workers = len(groups)
+	}
+	if workers <= 1 {
+		for _, group := range groups {
+			e.enrichGroup(ctx, group)
+		}
+		return
+	}
+
+	queue := make(chan []enrichJob)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for group := range queue {
+				e.enrichGroup(ctx, group)
+			}
+		}()
+	}
+	for _, group := range groups {
+		queue <- group
+	}
+	close(queue)
+	wg.Wait()
+}
+
+// enrichGroup 依次补充同一 IP 的全部记录，整组共享一个查询超时
+func (e *LoginEnrichment) enrichGroup(ctx context.Context, group []enrichJob) {
+	if ctx.Err() != nil {
+		return
+	}
+	if e.options.LookupTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, e.options.LookupTimeout)
+		defer cancel()
+	}
+
+	for _, job := range group {
+		for _, enricher := range e.enrichers {
+			enricher.Enrich(ctx, job.ip, job.fields)
+		}
+	}
+}
+
+// GeoLocationEnricher 使用 GeoIP 数据库补充 IP 归属地
+type GeoLocationEnricher struct {
+	geoip *GeoIPService
+}
+
+func NewGeoLocationEnricher(geoip *GeoIPService) *GeoLocationEnricher {
+	return &GeoLocationEnricher{geoip: geoip}
+}
+
+func (e *GeoLocationEnricher) Enrich(ctx context.Context, ip string, fields EnrichFields) {
+	if fields.Location == nil {
+		return
+	}
+	location, _, err := e.lookup(ctx, ip)
+	if err != nil {
+		return
+	}
+	*fields.Location = location
+}
+
+func (e *GeoLocationEnricher) kind() string {
+	return EnrichKindLocation
+}
+
+func (e *GeoLocationEnricher) target(fields EnrichFields) *string {
+	return fields.Location
+}
+
+// lookup 查询归属地，结果为空时可能是在线查询暂时失败，不缓存
+func (e *GeoLocationEnricher) lookup(ctx context.Context, ip string) (string, bool, error) {
+	location, err := e.geoip.LookupContext(ctx, ip)
+	if err != nil {
+		return "", false, err
+	}
+	return location, location != "", nil
+}
+
+// ReverseDNSEnricher 反向解析来源 IP 的主机名
+type ReverseDNSEnricher struct {
+	resolver *net.Resolver
+}
+
+func NewReverseDNSEnricher() *ReverseDNSEnricher {
+	return &ReverseDNSEnricher{
+		resolver: net.DefaultResolver,
+	}
+}
+
+func (e *ReverseDNSEnricher) Enrich(ctx context.Context, ip string, fields EnrichFields) {
+	if fields.Hostname == nil {
+		return
+	}
+	hostname, _, err := e.lookup(ctx, ip)
+	if err != nil {
+		return
+	}
+	*fields.Hostname = hostname
+}
+
+func (e *ReverseDNSEnricher) kind() string {
+	return EnrichKindHostname
+}
+
+func (e *ReverseDNSEnricher) target(fields EnrichFields) *string {
+	return fields.Hostname
+}
+
+// lookup 反向解析，没有 PTR 记录是确定的结果，超时等错误不缓存
+func (e *ReverseDNSEnricher) lookup(ctx context.Context, ip string) (string, bool, error) {
+	if net.ParseIP(ip) == nil {
+		return "", false, fmt.Errorf("invalid IP address: %s", ip)
+	}
+
+	names, err := e.resolver.LookupAddr(ctx, ip)
+	if err != nil {
+		var dnsErr *net.DNSError
+		if !errors.As(err, &dnsErr) || !dnsErr.IsNotFound {
+			return "", false, err
+		}
+	}
+
+	if len(names) == 0 {
+		return "", true, nil
+	}
+	return strings.TrimSuffix(names[0], "."), true, nil
+}
@@ -0,0 +1,137 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dushixiang/pika/internal/protocol"
+	"github.com/oschwald/geoip2-golang"
+)
+
+func TestEnrichLoginAssetsIsIdempotent(t *testing.T) {
+	reader := &fakeGeoIPReader{
+		cities: map[string]*geoip2.City{"8.8.8.8": newTestCity("United States")},
+	}
+	enricher := NewGeoLocationEnricher(newTestGeoIPService(reader))
+
+	assets := &protocol.LoginAssets{
+		SuccessfulLogins: []protocol.LoginRecord{{Username: "root", IP: "8.8.8.8"}},
+		FailedLogins:     []protocol.LoginRecord{{Username: "admin", IP: "192.168.1.10"}},
+		CurrentSessions:  []protocol.LoginSession{{Username: "root", IP: "8.8.8.8"}},
+	}
+
+	EnrichLoginAssets(assets, enricher)
+	EnrichLoginAssets(assets, enricher)
+
+	if got := assets.SuccessfulLogins[0].Location; got != "United States" {
+		t.Errorf("成功登录归属地 = %q", got)
+	}
+	if got := assets.FailedLogins[0].Location; got != "内网IP" {
+		t.Errorf("失败登录归属地 = %q", got)
+	}
+	if got := assets.CurrentSessions[0].Location; got != "United States" {
+		t.Errorf("会话归属地 = %q", got)
+	}
+
+	// 重新处理时数据库出错，不应清空已补充的字段
+	reader.err = errors.New("input/output error")
+	enricher.geoip.cache.Purge()
+	EnrichLoginAssets(assets, enricher)
+	if got := assets.SuccessfulLogins[0].Location; got != "United States" {
+		t.Errorf("查询出错后归属地被破坏: %q", got)
+	}
+}
+
+// slowEnricher 模拟有网络延迟的查询，归属地为 IP 本身，便于检查结果是否写回了正确的记录
+type slowEnricher struct {
+	delay    time.Duration
+	inflight atomic.Int64
+	peak     atomic.Int64
+}
+
+func (e *slowEnricher) Enrich(ctx context.Context, ip string, fields EnrichFields) {
+	n := e.inflight.Add(1)
+	defer e.inflight.Add(-1)
+	for {
+		peak := e.peak.Load()
+		if n <= peak || e.peak.CompareAndSwap(peak, n) {
+			break
+		}
+	}
+
+	select {
+	case <-time.After(e.delay):
+		*fields.Location = "loc-" + ip
+	case <-ctx.Done():
+	}
+}
+
+func newEnrichTestAssets(n int) *protocol.LoginAssets {
+	assets := &protocol.LoginAssets{}
+	for i := 0; i < n; i++ {
+		assets.SuccessfulLogins = append(assets.SuccessfulLogins, protocol.LoginRecord{
+			Username: "root",
+			IP:       fmt.Sprintf("203.0.%d.%d", i/256, i%256),
+		})
+	}
+	return assets
+}
+
+func TestLoginEnrichmentPoolPreservesAssociation(t *testing.T) {
+	enricher := &slowEnricher{delay: time.Millisecond}
+	enrichment := NewLoginEnrichment(EnrichOptions{Workers: 4, LookupTimeout: time.Second}, enricher)
+
+	assets := newEnrichTestAssets(100)
+	enrichment.EnrichLoginAssets(context.Background(), assets)
+
+	for _, record := range assets.SuccessfulLogins {
+		if record.Location != "loc-"+record.IP {
+			t.Fatalf("记录 %s 的归属地 = %q", record.IP, record.Location)
+		}
+	}
+	if peak := enricher.peak.Load(); peak > 4 {
+		t.Errorf("并发查询数 %d 超出上限 4", peak)
+	}
+}
+
+func TestLoginEnrichmentLookupTimeout(t *testing.T) {
+	enricher := &slowEnricher{delay: time.Second}
+	enrichment := NewLoginEnrichment(EnrichOptions{Workers: 2, LookupTimeout: 10 * time.Millisecond}, enricher)
+
+	assets := newEnrichTestAssets(4)
+	assets.SuccessfulLogins[0].Location = "已补充"
+
+	start := time.Now()
+	enrichment.EnrichLoginAssets(context.Background(), assets)
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("查询超时未生效，耗时 %v", elapsed)
+	}
+	// 超时时保持原值
+	if got := assets.SuccessfulLogins[0].Location; got != "已补充" {
+		t.Errorf("超时后归属地被破坏: %q", got)
+	}
+}
+
+func benchmarkLoginEnrichment(b *testing.B, workers int) {
+	enricher := &slowEnricher{delay: 200 * time.Microsecond}
+	enrichment := NewLoginEnrichment(EnrichOptions{Workers: workers, LookupTimeout: time.Second}, enricher)
+
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		assets := newEnrichTestAssets(500)
+		b.StartTimer()
+		enrichment.EnrichLoginAssets(context.Background(), assets)
+	}
+}
+
+func BenchmarkLoginEnrichmentSerial(b *testing.B) {
+	benchmarkLoginEnrichment(b, 1)
+}
+
+func BenchmarkLoginEnrichmentPooled(b *testing.B) {
+	benchmarkLoginEnrichment(b, defaultEnrichWorkers)
+}
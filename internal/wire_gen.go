@@ -33,7 +33,7 @@ func InitializeApp(logger *zap.Logger, db *gorm.DB, cfg *config.AppConfig) (*App
 	if err != nil {
 		return nil, err
 	}
-	agentService := service.NewAgentService(logger, db, apiKeyService, metricService, geoIPService)
+	agentService := service.NewAgentService(logger, db, apiKeyService, metricService, geoIPService, propertyService, cfg)
 	manager := websocket.NewManager(logger)
 	monitorService := service.NewMonitorService(logger, db, manager)
 	tamperRepo := repo.NewTamperRepo(db)
@@ -1,59 +1,457 @@
 package audit
 
 import (
-	"bufio"
+	"context"
+	"errors"
 	"fmt"
+	"net"
 	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime/debug"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/dushixiang/pika/internal/protocol"
+	"github.com/dushixiang/pika/pkg/agent/sysutil"
 )
 
 // LoginAssetsCollector 登录日志收集器
 type LoginAssetsCollector struct {
 	config   *Config
-	executor *CommandExecutor
+	executor CommandRunner
+
+	sshdPolicyCollector *SSHDPolicyCollector
+	hostLocator         *hostLocator
+	hostContext         *hostContextCollector
+	logTampering        *logTamperingDetector
+	analyzers           []LoginAnalyzer
+	transforms          loginTransformPipeline
+	natSources          *sourceMatcher
+	userFilter          *userFilter
+	terminalAliases     *terminalAliases
+	sinks               []LoginEventSink
+	metrics             MetricsRecorder
+	watermark           *watermarkTracker
+	fileAccess          FileAccessSource
+	locations           LocationResolver
+	knownUserIPs        map[string][]string
+
+	// 域名解析，可替换以便测试
+	lookupHost func(ctx context.Context, host string) ([]string, error)
+
+	// 在 PATH 中查找命令，可替换以便测试
+	lookPath func(file string) (string, error)
+
+	// 主机是否以 systemd 启动，可替换以便测试
+	systemdBooted func() bool
+
+	// 当前时间，可替换以便测试
+	now func() time.Time
 }
 
 // NewLoginAssetsCollector 创建登录日志收集器
-func NewLoginAssetsCollector(config *Config, executor *CommandExecutor) *LoginAssetsCollector {
-	return &LoginAssetsCollector{
+func NewLoginAssetsCollector(config *Config, executor CommandRunner) *LoginAssetsCollector {
+	lac := &LoginAssetsCollector{
 		config:   config,
 		executor: executor,
+
+		sshdPolicyCollector: NewSSHDPolicyCollector(config, executor),
+		natSources:          newSourceMatcher(config.LoginConfig.NATEgressSources),
+		userFilter:          newUserFilter(config.LoginConfig.IncludeUsers, config.LoginConfig.ExcludeUsers),
+		terminalAliases:     newTerminalAliases(config.LoginConfig.TerminalAliases),
+		now:                 time.Now,
+		lookupHost:          net.DefaultResolver.LookupHost,
+		lookPath:            exec.LookPath,
+		systemdBooted:       isSystemdBooted,
+	}
+	lac.analyzers = defaultLoginAnalyzers(config, func() time.Time { return lac.now() })
+	lac.hostLocator = newHostLocator(config.LoginConfig.HostLocation, func() time.Time { return lac.now() })
+	lac.logTampering = newLogTamperingDetector(config, func() time.Time { return lac.now() })
+	lac.hostContext = newHostContextCollector(config.LoginConfig.HostContext, executor)
+	lac.watermark = newWatermarkTracker(config.LoginConfig.WatermarkPath)
+	lac.loadState()
+
+	transforms, err := newLoginTransformPipeline(config.LoginConfig.RecordTransforms)
+	if err != nil {
+		globalLogger.Warn("记录转换配置无效，已忽略: %v", err)
+	}
+	lac.transforms = transforms
+
+	if config.LoginConfig.SocketSink.Path != "" {
+		sink, err := NewSocketSink(config.LoginConfig.SocketSink)
+		if err != nil {
+			globalLogger.Warn("创建socket事件输出失败: %v", err)
+		} else {
+			lac.sinks = append(lac.sinks, sink)
+		}
+	}
+
+	return lac
+}
+
+// AddSink 添加登录事件输出，每次收集完成后输出全部记录和会话
+func (lac *LoginAssetsCollector) AddSink(sink LoginEventSink) {
+	lac.sinks = append(lac.sinks, sink)
+}
+
+// SetClock 替换收集器使用的时钟，相对时间窗口以此为基准
+func (lac *LoginAssetsCollector) SetClock(now func() time.Time) {
+	lac.now = now
+}
+
+// Close 关闭收集器持有的资源，配置了状态文件时保存状态
+func (lac *LoginAssetsCollector) Close() error {
+	var errs []error
+	if err := lac.saveState(); err != nil {
+		errs = append(errs, fmt.Errorf("保存收集器状态失败: %w", err))
+	}
+	for _, sink := range lac.sinks {
+		if err := sink.Close(); err != nil {
+			errs = append(errs, err)
+		}
 	}
+	lac.sinks = nil
+	return errors.Join(errs...)
 }
 
-// Collect 收集登录日志
+// CollectResult 登录资产收集结果
+type CollectResult struct {
+	// 收集到的登录资产 (部分子收集器失败时仍包含其余结果)
+	Assets *protocol.LoginAssets
+
+	// 子收集器名称 -> 错误 (包括 panic)
+	Errors map[string]error
+}
+
+// loginSubCollector 登录子收集器
+type loginSubCollector struct {
+	name string
+	fn   func(assets *protocol.LoginAssets) error
+
+	// 与相邻的并发子收集器同时执行，只能写入成功登录、失败登录或当前会话，且不能读取其他字段
+	concurrent bool
+}
+
+// Collect 收集登录日志，忽略子收集器的错误
 func (lac *LoginAssetsCollector) Collect() *protocol.LoginAssets {
-	assets := &protocol.LoginAssets{}
+	return lac.CollectWithResult().Assets
+}
+
+// CollectWithErrors 收集登录日志，同时返回子收集器的错误 (按子收集器名称排序)
+// last、lastb、w 及其备用来源全部失败时返回错误，用于区分"没有登录"和"没有权限读取"等情况；
+// 有错误时仍返回已收集到的部分结果
+func (lac *LoginAssetsCollector) CollectWithErrors() (*protocol.LoginAssets, []error) {
+	result := lac.CollectWithResult()
+
+	names := make([]string, 0, len(result.Errors))
+	for name := range result.Errors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var errs []error
+	for _, name := range names {
+		errs = append(errs, fmt.Errorf("%s: %w", name, result.Errors[name]))
+	}
+	return result.Assets, errs
+}
+
+// CollectWithResult 收集登录日志，单个子收集器失败或 panic 不影响其他子收集器
+func (lac *LoginAssetsCollector) CollectWithResult() *CollectResult {
+	return lac.CollectSince(time.Time{})
+}
 
-	// 收集成功登录历史
-	assets.SuccessfulLogins = lac.collectSuccessfulLogins()
+// CollectSince 只收集 since 之后的登录记录，since 为零值时不限制
+// 当前会话是实时状态，始终完整返回。
+//
+// 边界是包含的 (Timestamp >= since)：last 和 syslog 的时间只精确到秒，严格大于会漏掉同一秒内的后续记录，
+// 重复的记录由 RecordID 去重。since 通常取自上次成功上报的水位 (见 CollectPending)；
+// 主机时钟被调整或日志写入时间与 last 输出的时间存在偏差时，水位附近的少量记录仍可能遗漏，
+// 需要完整结果时应定期以零值 since 全量收集
+func (lac *LoginAssetsCollector) CollectSince(since time.Time) *CollectResult {
+	result, _ := lac.collectSince(since, false)
+	return result
+}
 
-	// 收集失败登录历史
-	assets.FailedLogins = lac.collectFailedLogins()
+// CollectAfter 只返回时间戳 (毫秒) 严格大于 since 的成功和失败登录记录，since 不大于 0 时不限制
+// 当前会话是实时状态，始终完整返回。
+//
+// 与 CollectSince 不同，边界是不包含的 (Timestamp > since)：since 应为上次成功上报的记录中最新的时间戳，
+// 与该记录同一毫秒的其他记录会被跳过。主机时钟与 last 输出的时间存在偏差时，水位附近的少量记录可能遗漏
+func (lac *LoginAssetsCollector) CollectAfter(since int64) *protocol.LoginAssets {
+	if since <= 0 {
+		return lac.Collect()
+	}
+	// 时间戳为整数毫秒，Timestamp >= since+1 即 Timestamp > since
+	return lac.CollectSince(time.UnixMilli(since + 1)).Assets
+}
 
-	// 收集当前登录会话
-	assets.CurrentSessions = lac.collectCurrentSessions()
+// collectSince 收集 since 之后的登录记录
+// pending 为 true 且 since 非零值时按发送水位收集 (见 CollectPending)：读取 since 之后的全部记录，保留最早的
+// MaxLoginRecords 条，超出大小上限时丢弃最新的记录；返回未返回的记录中最早的时间 (毫秒)，全部返回时为 0
+func (lac *LoginAssetsCollector) collectSince(since time.Time, pending bool) (*CollectResult, int64) {
+	assets := &protocol.LoginAssets{}
+
+	limit := maxLoginRecords(lac.config)
+	oldestFirst := pending && !since.IsZero()
+	readLimit := limit
+	if oldestFirst {
+		readLimit = unlimitedRecords
+	}
+	errs := runLoginSubCollectors(assets, lac.subCollectors(since, readLimit))
+	// last --since 等只精确到秒，按毫秒再过滤一次
+	assets.SuccessfulLogins = dropRecordsBefore(assets.SuccessfulLogins, since)
+	assets.FailedLogins = dropRecordsBefore(assets.FailedLogins, since)
+
+	var ceiling int64
+	if oldestFirst {
+		var leftSuccessful, leftFailed []protocol.LoginRecord
+		assets.SuccessfulLogins, leftSuccessful = oldestLoginRecords(assets.SuccessfulLogins, limit)
+		assets.FailedLogins, leftFailed = oldestLoginRecords(assets.FailedLogins, limit)
+		ceiling = oldestRecordTime(leftSuccessful, leftFailed)
+	}
+
+	lac.normalize(assets)
 
 	// 统计信息
-	assets.Statistics = lac.calculateStatistics(assets)
+	statsErrs := runLoginSubCollectors(assets, []loginSubCollector{
+		{name: "statistics", fn: func(assets *protocol.LoginAssets) error {
+			assets.Statistics = lac.calculateStatistics(assets)
+			return nil
+		}},
+		// 关联登录后的敏感文件访问 (需要设置事件来源)
+		{name: "file_access", fn: lac.correlateFileAccess},
+		// 认证日志中提权到 root 的 sudo/su
+		{name: "privilege_escalations", fn: func(assets *protocol.LoginAssets) error {
+			return lac.collectPrivilegeEscalations(assets, since)
+		}},
+	})
+	for name, err := range statsErrs {
+		errs[name] = err
+	}
+	lac.updateState(assets)
+
+	emitLoginAssets(lac.sinks, assets)
+
+	// 事件输出使用完整的记录，只裁剪返回 (上报) 的结果
+	if dropped := trimLoginAssets(assets, lac.config.LoginConfig.MaxPayloadBytes, pending); dropped > 0 && (ceiling == 0 || dropped < ceiling) {
+		ceiling = dropped
+	}
+
+	return &CollectResult{
+		Assets: assets,
+		Errors: errs,
+	}, ceiling
+}
+
+// dropRecordsBefore 去掉早于 since 的记录，since 为零值时不过滤
+func dropRecordsBefore(records []protocol.LoginRecord, since time.Time) []protocol.LoginRecord {
+	return slices.DeleteFunc(records, func(record protocol.LoginRecord) bool {
+		return before(record.Timestamp, since)
+	})
+}
+
+// subCollectors 登录子收集器列表，limit 为成功登录和失败登录各自读取的最大条数 (最新的记录)
+func (lac *LoginAssetsCollector) subCollectors(since time.Time, limit int) []loginSubCollector {
+	return []loginSubCollector{
+		// 成功登录、失败登录和当前会话相互独立，各自执行外部命令，并发收集
+		{name: "successful_logins", concurrent: true, fn: func(assets *protocol.LoginAssets) (err error) {
+			assets.SuccessfulLogins, err = lac.collectSuccessfulLogins(since, limit)
+			return err
+		}},
+		{name: "failed_logins", concurrent: true, fn: func(assets *protocol.LoginAssets) (err error) {
+			assets.FailedLogins, err = lac.collectFailedLogins(since, limit)
+			return err
+		}},
+		{name: "current_sessions", concurrent: true, fn: func(assets *protocol.LoginAssets) (err error) {
+			assets.CurrentSessions, err = lac.collectCurrentSessions()
+			lac.classifySessions(assets.CurrentSessions)
+			return err
+		}},
+		// 从认证日志补充成功登录的认证方式
+		{name: "auth_methods", fn: func(assets *protocol.LoginAssets) error {
+			return lac.annotateAuthMethods(assets.SuccessfulLogins, lac.authLogFiles())
+		}},
+		// 收集账户锁定事件
+		{name: "account_lockouts", fn: func(assets *protocol.LoginAssets) (err error) {
+			assets.AccountLockouts, err = lac.collectAccountLockouts(since)
+			return err
+		}},
+		// 收集每个用户最近一次登录
+		{name: "last_login", fn: func(assets *protocol.LoginAssets) (err error) {
+			assets.LastLogins, err = lac.collectLastLogin()
+			return err
+		}},
+		// 收集 sshd 登录策略
+		{name: "sshd_policy", fn: func(assets *protocol.LoginAssets) error {
+			assets.SSHDPolicy = lac.sshdPolicyCollector.Collect()
+			return nil
+		}},
+		// 主机自身的位置
+		{name: "host_location", fn: func(assets *protocol.LoginAssets) (err error) {
+			assets.HostLocation, err = lac.hostLocator.Get()
+			return err
+		}},
+		// 主机环境
+		{name: "host_context", fn: func(assets *protocol.LoginAssets) error {
+			assets.HostContext = lac.hostContext.Collect()
+			return nil
+		}},
+		// 登录日志篡改迹象，依赖前面收集的登录记录和会话
+		{name: "log_tampering", fn: func(assets *protocol.LoginAssets) error {
+			assets.LogTampering = lac.logTampering.Detect(assets, since)
+			return nil
+		}},
+	}
+}
+
+// runLoginSubCollectors 依次执行子收集器，捕获各自的错误和 panic
+// 相邻的并发子收集器同时执行，全部完成后才合并结果并执行后续的子收集器
+func runLoginSubCollectors(assets *protocol.LoginAssets, collectors []loginSubCollector) map[string]error {
+	errs := make(map[string]error)
+	for i := 0; i < len(collectors); {
+		end := i + 1
+		for collectors[i].concurrent && end < len(collectors) && collectors[end].concurrent {
+			end++
+		}
+		for name, err := range runLoginSubCollectorGroup(assets, collectors[i:end]) {
+			globalLogger.Warn("登录子收集器 %s 失败: %v", name, err)
+			errs[name] = err
+		}
+		i = end
+	}
+	return errs
+}
+
+// runLoginSubCollectorGroup 同时执行一组子收集器，每个子收集器写入各自的临时结果，全部完成后合并
+func runLoginSubCollectorGroup(assets *protocol.LoginAssets, collectors []loginSubCollector) map[string]error {
+	errs := make(map[string]error)
+	if len(collectors) == 1 {
+		if err := runLoginSubCollector(assets, collectors[0]); err != nil {
+			errs[collectors[0].name] = err
+		}
+		return errs
+	}
+
+	results := make([]protocol.LoginAssets, len(collectors))
+	groupErrs := make([]error, len(collectors))
+	var wg sync.WaitGroup
+	for i, collector := range collectors {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			groupErrs[i] = runLoginSubCollector(&results[i], collector)
+		}()
+	}
+	wg.Wait()
+
+	for i, collector := range collectors {
+		mergeLoginSources(assets, &results[i])
+		if groupErrs[i] != nil {
+			errs[collector.name] = groupErrs[i]
+		}
+	}
+	return errs
+}
 
-	return assets
+// mergeLoginSources 合并并发子收集器写入的登录记录和会话
+func mergeLoginSources(dst, src *protocol.LoginAssets) {
+	if src.SuccessfulLogins != nil {
+		dst.SuccessfulLogins = src.SuccessfulLogins
+	}
+	if src.FailedLogins != nil {
+		dst.FailedLogins = src.FailedLogins
+	}
+	if src.CurrentSessions != nil {
+		dst.CurrentSessions = src.CurrentSessions
+	}
+}
+
+// runLoginSubCollector 执行单个子收集器，将 panic 转换为错误
+func runLoginSubCollector(assets *protocol.LoginAssets, collector loginSubCollector) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			globalLogger.Error("登录子收集器 %s panic: %v\n%s", collector.name, r, debug.Stack())
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return collector.fn(assets)
 }
 
 // collectSuccessfulLogins 收集成功登录历史
-func (lac *LoginAssetsCollector) collectSuccessfulLogins() []protocol.LoginRecord {
+// wtmp 没有记录时 (如不写 wtmp 的容器) 从认证日志读取；wtmp 无法读取且认证日志中也没有记录时返回错误
+func (lac *LoginAssetsCollector) collectSuccessfulLogins(since time.Time, limit int) ([]protocol.LoginRecord, error) {
+	records, err := lac.collectSuccessfulLoginsFromWtmpSources(since, limit)
+	if lac.config.LoginConfig.IncludeRotatedLogs {
+		rotated := lac.collectFromRotated(lac.config.LoginConfig.WtmpPath, "last", limit, since, isUtmpUserProcess, "success")
+		records = mergeNewestRecords(records, rotated, limit)
+	}
+	if len(records) > 0 {
+		return records, nil
+	}
+	records = lac.collectSuccessfulLoginsFromAuthLog(lac.authLogFiles(), since, limit)
+	if len(records) > 0 {
+		return records, nil
+	}
+	return records, err
+}
+
+// collectSuccessfulLoginsFromWtmpSources 通过 utmpdump、last 或直接读取 wtmp 收集成功登录
+// 全部方式都失败时返回各方式的错误
+func (lac *LoginAssetsCollector) collectSuccessfulLoginsFromWtmpSources(since time.Time, limit int) ([]protocol.LoginRecord, error) {
 	var records []protocol.LoginRecord
+	var errs []error
+
+	// 优先使用 utmpdump，输出格式不受 locale 和列宽影响
+	if lac.config.LoginConfig.PreferUtmpdump {
+		records, err := lac.collectFromUtmpdump(lac.config.LoginConfig.WtmpPath, limit, since, isUtmpUserProcess, "success")
+		if err == nil {
+			return records, nil
+		}
+		globalLogger.Debug("utmpdump读取wtmp失败: %v", err)
+		errs = append(errs, fmt.Errorf("utmpdump: %w", err))
+	}
 
 	// 使用 last 命令获取登录历史
-	output, err := lac.executor.Execute("last", "-n", "100", "-F", "-w")
+	args := append(append(limitArgs(limit), "-F", "-w"), sinceArgs(since)...)
+	output, err := lac.executeLast("last", args...)
 	if err != nil {
 		globalLogger.Debug("获取登录历史失败: %v", err)
-		return records
+		errs = append(errs, fmt.Errorf("last: %w", err))
+
+		// 直接读取 wtmp
+		records, err = lac.collectSuccessfulLoginsFromWtmp(limit, since)
+		if err != nil {
+			globalLogger.Debug("直接读取wtmp失败: %v", err)
+			return records, errors.Join(append(errs, fmt.Errorf("读取wtmp: %w", err))...)
+		}
+		return records, nil
 	}
 
+	records = lac.parseLastOutput(output, limit)
+
+	// 再以数字IP运行一次，同时保留主机名和可查询归属地的IP
+	if lac.config.LoginConfig.LastWithNumericIPs {
+		numeric, err := lac.executeLast("last", append([]string{"-i"}, args...)...)
+		if err != nil {
+			globalLogger.Debug("获取数字IP登录历史失败: %v", err)
+			return records, nil
+		}
+		records = mergeLastRecords(records, lac.parseLastOutput(numeric, limit), limit)
+	}
+
+	return records, nil
+}
+
+// parseLastOutput 解析 last -F -w 的输出
+func (lac *LoginAssetsCollector) parseLastOutput(output string, limit int) []protocol.LoginRecord {
+	var records []protocol.LoginRecord
+
 	lines := strings.Split(output, "\n")
 	for _, line := range lines {
 		line = strings.TrimSpace(line)
@@ -64,37 +462,30 @@ func (lac *LoginAssetsCollector) collectSuccessfulLogins() []protocol.LoginRecor
 			continue
 		}
 
-		fields := strings.Fields(line)
-		if len(fields) < 3 {
+		parsed, valid := splitLastLine(strings.Fields(line))
+		if !valid {
 			continue
 		}
 
-		username := fields[0]
-		terminal := fields[1]
-		ip := fields[2]
-
-		// 处理本地登录（没有IP的情况）
-		if ip == ":0" || ip == ":0.0" {
-			ip = "localhost"
-		} else if strings.HasPrefix(ip, ":") {
-			ip = "localhost" + ip
-		}
-
 		// 解析登录时间
-		timestamp := lac.parseLoginTime(fields)
+		timestamp, ok := lac.parseLoginTime(parsed.times)
 
 		record := protocol.LoginRecord{
-			Username:  username,
-			Terminal:  terminal,
-			IP:        ip,
-			Timestamp: timestamp,
-			Status:    "success",
+			Username:           sanitizeUTF8(parsed.username),
+			Terminal:           parsed.terminal,
+			IP:                 normalizeSource(parsed.source), // 本地登录（没有IP的情况）规范化为 localhost
+			Timestamp:          timestamp,
+			Status:             "success",
+			TimestampEstimated: !ok,
 		}
 
+		// 会话结束方式和时长
+		lac.parseSessionEnd(parsed.times, &record)
+
 		records = append(records, record)
 
 		// 限制数量
-		if len(records) >= 100 {
+		if len(records) >= limit {
 			break
 		}
 	}
@@ -102,14 +493,24 @@ func (lac *LoginAssetsCollector) collectSuccessfulLogins() []protocol.LoginRecor
 	return records
 }
 
-// parseLoginTime 解析登录时间
-func (lac *LoginAssetsCollector) parseLoginTime(fields []string) int64 {
-	// last -F 输出格式示例:
-	// username pts/0 192.168.1.1 Mon Dec 25 10:30:00 2023 - Mon Dec 25 11:00:00 2023
-	// 时间在第4-8个字段
+// parseLoginTime 解析登录时间，解析失败时返回当前时间且 ok 为 false
+func (lac *LoginAssetsCollector) parseLoginTime(times []string) (timestamp int64, ok bool) {
+	timestamp, err := parseLastLoginTime(times)
+	if err != nil {
+		// 如果解析失败，返回当前时间
+		globalLogger.Debug("无法解析登录时间: %v", err)
+		return time.Now().UnixMilli(), false
+	}
+	return timestamp, true
+}
 
-	if len(fields) < 8 {
-		return time.Now().UnixMilli()
+// parseLastLoginTime 解析 last -F 输出中的登录时间，times 为 splitLastLine 分出的时间部分
+// last -F 输出格式示例:
+// username pts/0 192.168.1.1 Mon Dec 25 10:30:00 2023 - Mon Dec 25 11:00:00 2023
+// 时间为时间部分的前5个字段
+func parseLastLoginTime(times []string) (int64, error) {
+	if len(times) < 5 {
+		return 0, fmt.Errorf("字段不足: %s", strings.Join(times, " "))
 	}
 
 	// 尝试多种时间格式
@@ -119,35 +520,123 @@ func (lac *LoginAssetsCollector) parseLoginTime(fields []string) int64 {
 		"2006-01-02 15:04:05",      // ISO格式
 	}
 
-	// 从第3个字段开始（索引2），因为前面是 username terminal ip
-	timeStr := strings.Join(fields[3:8], " ")
+	timeStr := strings.Join(times[:5], " ")
 
 	for _, format := range timeFormats {
 		if t, err := time.Parse(format, timeStr); err == nil {
-			// 使用本地时区解析时间
-			return t.UnixMilli()
+			return t.UnixMilli(), nil
 		}
 	}
+	return 0, fmt.Errorf("无法识别的时间: %s", timeStr)
+}
 
-	// 如果解析失败，返回当前时间
-	globalLogger.Debug("无法解析登录时间: %s", timeStr)
-	return time.Now().UnixMilli()
+// cLocaleTimeEnv 强制 last/lastb 以英文输出时间，LC_ALL 为空时不再覆盖 LC_TIME
+var cLocaleTimeEnv = []string{"LC_ALL=", "LC_TIME=C"}
+
+// executeLast 执行 last/lastb，输出中存在无法解析的时间 (非英文 locale 的星期和月份名称) 时
+// 以 LC_TIME=C 重新执行，使时间的解析不受主机 locale 影响
+func (lac *LoginAssetsCollector) executeLast(name string, args ...string) (string, error) {
+	output, err := lac.execute(name, args...)
+	if err != nil || !hasUnparsableLastTime(output) {
+		return output, err
+	}
+
+	runner, ok := lac.executor.(contextCommandRunner)
+	if !ok {
+		return output, nil
+	}
+	globalLogger.Debug("%s 输出的时间无法解析，以 LC_TIME=C 重新执行", name)
+	ctx, cancel := context.WithTimeout(context.Background(), loginCommandTimeout(lac.config))
+	defer cancel()
+	if cOutput, err := runner.ExecuteContextEnv(ctx, cLocaleTimeEnv, name, args...); err == nil {
+		return cOutput, nil
+	}
+	return output, nil
+}
+
+// hasUnparsableLastTime last 输出的记录中是否存在无法解析的登录时间
+func hasUnparsableLastTime(output string) bool {
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "wtmp") || strings.HasPrefix(line, "btmp") ||
+			strings.HasPrefix(line, "reboot") || strings.Contains(line, "system boot") {
+			continue
+		}
+		parsed, ok := splitLastLine(strings.Fields(line))
+		if !ok || len(parsed.times) < 5 {
+			continue
+		}
+		if _, err := parseLastLoginTime(parsed.times); err != nil {
+			return true
+		}
+	}
+	return false
 }
 
 // collectFailedLogins 收集失败登录历史
-func (lac *LoginAssetsCollector) collectFailedLogins() []protocol.LoginRecord {
-	var records []protocol.LoginRecord
+// btmp、lastb 都无法读取且备用的日志来源也没有记录时返回错误 (通常是权限不足)
+func (lac *LoginAssetsCollector) collectFailedLogins(since time.Time, limit int) ([]protocol.LoginRecord, error) {
+	records, err := lac.collectFailedLoginsFromCurrent(since, limit)
+	if !lac.config.LoginConfig.IncludeRotatedLogs {
+		return records, err
+	}
+
+	rotated := lac.collectFromRotated(lac.config.LoginConfig.BtmpPath, "lastb", limit, since, isUtmpLoginEntry, "failed")
+	records = mergeNewestRecords(records, rotated, limit)
+	if len(records) > 0 {
+		return records, nil
+	}
+	return records, err
+}
+
+// collectFailedLoginsFromCurrent 从当前的 btmp (不含轮转文件) 及备用的日志来源收集失败登录
+// btmp 总是先从文件尾部读取：utmpdump 需要解析整个文件，在记录量巨大的主机上耗时和内存都随文件增长，
+// 因此 PreferUtmpdump 对 btmp 只决定直接读取失败后是否先尝试 utmpdump
+func (lac *LoginAssetsCollector) collectFailedLoginsFromCurrent(since time.Time, limit int) ([]protocol.LoginRecord, error) {
+	var errs []error
+
+	records, err := lac.collectFailedLoginsFromBtmp(limit, since)
+	if err == nil {
+		return records, nil
+	}
+	globalLogger.Debug("直接读取btmp失败: %v", err)
+	errs = append(errs, fmt.Errorf("读取btmp: %w", err))
+
+	if lac.config.LoginConfig.PreferUtmpdump {
+		records, err = lac.collectFromUtmpdump(lac.config.LoginConfig.BtmpPath, limit, since, isUtmpLoginEntry, "failed")
+		if err == nil {
+			return records, nil
+		}
+		globalLogger.Debug("utmpdump读取btmp失败: %v", err)
+		errs = append(errs, fmt.Errorf("utmpdump: %w", err))
+	}
 
-	// 使用 lastb 命令获取失败登录历史
-	output, err := lac.executor.Execute("lastb", "-n", "100", "-F", "-w")
+	// 使用 lastb 命令获取失败登录历史 (lastb 同样从文件尾部读取，-n 限制读取条数)
+	args := append(append(limitArgs(limit), "-F", "-w"), sinceArgs(since)...)
+	output, err := lac.executeLast("lastb", args...)
 	if err != nil {
 		globalLogger.Debug("获取失败登录历史失败: %v (需要root权限)", err)
-
-		// 尝试从日志文件读取
-		records = lac.collectFailedLoginsFromAuthLog()
-		return records
+		errs = append(errs, fmt.Errorf("lastb (需要root权限): %w", err))
+
+		// 尝试从日志文件读取，没有日志文件时 (日志只保存在 journal 中) 读取 journal
+		if len(lac.authLogFiles()) > 0 {
+			records = lac.collectFailedLoginsFromAuthLog(since, limit)
+		} else if records, err = lac.collectFailedLoginsFromJournal(since, limit); err != nil {
+			globalLogger.Debug("从journal读取失败登录失败: %v", err)
+			errs = append(errs, fmt.Errorf("journalctl: %w", err))
+		}
+		if len(records) > 0 {
+			return records, nil
+		}
+		return records, errors.Join(errs...)
 	}
 
+	return lac.parseLastbOutput(output, limit), nil
+}
+
+// parseLastbOutput 解析 lastb 的输出，最多返回 limit 条
+func (lac *LoginAssetsCollector) parseLastbOutput(output string, limit int) []protocol.LoginRecord {
+	var records []protocol.LoginRecord
 	lines := strings.Split(output, "\n")
 	for _, line := range lines {
 		line = strings.TrimSpace(line)
@@ -157,35 +646,27 @@ func (lac *LoginAssetsCollector) collectFailedLogins() []protocol.LoginRecord {
 			continue
 		}
 
-		fields := strings.Fields(line)
-		if len(fields) < 3 {
+		parsed, valid := splitLastLine(strings.Fields(line))
+		if !valid {
 			continue
 		}
 
-		username := fields[0]
-		terminal := fields[1]
-		ip := fields[2]
-
-		// 处理本地登录
-		if ip == ":0" || ip == ":0.0" {
-			ip = "localhost"
-		}
-
 		// 解析登录时间
-		timestamp := lac.parseLoginTime(fields)
+		timestamp, ok := lac.parseLoginTime(parsed.times)
 
 		record := protocol.LoginRecord{
-			Username:  username,
-			Terminal:  terminal,
-			IP:        ip,
-			Timestamp: timestamp,
-			Status:    "failed",
+			Username:           sanitizeUTF8(parsed.username),
+			Terminal:           parsed.terminal,
+			IP:                 normalizeSource(parsed.source), // 本地登录规范化为 localhost
+			Timestamp:          timestamp,
+			Status:             "failed",
+			TimestampEstimated: !ok,
 		}
 
 		records = append(records, record)
 
 		// 限制数量
-		if len(records) >= 100 {
+		if len(records) >= limit {
 			break
 		}
 	}
@@ -194,81 +675,173 @@ func (lac *LoginAssetsCollector) collectFailedLogins() []protocol.LoginRecord {
 }
 
 // collectFailedLoginsFromAuthLog 从认证日志读取失败登录
-func (lac *LoginAssetsCollector) collectFailedLoginsFromAuthLog() []protocol.LoginRecord {
-	var records []protocol.LoginRecord
+// 日志文件按从旧到新读取，超过 limit 时保留最新的记录，最新的失败登录排在最后
+func (lac *LoginAssetsCollector) collectFailedLoginsFromAuthLog(since time.Time, limit int) []protocol.LoginRecord {
+	files := lac.authLogFiles()
+	if len(files) == 0 {
+		return nil
+	}
+
+	records, _ := lac.scanFailedLoginFiles(context.Background(), files, since, nil)
+	if len(records) > limit {
+		records = records[len(records)-limit:]
+	}
+	return records
+}
+
+// authLogFiles 读取的认证日志文件 (失败登录、成功登录的备用来源和认证方式)，按修改时间从旧到新排列
+// 未配置 AuthLogPaths 时使用 findAuthLog 找到的默认文件；匹配到的符号链接和非普通文件会被忽略
+func (lac *LoginAssetsCollector) authLogFiles() []string {
+	patterns := lac.config.LoginConfig.AuthLogPaths
+	if len(patterns) == 0 {
+		if path := findAuthLog(); path != "" {
+			return []string{path}
+		}
+		return nil
+	}
+
+	type logFile struct {
+		path    string
+		modTime time.Time
+	}
+	var files []logFile
+	seen := make(map[string]bool)
+	for _, pattern := range patterns {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			globalLogger.Debug("认证日志路径 %s 无效: %v", pattern, err)
+			continue
+		}
+		for _, path := range matches {
+			info, err := os.Lstat(path)
+			if err != nil || !info.Mode().IsRegular() || seen[path] {
+				continue
+			}
+			seen[path] = true
+			files = append(files, logFile{path: path, modTime: info.ModTime()})
+		}
+	}
+	sort.SliceStable(files, func(i, j int) bool {
+		return files[i].modTime.Before(files[j].modTime)
+	})
+
+	paths := make([]string, len(files))
+	for i, file := range files {
+		paths[i] = file.path
+	}
+	return paths
+}
+
+// isFailedLoginLine 是否为认证失败的日志行
+func isFailedLoginLine(line string) bool {
+	return strings.Contains(line, "Failed password") ||
+		strings.Contains(line, "authentication failure")
+}
 
+// findAuthLog 查找认证日志文件
+func findAuthLog() string {
 	// 尝试读取不同的认证日志文件
 	authLogPaths := []string{
 		"/var/log/auth.log",
 		"/var/log/secure",
 	}
 
-	var authLog string
+	// 不选择符号链接，避免被诱导读取其他文件
 	for _, path := range authLogPaths {
-		if _, err := os.Stat(path); err == nil {
-			authLog = path
-			break
+		if info, err := os.Lstat(path); err == nil && info.Mode().IsRegular() {
+			return path
 		}
 	}
+	return ""
+}
 
-	if authLog == "" {
-		return records
+// checkLogPath 检查日志路径不是符号链接，且所在目录不能被其他用户修改
+func checkLogPath(path string) error {
+	if err := sysutil.CheckTrustedDir(filepath.Dir(path)); err != nil {
+		return err
 	}
-
-	file, err := os.Open(authLog)
+	info, err := os.Lstat(path)
 	if err != nil {
-		return records
+		return err
 	}
-	defer file.Close()
-
-	scanner := bufio.NewScanner(file)
-	count := 0
-
-	for scanner.Scan() && count < 100 {
-		line := scanner.Text()
-
-		// 查找失败的SSH登录
-		if strings.Contains(line, "Failed password") ||
-			strings.Contains(line, "authentication failure") {
-
-			record := lac.parseFailedLoginFromLog(line)
-			if record != nil {
-				records = append(records, *record)
-				count++
-			}
-		}
+	if info.Mode()&os.ModeSymlink != 0 {
+		return fmt.Errorf("%s: %w", path, sysutil.ErrSymlink)
 	}
+	return nil
+}
 
-	return records
+// openLogFile 打开日志文件，拒绝符号链接和不可信目录中的文件 (探针通常以 root 运行)
+func openLogFile(path string) (*os.File, error) {
+	if err := sysutil.CheckTrustedDir(filepath.Dir(path)); err != nil {
+		return nil, err
+	}
+	return sysutil.OpenNoFollow(path)
 }
 
 // parseFailedLoginFromLog 从日志行解析失败登录
 func (lac *LoginAssetsCollector) parseFailedLoginFromLog(line string) *protocol.LoginRecord {
 	// 简化解析，提取用户名和IP
+	// Failed password for invalid user NAME from IP port 22 ssh2
+	// 用户名可能包含空格和多字节字符，取标记之后到最后一个 " from " 之间的全部内容
 	username := "unknown"
 	ip := "unknown"
+	ipParseOK := false
+
+	// 只在程序标识之后查找，避免匹配到 syslog 头部的主机名
+	message := line
+	if idx := strings.Index(line, ": "); idx != -1 {
+		message = line[idx+2:]
+	}
+
+	// pam_unix(sshd:auth): authentication failure; logname= uid=0 euid=0 tty=ssh ruser= rhost=IP  user=NAME
+	if strings.Contains(message, "authentication failure;") {
+		for _, field := range strings.Fields(message) {
+			if value, ok := strings.CutPrefix(field, "rhost="); ok && value != "" {
+				ip, ipParseOK = parseSourceIP(value)
+			} else if value, ok := strings.CutPrefix(field, "user="); ok && value != "" {
+				username = sanitizeUTF8(value)
+			}
+		}
+		return &protocol.LoginRecord{
+			Username:  username,
+			IP:        ip,
+			IPParseOK: ipParseOK,
+			Terminal:  "ssh",
+			Timestamp: lac.parseSyslogTime(line),
+			Status:    "failed",
+		}
+	}
+
+	fromIdx := strings.LastIndex(message, " from ")
 
 	// 提取用户名
-	if idx := strings.Index(line, "user "); idx != -1 {
-		rest := line[idx+5:]
-		if spaceIdx := strings.Index(rest, " "); spaceIdx != -1 {
-			username = rest[:spaceIdx]
+	start := -1
+	if idx := strings.Index(message, "invalid user "); idx != -1 {
+		start = idx + len("invalid user ")
+	} else if idx := strings.Index(message, " user "); idx != -1 {
+		start = idx + len(" user ")
+	} else if idx := strings.Index(message, " for "); idx != -1 {
+		start = idx + len(" for ")
+	}
+	if start != -1 {
+		rest := message[start:]
+		if fromIdx >= start {
+			rest = message[start:fromIdx]
+		} else if spaceIdx := strings.Index(rest, " "); spaceIdx != -1 {
+			rest = rest[:spaceIdx]
 		}
-	} else if idx := strings.Index(line, "for "); idx != -1 {
-		rest := line[idx+4:]
-		if spaceIdx := strings.Index(rest, " "); spaceIdx != -1 {
-			username = rest[:spaceIdx]
+		if rest != "" {
+			username = sanitizeUTF8(rest)
 		}
 	}
 
 	// 提取IP地址
-	if idx := strings.Index(line, "from "); idx != -1 {
-		rest := line[idx+5:]
+	if fromIdx != -1 {
+		rest := message[fromIdx+len(" from "):]
 		if spaceIdx := strings.Index(rest, " "); spaceIdx != -1 {
-			ip = rest[:spaceIdx]
-		} else {
-			ip = rest
+			rest = rest[:spaceIdx]
 		}
+		ip, ipParseOK = parseSourceIP(rest)
 	}
 
 	// 尝试解析日志时间
@@ -278,6 +851,7 @@ func (lac *LoginAssetsCollector) parseFailedLoginFromLog(line string) *protocol.
 	return &protocol.LoginRecord{
 		Username:  username,
 		IP:        ip,
+		IPParseOK: ipParseOK,
 		Terminal:  "ssh",
 		Timestamp: timestamp,
 		Status:    "failed",
@@ -292,6 +866,11 @@ func (lac *LoginAssetsCollector) parseSyslogTime(line string) int64 {
 		return time.Now().UnixMilli()
 	}
 
+	// rsyslog 高精度格式: 2024-12-25T10:30:00.123456+08:00
+	if t, err := time.Parse(time.RFC3339Nano, fields[0]); err == nil {
+		return t.UnixMilli()
+	}
+
 	// 获取当前年份（syslog不包含年份）
 	currentYear := time.Now().Year()
 
@@ -316,17 +895,31 @@ func (lac *LoginAssetsCollector) parseSyslogTime(line string) int64 {
 	return time.Now().UnixMilli()
 }
 
-// collectCurrentSessions 收集当前登录会话
-func (lac *LoginAssetsCollector) collectCurrentSessions() []protocol.LoginSession {
+// collectCurrentSessions 收集当前登录会话，w 和 utmp 都无法读取时返回错误
+func (lac *LoginAssetsCollector) collectCurrentSessions() ([]protocol.LoginSession, error) {
 	var sessions []protocol.LoginSession
 
-	// 使用 w 命令
-	output, err := lac.executor.Execute("w", "-h")
-	if err != nil {
-		globalLogger.Debug("获取当前登录失败: %v", err)
-		return sessions
+	// 使用 w 命令，BusyBox 等实现不支持 -h 时不带参数重试，输出的 uptime 行和标题行在解析时跳过
+	output, wErr := lac.execute("w", "-h")
+	if wErr != nil {
+		globalLogger.Debug("w -h 失败，不带参数重试: %v", wErr)
+		output, wErr = lac.execute("w")
+	}
+	if wErr != nil {
+		globalLogger.Debug("获取当前登录失败: %v", wErr)
+
+		// 直接读取 utmp
+		sessions, err := lac.collectCurrentSessionsFromUtmp()
+		if err != nil {
+			globalLogger.Debug("直接读取utmp失败: %v", err)
+			return sessions, errors.Join(fmt.Errorf("w: %w", wErr), fmt.Errorf("读取utmp: %w", err))
+		}
+		lac.applySessionPIDs(sessions)
+		return sessions, nil
 	}
 
+	resolved := make(map[string]string)
+	layout := procpsWLayout
 	lines := strings.Split(output, "\n")
 	for _, line := range lines {
 		line = strings.TrimSpace(line)
@@ -335,38 +928,58 @@ func (lac *LoginAssetsCollector) collectCurrentSessions() []protocol.LoginSessio
 		}
 
 		fields := strings.Fields(line)
-		if len(fields) < 4 {
+		if isWBanner(fields) {
+			continue
+		}
+		if header, ok := parseWHeader(fields); ok {
+			layout = header
+			continue
+		}
+		if len(fields) < 3 || !layout.busybox && len(fields) < 4 {
 			continue
 		}
 
 		username := fields[0]
 		terminal := fields[1]
-		fromIP := fields[2]
-
-		// 处理本地会话
-		if fromIP == "-" || fromIP == "" {
-			fromIP = "localhost"
+		fromIP := layout.source(fields)
+
+		// 处理本地会话，远程来源可能是 IPv6、带有 :display 后缀或主机名 (可能被 w 截断)
+		ipParseOK := false
+		hostname := ""
+		if source := normalizeSource(fromIP); isLocalSource(source) {
+			fromIP = source
+		} else if ip, ok := parseSourceIP(fromIP); ok {
+			fromIP, ipParseOK = ip, true
+		} else {
+			fromIP, hostname = "", ip
+			if resolved := lac.resolveSessionHost(hostname, resolved); resolved != "" {
+				fromIP, ipParseOK = resolved, true
+			}
 		}
 
-		// 解析空闲时间
-		idleStr := fields[3]
-		idleSeconds := lac.parseIdleTime(idleStr)
+		// 解析空闲时间 (procps 的列: USER TTY FROM LOGIN@ IDLE ...)
+		idleSeconds := layout.idleSeconds(lac, fields)
 
-		// 解析登录时间（从空闲时间推算）
+		// 登录时间先从空闲时间推算，之后以 utmp 中的实际登录时间为准
 		loginTime := time.Now().Add(-time.Duration(idleSeconds) * time.Second).UnixMilli()
 
 		session := protocol.LoginSession{
-			Username:  username,
-			Terminal:  terminal,
-			IP:        fromIP,
-			LoginTime: loginTime,
-			IdleTime:  idleSeconds,
+			Username:       username,
+			Terminal:       terminal,
+			IP:             fromIP,
+			IPParseOK:      ipParseOK,
+			Hostname:       hostname,
+			LoginTime:      loginTime,
+			IdleTime:       idleSeconds,
+			CurrentProcess: layout.process(fields),
 		}
 
 		sessions = append(sessions, session)
 	}
 
-	return sessions
+	lac.applyUtmpLoginTimes(sessions)
+	lac.applySessionPIDs(sessions)
+	return sessions, nil
 }
 
 // parseIdleTime 解析空闲时间字符串
@@ -375,28 +988,38 @@ func (lac *LoginAssetsCollector) parseIdleTime(idleStr string) int {
 		return 0
 	}
 
-	// 支持格式: "1.00s", "2:30", "1:00m", "3days"
+	// 支持格式: "1.00s", "2:30", "1:00m", "45m", "3days", "14Jan24"
 	idleStr = strings.TrimSpace(idleStr)
 
-	// 秒
-	if strings.HasSuffix(idleStr, "s") {
+	// 秒 ("3days" 同样以 s 结尾，由后面按天处理)
+	if strings.HasSuffix(idleStr, "s") && !strings.Contains(idleStr, "day") {
 		var seconds float64
 		if _, err := fmt.Sscanf(idleStr, "%f", &seconds); err == nil {
 			return int(seconds)
 		}
 	}
 
-	// 分:秒 或 时:分
+	// 分:秒 ("2:30") 或 时:分 ("1:05m")
 	if strings.Contains(idleStr, ":") {
 		parts := strings.Split(idleStr, ":")
 		if len(parts) == 2 {
-			var hours, minutes int
-			if _, err := fmt.Sscanf(idleStr, "%d:%d", &hours, &minutes); err == nil {
-				return hours*3600 + minutes*60
+			var major, minor int
+			if _, err := fmt.Sscanf(idleStr, "%d:%d", &major, &minor); err == nil {
+				if strings.HasSuffix(idleStr, "m") {
+					return major*3600 + minor*60
+				}
+				return major*60 + minor
 			}
 		}
 	}
 
+	// 只有分钟 ("45m")
+	if minutes, ok := strings.CutSuffix(idleStr, "m"); ok {
+		if n, err := strconv.Atoi(minutes); err == nil && n >= 0 {
+			return n * 60
+		}
+	}
+
 	// 天
 	if strings.Contains(idleStr, "day") {
 		var days int
@@ -405,9 +1028,112 @@ func (lac *LoginAssetsCollector) parseIdleTime(idleStr string) int {
 		}
 	}
 
+	// 空闲超过一定时间后部分版本输出开始空闲的日期 ("14Jan24")，按到当前时间的间隔估算
+	if since, err := time.ParseInLocation("02Jan06", idleStr, time.Local); err == nil {
+		if idle := lac.now().Sub(since); idle > 0 {
+			return int(idle.Seconds())
+		}
+		return 0
+	}
+
+	globalLogger.Debug("无法识别的空闲时间: %s", idleStr)
 	return 0
 }
 
+// normalize 填充归属地之后执行记录转换，再按转换后的用户名过滤，之后按规范化的来源标记 NAT 出口、
+// 按别名表规范化终端并计算记录标识
+func (lac *LoginAssetsCollector) normalize(assets *protocol.LoginAssets) {
+	lac.resolveLocations(assets)
+	lac.transforms.Apply(assets)
+	filterLoginUsers(assets, lac.userFilter)
+	if lac.config.LoginConfig.DeduplicateRecords {
+		assets.SuccessfulLogins = dedupLoginRecords(assets.SuccessfulLogins)
+		assets.FailedLogins = dedupLoginRecords(assets.FailedLogins)
+	}
+	tagNATSources(assets, lac.natSources)
+	lac.terminalAliases.Apply(assets)
+	assignRecordIDs(assets)
+}
+
+// filterLoginUsers 按用户过滤器去除登录记录、当前会话、最近登录和账户锁定，在记录转换之后进行，过滤条目匹配转换后的用户名
+func filterLoginUsers(assets *protocol.LoginAssets, filter *userFilter) {
+	if filter == nil {
+		return
+	}
+	assets.SuccessfulLogins = filterUsers(assets.SuccessfulLogins, filter, func(r protocol.LoginRecord) string { return r.Username })
+	assets.FailedLogins = filterUsers(assets.FailedLogins, filter, func(r protocol.LoginRecord) string { return r.Username })
+	assets.CurrentSessions = filterUsers(assets.CurrentSessions, filter, func(s protocol.LoginSession) string { return s.Username })
+	assets.LastLogins = filterUsers(assets.LastLogins, filter, func(e protocol.LastLoginEntry) string { return e.Username })
+	assets.AccountLockouts = filterUsers(assets.AccountLockouts, filter, func(l protocol.AccountLockout) string { return l.Username })
+}
+
+// filterUsers 保留用户过滤器放行的条目，原地过滤
+func filterUsers[T any](items []T, filter *userFilter, username func(T) string) []T {
+	if filter == nil {
+		return items
+	}
+	kept := items[:0]
+	for _, item := range items {
+		if filter.Allows(username(item)) {
+			kept = append(kept, item)
+		}
+	}
+	return kept
+}
+
+// countLoginsByHour 成功登录按一天中的小时统计，时间无法解析的记录不计入
+func countLoginsByHour(logins []protocol.LoginRecord, location *time.Location) [24]int {
+	var hours [24]int
+	for _, login := range logins {
+		if login.TimestampEstimated || login.Timestamp <= 0 {
+			continue
+		}
+		hours[time.UnixMilli(login.Timestamp).In(location).Hour()]++
+	}
+	return hours
+}
+
+// dedupLoginRecords 去除用户名、终端、IP和时间都相同的重复记录，保留第一条
+func dedupLoginRecords(records []protocol.LoginRecord) []protocol.LoginRecord {
+	type recordKey struct {
+		username, terminal, ip string
+		timestamp              int64
+	}
+	seen := make(map[recordKey]bool, len(records))
+	deduped := records[:0]
+	for _, record := range records {
+		key := recordKey{record.Username, record.Terminal, record.IP, record.Timestamp}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		deduped = append(deduped, record)
+	}
+	if removed := len(records) - len(deduped); removed > 0 {
+		globalLogger.Debug("去除 %d 条重复的登录记录", removed)
+	}
+	return deduped
+}
+
+// assignRecordIDs 为全部登录记录计算稳定的记录标识
+func assignRecordIDs(assets *protocol.LoginAssets) {
+	for _, records := range [][]protocol.LoginRecord{assets.SuccessfulLogins, assets.FailedLogins} {
+		for i := range records {
+			records[i].RecordID = protocol.LoginRecordID(records[i])
+		}
+	}
+}
+
+// classifySessions 按空闲阈值标记空闲和长期空闲的会话
+func (lac *LoginAssetsCollector) classifySessions(sessions []protocol.LoginSession) {
+	idle := int(lac.config.LoginConfig.SessionIdleThreshold.Seconds())
+	stale := int(lac.config.LoginConfig.SessionStaleThreshold.Seconds())
+	for i := range sessions {
+		sessions[i].IsStale = stale > 0 && sessions[i].IdleTime > stale
+		sessions[i].IsIdle = sessions[i].IsStale || (idle > 0 && sessions[i].IdleTime > idle)
+	}
+}
+
 // calculateStatistics 计算统计信息
 func (lac *LoginAssetsCollector) calculateStatistics(assets *protocol.LoginAssets) *protocol.LoginStatistics {
 	stats := &protocol.LoginStatistics{
@@ -422,17 +1148,76 @@ func (lac *LoginAssetsCollector) calculateStatistics(assets *protocol.LoginAsset
 	for _, login := range assets.SuccessfulLogins {
 		stats.UniqueIPs[login.IP]++
 		stats.UniqueUsers[login.Username]++
+		if login.EndReason == protocol.SessionEndCrash {
+			stats.CrashTerminatedSessions++
+		}
 	}
 
-	// 查找高频IP
-	for ip, count := range stats.UniqueIPs {
-		if count > 10 {
-			if stats.HighFrequencyIPs == nil {
-				stats.HighFrequencyIPs = make(map[string]int)
+	stats.LoginsByCountry = countLoginsByCountry(assets.SuccessfulLogins)
+	stats.LoginsByHour = countLoginsByHour(assets.SuccessfulLogins, analysisLocation(lac.config))
+
+	// 按空闲状态统计当前会话
+	for _, session := range assets.CurrentSessions {
+		switch {
+		case session.IsStale:
+			stats.StaleSessions++
+			if session.Username == "root" {
+				stats.StaleRootSessions++
 			}
-			stats.HighFrequencyIPs[ip] = count
+		case session.IsIdle:
+			stats.IdleSessions++
+		default:
+			stats.ActiveSessions++
 		}
 	}
 
+	stats.RootLogins = rootLogins(assets.SuccessfulLogins)
+
+	// 按用户汇总，与统计信息一样在裁剪前计算
+	assets.UserSummaries = summarizeUsers(assets)
+
+	// 执行分析器 (包括查找高频IP)
+	lac.runFindingAnalyzers(assets, stats)
+
+	// 首次出现的来源 (需要设置历史来源)
+	if lac.knownUserIPs != nil {
+		stats.NewSourceLogins = FindNewSourceLogins(assets.SuccessfulLogins, lac.knownUserIPs)
+	}
+
 	return stats
 }
+
+// maxLoginRecords 成功和失败登录各自收集的最大记录数，未配置时默认 100
+func maxLoginRecords(config *Config) int {
+	if config.LoginConfig.MaxLoginRecords > 0 {
+		return config.LoginConfig.MaxLoginRecords
+	}
+	return 100
+}
+
+// loginCommandTimeout 登录相关命令的超时时间，未配置时默认 30 秒
+func loginCommandTimeout(config *Config) time.Duration {
+	if config.LoginConfig.CommandTimeout > 0 {
+		return config.LoginConfig.CommandTimeout
+	}
+	return 30 * time.Second
+}
+
+// execute 执行登录相关命令，超时后结束进程
+func (lac *LoginAssetsCollector) execute(name string, args ...string) (string, error) {
+	runner, ok := lac.executor.(contextCommandRunner)
+	if !ok {
+		return lac.executor.Execute(name, args...)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), loginCommandTimeout(lac.config))
+	defer cancel()
+	return runner.ExecuteContextEnv(ctx, nil, name, args...)
+}
+
+// highFrequencyIPThreshold 高频IP阈值，未配置时默认 10
+func highFrequencyIPThreshold(config *Config) int {
+	if config.LoginConfig.HighFrequencyIPThreshold > 0 {
+		return config.LoginConfig.HighFrequencyIPThreshold
+	}
+	return 10
+}
@@ -0,0 +1,183 @@
+package audit
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/dushixiang/pika/internal/protocol"
+)
+
+// LoginAnalyzer 登录分析器
+// 每个分析器都必须能针对单条记录解释判定过程，便于排查误报和漏报
+type LoginAnalyzer interface {
+	// Name 分析器名称
+	Name() string
+
+	// Explain 解释单条记录是否命中，assets 为该记录所属的收集结果
+	// 实现必须是只读的，不得修改 assets 或产生其他副作用
+	Explain(assets *protocol.LoginAssets, record protocol.LoginRecord) AnalyzerExplanation
+}
+
+// findingAnalyzer 产生告警的分析器，分析结果写入统计信息
+type findingAnalyzer interface {
+	LoginAnalyzer
+
+	// AnalyzeInto 分析全部记录并将结果写入 stats
+	AnalyzeInto(assets *protocol.LoginAssets, stats *protocol.LoginStatistics)
+}
+
+// AnalyzerExplanation 分析器对单条记录的判定说明
+type AnalyzerExplanation struct {
+	Analyzer string `json:"analyzer"` // 分析器名称
+	Fired    bool   `json:"fired"`    // 是否命中
+	Detail   string `json:"detail"`   // 判定依据 (参与比较的具体数值)
+}
+
+// defaultLoginAnalyzers 默认启用的分析器，now 为判断会话时长等使用的当前时间
+func defaultLoginAnalyzers(config *Config, now func() time.Time) []LoginAnalyzer {
+	analyzers := []LoginAnalyzer{
+		&highFrequencyIPAnalyzer{threshold: highFrequencyIPThreshold(config)},
+		newTerminalBurstAnalyzer(config),
+		newScriptedTimingAnalyzer(config),
+		newBruteForceAnalyzer(config),
+		newTimingPatternAnalyzer(config),
+		newLongLivedSessionAnalyzer(config, now),
+		newConcurrentSessionAnalyzer(config, now),
+	}
+	if config.LoginConfig.BusinessHoursStart != config.LoginConfig.BusinessHoursEnd {
+		analyzers = append(analyzers, newOffHoursAnalyzer(config))
+	}
+	if len(config.LoginConfig.SharedAccounts) > 0 {
+		analyzers = append(analyzers, newSharedAccountAnalyzer(config))
+	}
+	if config.LoginConfig.KeyOnlyAuth {
+		analyzers = append(analyzers, &keyOnlyAuthAnalyzer{})
+	}
+	if len(config.LoginConfig.BastionSources) > 0 {
+		analyzers = append(analyzers, newBastionBypassAnalyzer(config))
+	}
+	if len(config.LoginConfig.ExpectedCountries) > 0 {
+		analyzers = append(analyzers, newForeignLoginAnalyzer(config))
+	}
+	return analyzers
+}
+
+// Explain 使用当前配置的全部分析器解释单条登录记录
+func (lac *LoginAssetsCollector) Explain(assets *protocol.LoginAssets, record protocol.LoginRecord) []AnalyzerExplanation {
+	if assets == nil {
+		assets = &protocol.LoginAssets{}
+	}
+
+	explanations := make([]AnalyzerExplanation, 0, len(lac.analyzers))
+	for _, analyzer := range lac.analyzers {
+		explanations = append(explanations, analyzer.Explain(assets, record))
+	}
+	return explanations
+}
+
+// runFindingAnalyzers 执行全部产生告警的分析器，设置了指标输出时记录每个分析器的执行和告警次数
+func (lac *LoginAssetsCollector) runFindingAnalyzers(assets *protocol.LoginAssets, stats *protocol.LoginStatistics) {
+	for _, analyzer := range lac.analyzers {
+		fa, ok := analyzer.(findingAnalyzer)
+		if !ok {
+			continue
+		}
+		before := analyzerFindings(stats)
+		fa.AnalyzeInto(assets, stats)
+		lac.recordAnalyzerRun(analyzer.Name(), analyzerFindings(stats)-before)
+	}
+}
+
+// ExplainSession 使用当前配置的全部分析器解释单个会话
+func (lac *LoginAssetsCollector) ExplainSession(assets *protocol.LoginAssets, session protocol.LoginSession) []AnalyzerExplanation {
+	return lac.Explain(assets, protocol.LoginRecord{
+		Username:  session.Username,
+		IP:        session.IP,
+		Location:  session.Location,
+		Terminal:  session.Terminal,
+		Timestamp: session.LoginTime,
+		Status:    "session",
+	})
+}
+
+// highFrequencyIPAnalyzer 高频登录IP分析器
+type highFrequencyIPAnalyzer struct {
+	threshold int
+}
+
+func (a *highFrequencyIPAnalyzer) Name() string {
+	return "high-frequency-ip"
+}
+
+// AnalyzeInto 查找每小时成功登录次数达到阈值的来源，NAT 出口代表多个用户，不参与判断
+// 结果按频率从高到低排列
+func (a *highFrequencyIPAnalyzer) AnalyzeInto(assets *protocol.LoginAssets, stats *protocol.LoginStatistics) {
+	natIPs := natSourceIPs(assets.SuccessfulLogins)
+	for ip, rate := range loginRates(assets.SuccessfulLogins) {
+		if rate.RatePerHour >= float64(a.threshold) && !natIPs[ip] {
+			stats.HighFrequencyIPs = append(stats.HighFrequencyIPs, *rate)
+		}
+	}
+	sort.Slice(stats.HighFrequencyIPs, func(i, j int) bool {
+		if stats.HighFrequencyIPs[i].RatePerHour != stats.HighFrequencyIPs[j].RatePerHour {
+			return stats.HighFrequencyIPs[i].RatePerHour > stats.HighFrequencyIPs[j].RatePerHour
+		}
+		return stats.HighFrequencyIPs[i].IP < stats.HighFrequencyIPs[j].IP
+	})
+}
+
+// loginRates 按来源IP统计成功登录次数和每小时登录次数
+// 跨度为最早与最晚登录的间隔，不足1小时按1小时计，避免少量登录被放大成很高的频率；没有时间的记录只计入次数
+func loginRates(logins []protocol.LoginRecord) map[string]*protocol.HighFrequencyIP {
+	rates := make(map[string]*protocol.HighFrequencyIP)
+	for _, login := range logins {
+		rate := rates[login.IP]
+		if rate == nil {
+			rate = &protocol.HighFrequencyIP{IP: login.IP}
+			rates[login.IP] = rate
+		}
+		rate.Count++
+		if login.Timestamp <= 0 {
+			continue
+		}
+		if rate.FirstLogin == 0 || login.Timestamp < rate.FirstLogin {
+			rate.FirstLogin = login.Timestamp
+		}
+		rate.LastLogin = max(rate.LastLogin, login.Timestamp)
+	}
+
+	for _, rate := range rates {
+		hours := max(float64(rate.LastLogin-rate.FirstLogin)/float64(time.Hour.Milliseconds()), 1)
+		rate.RatePerHour = float64(rate.Count) / hours
+	}
+	return rates
+}
+
+func (a *highFrequencyIPAnalyzer) Explain(assets *protocol.LoginAssets, record protocol.LoginRecord) AnalyzerExplanation {
+	if record.BehindNAT || natSourceIPs(assets.SuccessfulLogins)[record.IP] {
+		return AnalyzerExplanation{
+			Analyzer: a.Name(),
+			Detail:   fmt.Sprintf("%s: %s is a NAT egress shared by many users, not counted", a.Name(), record.IP),
+		}
+	}
+
+	rate := loginRates(assets.SuccessfulLogins)[record.IP]
+	if rate == nil {
+		rate = &protocol.HighFrequencyIP{IP: record.IP}
+	}
+
+	fired := rate.RatePerHour >= float64(a.threshold)
+	op := "<"
+	if fired {
+		op = ">="
+	}
+
+	span := time.Duration(rate.LastLogin-rate.FirstLogin) * time.Millisecond
+	return AnalyzerExplanation{
+		Analyzer: a.Name(),
+		Fired:    fired,
+		Detail: fmt.Sprintf("%s: %d successful logins from %s over %s (%.1f/h) %s %d/h threshold",
+			a.Name(), rate.Count, record.IP, span, rate.RatePerHour, op, a.threshold),
+	}
+}
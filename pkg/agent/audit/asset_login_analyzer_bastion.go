@@ -0,0 +1,128 @@
+package audit
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+
+	"github.com/dushixiang/pika/internal/protocol"
+)
+
+// sourceMatcher 来源匹配，支持 IP、CIDR 和主机名 (不区分大小写)
+type sourceMatcher struct {
+	prefixes  []netip.Prefix
+	hostnames map[string]bool
+}
+
+func newSourceMatcher(sources []string) *sourceMatcher {
+	m := &sourceMatcher{hostnames: make(map[string]bool)}
+	for _, source := range sources {
+		source = strings.TrimSpace(source)
+		if source == "" {
+			continue
+		}
+		if prefix, err := netip.ParsePrefix(source); err == nil {
+			m.prefixes = append(m.prefixes, prefix.Masked())
+			continue
+		}
+		if addr, err := netip.ParseAddr(source); err == nil {
+			m.prefixes = append(m.prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		m.hostnames[normalizeHostname(source)] = true
+	}
+	return m
+}
+
+// Match 来源IP或主机名是否匹配，返回命中的条目
+func (m *sourceMatcher) Match(ip, hostname string) (string, bool) {
+	if addr, err := netip.ParseAddr(strings.Trim(ip, "[]")); err == nil {
+		addr = addr.Unmap()
+		for _, prefix := range m.prefixes {
+			if prefix.Contains(addr) {
+				return prefix.String(), true
+			}
+		}
+	}
+	for _, name := range []string{ip, hostname} {
+		name = normalizeHostname(name)
+		if name != "" && m.hostnames[name] {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// isLoopbackSource 本机来源 (端口转发等) 不经过网络，不视为绕过
+func isLoopbackSource(ip string) bool {
+	if ip == "" || strings.HasPrefix(ip, "localhost") {
+		return true
+	}
+	addr, err := netip.ParseAddr(strings.Trim(ip, "[]"))
+	return err == nil && addr.Unmap().IsLoopback()
+}
+
+// bastionBypassAnalyzer 堡垒机绕过分析器
+// 内部主机只应经由堡垒机访问，来自其他来源的 SSH 登录成功违反网络分段策略
+type bastionBypassAnalyzer struct {
+	bastions *sourceMatcher
+}
+
+func newBastionBypassAnalyzer(config *Config) *bastionBypassAnalyzer {
+	return &bastionBypassAnalyzer{bastions: newSourceMatcher(config.LoginConfig.BastionSources)}
+}
+
+func (a *bastionBypassAnalyzer) Name() string {
+	return "bastion-bypass"
+}
+
+// isSSHLogin 是否为网络登录 (本地控制台、图形界面不受堡垒机策略约束)
+func isSSHLogin(record protocol.LoginRecord) bool {
+	return classifyTerminal(record.Terminal) == TerminalTypeNetwork && !isLoopbackSource(record.IP)
+}
+
+// Analyze 检测来源不是堡垒机的 SSH 登录成功
+func (a *bastionBypassAnalyzer) Analyze(assets *protocol.LoginAssets) []protocol.BastionBypass {
+	var findings []protocol.BastionBypass
+	for _, login := range assets.SuccessfulLogins {
+		if !isSSHLogin(login) {
+			continue
+		}
+		if _, ok := a.bastions.Match(login.IP, login.Hostname); ok {
+			continue
+		}
+		findings = append(findings, protocol.BastionBypass{
+			Username:   login.Username,
+			IP:         login.IP,
+			Hostname:   login.Hostname,
+			Terminal:   login.Terminal,
+			Timestamp:  login.Timestamp,
+			AuthMethod: login.AuthMethod,
+		})
+	}
+	return findings
+}
+
+func (a *bastionBypassAnalyzer) AnalyzeInto(assets *protocol.LoginAssets, stats *protocol.LoginStatistics) {
+	stats.BastionBypasses = a.Analyze(assets)
+}
+
+func (a *bastionBypassAnalyzer) Explain(assets *protocol.LoginAssets, record protocol.LoginRecord) AnalyzerExplanation {
+	explanation := AnalyzerExplanation{Analyzer: a.Name()}
+
+	switch {
+	case record.Status != "success" && record.Status != "session":
+		explanation.Detail = fmt.Sprintf("%s: only successful logins and sessions are checked, status is %q", a.Name(), record.Status)
+	case !isSSHLogin(record):
+		explanation.Detail = fmt.Sprintf("%s: terminal %s from %q is not a remote SSH login", a.Name(), record.Terminal, record.IP)
+	default:
+		if matched, ok := a.bastions.Match(record.IP, record.Hostname); ok {
+			explanation.Detail = fmt.Sprintf("%s: source %s matches bastion %s", a.Name(), record.IP, matched)
+		} else {
+			explanation.Fired = true
+			explanation.Detail = fmt.Sprintf("%s: source %s matches none of %d configured bastion sources",
+				a.Name(), record.IP, len(a.bastions.prefixes)+len(a.bastions.hostnames))
+		}
+	}
+	return explanation
+}
@@ -0,0 +1,112 @@
+package audit
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/dushixiang/pika/internal/protocol"
+)
+
+// bruteForceAnalyzer 暴力破解分析器
+// 同一来源在滑动时间窗口内的失败次数达到阈值时告警，比只统计唯一IP更能反映攻击过程
+type bruteForceAnalyzer struct {
+	window    time.Duration
+	threshold int
+}
+
+func newBruteForceAnalyzer(config *Config) *bruteForceAnalyzer {
+	a := &bruteForceAnalyzer{
+		window:    config.LoginConfig.BruteForceWindow,
+		threshold: config.LoginConfig.BruteForceThreshold,
+	}
+	if a.window <= 0 {
+		a.window = time.Minute
+	}
+	if a.threshold <= 0 {
+		a.threshold = 10
+	}
+	return a
+}
+
+func (a *bruteForceAnalyzer) Name() string {
+	return "brute-force"
+}
+
+// failedByIP 按来源分组的失败登录，lastb 的输出不保证按时间排列，分组后按时间排序
+func (a *bruteForceAnalyzer) failedByIP(assets *protocol.LoginAssets) map[string][]protocol.LoginRecord {
+	byIP := make(map[string][]protocol.LoginRecord)
+	for _, login := range assets.FailedLogins {
+		if login.IP == "" || login.IP == "unknown" {
+			continue
+		}
+		byIP[login.IP] = append(byIP[login.IP], login)
+	}
+	for _, logins := range byIP {
+		sort.SliceStable(logins, func(i, j int) bool {
+			return logins[i].Timestamp < logins[j].Timestamp
+		})
+	}
+	return byIP
+}
+
+func (a *bruteForceAnalyzer) AnalyzeInto(assets *protocol.LoginAssets, stats *protocol.LoginStatistics) {
+	stats.BruteForceAttempts = a.Analyze(assets)
+}
+
+// Analyze 检测全部来源失败次数最多的窗口
+func (a *bruteForceAnalyzer) Analyze(assets *protocol.LoginAssets) []protocol.BruteForceAlert {
+	var alerts []protocol.BruteForceAlert
+	for ip, logins := range a.failedByIP(assets) {
+		start, end := densestWindow(logins, a.window, 0)
+		if end-start+1 < a.threshold {
+			continue
+		}
+
+		window := logins[start : end+1]
+		alert := protocol.BruteForceAlert{
+			IP:          ip,
+			Count:       len(window),
+			WindowStart: window[0].Timestamp,
+			WindowEnd:   window[len(window)-1].Timestamp,
+		}
+		seen := make(map[string]bool)
+		for _, login := range window {
+			if !seen[login.Username] {
+				seen[login.Username] = true
+				alert.Usernames = append(alert.Usernames, login.Username)
+			}
+		}
+		alerts = append(alerts, alert)
+	}
+
+	sort.Slice(alerts, func(i, j int) bool {
+		if alerts[i].WindowStart != alerts[j].WindowStart {
+			return alerts[i].WindowStart < alerts[j].WindowStart
+		}
+		return alerts[i].IP < alerts[j].IP
+	})
+	return alerts
+}
+
+func (a *bruteForceAnalyzer) Explain(assets *protocol.LoginAssets, record protocol.LoginRecord) AnalyzerExplanation {
+	explanation := AnalyzerExplanation{Analyzer: a.Name()}
+
+	if record.Status != "failed" {
+		explanation.Detail = fmt.Sprintf("%s: %s record is not a failed login, not counted", a.Name(), record.Status)
+		return explanation
+	}
+
+	logins := a.failedByIP(assets)[record.IP]
+	start, end := densestWindow(logins, a.window, record.Timestamp)
+	count := end - start + 1
+
+	explanation.Fired = count >= a.threshold
+	op := "<"
+	if explanation.Fired {
+		op = ">="
+	}
+	explanation.Detail = fmt.Sprintf("%s: %d failed logins from %s within %s %s %d threshold",
+		a.Name(), count, record.IP, a.window, op, a.threshold)
+	return explanation
+}
@@ -0,0 +1,148 @@
+package audit
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/dushixiang/pika/internal/protocol"
+)
+
+// terminalBurstAnalyzer 终端突发分配分析器
+// 同一来源在短时间内分配大量 pts 终端，通常是自动化工具在复用连接而非人工交互
+type terminalBurstAnalyzer struct {
+	window    time.Duration
+	threshold int
+}
+
+func newTerminalBurstAnalyzer(config *Config) *terminalBurstAnalyzer {
+	a := &terminalBurstAnalyzer{
+		window:    config.LoginConfig.TerminalBurstWindow,
+		threshold: config.LoginConfig.TerminalBurstThreshold,
+	}
+	if a.window <= 0 {
+		a.window = time.Minute
+	}
+	if a.threshold <= 0 {
+		a.threshold = 8
+	}
+	return a
+}
+
+func (a *terminalBurstAnalyzer) Name() string {
+	return "terminal-burst"
+}
+
+// networkPTYLogins 按来源分组并按时间排序的网络终端登录
+// NAT 出口背后是多个用户，同时分配多个终端是正常的，不参与分组
+func (a *terminalBurstAnalyzer) networkPTYLogins(assets *protocol.LoginAssets) map[string][]protocol.LoginRecord {
+	byIP := make(map[string][]protocol.LoginRecord)
+	for _, login := range assets.SuccessfulLogins {
+		if isNetworkPTYLogin(login) && !login.BehindNAT {
+			byIP[login.IP] = append(byIP[login.IP], login)
+		}
+	}
+	for _, logins := range byIP {
+		sort.SliceStable(logins, func(i, j int) bool {
+			return logins[i].Timestamp < logins[j].Timestamp
+		})
+	}
+	return byIP
+}
+
+// densestWindow 查找 window 内记录最多的时间窗口，logins 需已按时间排序
+// within 不为 0 时只考虑包含该时间点的窗口
+func densestWindow(logins []protocol.LoginRecord, window time.Duration, within int64) (start, end int) {
+	windowMs := window.Milliseconds()
+	best := 0
+	for i, j := 0, 0; i < len(logins); i++ {
+		if j < i {
+			j = i
+		}
+		for j+1 < len(logins) && logins[j+1].Timestamp-logins[i].Timestamp <= windowMs {
+			j++
+		}
+		if within != 0 && (within < logins[i].Timestamp || within > logins[j].Timestamp) {
+			continue
+		}
+		if j-i+1 > best {
+			best = j - i + 1
+			start, end = i, j
+		}
+	}
+	if best == 0 {
+		return 0, -1
+	}
+	return start, end
+}
+
+func (a *terminalBurstAnalyzer) AnalyzeInto(assets *protocol.LoginAssets, stats *protocol.LoginStatistics) {
+	stats.AutomationSuspicions = a.Analyze(assets)
+}
+
+// Analyze 检测全部来源的终端突发分配
+func (a *terminalBurstAnalyzer) Analyze(assets *protocol.LoginAssets) []protocol.AutomationSuspicion {
+	var suspicions []protocol.AutomationSuspicion
+	for ip, logins := range a.networkPTYLogins(assets) {
+		start, end := densestWindow(logins, a.window, 0)
+		if end-start+1 <= a.threshold {
+			continue
+		}
+		suspicions = append(suspicions, a.suspicion(ip, logins[start:end+1]))
+	}
+
+	sort.Slice(suspicions, func(i, j int) bool {
+		return suspicions[i].WindowStart < suspicions[j].WindowStart
+	})
+	return suspicions
+}
+
+// suspicion 根据窗口内的记录构建告警
+func (a *terminalBurstAnalyzer) suspicion(ip string, logins []protocol.LoginRecord) protocol.AutomationSuspicion {
+	suspicion := protocol.AutomationSuspicion{
+		IP:            ip,
+		TerminalCount: len(logins),
+		WindowStart:   logins[0].Timestamp,
+		WindowEnd:     logins[len(logins)-1].Timestamp,
+	}
+
+	seenTerminals := make(map[string]bool)
+	seenUsers := make(map[string]bool)
+	for _, login := range logins {
+		if !seenTerminals[login.Terminal] {
+			seenTerminals[login.Terminal] = true
+			suspicion.Terminals = append(suspicion.Terminals, login.Terminal)
+		}
+		if !seenUsers[login.Username] {
+			seenUsers[login.Username] = true
+			suspicion.Usernames = append(suspicion.Usernames, login.Username)
+		}
+	}
+	return suspicion
+}
+
+func (a *terminalBurstAnalyzer) Explain(assets *protocol.LoginAssets, record protocol.LoginRecord) AnalyzerExplanation {
+	explanation := AnalyzerExplanation{Analyzer: a.Name()}
+
+	if !isNetworkPTYLogin(record) {
+		explanation.Detail = fmt.Sprintf("%s: terminal %q from %s is not a network pts, not counted", a.Name(), record.Terminal, record.IP)
+		return explanation
+	}
+	if record.BehindNAT || natSourceIPs(assets.SuccessfulLogins)[record.IP] {
+		explanation.Detail = fmt.Sprintf("%s: %s is a NAT egress shared by many users, not counted", a.Name(), record.IP)
+		return explanation
+	}
+
+	logins := a.networkPTYLogins(assets)[record.IP]
+	start, end := densestWindow(logins, a.window, record.Timestamp)
+	count := end - start + 1
+
+	explanation.Fired = count > a.threshold
+	op := "<="
+	if explanation.Fired {
+		op = ">"
+	}
+	explanation.Detail = fmt.Sprintf("%s: %d pts allocations from %s within %s %s %d threshold",
+		a.Name(), count, record.IP, a.window, op, a.threshold)
+	return explanation
+}
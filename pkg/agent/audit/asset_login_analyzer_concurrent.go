@@ -0,0 +1,181 @@
+package audit
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dushixiang/pika/internal/protocol"
+)
+
+// concurrentSessionAnalyzer 并发登录分析器
+// 同一用户同时从多个来源IP在线 (尤其是来自不同国家) 是账户被盗用的强烈信号。
+// 默认只检查当前会话，开启 ConcurrentSessionHistory 后同时检查历史登录记录中时间重叠的会话
+type concurrentSessionAnalyzer struct {
+	history bool
+	now     func() time.Time
+}
+
+func newConcurrentSessionAnalyzer(config *Config, now func() time.Time) *concurrentSessionAnalyzer {
+	return &concurrentSessionAnalyzer{
+		history: config.LoginConfig.ConcurrentSessionHistory,
+		now:     now,
+	}
+}
+
+func (a *concurrentSessionAnalyzer) Name() string {
+	return "concurrent-sessions"
+}
+
+// concurrentSpan 用户在线的时间段
+type concurrentSpan struct {
+	username string
+	source   protocol.ConcurrentSessionSource
+	end      int64
+}
+
+// spans 按用户分组的在线时间段，不含本机、回环地址、来源未知和来自 NAT 出口的会话
+// (NAT 出口背后有多个用户，同一用户经 NAT 与直连同时在线是常见情况)
+func (a *concurrentSessionAnalyzer) spans(assets *protocol.LoginAssets) map[string][]concurrentSpan {
+	now := a.now().UnixMilli()
+	byUser := make(map[string][]concurrentSpan)
+	terminals := make(map[string]bool)
+
+	for _, session := range assets.CurrentSessions {
+		terminals[session.Username+"\x00"+session.Terminal] = true
+		if !isRemoteSource(session.IP) || session.BehindNAT {
+			continue
+		}
+		byUser[session.Username] = append(byUser[session.Username], concurrentSpan{
+			username: session.Username,
+			source: protocol.ConcurrentSessionSource{
+				IP:        session.IP,
+				Location:  session.Location,
+				Terminal:  session.Terminal,
+				LoginTime: session.LoginTime,
+				Active:    true,
+			},
+			end: now,
+		})
+	}
+	if !a.history {
+		return byUser
+	}
+
+	for _, login := range assets.SuccessfulLogins {
+		if !isRemoteSource(login.IP) || login.BehindNAT || login.TimestampEstimated || login.Timestamp <= 0 {
+			continue
+		}
+		// 仍在线的记录即当前会话，已从当前会话中取得；没有登出时间 (crash/down) 的记录无法判断是否重叠
+		end := login.LogoutTime
+		if login.EndReason == "still_logged_in" {
+			if terminals[login.Username+"\x00"+login.Terminal] {
+				continue
+			}
+			end = now
+		}
+		if end <= 0 {
+			continue
+		}
+		byUser[login.Username] = append(byUser[login.Username], concurrentSpan{
+			username: login.Username,
+			source: protocol.ConcurrentSessionSource{
+				IP:        login.IP,
+				Location:  login.Location,
+				Terminal:  login.Terminal,
+				LoginTime: login.Timestamp,
+			},
+			end: end,
+		})
+	}
+	return byUser
+}
+
+// isRemoteSource 是否为参与并发判断的远程来源
+func isRemoteSource(ip string) bool {
+	return ip != "unknown" && !isLoopbackSource(ip)
+}
+
+// overlapping 与其他来源IP的时间段重叠的时间段
+func overlapping(spans []concurrentSpan) []concurrentSpan {
+	marked := make([]bool, len(spans))
+	for i := range spans {
+		for j := i + 1; j < len(spans); j++ {
+			if spans[i].source.IP == spans[j].source.IP {
+				continue
+			}
+			if spans[i].source.LoginTime <= spans[j].end && spans[j].source.LoginTime <= spans[i].end {
+				marked[i], marked[j] = true, true
+			}
+		}
+	}
+
+	var found []concurrentSpan
+	for i, span := range spans {
+		if marked[i] {
+			found = append(found, span)
+		}
+	}
+	return found
+}
+
+// Analyze 检测同时从多个来源IP在线的用户，按用户名排列
+func (a *concurrentSessionAnalyzer) Analyze(assets *protocol.LoginAssets) []protocol.ConcurrentSessionAlert {
+	var alerts []protocol.ConcurrentSessionAlert
+	for username, spans := range a.spans(assets) {
+		found := overlapping(spans)
+		if len(found) == 0 {
+			continue
+		}
+		sort.SliceStable(found, func(i, j int) bool {
+			return found[i].source.LoginTime < found[j].source.LoginTime
+		})
+
+		alert := protocol.ConcurrentSessionAlert{Username: username}
+		ips := make(map[string]struct{})
+		for _, span := range found {
+			ips[span.source.IP] = struct{}{}
+			alert.Sources = append(alert.Sources, span.source)
+		}
+		alert.IPs = sortedKeys(ips)
+		alerts = append(alerts, alert)
+	}
+
+	sort.Slice(alerts, func(i, j int) bool {
+		return alerts[i].Username < alerts[j].Username
+	})
+	return alerts
+}
+
+func (a *concurrentSessionAnalyzer) AnalyzeInto(assets *protocol.LoginAssets, stats *protocol.LoginStatistics) {
+	stats.ConcurrentAccess = a.Analyze(assets)
+}
+
+func (a *concurrentSessionAnalyzer) Explain(assets *protocol.LoginAssets, record protocol.LoginRecord) AnalyzerExplanation {
+	explanation := AnalyzerExplanation{Analyzer: a.Name()}
+	if record.Status != "success" && record.Status != "session" {
+		explanation.Detail = fmt.Sprintf("%s: only successful logins and sessions are checked, status is %q", a.Name(), record.Status)
+		return explanation
+	}
+	if !isRemoteSource(record.IP) {
+		explanation.Detail = fmt.Sprintf("%s: local source %q is not counted", a.Name(), record.IP)
+		return explanation
+	}
+
+	var others []string
+	for _, span := range overlapping(a.spans(assets)[record.Username]) {
+		if span.source.IP == record.IP && span.source.Terminal == record.Terminal {
+			explanation.Fired = true
+		} else if span.source.IP != record.IP {
+			others = append(others, span.source.IP)
+		}
+	}
+	if explanation.Fired {
+		explanation.Detail = fmt.Sprintf("%s: %s was online from %s at the same time as %s",
+			a.Name(), record.Username, record.IP, strings.Join(others, ", "))
+	} else {
+		explanation.Detail = fmt.Sprintf("%s: no session of %s from another IP overlaps this login", a.Name(), record.Username)
+	}
+	return explanation
+}
@@ -0,0 +1,68 @@
+package audit
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/dushixiang/pika/internal/protocol"
+)
+
+// foreignLoginAnalyzer 异地登录分析器
+// 来自预期国家以外的成功登录告警；内网IP和归属地未知的登录无法判断，不告警
+type foreignLoginAnalyzer struct {
+	expected map[string]bool
+}
+
+func newForeignLoginAnalyzer(config *Config) *foreignLoginAnalyzer {
+	a := &foreignLoginAnalyzer{expected: make(map[string]bool)}
+	for _, country := range config.LoginConfig.ExpectedCountries {
+		if country = strings.TrimSpace(country); country != "" {
+			a.expected[strings.ToLower(country)] = true
+		}
+	}
+	return a
+}
+
+func (a *foreignLoginAnalyzer) Name() string {
+	return "foreign-login"
+}
+
+// isForeign 归属地是否为预期国家以外的国家
+func (a *foreignLoginAnalyzer) isForeign(location string) bool {
+	country := locationCountry(location)
+	return country != "" && !a.expected[strings.ToLower(strings.TrimSpace(country))]
+}
+
+// Analyze 检测来自预期国家以外的成功登录
+func (a *foreignLoginAnalyzer) Analyze(assets *protocol.LoginAssets) []protocol.LoginRecord {
+	var foreign []protocol.LoginRecord
+	for _, login := range assets.SuccessfulLogins {
+		if a.isForeign(login.Location) {
+			foreign = append(foreign, login)
+		}
+	}
+	return foreign
+}
+
+func (a *foreignLoginAnalyzer) AnalyzeInto(assets *protocol.LoginAssets, stats *protocol.LoginStatistics) {
+	stats.ForeignLogins = a.Analyze(assets)
+}
+
+func (a *foreignLoginAnalyzer) Explain(assets *protocol.LoginAssets, record protocol.LoginRecord) AnalyzerExplanation {
+	explanation := AnalyzerExplanation{Analyzer: a.Name()}
+
+	country := locationCountry(record.Location)
+	switch {
+	case record.Status != "success":
+		explanation.Detail = fmt.Sprintf("%s: only successful logins are checked, status is %q", a.Name(), record.Status)
+	case country == "":
+		explanation.Detail = fmt.Sprintf("%s: location of %s is %s, not checked", a.Name(), record.IP, countryBucket(record.Location))
+	case a.isForeign(record.Location):
+		explanation.Fired = true
+		explanation.Detail = fmt.Sprintf("%s: country %q of %s is not one of %d expected countries",
+			a.Name(), country, record.IP, len(a.expected))
+	default:
+		explanation.Detail = fmt.Sprintf("%s: country %q of %s is expected", a.Name(), country, record.IP)
+	}
+	return explanation
+}
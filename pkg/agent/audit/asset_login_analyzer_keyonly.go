@@ -0,0 +1,78 @@
+package audit
+
+import (
+	"fmt"
+
+	"github.com/dushixiang/pika/internal/protocol"
+)
+
+// keyOnlyAuthAnalyzer 仅公钥登录策略分析器
+// 主机声明为仅允许公钥登录时，密码认证成功说明配置被改动或存在绕过
+type keyOnlyAuthAnalyzer struct{}
+
+func (a *keyOnlyAuthAnalyzer) Name() string {
+	return "key-only-auth"
+}
+
+// isPasswordAuth 是否为基于密码的认证方式
+func isPasswordAuth(method string) bool {
+	return method == protocol.AuthMethodPassword || method == protocol.AuthMethodKeyboardInteractive
+}
+
+// Analyze 检测全部成功登录中的密码认证
+// 结合 sshd 策略说明密码认证是否确实处于开启状态
+func (a *keyOnlyAuthAnalyzer) Analyze(assets *protocol.LoginAssets) []protocol.UnexpectedAuthMethod {
+	var findings []protocol.UnexpectedAuthMethod
+	for _, login := range assets.SuccessfulLogins {
+		if !isPasswordAuth(login.AuthMethod) {
+			continue
+		}
+
+		finding := protocol.UnexpectedAuthMethod{
+			Username:   login.Username,
+			IP:         login.IP,
+			Timestamp:  login.Timestamp,
+			AuthMethod: login.AuthMethod,
+		}
+		if policy := assets.SSHDPolicy; policy != nil {
+			finding.PolicySource = policy.Source
+			finding.PasswordAuthEnabled = passwordAuthEnabled(policy, login.AuthMethod)
+		}
+		findings = append(findings, finding)
+	}
+	return findings
+}
+
+// passwordAuthEnabled sshd 策略是否允许该密码类认证方式
+func passwordAuthEnabled(policy *protocol.SSHDPolicy, method string) bool {
+	if method == protocol.AuthMethodKeyboardInteractive {
+		return policy.KbdInteractiveAuth
+	}
+	return policy.PasswordAuthentication
+}
+
+func (a *keyOnlyAuthAnalyzer) AnalyzeInto(assets *protocol.LoginAssets, stats *protocol.LoginStatistics) {
+	stats.UnexpectedAuthMethods = a.Analyze(assets)
+}
+
+func (a *keyOnlyAuthAnalyzer) Explain(assets *protocol.LoginAssets, record protocol.LoginRecord) AnalyzerExplanation {
+	explanation := AnalyzerExplanation{Analyzer: a.Name()}
+
+	if record.AuthMethod == "" {
+		explanation.Detail = fmt.Sprintf("%s: auth method of %s from %s unknown", a.Name(), record.Username, record.IP)
+		return explanation
+	}
+	if !isPasswordAuth(record.AuthMethod) {
+		explanation.Detail = fmt.Sprintf("%s: %s from %s authenticated with %s", a.Name(), record.Username, record.IP, record.AuthMethod)
+		return explanation
+	}
+
+	explanation.Fired = true
+	policy := "sshd policy unavailable"
+	if assets.SSHDPolicy != nil {
+		policy = fmt.Sprintf("sshd policy (%s) allows it: %t", assets.SSHDPolicy.Source, passwordAuthEnabled(assets.SSHDPolicy, record.AuthMethod))
+	}
+	explanation.Detail = fmt.Sprintf("%s: %s from %s authenticated with %s on key-only host, %s",
+		a.Name(), record.Username, record.IP, record.AuthMethod, policy)
+	return explanation
+}
@@ -0,0 +1,116 @@
+package audit
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/dushixiang/pika/internal/protocol"
+)
+
+// longLivedSessionAnalyzer 超长会话分析器
+// 持续数天的会话 (尤其是 root 或堡垒机上的会话) 本身是风险，也常是被遗忘或废弃的访问。
+// 按账户类别使用不同的时长上限，root 和服务账户通常应比普通用户更严格
+type longLivedSessionAnalyzer struct {
+	limits          map[string]time.Duration
+	serviceAccounts map[string]bool
+	now             func() time.Time
+}
+
+func newLongLivedSessionAnalyzer(config *Config, now func() time.Time) *longLivedSessionAnalyzer {
+	a := &longLivedSessionAnalyzer{
+		limits: map[string]time.Duration{
+			protocol.AccountClassRoot:    config.LoginConfig.SessionMaxAge.Root,
+			protocol.AccountClassService: config.LoginConfig.SessionMaxAge.Service,
+			protocol.AccountClassHuman:   config.LoginConfig.SessionMaxAge.Human,
+		},
+		serviceAccounts: make(map[string]bool),
+		now:             now,
+	}
+	for _, account := range config.LoginConfig.ServiceAccounts {
+		a.serviceAccounts[account] = true
+	}
+	return a
+}
+
+func (a *longLivedSessionAnalyzer) Name() string {
+	return "long-lived-session"
+}
+
+// accountClass 账户所属的类别
+func (a *longLivedSessionAnalyzer) accountClass(username string) string {
+	switch {
+	case username == "root":
+		return protocol.AccountClassRoot
+	case a.serviceAccounts[username]:
+		return protocol.AccountClassService
+	default:
+		return protocol.AccountClassHuman
+	}
+}
+
+// check 会话的账户类别、已持续时间和上限，上限为 0 时不检查
+func (a *longLivedSessionAnalyzer) check(username string, loginTime int64) (class string, age, limit time.Duration) {
+	class = a.accountClass(username)
+	if loginTime > 0 {
+		age = a.now().Sub(time.UnixMilli(loginTime))
+	}
+	return class, age, a.limits[class]
+}
+
+// Analyze 检测持续时间超过上限的当前会话，按持续时间从长到短排列
+func (a *longLivedSessionAnalyzer) Analyze(assets *protocol.LoginAssets) []protocol.LongLivedSession {
+	var findings []protocol.LongLivedSession
+	for _, session := range assets.CurrentSessions {
+		class, age, limit := a.check(session.Username, session.LoginTime)
+		if limit <= 0 || age <= limit {
+			continue
+		}
+		findings = append(findings, protocol.LongLivedSession{
+			Username:      session.Username,
+			AccountClass:  class,
+			Terminal:      session.Terminal,
+			IP:            session.IP,
+			Hostname:      session.Hostname,
+			LoginTime:     session.LoginTime,
+			AgeSeconds:    int64(age.Seconds()),
+			MaxAgeSeconds: int64(limit.Seconds()),
+			IsIdle:        session.IsIdle,
+		})
+	}
+
+	sort.SliceStable(findings, func(i, j int) bool {
+		return findings[i].AgeSeconds > findings[j].AgeSeconds
+	})
+	return findings
+}
+
+func (a *longLivedSessionAnalyzer) AnalyzeInto(assets *protocol.LoginAssets, stats *protocol.LoginStatistics) {
+	stats.LongLivedSessions = a.Analyze(assets)
+}
+
+func (a *longLivedSessionAnalyzer) Explain(assets *protocol.LoginAssets, record protocol.LoginRecord) AnalyzerExplanation {
+	explanation := AnalyzerExplanation{Analyzer: a.Name()}
+
+	if record.Status != "session" {
+		explanation.Detail = fmt.Sprintf("%s: %s record is not a current session, not checked", a.Name(), record.Status)
+		return explanation
+	}
+
+	class, age, limit := a.check(record.Username, record.Timestamp)
+	switch {
+	case limit <= 0:
+		explanation.Detail = fmt.Sprintf("%s: no max age configured for %s account %s", a.Name(), class, record.Username)
+	case record.Timestamp <= 0:
+		explanation.Detail = fmt.Sprintf("%s: login time of %s on %s unknown", a.Name(), record.Username, record.Terminal)
+	default:
+		explanation.Fired = age > limit
+		op := "<="
+		if explanation.Fired {
+			op = ">"
+		}
+		explanation.Detail = fmt.Sprintf("%s: %s session of %s on %s open for %s %s %s max age",
+			a.Name(), class, record.Username, record.Terminal, age.Round(time.Minute), op, limit)
+	}
+	return explanation
+}
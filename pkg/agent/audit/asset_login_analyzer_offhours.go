@@ -0,0 +1,75 @@
+package audit
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/dushixiang/pika/internal/protocol"
+)
+
+// offHoursAnalyzer 非工作时间登录分析器
+// 逐条列出工作时间以外的成功登录；时间无法解析的记录 (使用收集时间代替) 不参与判断
+type offHoursAnalyzer struct {
+	start    int
+	end      int
+	location *time.Location
+}
+
+func newOffHoursAnalyzer(config *Config) *offHoursAnalyzer {
+	return &offHoursAnalyzer{
+		start:    config.LoginConfig.BusinessHoursStart,
+		end:      config.LoginConfig.BusinessHoursEnd,
+		location: analysisLocation(config),
+	}
+}
+
+func (a *offHoursAnalyzer) Name() string {
+	return "off-hours"
+}
+
+// isBusinessHour 小时是否在工作时间 [start, end) 内，可跨越午夜
+func (a *offHoursAnalyzer) isBusinessHour(hour int) bool {
+	if a.start < a.end {
+		return hour >= a.start && hour < a.end
+	}
+	return hour >= a.start || hour < a.end
+}
+
+// Analyze 检测工作时间以外的成功登录
+func (a *offHoursAnalyzer) Analyze(assets *protocol.LoginAssets) []protocol.LoginRecord {
+	var logins []protocol.LoginRecord
+	for _, login := range assets.SuccessfulLogins {
+		if login.TimestampEstimated || login.Timestamp <= 0 {
+			continue
+		}
+		if !a.isBusinessHour(time.UnixMilli(login.Timestamp).In(a.location).Hour()) {
+			logins = append(logins, login)
+		}
+	}
+	return logins
+}
+
+func (a *offHoursAnalyzer) AnalyzeInto(assets *protocol.LoginAssets, stats *protocol.LoginStatistics) {
+	stats.OffHoursLogins = a.Analyze(assets)
+}
+
+func (a *offHoursAnalyzer) Explain(assets *protocol.LoginAssets, record protocol.LoginRecord) AnalyzerExplanation {
+	explanation := AnalyzerExplanation{Analyzer: a.Name()}
+
+	switch {
+	case record.Status != "success":
+		explanation.Detail = fmt.Sprintf("%s: only successful logins are checked, status is %q", a.Name(), record.Status)
+	case record.TimestampEstimated || record.Timestamp <= 0:
+		explanation.Detail = fmt.Sprintf("%s: login time could not be parsed, not checked", a.Name())
+	default:
+		at := time.UnixMilli(record.Timestamp).In(a.location)
+		explanation.Fired = !a.isBusinessHour(at.Hour())
+		where := "inside"
+		if explanation.Fired {
+			where = "outside"
+		}
+		explanation.Detail = fmt.Sprintf("%s: login at %s is %s business hours %02d:00-%02d:00 (%s)",
+			a.Name(), at.Format("15:04"), where, a.start, a.end, a.location)
+	}
+	return explanation
+}
@@ -0,0 +1,137 @@
+package audit
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/dushixiang/pika/internal/protocol"
+)
+
+// scriptedTimingAnalyzer 脚本化尝试分析器
+// 人工尝试的间隔不规律，脚本的间隔几乎固定；即使次数低于阈值的慢速暴力破解也能识别
+type scriptedTimingAnalyzer struct {
+	minAttempts int
+	maxCV       float64
+}
+
+func newScriptedTimingAnalyzer(config *Config) *scriptedTimingAnalyzer {
+	a := &scriptedTimingAnalyzer{
+		minAttempts: config.LoginConfig.ScriptedMinAttempts,
+		maxCV:       config.LoginConfig.ScriptedMaxCV,
+	}
+	if a.minAttempts < 3 {
+		// 至少需要两个间隔才能计算离散程度
+		a.minAttempts = 3
+	}
+	if a.maxCV <= 0 {
+		a.maxCV = 0.1
+	}
+	return a
+}
+
+func (a *scriptedTimingAnalyzer) Name() string {
+	return "scripted-timing"
+}
+
+// attemptTimes 按来源分组并排序的失败尝试时间
+func (a *scriptedTimingAnalyzer) attemptTimes(assets *protocol.LoginAssets) map[string][]int64 {
+	byIP := make(map[string][]int64)
+	for _, login := range assets.FailedLogins {
+		if login.IP == "" || login.IP == "unknown" {
+			continue
+		}
+		byIP[login.IP] = append(byIP[login.IP], login.Timestamp)
+	}
+	for _, times := range byIP {
+		sort.Slice(times, func(i, j int) bool { return times[i] < times[j] })
+	}
+	return byIP
+}
+
+// gapStats 相邻尝试间隔的平均值、标准差和变异系数
+func gapStats(times []int64) (mean, stddev, cv float64) {
+	if len(times) < 2 {
+		return 0, 0, math.NaN()
+	}
+
+	gaps := make([]float64, 0, len(times)-1)
+	for i := 1; i < len(times); i++ {
+		gaps = append(gaps, float64(times[i]-times[i-1]))
+	}
+
+	for _, gap := range gaps {
+		mean += gap
+	}
+	mean /= float64(len(gaps))
+
+	for _, gap := range gaps {
+		stddev += (gap - mean) * (gap - mean)
+	}
+	stddev = math.Sqrt(stddev / float64(len(gaps)))
+
+	if mean <= 0 {
+		// 全部在同一时刻，无法判断节奏
+		return mean, stddev, math.NaN()
+	}
+	return mean, stddev, stddev / mean
+}
+
+// Analyze 检测全部来源的脚本化尝试
+func (a *scriptedTimingAnalyzer) Analyze(assets *protocol.LoginAssets) []protocol.ScriptedAttack {
+	var attacks []protocol.ScriptedAttack
+	for ip, times := range a.attemptTimes(assets) {
+		if len(times) < a.minAttempts {
+			continue
+		}
+		mean, stddev, cv := gapStats(times)
+		if math.IsNaN(cv) || cv >= a.maxCV {
+			continue
+		}
+		attacks = append(attacks, protocol.ScriptedAttack{
+			IP:                     ip,
+			Attempts:               len(times),
+			MeanIntervalMs:         mean,
+			StdDevIntervalMs:       stddev,
+			CoefficientOfVariation: cv,
+			FirstSeen:              times[0],
+			LastSeen:               times[len(times)-1],
+		})
+	}
+
+	sort.Slice(attacks, func(i, j int) bool {
+		return attacks[i].FirstSeen < attacks[j].FirstSeen
+	})
+	return attacks
+}
+
+func (a *scriptedTimingAnalyzer) AnalyzeInto(assets *protocol.LoginAssets, stats *protocol.LoginStatistics) {
+	stats.ScriptedAttacks = a.Analyze(assets)
+}
+
+func (a *scriptedTimingAnalyzer) Explain(assets *protocol.LoginAssets, record protocol.LoginRecord) AnalyzerExplanation {
+	explanation := AnalyzerExplanation{Analyzer: a.Name()}
+
+	times := a.attemptTimes(assets)[record.IP]
+	if len(times) < a.minAttempts {
+		explanation.Detail = fmt.Sprintf("%s: %d failed attempts from %s < %d required to judge timing",
+			a.Name(), len(times), record.IP, a.minAttempts)
+		return explanation
+	}
+
+	mean, _, cv := gapStats(times)
+	if math.IsNaN(cv) {
+		explanation.Detail = fmt.Sprintf("%s: %d failed attempts from %s share one timestamp, timing undetermined",
+			a.Name(), len(times), record.IP)
+		return explanation
+	}
+
+	explanation.Fired = cv < a.maxCV
+	op := ">="
+	if explanation.Fired {
+		op = "<"
+	}
+	explanation.Detail = fmt.Sprintf("%s: %d failed attempts from %s, mean gap %.1fs, gap CV %.3f %s %.3f threshold",
+		a.Name(), len(times), record.IP, mean/1000, cv, op, a.maxCV)
+	return explanation
+}
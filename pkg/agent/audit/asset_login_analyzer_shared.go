@@ -0,0 +1,164 @@
+package audit
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dushixiang/pika/internal/protocol"
+)
+
+// sharedAccountAnalyzer 共享账户来源广度分析器
+// 共享账户本身来源就很分散，不适用按用户的基线，只在来源广度超出该账户自身的阈值时告警
+type sharedAccountAnalyzer struct {
+	window   time.Duration
+	policies map[string]SharedAccountPolicy
+}
+
+func newSharedAccountAnalyzer(config *Config) *sharedAccountAnalyzer {
+	a := &sharedAccountAnalyzer{
+		window:   config.LoginConfig.SharedAccountWindow,
+		policies: config.LoginConfig.SharedAccounts,
+	}
+	if a.window <= 0 {
+		a.window = 24 * time.Hour
+	}
+	return a
+}
+
+func (a *sharedAccountAnalyzer) Name() string {
+	return "shared-account-breadth"
+}
+
+// sharedAccountBreadth 共享账户在窗口内的来源广度
+type sharedAccountBreadth struct {
+	networks    []string
+	countries   []string
+	windowStart int64
+	windowEnd   int64
+}
+
+// breadth 统计账户在窗口内的来源，窗口以 end 为结束时间，end 为 0 时以该账户最新的登录为准
+func (a *sharedAccountAnalyzer) breadth(assets *protocol.LoginAssets, username string, end int64) sharedAccountBreadth {
+	if end == 0 {
+		for _, login := range assets.SuccessfulLogins {
+			if login.Username == username && login.Timestamp > end {
+				end = login.Timestamp
+			}
+		}
+	}
+
+	b := sharedAccountBreadth{
+		windowStart: end - a.window.Milliseconds(),
+		windowEnd:   end,
+	}
+
+	networks := make(map[string]struct{})
+	countries := make(map[string]struct{})
+	for _, login := range assets.SuccessfulLogins {
+		if login.Username != username || login.Timestamp < b.windowStart || login.Timestamp > b.windowEnd {
+			continue
+		}
+		if network := sourceNetwork(login.IP); network != "" {
+			networks[network] = struct{}{}
+		}
+		if country := locationCountry(login.Location); country != "" {
+			countries[country] = struct{}{}
+		}
+	}
+
+	b.networks = sortedKeys(networks)
+	b.countries = sortedKeys(countries)
+	return b
+}
+
+// exceeds 来源广度是否超出阈值
+func (b sharedAccountBreadth) exceeds(policy SharedAccountPolicy) bool {
+	return (policy.MaxNetworks > 0 && len(b.networks) > policy.MaxNetworks) ||
+		(policy.MaxCountries > 0 && len(b.countries) > policy.MaxCountries)
+}
+
+// Analyze 检查全部共享账户
+func (a *sharedAccountAnalyzer) Analyze(assets *protocol.LoginAssets) []protocol.SharedAccountAlert {
+	var alerts []protocol.SharedAccountAlert
+	for username, policy := range a.policies {
+		b := a.breadth(assets, username, 0)
+		if !b.exceeds(policy) {
+			continue
+		}
+		alerts = append(alerts, protocol.SharedAccountAlert{
+			Username:     username,
+			Networks:     b.networks,
+			Countries:    b.countries,
+			MaxNetworks:  policy.MaxNetworks,
+			MaxCountries: policy.MaxCountries,
+			WindowStart:  b.windowStart,
+			WindowEnd:    b.windowEnd,
+		})
+	}
+
+	sort.Slice(alerts, func(i, j int) bool {
+		return alerts[i].Username < alerts[j].Username
+	})
+	return alerts
+}
+
+func (a *sharedAccountAnalyzer) AnalyzeInto(assets *protocol.LoginAssets, stats *protocol.LoginStatistics) {
+	stats.SharedAccountAlerts = a.Analyze(assets)
+}
+
+func (a *sharedAccountAnalyzer) Explain(assets *protocol.LoginAssets, record protocol.LoginRecord) AnalyzerExplanation {
+	policy, ok := a.policies[record.Username]
+	if !ok {
+		return AnalyzerExplanation{
+			Analyzer: a.Name(),
+			Detail:   fmt.Sprintf("%s: %s is not a configured shared account", a.Name(), record.Username),
+		}
+	}
+
+	b := a.breadth(assets, record.Username, record.Timestamp)
+	fired := b.exceeds(policy)
+
+	return AnalyzerExplanation{
+		Analyzer: a.Name(),
+		Fired:    fired,
+		Detail: fmt.Sprintf("%s: %s used from %d networks (max %d) and %d countries (max %d) within %s",
+			a.Name(), record.Username, len(b.networks), policy.MaxNetworks, len(b.countries), policy.MaxCountries, a.window),
+	}
+}
+
+// sourceNetwork 来源所在网段，IPv4 按 /24、IPv6 按 /48 聚合，非IP来源返回空
+func sourceNetwork(ip string) string {
+	parsed := net.ParseIP(ip)
+	if parsed == nil || parsed.IsLoopback() {
+		return ""
+	}
+	if v4 := parsed.To4(); v4 != nil {
+		return (&net.IPNet{IP: v4.Mask(net.CIDRMask(24, 32)), Mask: net.CIDRMask(24, 32)}).String()
+	}
+	return (&net.IPNet{IP: parsed.Mask(net.CIDRMask(48, 128)), Mask: net.CIDRMask(48, 128)}).String()
+}
+
+// locationCountry 从归属地 (国家-省份-城市) 中取出国家
+func locationCountry(location string) string {
+	if location == "" || location == "内网IP" {
+		return ""
+	}
+	country, _, _ := strings.Cut(location, "-")
+	return country
+}
+
+// sortedKeys 排序后的集合元素
+func sortedKeys(set map[string]struct{}) []string {
+	if len(set) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,234 @@
+package audit
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/dushixiang/pika/internal/protocol"
+)
+
+// timingPatternAnalyzer 时段偏斜分析器
+// 攻击者常选择无人值守的时段行动：按记录覆盖的时间范围计算周末、节假日、夜间的预期占比，
+// 实际占比明显偏高时告警。与逐条标记非工作时间登录不同，这里关注的是整体分布
+type timingPatternAnalyzer struct {
+	holidays       map[string]bool // YYYY-MM-DD
+	overnightStart int
+	overnightEnd   int
+	skewThreshold  float64
+	minEvents      int
+	location       *time.Location
+}
+
+func newTimingPatternAnalyzer(config *Config) *timingPatternAnalyzer {
+	a := &timingPatternAnalyzer{
+		holidays:       make(map[string]bool),
+		overnightStart: config.LoginConfig.OvernightStartHour,
+		overnightEnd:   config.LoginConfig.OvernightEndHour,
+		skewThreshold:  config.LoginConfig.TimingSkewThreshold,
+		minEvents:      config.LoginConfig.TimingMinEvents,
+		location:       analysisLocation(config),
+	}
+	for _, holiday := range config.LoginConfig.Holidays {
+		date, err := time.Parse(time.DateOnly, strings.TrimSpace(holiday))
+		if err != nil {
+			globalLogger.Warn("节假日配置无效，已忽略: %s", holiday)
+			continue
+		}
+		a.holidays[date.Format(time.DateOnly)] = true
+	}
+	if a.skewThreshold <= 1 {
+		a.skewThreshold = 2
+	}
+	if a.minEvents <= 0 {
+		a.minEvents = 20
+	}
+	return a
+}
+
+// analysisLocation 分析使用的时区
+func analysisLocation(config *Config) *time.Location {
+	if config.LoginConfig.TimeZone == "" {
+		return time.Local
+	}
+	location, err := time.LoadLocation(config.LoginConfig.TimeZone)
+	if err != nil {
+		globalLogger.Warn("时区配置无效，使用本机时区: %v", err)
+		return time.Local
+	}
+	return location
+}
+
+func (a *timingPatternAnalyzer) Name() string {
+	return "timing-pattern"
+}
+
+// categories 时间点所属的时段
+func (a *timingPatternAnalyzer) categories(t time.Time) []string {
+	var categories []string
+	if weekday := t.Weekday(); weekday == time.Saturday || weekday == time.Sunday {
+		categories = append(categories, protocol.TimingWeekend)
+	}
+	if a.holidays[t.Format(time.DateOnly)] {
+		categories = append(categories, protocol.TimingHoliday)
+	}
+	if a.isOvernight(t.Hour()) {
+		categories = append(categories, protocol.TimingOvernight)
+	}
+	return categories
+}
+
+func (a *timingPatternAnalyzer) isOvernight(hour int) bool {
+	switch {
+	case a.overnightStart == a.overnightEnd:
+		return false
+	case a.overnightStart < a.overnightEnd:
+		return hour >= a.overnightStart && hour < a.overnightEnd
+	default:
+		return hour >= a.overnightStart || hour < a.overnightEnd
+	}
+}
+
+// expectedShares 时间范围内各时段所占的时长比例，按小时统计
+func (a *timingPatternAnalyzer) expectedShares(first, last int64) map[string]float64 {
+	start := time.UnixMilli(first).In(a.location).Truncate(time.Hour)
+	end := time.UnixMilli(last).In(a.location)
+
+	counts := make(map[string]int)
+	total := 0
+	for t := start; !t.After(end); t = t.Add(time.Hour) {
+		total++
+		for _, category := range a.categories(t) {
+			counts[category]++
+		}
+	}
+
+	shares := make(map[string]float64, len(counts))
+	for category, count := range counts {
+		shares[category] = float64(count) / float64(total)
+	}
+	return shares
+}
+
+// records 某种登录结果的记录
+func (a *timingPatternAnalyzer) records(assets *protocol.LoginAssets, status string) []protocol.LoginRecord {
+	if status == "failed" {
+		return assets.FailedLogins
+	}
+	return assets.SuccessfulLogins
+}
+
+// patterns 某种登录结果在各时段的分布，包括未达到阈值的时段
+func (a *timingPatternAnalyzer) patterns(records []protocol.LoginRecord, status string) []protocol.TimingPattern {
+	var first, last int64
+	counts := make(map[string]int)
+	byWeekday := make([]int, 7)
+	byHour := make([]int, 24)
+	total := 0
+	for _, record := range records {
+		if record.Timestamp <= 0 {
+			continue
+		}
+		total++
+		if first == 0 || record.Timestamp < first {
+			first = record.Timestamp
+		}
+		if record.Timestamp > last {
+			last = record.Timestamp
+		}
+
+		t := time.UnixMilli(record.Timestamp).In(a.location)
+		byWeekday[t.Weekday()]++
+		byHour[t.Hour()]++
+		for _, category := range a.categories(t) {
+			counts[category]++
+		}
+	}
+	if total == 0 {
+		return nil
+	}
+
+	expected := a.expectedShares(first, last)
+
+	var patterns []protocol.TimingPattern
+	for _, category := range []string{protocol.TimingWeekend, protocol.TimingHoliday, protocol.TimingOvernight} {
+		// 时间范围内不包含该时段时无法判断
+		if expected[category] == 0 {
+			continue
+		}
+		share := float64(counts[category]) / float64(total)
+		patterns = append(patterns, protocol.TimingPattern{
+			Status:        status,
+			Category:      category,
+			Events:        counts[category],
+			TotalEvents:   total,
+			Share:         share,
+			ExpectedShare: expected[category],
+			Skew:          share / expected[category],
+			ByWeekday:     byWeekday,
+			ByHour:        byHour,
+			FirstSeen:     first,
+			LastSeen:      last,
+		})
+	}
+	return patterns
+}
+
+func (a *timingPatternAnalyzer) fired(pattern protocol.TimingPattern) bool {
+	return pattern.TotalEvents >= a.minEvents && pattern.Skew >= a.skewThreshold
+}
+
+// Analyze 检测成功和失败登录中明显偏向无人值守时段的分布
+func (a *timingPatternAnalyzer) Analyze(assets *protocol.LoginAssets) []protocol.TimingPattern {
+	var findings []protocol.TimingPattern
+	for _, status := range []string{"failed", "success"} {
+		for _, pattern := range a.patterns(a.records(assets, status), status) {
+			if a.fired(pattern) {
+				findings = append(findings, pattern)
+			}
+		}
+	}
+	return findings
+}
+
+func (a *timingPatternAnalyzer) AnalyzeInto(assets *protocol.LoginAssets, stats *protocol.LoginStatistics) {
+	stats.TimingPatterns = a.Analyze(assets)
+}
+
+func (a *timingPatternAnalyzer) Explain(assets *protocol.LoginAssets, record protocol.LoginRecord) AnalyzerExplanation {
+	explanation := AnalyzerExplanation{Analyzer: a.Name()}
+
+	status := "success"
+	if record.Status == "failed" {
+		status = "failed"
+	}
+	categories := a.categories(time.UnixMilli(record.Timestamp).In(a.location))
+	if len(categories) == 0 {
+		explanation.Detail = fmt.Sprintf("%s: %s login at %s is outside weekend, holiday and overnight hours",
+			a.Name(), status, time.UnixMilli(record.Timestamp).In(a.location).Format(time.RFC3339))
+		return explanation
+	}
+
+	var details []string
+	for _, pattern := range a.patterns(a.records(assets, status), status) {
+		if !slices.Contains(categories, pattern.Category) {
+			continue
+		}
+		fired := a.fired(pattern)
+		explanation.Fired = explanation.Fired || fired
+		op := "<"
+		if fired {
+			op = ">="
+		}
+		details = append(details, fmt.Sprintf("%s %d/%d (%.0f%% vs %.0f%% expected, skew %.2f %s %.2f, min %d events)",
+			pattern.Category, pattern.Events, pattern.TotalEvents, pattern.Share*100, pattern.ExpectedShare*100,
+			pattern.Skew, op, a.skewThreshold, a.minEvents))
+	}
+	if len(details) == 0 {
+		explanation.Detail = fmt.Sprintf("%s: no %s logins with timestamps to compare against", a.Name(), status)
+		return explanation
+	}
+	explanation.Detail = fmt.Sprintf("%s: %s login in %s; %s", a.Name(), status, strings.Join(categories, "+"), strings.Join(details, "; "))
+	return explanation
+}
@@ -0,0 +1,51 @@
+package audit
+
+import (
+	"time"
+
+	"github.com/dushixiang/pika/internal/protocol"
+)
+
+// AnalyzeArchive 对归档的登录记录和会话重新执行全部分析器
+// 与实时收集产生相同结构的结果 (记录、会话和统计信息中的全部告警)，用于新分析器上线或调整阈值后回溯历史数据。
+// 只使用传入的数据和配置，不读取本机的日志、命令输出或其他状态；
+// 按本地时间分析时使用 config.LoginConfig.TimeZone，重新分析其他主机的记录时应设置为该主机的时区；
+// 会话时长以分析时的当前时间计算。
+// records 按 Status 分为成功和失败登录，传入的切片不会被修改
+func AnalyzeArchive(records []protocol.LoginRecord, sessions []protocol.LoginSession, config *Config) *protocol.LoginAssets {
+	if config == nil {
+		config = DefaultConfig()
+	}
+
+	assets := &protocol.LoginAssets{
+		CurrentSessions: append([]protocol.LoginSession(nil), sessions...),
+	}
+	for _, record := range records {
+		if record.Status == "failed" {
+			assets.FailedLogins = append(assets.FailedLogins, record)
+		} else {
+			assets.SuccessfulLogins = append(assets.SuccessfulLogins, record)
+		}
+	}
+
+	// 只包含分析需要的部分，不创建事件输出、主机位置探测等依赖本机的组件
+	lac := &LoginAssetsCollector{
+		config:          config,
+		natSources:      newSourceMatcher(config.LoginConfig.NATEgressSources),
+		terminalAliases: newTerminalAliases(config.LoginConfig.TerminalAliases),
+		now:             time.Now,
+	}
+	lac.analyzers = defaultLoginAnalyzers(config, func() time.Time { return lac.now() })
+	transforms, err := newLoginTransformPipeline(config.LoginConfig.RecordTransforms)
+	if err != nil {
+		globalLogger.Warn("记录转换配置无效，已忽略: %v", err)
+	}
+	lac.transforms = transforms
+
+	// 与实时收集相同的处理顺序
+	lac.classifySessions(assets.CurrentSessions)
+	lac.normalize(assets)
+	assets.Statistics = lac.calculateStatistics(assets)
+
+	return assets
+}
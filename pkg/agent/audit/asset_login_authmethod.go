@@ -0,0 +1,209 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/dushixiang/pika/internal/protocol"
+)
+
+// 认证日志中的登录时间与 wtmp 记录时间允许的最大偏差
+const authMethodMatchWindow = 2 * time.Minute
+
+// acceptedLogin sshd 认证成功日志
+type acceptedLogin struct {
+	username  string
+	ip        string
+	method    string
+	timestamp int64
+
+	// 公钥登录的密钥类型和 SHA256 指纹
+	keyType        string
+	keyFingerprint string
+}
+
+// parseAcceptedLine 解析 sshd 认证成功日志
+// Dec 25 10:30:00 host sshd[1234]: Accepted publickey for root from 192.168.1.1 port 22 ssh2: RSA SHA256:...
+// Dec 25 10:30:00 host sshd[1234]: Accepted keyboard-interactive/pam for root from 192.168.1.1 port 22 ssh2
+func (lac *LoginAssetsCollector) parseAcceptedLine(line string) (acceptedLogin, bool) {
+	idx := strings.Index(line, "Accepted ")
+	if idx == -1 {
+		return acceptedLogin{}, false
+	}
+
+	// method for user from ip port ...
+	fields := strings.Fields(line[idx+len("Accepted "):])
+	if len(fields) < 5 || fields[1] != "for" || fields[3] != "from" {
+		return acceptedLogin{}, false
+	}
+
+	// keyboard-interactive/pam 只保留认证方式
+	method, _, _ := strings.Cut(fields[0], "/")
+
+	login := acceptedLogin{
+		username:  sanitizeUTF8(fields[2]),
+		ip:        normalizeSource(fields[4]),
+		method:    method,
+		timestamp: lac.parseSyslogTime(line),
+	}
+	if method == protocol.AuthMethodPublicKey {
+		login.keyType, login.keyFingerprint = parseAcceptedKey(line)
+	}
+	return login, true
+}
+
+// parseAcceptedKey 解析公钥登录日志中 "ssh2: " 之后的密钥类型和 SHA256 指纹
+// ... ssh2: RSA SHA256:uN4k...，证书登录为 ED25519-CERT SHA256:... ID ...；较早的 sshd 输出 MD5 指纹，不记录
+func parseAcceptedKey(line string) (keyType, fingerprint string) {
+	_, rest, ok := strings.Cut(line, " ssh2: ")
+	if !ok {
+		return "", ""
+	}
+	fields := strings.Fields(rest)
+	if len(fields) < 2 || !strings.HasPrefix(fields[1], "SHA256:") {
+		return "", ""
+	}
+	return fields[0], fields[1]
+}
+
+// authLogSessionServices 会话打开日志中作为成功登录收集的 PAM 服务 (控制台和图形界面登录)
+// sshd 的登录已由 Accepted 日志覆盖，cron、sudo、su 等不是登录
+var authLogSessionServices = map[string]string{
+	"login":         "console",
+	"gdm-password":  ":0",
+	"gdm-autologin": ":0",
+	"lightdm":       ":0",
+	"sddm":          ":0",
+}
+
+// parseSessionOpenedLine 解析 PAM 会话打开日志，只接受 authLogSessionServices 中的服务
+// Dec 25 10:30:00 host login[812]: pam_unix(login:session): session opened for user root(uid=0) by LOGIN(uid=0)
+func (lac *LoginAssetsCollector) parseSessionOpenedLine(line string) (*protocol.LoginRecord, bool) {
+	idx := strings.Index(line, "pam_unix(")
+	if idx == -1 || !strings.Contains(line, "session opened for user ") {
+		return nil, false
+	}
+	service, _, ok := strings.Cut(line[idx+len("pam_unix("):], ":session)")
+	if !ok {
+		return nil, false
+	}
+	terminal, ok := authLogSessionServices[service]
+	if !ok {
+		return nil, false
+	}
+
+	_, rest, _ := strings.Cut(line, "session opened for user ")
+	fields := strings.Fields(rest)
+	if len(fields) == 0 {
+		return nil, false
+	}
+	// 新版本在用户名后附带 (uid=N)
+	username, _, _ := strings.Cut(fields[0], "(")
+
+	return &protocol.LoginRecord{
+		Username:  sanitizeUTF8(username),
+		Terminal:  terminal,
+		Timestamp: lac.parseSyslogTime(line),
+		Status:    "success",
+	}, true
+}
+
+// collectSuccessfulLoginsFromAuthLog 从认证日志 (按从旧到新排列) 收集成功登录，wtmp 没有记录时使用
+// sshd 的 Accepted 日志带有来源IP和认证方式，控制台和图形界面登录取自 PAM 会话打开日志
+func (lac *LoginAssetsCollector) collectSuccessfulLoginsFromAuthLog(paths []string, since time.Time, limit int) []protocol.LoginRecord {
+	var records []protocol.LoginRecord
+	for _, path := range paths {
+		records = append(records, lac.scanSuccessfulLogins(path, since)...)
+	}
+	return newestLoginRecords(records, limit)
+}
+
+// scanSuccessfulLogins 读取单个认证日志中的成功登录，无法读取时返回已读取的部分
+func (lac *LoginAssetsCollector) scanSuccessfulLogins(path string, since time.Time) []protocol.LoginRecord {
+	var records []protocol.LoginRecord
+	var read int64
+	err := lac.scanLogFile(context.Background(), path, &read, func(line string) {
+		var record *protocol.LoginRecord
+		if login, ok := lac.parseAcceptedLine(line); ok {
+			record = &protocol.LoginRecord{
+				Username:   login.username,
+				IP:         login.ip,
+				Terminal:   "ssh",
+				Timestamp:  login.timestamp,
+				Status:     "success",
+				AuthMethod: login.method,
+
+				KeyType:        login.keyType,
+				KeyFingerprint: login.keyFingerprint,
+			}
+		} else if session, ok := lac.parseSessionOpenedLine(line); ok {
+			record = session
+		}
+		if record != nil && !before(record.Timestamp, since) {
+			records = append(records, *record)
+		}
+	})
+	if err != nil {
+		globalLogger.Debug("读取认证日志 %s 失败: %v", path, err)
+	}
+	return records
+}
+
+// readAcceptedLogins 读取认证日志中的全部认证成功记录
+func (lac *LoginAssetsCollector) readAcceptedLogins(path string) ([]acceptedLogin, error) {
+	var accepted []acceptedLogin
+	var read int64
+	err := lac.scanLogFile(context.Background(), path, &read, func(line string) {
+		if login, ok := lac.parseAcceptedLine(line); ok {
+			accepted = append(accepted, login)
+		}
+	})
+	return accepted, err
+}
+
+// annotateAuthMethods 根据认证日志为成功登录记录补充认证方式
+// wtmp 中没有认证方式，按用户名和来源IP匹配时间最接近的认证成功日志
+// paths 为全部认证日志，部分文件无法读取时仍使用其余文件补充，并返回读取错误
+func (lac *LoginAssetsCollector) annotateAuthMethods(records []protocol.LoginRecord, paths []string) error {
+	if len(records) == 0 || len(paths) == 0 {
+		return nil
+	}
+
+	var accepted []acceptedLogin
+	var errs []error
+	for _, path := range paths {
+		logins, err := lac.readAcceptedLogins(path)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		accepted = append(accepted, logins...)
+	}
+
+	window := authMethodMatchWindow.Milliseconds()
+	for i := range records {
+		record := &records[i]
+		if record.AuthMethod != "" {
+			continue
+		}
+
+		best := int64(-1)
+		for _, login := range accepted {
+			if login.username != record.Username || login.ip != record.IP {
+				continue
+			}
+			diff := login.timestamp - record.Timestamp
+			if diff < 0 {
+				diff = -diff
+			}
+			if diff <= window && (best < 0 || diff < best) {
+				best = diff
+				record.AuthMethod = login.method
+				record.KeyType = login.keyType
+				record.KeyFingerprint = login.keyFingerprint
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,134 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"github.com/dushixiang/pika/internal/protocol"
+)
+
+// ComputeDelta 计算两次收集结果之间的增量，只保留 current 中新出现的内容
+//   - 登录记录按 RecordID 比较，只保留 previous 中没有的记录
+//   - 会话只保留新出现的会话，previous 中存在而 current 中已不存在的会话放入 EndedSessions
+//   - 锁定事件、篡改迹象、lastlog、用户汇总和统计信息中的告警只保留新出现 (或变化) 的条目
+//   - 计数、唯一IP/用户等统计和 sshd 策略、主机位置等快照保持 current 的值 (快照未变化时省略)
+//   - 裁剪信息描述的是 current 本身 (增量中的记录可能因此不完整)，总是保留
+//
+// 这是不依赖任何状态存储的纯函数，适合在内存中缓存上一次结果的宿主程序使用。
+// 它是对按时间水位收集 (CollectSince) 的补充而不是替代：水位可以跨重启持久化并减少读取的日志量，
+// 增量只减少传输的数据量，缓存丢失后需要重新发送完整结果。
+// previous 为 nil 时返回 current 的全部内容，current 为 nil 时返回 nil，两者都不会被修改
+func ComputeDelta(previous, current *protocol.LoginAssets) *protocol.LoginAssets {
+	if current == nil {
+		return nil
+	}
+	if previous == nil {
+		previous = &protocol.LoginAssets{}
+	}
+
+	delta := &protocol.LoginAssets{
+		SuccessfulLogins: newItems(previous.SuccessfulLogins, current.SuccessfulLogins, loginRecordKey),
+		FailedLogins:     newItems(previous.FailedLogins, current.FailedLogins, loginRecordKey),
+		CurrentSessions:  newItems(previous.CurrentSessions, current.CurrentSessions, loginSessionKey),
+		EndedSessions:    newItems(current.CurrentSessions, previous.CurrentSessions, loginSessionKey),
+		AccountLockouts:  newItems(previous.AccountLockouts, current.AccountLockouts, valueKey[protocol.AccountLockout]),
+		LogTampering:     newItems(previous.LogTampering, current.LogTampering, valueKey[protocol.LogTamperingSuspicion]),
+		LastLogins:       newItems(previous.LastLogins, current.LastLogins, valueKey[protocol.LastLoginEntry]),
+		UserSummaries:    newItems(previous.UserSummaries, current.UserSummaries, valueKey[protocol.UserLoginSummary]),
+		SSHDPolicy:       changedSnapshot(previous.SSHDPolicy, current.SSHDPolicy),
+		HostLocation:     changedSnapshot(previous.HostLocation, current.HostLocation),
+		HostContext:      changedSnapshot(previous.HostContext, current.HostContext),
+		Statistics:       statisticsDelta(previous.Statistics, current.Statistics),
+	}
+	if current.Trimmed != nil {
+		trimmed := *current.Trimmed
+		delta.Trimmed = &trimmed
+	}
+	return delta
+}
+
+// statisticsDelta 统计信息的增量，告警只保留新出现的条目，其余统计保持当前值
+func statisticsDelta(previous, current *protocol.LoginStatistics) *protocol.LoginStatistics {
+	if current == nil {
+		return nil
+	}
+	if previous == nil {
+		previous = &protocol.LoginStatistics{}
+	}
+
+	stats := *current
+	// 登录次数和频率随每次收集变化，按来源IP判断是否为新告警
+	stats.HighFrequencyIPs = newItems(previous.HighFrequencyIPs, current.HighFrequencyIPs, func(item protocol.HighFrequencyIP) string {
+		return item.IP
+	})
+	stats.AutomationSuspicions = newItems(previous.AutomationSuspicions, current.AutomationSuspicions, valueKey[protocol.AutomationSuspicion])
+	stats.SharedAccountAlerts = newItems(previous.SharedAccountAlerts, current.SharedAccountAlerts, valueKey[protocol.SharedAccountAlert])
+	stats.ScriptedAttacks = newItems(previous.ScriptedAttacks, current.ScriptedAttacks, valueKey[protocol.ScriptedAttack])
+	stats.UnexpectedAuthMethods = newItems(previous.UnexpectedAuthMethods, current.UnexpectedAuthMethods, valueKey[protocol.UnexpectedAuthMethod])
+	stats.TimingPatterns = newItems(previous.TimingPatterns, current.TimingPatterns, valueKey[protocol.TimingPattern])
+	stats.BastionBypasses = newItems(previous.BastionBypasses, current.BastionBypasses, valueKey[protocol.BastionBypass])
+	stats.LongLivedSessions = newItems(previous.LongLivedSessions, current.LongLivedSessions, longLivedSessionKey)
+	stats.ConcurrentAccess = newItems(previous.ConcurrentAccess, current.ConcurrentAccess, concurrentAccessKey)
+	stats.BruteForceAttempts = newItems(previous.BruteForceAttempts, current.BruteForceAttempts, valueKey[protocol.BruteForceAlert])
+	stats.ForeignLogins = newItems(previous.ForeignLogins, current.ForeignLogins, loginRecordKey)
+	stats.OffHoursLogins = newItems(previous.OffHoursLogins, current.OffHoursLogins, loginRecordKey)
+	stats.NewSourceLogins = newItems(previous.NewSourceLogins, current.NewSourceLogins, loginRecordKey)
+	stats.RootLogins = newItems(previous.RootLogins, current.RootLogins, loginRecordKey)
+	stats.PrivilegeEscalations = newItems(previous.PrivilegeEscalations, current.PrivilegeEscalations, loginRecordKey)
+	stats.PostLoginFileAccesses = newItems(previous.PostLoginFileAccesses, current.PostLoginFileAccesses, valueKey[protocol.PostLoginFileAccess])
+	return &stats
+}
+
+// newItems current 中 key 不在 previous 中的条目，保持原有顺序
+func newItems[T any](previous, current []T, key func(T) string) []T {
+	seen := make(map[string]bool, len(previous))
+	for _, item := range previous {
+		seen[key(item)] = true
+	}
+
+	var items []T
+	for _, item := range current {
+		if !seen[key(item)] {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// changedSnapshot 快照与上次不同时返回当前值，否则返回 nil
+func changedSnapshot[T any](previous, current *T) *T {
+	if reflect.DeepEqual(previous, current) {
+		return nil
+	}
+	return current
+}
+
+// loginRecordKey 登录记录的标识，缺少 RecordID 时 (如旧版本的结果) 现场计算
+func loginRecordKey(record protocol.LoginRecord) string {
+	if record.RecordID != "" {
+		return record.RecordID
+	}
+	return protocol.LoginRecordID(record)
+}
+
+// loginSessionKey 会话的标识，同一终端上的新登录视为不同的会话
+func loginSessionKey(session protocol.LoginSession) string {
+	return fmt.Sprintf("%s\x1f%s\x1f%s\x1f%d", session.Username, session.Terminal, session.IP, session.LoginTime)
+}
+
+// longLivedSessionKey 超长会话的标识，持续时间每次收集都会变化，不参与比较
+func longLivedSessionKey(session protocol.LongLivedSession) string {
+	return fmt.Sprintf("%s\x1f%s\x1f%s\x1f%d", session.Username, session.Terminal, session.IP, session.LoginTime)
+}
+
+// concurrentAccessKey 并发登录告警的标识，同一用户出现新的来源IP时视为新的告警
+func concurrentAccessKey(alert protocol.ConcurrentSessionAlert) string {
+	return fmt.Sprintf("%s\x1f%v", alert.Username, alert.IPs)
+}
+
+// valueKey 按全部字段比较，用于没有标识的告警和事件
+func valueKey[T any](item T) string {
+	data, _ := json.Marshal(item)
+	return string(data)
+}
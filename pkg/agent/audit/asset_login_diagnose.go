@@ -0,0 +1,129 @@
+package audit
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"strings"
+
+	"github.com/dushixiang/pika/internal/protocol"
+)
+
+// DiagnosticReport 登录资产收集的诊断报告
+type DiagnosticReport = protocol.DiagnosticReport
+
+// LocationResolverStatus 归属地查询可以实现的可选接口，用于在诊断报告中说明数据库状态
+// 数据库已加载时返回 nil，服务端的 GeoIPService 满足该接口
+type LocationResolverStatus interface {
+	Status() error
+}
+
+// diagnosticCommands 收集登录记录依赖的外部命令及探测时使用的参数
+var diagnosticCommands = []struct {
+	name string
+	args []string
+}{
+	{"last", []string{"-n", "1"}},
+	{"lastb", []string{"-n", "1"}},
+	{"w", []string{"-h"}},
+}
+
+// Diagnose 探测收集登录记录依赖的命令和日志文件是否可用，以及归属地数据库的状态
+// 用于排查收集不到登录记录的原因，只执行只读的命令，不收集登录记录
+func (lac *LoginAssetsCollector) Diagnose() *DiagnosticReport {
+	report := &DiagnosticReport{
+		GeneratedAt:   lac.now().UnixMilli(),
+		RunningAsRoot: os.Geteuid() == 0,
+	}
+
+	btmp := lac.diagnoseFile(lac.config.LoginConfig.BtmpPath, "btmp")
+	for _, command := range diagnosticCommands {
+		diagnostic := lac.diagnoseCommand(command.name, command.args)
+		// lastb 读取 btmp 失败时 (通常需要 root 权限) 非零退出，stderr 不会返回
+		if command.name == "lastb" && !diagnostic.Runnable && diagnostic.Found && errors.Is(btmp.err, fs.ErrPermission) {
+			diagnostic.PermissionDenied = true
+		}
+		report.Commands = append(report.Commands, diagnostic)
+	}
+
+	authLogs := lac.authLogFiles()
+	if len(authLogs) == 0 {
+		// 没有找到时报告配置的路径 (或默认路径)
+		authLogs = lac.config.LoginConfig.AuthLogPaths
+		if len(authLogs) == 0 {
+			authLogs = []string{"/var/log/auth.log", "/var/log/secure"}
+		}
+	}
+	for _, path := range authLogs {
+		report.Files = append(report.Files, lac.diagnoseFile(path, "auth_log").FileDiagnostic)
+	}
+	report.Files = append(report.Files,
+		lac.diagnoseFile(lac.config.LoginConfig.WtmpPath, "wtmp").FileDiagnostic,
+		btmp.FileDiagnostic,
+		lac.diagnoseFile(lac.config.LoginConfig.UtmpPath, "utmp").FileDiagnostic,
+	)
+
+	if lac.locations != nil {
+		report.GeoIP = &protocol.GeoIPDiagnostic{}
+		if status, ok := lac.locations.(LocationResolverStatus); !ok {
+			report.GeoIP.Error = "归属地查询不支持报告数据库状态"
+		} else if err := status.Status(); err != nil {
+			report.GeoIP.Error = err.Error()
+		} else {
+			report.GeoIP.Loaded = true
+		}
+	}
+	return report
+}
+
+// diagnoseCommand 在 PATH 中查找命令并以只读的参数执行一次
+func (lac *LoginAssetsCollector) diagnoseCommand(name string, args []string) protocol.CommandDiagnostic {
+	diagnostic := protocol.CommandDiagnostic{Name: name}
+	path, err := lac.lookPath(name)
+	if err != nil {
+		diagnostic.Error = err.Error()
+		return diagnostic
+	}
+	diagnostic.Path = path
+	diagnostic.Found = true
+
+	if _, err := lac.execute(name, args...); err != nil {
+		diagnostic.Error = err.Error()
+		diagnostic.PermissionDenied = errors.Is(err, fs.ErrPermission) || strings.Contains(err.Error(), "Permission denied")
+		return diagnostic
+	}
+	diagnostic.Runnable = true
+	return diagnostic
+}
+
+// fileDiagnostic 文件探测结果及读取的原始错误
+type fileDiagnostic struct {
+	protocol.FileDiagnostic
+	err error
+}
+
+// diagnoseFile 按收集时相同的方式 (不跟随符号链接、检查所在目录) 打开文件
+func (lac *LoginAssetsCollector) diagnoseFile(path, purpose string) fileDiagnostic {
+	diagnostic := fileDiagnostic{FileDiagnostic: protocol.FileDiagnostic{Path: path, Purpose: purpose}}
+	if path == "" {
+		diagnostic.err = errors.New("未配置路径")
+		diagnostic.Error = diagnostic.err.Error()
+		return diagnostic
+	}
+	if _, err := os.Lstat(path); err != nil {
+		diagnostic.err = err
+		diagnostic.Error = err.Error()
+		return diagnostic
+	}
+	diagnostic.Exists = true
+
+	file, err := openLogFile(path)
+	if err != nil {
+		diagnostic.err = err
+		diagnostic.Error = err.Error()
+		return diagnostic
+	}
+	file.Close()
+	diagnostic.Readable = true
+	return diagnostic
+}
@@ -0,0 +1,111 @@
+package audit
+
+import (
+	"sort"
+	"time"
+
+	"github.com/dushixiang/pika/internal/protocol"
+)
+
+// FileAccessEvent 敏感文件访问事件
+type FileAccessEvent struct {
+	Username  string // 访问者用户名 (auditd 的 auid 对应的登录用户)
+	Terminal  string // 访问进程的终端，未知时为空
+	Path      string // 访问的文件
+	Operation string // 访问方式 (read/write/exec 等)
+	Process   string // 访问的进程
+	Timestamp int64  // 访问时间(毫秒)
+}
+
+// FileAccessSource 敏感文件访问事件来源，由宿主程序实现 (如读取 auditd 对 /etc/shadow 等文件的监控)
+// 审计包只负责把访问与登录记录关联，不监控文件
+type FileAccessSource interface {
+	// FileAccessEvents 返回 [since, until] 内的访问事件
+	FileAccessEvents(since, until time.Time) ([]FileAccessEvent, error)
+}
+
+// SetFileAccessSource 设置敏感文件访问事件来源，为 nil 时不关联
+func (lac *LoginAssetsCollector) SetFileAccessSource(source FileAccessSource) {
+	lac.fileAccess = source
+}
+
+// correlateFileAccess 从事件来源读取登录记录覆盖的时间范围内的访问事件并关联
+func (lac *LoginAssetsCollector) correlateFileAccess(assets *protocol.LoginAssets) error {
+	if lac.fileAccess == nil || assets.Statistics == nil || len(assets.SuccessfulLogins) == 0 {
+		return nil
+	}
+
+	var since int64
+	for _, login := range assets.SuccessfulLogins {
+		if login.Timestamp > 0 && (since == 0 || login.Timestamp < since) {
+			since = login.Timestamp
+		}
+	}
+	events, err := lac.fileAccess.FileAccessEvents(time.UnixMilli(since), lac.now())
+	if err != nil {
+		return err
+	}
+	assets.Statistics.PostLoginFileAccesses = CorrelateFileAccess(assets.SuccessfulLogins, events, lac.config.LoginConfig.FileAccessWindow)
+	return nil
+}
+
+// CorrelateFileAccess 将访问事件关联到此前 window 内同一用户的最近一次成功登录
+// 两者都有终端时要求终端相同，登录记录有登出时间时访问必须发生在登出之前；
+// 关联不到登录的访问 (如定时任务) 不输出。结果按访问时间排序
+func CorrelateFileAccess(logins []protocol.LoginRecord, events []FileAccessEvent, window time.Duration) []protocol.PostLoginFileAccess {
+	if window <= 0 {
+		window = 5 * time.Minute
+	}
+	windowMs := window.Milliseconds()
+
+	byUser := make(map[string][]protocol.LoginRecord)
+	for _, login := range logins {
+		if login.Timestamp > 0 {
+			byUser[login.Username] = append(byUser[login.Username], login)
+		}
+	}
+	for _, userLogins := range byUser {
+		sort.Slice(userLogins, func(i, j int) bool {
+			return userLogins[i].Timestamp > userLogins[j].Timestamp
+		})
+	}
+
+	var accesses []protocol.PostLoginFileAccess
+	for _, event := range events {
+		// 从最近的登录开始查找
+		for _, login := range byUser[event.Username] {
+			delay := event.Timestamp - login.Timestamp
+			if delay < 0 {
+				continue
+			}
+			if delay > windowMs {
+				break
+			}
+			if event.Terminal != "" && login.Terminal != "" && event.Terminal != login.Terminal {
+				continue
+			}
+			if login.LogoutTime > 0 && event.Timestamp > login.LogoutTime {
+				continue
+			}
+			accesses = append(accesses, protocol.PostLoginFileAccess{
+				Username:     login.Username,
+				IP:           login.IP,
+				Hostname:     login.Hostname,
+				Terminal:     login.Terminal,
+				LoginTime:    login.Timestamp,
+				RecordID:     login.RecordID,
+				Path:         event.Path,
+				Operation:    event.Operation,
+				Process:      event.Process,
+				AccessTime:   event.Timestamp,
+				DelaySeconds: delay / 1000,
+			})
+			break
+		}
+	}
+
+	sort.SliceStable(accesses, func(i, j int) bool {
+		return accesses[i].AccessTime < accesses[j].AccessTime
+	})
+	return accesses
+}
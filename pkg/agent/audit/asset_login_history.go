@@ -0,0 +1,177 @@
+package audit
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dushixiang/pika/internal/protocol"
+)
+
+// 历史扫描进度回调的最小间隔
+const scanProgressInterval = 500 * time.Millisecond
+
+// ScanProgress 历史扫描进度
+type ScanProgress struct {
+	FilesTotal     int   // 需要扫描的文件数
+	FilesProcessed int   // 已扫描完成的文件数
+	BytesTotal     int64 // 文件总大小 (压缩文件按磁盘上的大小计算)
+	BytesRead      int64 // 已读取的字节数
+	Records        int   // 已找到的记录数
+}
+
+// Percent 完成百分比
+func (p ScanProgress) Percent() float64 {
+	if p.BytesTotal <= 0 {
+		return 100
+	}
+	return float64(p.BytesRead) * 100 / float64(p.BytesTotal)
+}
+
+// countingReader 统计已读取的字节数
+type countingReader struct {
+	reader io.Reader
+	n      *int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	*r.n += int64(n)
+	return n, err
+}
+
+// rotatedLogFiles 日志文件及其轮转文件，按从旧到新排列
+// auth.log.3.gz, auth.log.2.gz, auth.log.1, auth.log
+func rotatedLogFiles(path string, since time.Time) []string {
+	matches, _ := filepath.Glob(path + ".*")
+
+	type rotated struct {
+		path  string
+		index int
+	}
+	var files []rotated
+	for _, match := range matches {
+		suffix := strings.TrimSuffix(strings.TrimPrefix(match, path+"."), ".gz")
+		index, err := strconv.Atoi(suffix)
+		if err != nil {
+			continue
+		}
+		files = append(files, rotated{path: match, index: index})
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].index > files[j].index
+	})
+
+	var paths []string
+	for _, file := range files {
+		// 最后修改时间早于 since 的轮转文件中不会有需要的记录
+		if info, err := os.Stat(file.path); err == nil && !since.IsZero() && info.ModTime().Before(since) {
+			continue
+		}
+		paths = append(paths, file.path)
+	}
+	if _, err := os.Stat(path); err == nil {
+		paths = append(paths, path)
+	}
+	return paths
+}
+
+// ScanFailedLoginHistory 扫描认证日志及其轮转文件 (含 .gz)，返回 since 之后的全部失败登录
+// progress 不为 nil 时定期回调扫描进度；每个文件之间以及文件内部都会检查 ctx，取消时返回已找到的记录和 ctx 的错误
+func (lac *LoginAssetsCollector) ScanFailedLoginHistory(ctx context.Context, since time.Time, progress func(ScanProgress)) ([]protocol.LoginRecord, error) {
+	authLog := findAuthLog()
+	if authLog == "" {
+		return nil, nil
+	}
+	return lac.scanFailedLoginFiles(ctx, rotatedLogFiles(authLog, since), since, progress)
+}
+
+func (lac *LoginAssetsCollector) scanFailedLoginFiles(ctx context.Context, paths []string, since time.Time, progress func(ScanProgress)) ([]protocol.LoginRecord, error) {
+	state := ScanProgress{FilesTotal: len(paths)}
+	for _, path := range paths {
+		if info, err := os.Stat(path); err == nil {
+			state.BytesTotal += info.Size()
+		}
+	}
+
+	var records []protocol.LoginRecord
+	lastReport := time.Time{}
+	report := func(force bool) {
+		if progress == nil {
+			return
+		}
+		now := lac.now()
+		if !force && now.Sub(lastReport) < scanProgressInterval {
+			return
+		}
+		lastReport = now
+		state.Records = len(records)
+		progress(state)
+	}
+
+	for _, path := range paths {
+		if err := ctx.Err(); err != nil {
+			return records, err
+		}
+
+		err := lac.scanLogFile(ctx, path, &state.BytesRead, func(line string) {
+			if !isFailedLoginLine(line) {
+				return
+			}
+			if record := lac.parseFailedLoginFromLog(line); record != nil && !before(record.Timestamp, since) {
+				record.RecordID = protocol.LoginRecordID(*record)
+				records = append(records, *record)
+			}
+			report(false)
+		})
+		if err != nil {
+			if ctx.Err() != nil {
+				return records, ctx.Err()
+			}
+			globalLogger.Debug("扫描 %s 失败: %v", path, err)
+		}
+
+		state.FilesProcessed++
+		report(true)
+	}
+
+	return records, nil
+}
+
+// scanLogFile 逐行读取单个日志文件，gz 文件自动解压
+func (lac *LoginAssetsCollector) scanLogFile(ctx context.Context, path string, bytesRead *int64, handle func(line string)) error {
+	file, err := openLogFile(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var reader io.Reader = &countingReader{reader: file, n: bytesRead}
+	if strings.HasSuffix(path, ".gz") {
+		gz, err := gzip.NewReader(reader)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		reader = gz
+	}
+
+	scanner := bufio.NewScanner(reader)
+	for lines := 0; scanner.Scan(); lines++ {
+		// 大文件内部也定期检查是否已取消
+		if lines%4096 == 0 {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+		}
+		handle(scanner.Text())
+	}
+	return scanner.Err()
+}
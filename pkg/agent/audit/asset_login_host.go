@@ -0,0 +1,101 @@
+package audit
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dushixiang/pika/internal/protocol"
+)
+
+// 主机位置获取方式
+const (
+	HostLocationStatic = "static"
+	HostLocationAPI    = "api"
+)
+
+// hostLocator 获取并缓存主机自身的位置
+// 探测公网IP需要访问外部接口，因此默认关闭，结果缓存到刷新间隔到期
+type hostLocator struct {
+	config HostLocationConfig
+	now    func() time.Time
+	fetch  func(url string) (string, error)
+
+	mu        sync.Mutex
+	cached    *protocol.HostLocation
+	fetchedAt time.Time
+}
+
+func newHostLocator(config HostLocationConfig, now func() time.Time) *hostLocator {
+	return &hostLocator{
+		config: config,
+		now:    now,
+		fetch:  fetchPublicIP,
+	}
+}
+
+// Get 返回主机位置，未启用时返回 nil
+// 探测失败时返回上一次的结果和错误
+func (h *hostLocator) Get() (*protocol.HostLocation, error) {
+	switch h.config.Method {
+	case "":
+		return nil, nil
+	case HostLocationStatic:
+		return &protocol.HostLocation{IP: h.config.IP, Location: h.config.Location}, nil
+	case HostLocationAPI:
+	default:
+		return nil, fmt.Errorf("不支持的主机位置获取方式: %s", h.config.Method)
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	now := h.now()
+	if h.cached != nil && now.Sub(h.fetchedAt) < h.config.RefreshInterval {
+		return h.cached, nil
+	}
+
+	ip, err := h.fetch(h.config.APIURL)
+	if err != nil {
+		return h.cached, fmt.Errorf("探测主机公网IP失败: %w", err)
+	}
+
+	h.cached = &protocol.HostLocation{IP: ip, Location: h.config.Location}
+	h.fetchedAt = now
+	return h.cached, nil
+}
+
+// fetchPublicIP 请求返回调用方公网IP的接口
+func fetchPublicIP(url string) (string, error) {
+	if url == "" {
+		return "", fmt.Errorf("未配置探测接口")
+	}
+
+	client := &http.Client{
+		Timeout: 10 * time.Second,
+	}
+	resp, err := client.Get(url)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("接口返回错误状态: %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 256))
+	if err != nil {
+		return "", err
+	}
+
+	ip := strings.TrimSpace(string(body))
+	if net.ParseIP(ip) == nil {
+		return "", fmt.Errorf("响应不是有效的IP地址: %q", ip)
+	}
+	return ip, nil
+}
@@ -0,0 +1,106 @@
+package audit
+
+import (
+	"bufio"
+	"os"
+	"strings"
+
+	"github.com/dushixiang/pika/internal/protocol"
+	"github.com/dushixiang/pika/pkg/version"
+)
+
+// hostContextCollector 主机环境收集器，每次收集读取一次，不做网络请求
+type hostContextCollector struct {
+	config   HostContextConfig
+	executor CommandRunner
+
+	osReleasePath  string
+	kernelPath     string
+	instanceIDPath string
+}
+
+func newHostContextCollector(config HostContextConfig, executor CommandRunner) *hostContextCollector {
+	return &hostContextCollector{
+		config:         config,
+		executor:       executor,
+		osReleasePath:  "/etc/os-release",
+		kernelPath:     "/proc/sys/kernel/osrelease",
+		instanceIDPath: "/var/lib/cloud/data/instance-id",
+	}
+}
+
+// Collect 收集已开启的字段，未启用时返回 nil
+func (c *hostContextCollector) Collect() *protocol.HostContext {
+	if !c.config.Enabled {
+		return nil
+	}
+
+	hostContext := &protocol.HostContext{}
+	if c.config.Hostname {
+		hostContext.Hostname, _ = os.Hostname()
+	}
+	if c.config.Distro {
+		hostContext.Distro = readOSRelease(c.osReleasePath)
+	}
+	if c.config.Kernel {
+		hostContext.Kernel = c.kernelVersion()
+	}
+	if c.config.AgentVersion {
+		hostContext.AgentVersion = version.GetAgentVersion()
+	}
+	if c.config.InstanceID {
+		hostContext.InstanceID = readFirstLine(c.instanceIDPath)
+	}
+	return hostContext
+}
+
+// kernelVersion 内核版本，优先使用 uname -r，无法执行命令时读取 /proc
+func (c *hostContextCollector) kernelVersion() string {
+	if c.executor != nil {
+		if output, err := c.executor.Execute("uname", "-r"); err == nil {
+			if kernel := strings.TrimSpace(output); kernel != "" {
+				return kernel
+			}
+		}
+	}
+	return readFirstLine(c.kernelPath)
+}
+
+// readOSRelease 读取 os-release 中的 PRETTY_NAME，没有时使用 NAME VERSION_ID
+func readOSRelease(path string) string {
+	file, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+
+	values := make(map[string]string)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(strings.TrimSpace(scanner.Text()), "=")
+		if !ok || strings.HasPrefix(key, "#") {
+			continue
+		}
+		values[key] = strings.Trim(value, `"'`)
+	}
+
+	if values["PRETTY_NAME"] != "" {
+		return values["PRETTY_NAME"]
+	}
+	return strings.TrimSpace(values["NAME"] + " " + values["VERSION_ID"])
+}
+
+// readFirstLine 读取文件的第一行，文件不存在时返回空
+func readFirstLine(path string) string {
+	file, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	if scanner.Scan() {
+		return strings.TrimSpace(scanner.Text())
+	}
+	return ""
+}
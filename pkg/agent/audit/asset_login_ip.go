@@ -0,0 +1,62 @@
+package audit
+
+import (
+	"context"
+	"net"
+	"strings"
+	"time"
+)
+
+// parseSourceIP 解析日志或 w 输出中的来源地址，返回规范化后的 IP
+// 去掉方括号、:port 端口和 %zone 接口后缀 (如 [fe80::1%eth0]:22)，IPv4 映射的 IPv6 地址转为 IPv4；
+// 无法解析时 (主机名、被 w 截断的 IPv6 等) 返回按 normalizeSource 处理的原始值和 false
+func parseSourceIP(raw string) (string, bool) {
+	candidate := raw
+	// 带端口的形式只有 [IPv6]:port 和 IPv4:port，不带方括号的 IPv6 含有多个冒号，不能按端口拆分
+	if host, _, err := net.SplitHostPort(candidate); err == nil {
+		candidate = host
+	}
+	candidate = strings.Trim(candidate, "[]")
+	if idx := strings.Index(candidate, "%"); idx != -1 {
+		candidate = candidate[:idx]
+	}
+
+	ip := net.ParseIP(candidate)
+	if ip == nil {
+		return normalizeSource(raw), false
+	}
+	if ipv4 := ip.To4(); ipv4 != nil {
+		ip = ipv4
+	}
+	return ip.String(), true
+}
+
+// 会话来源主机名的解析超时
+const sessionHostLookupTimeout = 2 * time.Second
+
+// resolveSessionHost 开启 ResolveSessionHostnames 时将会话来源的主机名解析为 IP，失败时返回空
+// 被 w 截断的主机名通常无法解析；同一次收集中的结果记录在 cache 中
+func (lac *LoginAssetsCollector) resolveSessionHost(hostname string, cache map[string]string) string {
+	if !lac.config.LoginConfig.ResolveSessionHostnames || hostname == "" {
+		return ""
+	}
+	if ip, ok := cache[hostname]; ok {
+		return ip
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), sessionHostLookupTimeout)
+	defer cancel()
+	ip := ""
+	addrs, err := lac.lookupHost(ctx, strings.TrimSuffix(hostname, "."))
+	if err != nil {
+		globalLogger.Debug("解析会话来源 %s 失败: %v", hostname, err)
+	}
+	for _, addr := range addrs {
+		if parsed, ok := parseSourceIP(addr); ok {
+			ip = parsed
+			break
+		}
+	}
+	cache[hostname] = ip
+	return ip
+}
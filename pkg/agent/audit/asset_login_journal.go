@@ -0,0 +1,66 @@
+package audit
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dushixiang/pika/internal/protocol"
+)
+
+// journalISOLayouts journalctl -o short-iso 的时间格式
+// 较早的 systemd 输出的时区不带冒号 (+0800)，较新的版本输出 RFC3339
+var journalISOLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05-0700",
+	"2006-01-02T15:04:05.999999-0700",
+}
+
+// collectFailedLoginsFromJournal 从 systemd journal 读取 sshd 的失败登录
+// 日志只保存在 journal 中的发行版没有 auth.log/secure，lastb 也不可用时使用
+func (lac *LoginAssetsCollector) collectFailedLoginsFromJournal(since time.Time, limit int) ([]protocol.LoginRecord, error) {
+	args := append([]string{"-u", "ssh", "-u", "sshd", "--no-pager", "-o", "short-iso"}, sinceArgs(since)...)
+	output, err := lac.execute("journalctl", args...)
+	if err != nil {
+		return nil, err
+	}
+	return newestLoginRecords(lac.parseJournalFailedLogins(output, since), limit), nil
+}
+
+// parseJournalFailedLogins 解析 journalctl -o short-iso 输出中的失败登录
+func (lac *LoginAssetsCollector) parseJournalFailedLogins(output string, since time.Time) []protocol.LoginRecord {
+	var records []protocol.LoginRecord
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		// 跳过 "-- No entries --"、"-- Boot ... --" 等提示行
+		if line == "" || strings.HasPrefix(line, "-- ") || !isFailedLoginLine(line) {
+			continue
+		}
+
+		timestamp, err := parseJournalTime(strings.Fields(line)[0])
+		if err != nil {
+			globalLogger.Debug("解析journal时间失败: %v", err)
+			continue
+		}
+		record := lac.parseFailedLoginFromLog(line)
+		if record == nil {
+			continue
+		}
+		record.Timestamp = timestamp
+		if before(record.Timestamp, since) {
+			continue
+		}
+		records = append(records, *record)
+	}
+	return records
+}
+
+// parseJournalTime 解析 short-iso 的时间，带有年份和时区，不需要推断
+func parseJournalTime(value string) (int64, error) {
+	for _, layout := range journalISOLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t.UnixMilli(), nil
+		}
+	}
+	return 0, fmt.Errorf("无法识别的时间: %s", value)
+}
@@ -0,0 +1,199 @@
+package audit
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dushixiang/pika/internal/protocol"
+)
+
+// lastWeekdays、lastMonths last -F 时间中的星期和月份 (C locale)
+var (
+	lastWeekdays = map[string]bool{"Mon": true, "Tue": true, "Wed": true, "Thu": true, "Fri": true, "Sat": true, "Sun": true}
+	lastMonths   = map[string]bool{
+		"Jan": true, "Feb": true, "Mar": true, "Apr": true, "May": true, "Jun": true,
+		"Jul": true, "Aug": true, "Sep": true, "Oct": true, "Nov": true, "Dec": true,
+	}
+)
+
+// lastLine last/lastb 输出中的一行
+type lastLine struct {
+	username string
+	terminal string
+	source   string   // FROM 列，本地控制台登录时为空
+	times    []string // 登录时间及之后的会话结束部分
+}
+
+// splitLastLine 以登录时间开头的星期和月份为界，将 last/lastb 的一行分为身份部分和时间部分
+// FROM 为空 (本地控制台登录) 时身份部分只有用户名和终端，不会把时间误当作来源；
+// 身份部分超过3个字段时 (tmux/screen、显示管理器的终端名带空格) 第一个为用户名、最后一个为来源，中间的都属于终端。
+// 找不到星期时 (非英文 locale) 按固定位置拆分，时间部分无法解析，由 executeLast 以 LC_TIME=C 重新执行
+func splitLastLine(fields []string) (lastLine, bool) {
+	if len(fields) < 3 {
+		return lastLine{}, false
+	}
+
+	anchor := -1
+	for i := 2; i+1 < len(fields); i++ {
+		if lastWeekdays[fields[i]] && lastMonths[fields[i+1]] {
+			anchor = i
+			break
+		}
+	}
+	if anchor < 0 {
+		return lastLine{username: fields[0], terminal: fields[1], source: fields[2], times: fields[3:]}, true
+	}
+
+	line := lastLine{username: fields[0], times: fields[anchor:]}
+	identity := fields[1:anchor]
+	switch len(identity) {
+	case 1:
+		line.terminal = identity[0]
+	default:
+		line.terminal = strings.Join(identity[:len(identity)-1], " ")
+		line.source = identity[len(identity)-1]
+	}
+	return line, true
+}
+
+// parseSessionEnd 解析 last -F 登录时间之后的会话结束部分，times 为 splitLastLine 分出的时间部分
+// username pts/0 192.168.1.1 Mon Dec 25 10:30:00 2023 - Mon Dec 25 11:00:00 2023  (00:30)
+// username pts/0 192.168.1.1 Mon Dec 25 10:30:00 2023 - crash                     (1+02:03)
+// username pts/0 192.168.1.1 Mon Dec 25 10:30:00 2023 - down                      (00:12)
+// username pts/0 192.168.1.1 Mon Dec 25 10:30:00 2023 - gone - no logout
+// username pts/0 192.168.1.1 Mon Dec 25 10:30:00 2023   still logged in
+func (lac *LoginAssetsCollector) parseSessionEnd(times []string, record *protocol.LoginRecord) {
+	if len(times) < 6 {
+		return
+	}
+	rest := times[5:]
+
+	if rest[0] == "still" {
+		record.EndReason = protocol.SessionEndStillLoggedIn
+		return
+	}
+	if rest[0] != "-" || len(rest) < 2 {
+		return
+	}
+
+	switch rest[1] {
+	case "crash":
+		record.EndReason = protocol.SessionEndCrash
+	case "down":
+		record.EndReason = protocol.SessionEndDown
+	case "gone":
+		record.EndReason = protocol.SessionEndGone
+		return
+	default:
+		if len(rest) < 6 {
+			return
+		}
+		record.EndReason = protocol.SessionEndLogout
+		if t, ok := parseLastTime(strings.Join(rest[1:6], " ")); ok {
+			record.LogoutTime = t.UnixMilli()
+			record.DurationSeconds = (record.LogoutTime - record.Timestamp) / 1000
+		}
+	}
+
+	// crash/down 没有登出时间，时长以 last 给出的为准 (到下次启动或关机)
+	if record.DurationSeconds == 0 {
+		if duration, ok := parseLastDuration(rest[len(rest)-1]); ok {
+			record.DurationSeconds = int64(duration.Seconds())
+		}
+	}
+}
+
+// parseLastTime 解析 last -F 的完整时间
+func parseLastTime(value string) (time.Time, bool) {
+	for _, layout := range []string{"Mon Jan _2 15:04:05 2006", "Mon Jan 2 15:04:05 2006"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// parseLastDuration 解析会话时长: (00:30) 或 (1+02:03)
+func parseLastDuration(value string) (time.Duration, bool) {
+	if !strings.HasPrefix(value, "(") || !strings.HasSuffix(value, ")") {
+		return 0, false
+	}
+	value = strings.Trim(value, "()")
+
+	var days, hours, minutes int
+	if d, hm, ok := strings.Cut(value, "+"); ok {
+		if _, err := fmt.Sscanf(d, "%d", &days); err != nil {
+			return 0, false
+		}
+		value = hm
+	}
+	if _, err := fmt.Sscanf(value, "%d:%d", &hours, &minutes); err != nil {
+		return 0, false
+	}
+
+	return time.Duration(days)*24*time.Hour + time.Duration(hours)*time.Hour + time.Duration(minutes)*time.Minute, true
+}
+
+// lastRecordKey 两次运行 last 时用于匹配同一条记录
+type lastRecordKey struct {
+	username  string
+	terminal  string
+	timestamp int64
+}
+
+// mergeLastRecords 合并 last (主机名) 和 last -i (数字IP) 的记录
+// 两次运行之间可能有新的登录，记录数不一定相同：只在一次运行中出现的记录原样保留
+func mergeLastRecords(named, numeric []protocol.LoginRecord, limit int) []protocol.LoginRecord {
+	// 同一用户和终端可能在同一秒有多条记录，按出现顺序依次匹配
+	byKey := make(map[lastRecordKey][]int)
+	for i, record := range named {
+		key := lastRecordKey{record.Username, record.Terminal, record.Timestamp}
+		byKey[key] = append(byKey[key], i)
+	}
+
+	matched := make([]bool, len(named))
+	merged := make([]protocol.LoginRecord, 0, max(len(named), len(numeric)))
+	for _, record := range numeric {
+		key := lastRecordKey{record.Username, record.Terminal, record.Timestamp}
+		if indexes := byKey[key]; len(indexes) > 0 {
+			byKey[key] = indexes[1:]
+			matched[indexes[0]] = true
+
+			host := named[indexes[0]].IP
+			if net.ParseIP(host) == nil {
+				record.Hostname = host
+			}
+			// 本地登录在 -i 输出中为 0.0.0.0
+			if record.IP == "0.0.0.0" || record.IP == "::" {
+				record.IP = host
+			}
+		}
+		merged = append(merged, record)
+	}
+
+	for i, record := range named {
+		if matched[i] {
+			continue
+		}
+		if net.ParseIP(record.IP) == nil {
+			record.Hostname = record.IP
+			// 没有对应的 -i 记录时无法得知远程主机名的IP，不能把主机名留在 IP 字段里
+			if !isLocalSource(record.IP) {
+				record.IP = "unknown"
+			}
+		}
+		merged = append(merged, record)
+	}
+
+	// 与 last 的输出一致，新的在前
+	sort.SliceStable(merged, func(i, j int) bool {
+		return merged[i].Timestamp > merged[j].Timestamp
+	})
+	if len(merged) > limit {
+		merged = merged[:limit]
+	}
+	return merged
+}
@@ -0,0 +1,88 @@
+package audit
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dushixiang/pika/internal/protocol"
+)
+
+// lastlogNeverLoggedIn lastlog 中从未登录的用户的标记
+const lastlogNeverLoggedIn = "**Never logged in**"
+
+// lastlogTimeLayout lastlog 的最近登录时间格式 (Mon Oct 14 10:22:33 +0800 2024)
+const lastlogTimeLayout = "Mon Jan _2 15:04:05 -0700 2006"
+
+// collectLastLogin 通过 lastlog 收集每个用户最近一次登录
+// 只有禁止执行外部命令时返回错误，其他失败 (如未安装) 视为没有数据
+func (lac *LoginAssetsCollector) collectLastLogin() ([]protocol.LastLoginEntry, error) {
+	output, err := lac.execute("lastlog")
+	if err != nil {
+		globalLogger.Debug("获取lastlog失败: %v", err)
+		if errors.Is(err, ErrNoExec) {
+			return nil, fmt.Errorf("lastlog: %w", err)
+		}
+		return nil, nil
+	}
+	return parseLastlogOutput(output), nil
+}
+
+// parseLastlogOutput 解析 lastlog 的列输出
+//
+//	Username         Port     From             Latest
+//	root             pts/0    192.168.1.10     Mon Oct 14 10:22:33 +0800 2024
+//	daemon                                     **Never logged in**
+//
+// 用户名超出列宽时后面的列整体右移，因此时间按末尾的字段解析；
+// Port 和 From 只有一个时按其起始位置与表头 From 列的位置判断
+func parseLastlogOutput(output string) []protocol.LastLoginEntry {
+	var entries []protocol.LastLoginEntry
+	fromCol := -1
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimRight(line, " \t\r")
+		if line == "" {
+			continue
+		}
+		if fromCol < 0 && strings.HasPrefix(line, "Username") {
+			fromCol = strings.Index(line, "From")
+			continue
+		}
+
+		if rest, ok := strings.CutSuffix(line, lastlogNeverLoggedIn); ok {
+			fields := strings.Fields(rest)
+			if len(fields) == 0 {
+				continue
+			}
+			entries = append(entries, protocol.LastLoginEntry{Username: fields[0], NeverLoggedIn: true})
+			continue
+		}
+
+		fields := strings.Fields(line)
+		// 用户名 + 6 个时间字段，Port 和 From 可能为空
+		if len(fields) < 7 || len(fields) > 9 {
+			continue
+		}
+		timeFields := fields[len(fields)-6:]
+		latest, err := time.Parse(lastlogTimeLayout, strings.Join(timeFields, " "))
+		if err != nil {
+			globalLogger.Debug("解析lastlog时间失败: %v", err)
+			continue
+		}
+
+		entry := protocol.LastLoginEntry{Username: fields[0], Latest: latest.UnixMilli()}
+		switch middle := fields[1 : len(fields)-6]; len(middle) {
+		case 2:
+			entry.Port, entry.From = middle[0], middle[1]
+		case 1:
+			if fromCol >= 0 && strings.Index(line[len(fields[0]):], middle[0])+len(fields[0]) >= fromCol {
+				entry.From = middle[0]
+			} else {
+				entry.Port = middle[0]
+			}
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
@@ -0,0 +1,79 @@
+package audit
+
+import (
+	"github.com/dushixiang/pika/internal/protocol"
+)
+
+// LocationResolver IP 归属地查询，服务端的 GeoIPService 满足该接口
+// 查询失败或没有位置信息时返回空字符串
+type LocationResolver interface {
+	LookupIP(ip string) string
+}
+
+// SetLocationResolver 设置收集时使用的归属地查询，为 nil 时不填充归属地 (由服务端补充)
+func (lac *LoginAssetsCollector) SetLocationResolver(resolver LocationResolver) {
+	lac.locations = resolver
+}
+
+// resolveLocations 为登录记录和会话填充归属地，已有归属地的保持不变
+// 同一次收集中每个 IP 只查询一次
+func (lac *LoginAssetsCollector) resolveLocations(assets *protocol.LoginAssets) {
+	if lac.locations == nil {
+		return
+	}
+
+	resolved := make(map[string]string)
+	lookup := func(ip string) string {
+		if ip == "" || ip == "unknown" {
+			return ""
+		}
+		location, ok := resolved[ip]
+		if !ok {
+			location = lac.locations.LookupIP(ip)
+			resolved[ip] = location
+		}
+		return location
+	}
+
+	for _, records := range [][]protocol.LoginRecord{assets.SuccessfulLogins, assets.FailedLogins} {
+		for i := range records {
+			if records[i].Location == "" {
+				records[i].Location = lookup(records[i].IP)
+			}
+		}
+	}
+	for i := range assets.CurrentSessions {
+		if assets.CurrentSessions[i].Location == "" {
+			assets.CurrentSessions[i].Location = lookup(assets.CurrentSessions[i].IP)
+		}
+	}
+}
+
+// countryBucket 按国家统计时归属地所属的国家，内网IP和归属地未知的分别归入单独的分类
+func countryBucket(location string) string {
+	if country := locationCountry(location); country != "" {
+		return country
+	}
+	if location == "内网IP" {
+		return protocol.CountryPrivate
+	}
+	return protocol.CountryUnknown
+}
+
+// countLoginsByCountry 成功登录按国家统计，记录都没有归属地时返回 nil
+func countLoginsByCountry(logins []protocol.LoginRecord) map[string]int {
+	var counts map[string]int
+	for _, login := range logins {
+		if login.Location != "" {
+			counts = make(map[string]int)
+			break
+		}
+	}
+	if counts == nil {
+		return nil
+	}
+	for _, login := range logins {
+		counts[countryBucket(login.Location)]++
+	}
+	return counts
+}
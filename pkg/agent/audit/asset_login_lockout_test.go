@@ -0,0 +1,156 @@
+package audit
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dushixiang/pika/internal/protocol"
+)
+
+func TestParseLockoutLine(t *testing.T) {
+	lac := &LoginAssetsCollector{config: DefaultConfig()}
+	policy := faillockPolicy{deny: 3, unlockTime: 10 * time.Minute}
+	both := []string{"pam_faillock", "pam_tally2"}
+	lockedAt := time.Date(2024, 3, 4, 10, 15, 2, 0, time.UTC).UnixMilli()
+
+	for _, tt := range []struct {
+		name     string
+		line     string
+		modules  []string
+		want     bool
+		username string
+		module   string
+		attempts int
+	}{
+		{
+			name:     "pam_faillock",
+			line:     "2024-03-04T10:15:02+00:00 web1 sshd[2211]: pam_faillock(sshd:auth): Consecutive login failures for user alice account temporarily locked",
+			modules:  both,
+			want:     true,
+			username: "alice",
+			module:   "pam_faillock",
+			attempts: 3,
+		},
+		{
+			name:     "pam_tally2",
+			line:     "2024-03-04T10:15:02+00:00 web1 sshd[2250]: pam_tally2(sshd:auth): user bob (1001) tally 4, deny 3",
+			modules:  both,
+			want:     true,
+			username: "bob",
+			module:   "pam_tally2",
+			attempts: 4,
+		},
+		{
+			name:    "未启用的模块",
+			line:    "2024-03-04T10:15:02+00:00 web1 sshd[2250]: pam_tally2(sshd:auth): user bob (1001) tally 4, deny 3",
+			modules: []string{"pam_faillock"},
+		},
+		{
+			name:    "未锁定的失败",
+			line:    "2024-03-04T10:15:02+00:00 web1 sshd[2211]: pam_faillock(sshd:auth): User unknown",
+			modules: both,
+		},
+		{
+			name:    "其他模块",
+			line:    "2024-03-04T10:15:02+00:00 web1 sshd[2211]: pam_unix(sshd:auth): authentication failure; logname= uid=0 euid=0 tty=ssh ruser= rhost=203.0.113.7  user=alice",
+			modules: both,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got := lac.parseLockoutLine(tt.line, tt.modules, policy)
+			if !tt.want {
+				if got != nil {
+					t.Fatalf("不应解析为锁定: %+v", got)
+				}
+				return
+			}
+			if got == nil {
+				t.Fatal("未解析到锁定")
+			}
+			if got.Username != tt.username || got.Module != tt.module || got.Attempts != tt.attempts ||
+				got.Source != lockoutSourceAuthLog || got.LockedAt != lockedAt || got.UnlockedAt != lockedAt+(10*time.Minute).Milliseconds() {
+				t.Errorf("锁定 = %+v", got)
+			}
+		})
+	}
+
+	// 传统 syslog 时间
+	got := lac.parseLockoutLine("Mar  4 10:15:02 web1 sshd[2211]: pam_faillock(sshd:auth): Consecutive login failures for user carol account temporarily locked", both, policy)
+	if got == nil || got.Username != "carol" {
+		t.Fatalf("传统 syslog 格式 = %+v", got)
+	}
+}
+
+func TestReadFaillockPolicy(t *testing.T) {
+	dir := t.TempDir()
+	if got := readFaillockPolicy(filepath.Join(dir, "missing.conf")); got.deny != 3 || got.unlockTime != 600*time.Second {
+		t.Errorf("默认策略 = %+v", got)
+	}
+
+	path := filepath.Join(dir, "faillock.conf")
+	conf := "# Configuration for locking the user after multiple failed\n# deny = 3\ndeny = 5\n  unlock_time = never\nsilent\n"
+	if err := os.WriteFile(path, []byte(conf), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	policy := readFaillockPolicy(path)
+	if policy.deny != 5 || policy.unlockTime != 0 {
+		t.Fatalf("策略 = %+v", policy)
+	}
+	// unlock_time=never 时需要管理员解锁，始终处于锁定状态
+	if unlockedAt, locked := policy.unlockState(time.Now().Add(-24 * time.Hour).UnixMilli()); unlockedAt != 0 || !locked {
+		t.Errorf("unlock_time=never: %d, %v", unlockedAt, locked)
+	}
+}
+
+func TestParseFaillockOutput(t *testing.T) {
+	output := `alice:
+When                Type  Source                                           Valid
+2024-03-04 10:15:00 RHOST 203.0.113.7                                          V
+2024-03-04 10:15:01 RHOST 203.0.113.7                                          V
+2024-03-04 10:15:02 RHOST 203.0.113.7                                          V
+bob:
+When                Type  Source                                           Valid
+2024-03-04 09:00:00 RHOST 198.51.100.4                                         I
+2024-03-04 09:00:03 RHOST 198.51.100.4                                         I
+2024-03-04 09:00:05 TTY   pts/1                                                V
+root:
+When                Type  Source                                           Valid
+`
+	lockouts := parseFaillockOutput(output, faillockPolicy{deny: 3})
+	if len(lockouts) != 1 {
+		t.Fatalf("锁定 = %+v", lockouts)
+	}
+	want := time.Date(2024, 3, 4, 10, 15, 2, 0, time.Local).UnixMilli()
+	if got := lockouts[0]; got.Username != "alice" || got.Attempts != 3 || got.LockedAt != want ||
+		got.Source != lockoutSourceFaillock || !got.Locked || got.UnlockedAt != 0 {
+		t.Errorf("alice = %+v", got)
+	}
+
+	// 无效 (I) 的失败不计入
+	if lockouts := parseFaillockOutput(output, faillockPolicy{deny: 1}); len(lockouts) != 2 || lockouts[1].Username != "bob" || lockouts[1].Attempts != 1 {
+		t.Errorf("deny=1 = %+v", lockouts)
+	}
+}
+
+func TestDedupLockouts(t *testing.T) {
+	lockedAt := time.Date(2024, 3, 4, 10, 15, 2, 0, time.UTC).UnixMilli()
+	authLog := []protocol.AccountLockout{
+		{Username: "alice", Source: lockoutSourceAuthLog, LockedAt: lockedAt + 400},
+		{Username: "alice", Source: lockoutSourceAuthLog, LockedAt: lockedAt - time.Hour.Milliseconds()},
+		{Username: "bob", Source: lockoutSourceAuthLog, LockedAt: lockedAt},
+	}
+	faillock := []protocol.AccountLockout{
+		{Username: "alice", Source: lockoutSourceFaillock, LockedAt: lockedAt, Attempts: 3},
+	}
+	got := dedupLockouts(authLog, faillock)
+	if len(got) != 3 {
+		t.Fatalf("合并后 = %+v", got)
+	}
+	for _, lockout := range got {
+		if lockout.Username == "alice" && lockout.Source == lockoutSourceAuthLog && lockout.LockedAt == lockedAt+400 {
+			t.Errorf("同一次锁定不应重复: %+v", got)
+		}
+	}
+}
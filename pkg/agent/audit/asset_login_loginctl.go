@@ -0,0 +1,89 @@
+package audit
+
+import (
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/dushixiang/pika/internal/protocol"
+)
+
+// isSystemdBooted 主机是否以 systemd 启动 (与 sd_booted 的判断相同)，否则没有 logind，不执行 loginctl
+func isSystemdBooted() bool {
+	info, err := os.Stat("/run/systemd/system")
+	return err == nil && info.IsDir()
+}
+
+// applySessionPIDs 通过 loginctl 为会话补充首进程 PID，按用户名和终端匹配
+// 需要开启 ResolveSessionPIDs，主机不是以 systemd 启动或 loginctl 执行失败时保持为 0
+func (lac *LoginAssetsCollector) applySessionPIDs(sessions []protocol.LoginSession) {
+	if !lac.config.LoginConfig.ResolveSessionPIDs || len(sessions) == 0 || lac.systemdBooted == nil || !lac.systemdBooted() {
+		return
+	}
+
+	// list-sessions 的列随 systemd 版本变化 (SEAT 可能为空)，只取第一列的会话 ID，其余属性由 show-session 读取
+	output, err := lac.execute("loginctl", "list-sessions", "--no-legend", "--no-pager")
+	if err != nil {
+		globalLogger.Debug("获取logind会话失败: %v", err)
+		return
+	}
+	var ids []string
+	for _, line := range strings.Split(output, "\n") {
+		if fields := strings.Fields(line); len(fields) > 0 {
+			ids = append(ids, fields[0])
+		}
+	}
+	if len(ids) == 0 {
+		return
+	}
+
+	args := append([]string{"show-session", "--no-pager", "-p", "Name", "-p", "TTY", "-p", "Leader"}, ids...)
+	output, err = lac.execute("loginctl", args...)
+	if err != nil {
+		globalLogger.Debug("获取logind会话属性失败: %v", err)
+		return
+	}
+
+	leaders := parseLoginctlLeaders(output)
+	for i := range sessions {
+		if pid, ok := leaders[sessions[i].Username+"\x00"+sessions[i].Terminal]; ok {
+			sessions[i].PID = pid
+		}
+	}
+}
+
+// parseLoginctlLeaders 解析 loginctl show-session 的输出，返回 用户名\x00终端 -> 首进程 PID
+// 每个会话输出一组 KEY=VALUE，组之间以空行分隔；没有终端的会话 (如 cron) 不参与匹配
+func parseLoginctlLeaders(output string) map[string]int {
+	leaders := make(map[string]int)
+	var name, tty string
+	var leader int
+	flush := func() {
+		if name != "" && tty != "" && leader > 0 {
+			leaders[name+"\x00"+tty] = leader
+		}
+		name, tty, leader = "", "", 0
+	}
+
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			flush()
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "Name":
+			name = value
+		case "TTY":
+			tty = strings.TrimPrefix(value, "/dev/")
+		case "Leader":
+			leader, _ = strconv.Atoi(value)
+		}
+	}
+	flush()
+	return leaders
+}
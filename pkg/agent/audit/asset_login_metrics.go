@@ -0,0 +1,50 @@
+package audit
+
+import (
+	"github.com/dushixiang/pika/internal/protocol"
+)
+
+// 分析器指标名称，均带有 analyzer 标签 (分析器名称)
+const (
+	MetricAnalyzerEvaluations = "login_analyzer_evaluations_total" // 分析器执行次数 (每次收集或重新分析一次)
+	MetricAnalyzerFirings     = "login_analyzer_firings_total"     // 分析器产生的告警条数
+)
+
+// MetricsRecorder 指标输出，由宿主程序对接到自身的监控系统
+// 用于观察各分析器的告警频率并据此调整阈值，实现应是并发安全且不阻塞的
+type MetricsRecorder interface {
+	// AddCounter 计数器增加 delta
+	AddCounter(name string, labels map[string]string, delta int64)
+}
+
+// SetMetricsRecorder 设置指标输出，为 nil 时不输出指标
+func (lac *LoginAssetsCollector) SetMetricsRecorder(recorder MetricsRecorder) {
+	lac.metrics = recorder
+}
+
+// recordAnalyzerRun 记录分析器的一次执行及产生的告警条数
+func (lac *LoginAssetsCollector) recordAnalyzerRun(analyzer string, firings int) {
+	if lac.metrics == nil {
+		return
+	}
+	labels := map[string]string{"analyzer": analyzer}
+	lac.metrics.AddCounter(MetricAnalyzerEvaluations, labels, 1)
+	lac.metrics.AddCounter(MetricAnalyzerFirings, labels, int64(firings))
+}
+
+// analyzerFindings 统计信息中分析器产生的告警总条数
+// 每个分析器只写入自己的告警字段，执行前后的差值即为该分析器的告警条数；新增告警字段时需同步
+func analyzerFindings(stats *protocol.LoginStatistics) int {
+	return len(stats.HighFrequencyIPs) +
+		len(stats.AutomationSuspicions) +
+		len(stats.SharedAccountAlerts) +
+		len(stats.ScriptedAttacks) +
+		len(stats.UnexpectedAuthMethods) +
+		len(stats.TimingPatterns) +
+		len(stats.BastionBypasses) +
+		len(stats.LongLivedSessions) +
+		len(stats.ConcurrentAccess) +
+		len(stats.BruteForceAttempts) +
+		len(stats.ForeignLogins) +
+		len(stats.OffHoursLogins)
+}
@@ -0,0 +1,33 @@
+package audit
+
+import (
+	"github.com/dushixiang/pika/internal/protocol"
+)
+
+// tagNATSources 标记来源为 NAT 出口的登录记录和会话
+// 办公网络等通过同一出口访问时，多个用户表现为同一个来源IP，
+// 按来源IP关联的分析 (高频来源、终端突发分配，以及并发会话、异地登录等) 应跳过带有该标记的来源
+func tagNATSources(assets *protocol.LoginAssets, nat *sourceMatcher) {
+	if nat == nil || (len(nat.prefixes) == 0 && len(nat.hostnames) == 0) {
+		return
+	}
+	for _, records := range [][]protocol.LoginRecord{assets.SuccessfulLogins, assets.FailedLogins} {
+		for i := range records {
+			_, records[i].BehindNAT = nat.Match(records[i].IP, records[i].Hostname)
+		}
+	}
+	for i := range assets.CurrentSessions {
+		_, assets.CurrentSessions[i].BehindNAT = nat.Match(assets.CurrentSessions[i].IP, assets.CurrentSessions[i].Hostname)
+	}
+}
+
+// natSourceIPs 标记为 NAT 出口的来源IP
+func natSourceIPs(records []protocol.LoginRecord) map[string]bool {
+	ips := make(map[string]bool)
+	for _, record := range records {
+		if record.BehindNAT {
+			ips[record.IP] = true
+		}
+	}
+	return ips
+}
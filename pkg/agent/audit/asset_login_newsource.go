@@ -0,0 +1,46 @@
+package audit
+
+import (
+	"slices"
+
+	"github.com/dushixiang/pika/internal/protocol"
+)
+
+// SetKnownUserIPs 设置各用户历史上使用过的来源IP (用户名 -> IP)，之后的统计信息中列出首次出现的来源
+// 审计包不保存历史，由宿主程序持久化并在每次收集前传入 (可使用 MergeKnownUserIPs 更新)；为 nil 时不检测
+func (lac *LoginAssetsCollector) SetKnownUserIPs(known map[string][]string) {
+	lac.knownUserIPs = known
+}
+
+// hasSourceIP 是否为可以按来源IP判断的记录 (排除本地登录和未知来源)
+func hasSourceIP(login protocol.LoginRecord) bool {
+	return login.IP != "" && login.IP != "unknown" && !isLoopbackSource(login.IP)
+}
+
+// FindNewSourceLogins 找出 (用户名, 来源IP) 不在 known 中的成功登录，按原有顺序返回
+// 同一个新来源的多次登录全部列出；纯函数，不修改输入
+func FindNewSourceLogins(logins []protocol.LoginRecord, known map[string][]string) []protocol.LoginRecord {
+	var found []protocol.LoginRecord
+	for _, login := range logins {
+		if !hasSourceIP(login) {
+			continue
+		}
+		if !slices.Contains(known[login.Username], login.IP) {
+			found = append(found, login)
+		}
+	}
+	return found
+}
+
+// MergeKnownUserIPs 将登录记录的来源合并到历史来源中并返回，known 为 nil 时创建新的集合
+func MergeKnownUserIPs(known map[string][]string, logins []protocol.LoginRecord) map[string][]string {
+	if known == nil {
+		known = make(map[string][]string)
+	}
+	for _, login := range logins {
+		if hasSourceIP(login) && !slices.Contains(known[login.Username], login.IP) {
+			known[login.Username] = append(known[login.Username], login.IP)
+		}
+	}
+	return known
+}
@@ -0,0 +1,120 @@
+package audit
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dushixiang/pika/internal/protocol"
+)
+
+// collectFromRotated 收集 wtmp/btmp 轮转文件 (wtmp.1、wtmp.2.gz 等，不含当前文件) 中的记录
+// 逐个文件以 command -f 读取 (last/lastb)，gz 文件先解压到临时目录；命令不可用时直接解析文件。
+// 单个文件失败只记录日志，返回全部轮转文件中的记录
+func (lac *LoginAssetsCollector) collectFromRotated(path, command string, limit int, since time.Time, accept func(*utmpEntry) bool, status string) []protocol.LoginRecord {
+	var records []protocol.LoginRecord
+	for _, rotated := range rotatedLogFiles(path, since) {
+		if rotated == path {
+			continue
+		}
+		fileRecords, err := lac.collectFromRotatedFile(rotated, command, limit, since, accept, status)
+		if err != nil {
+			globalLogger.Debug("读取轮转文件 %s 失败: %v", rotated, err)
+			continue
+		}
+		records = append(records, fileRecords...)
+	}
+	return records
+}
+
+func (lac *LoginAssetsCollector) collectFromRotatedFile(path, command string, limit int, since time.Time, accept func(*utmpEntry) bool, status string) ([]protocol.LoginRecord, error) {
+	// last 会跟随符号链接，执行前先检查路径
+	if err := checkLogPath(path); err != nil {
+		return nil, err
+	}
+	if strings.HasSuffix(path, ".gz") {
+		decompressed, cleanup, err := decompressToTemp(path)
+		if err != nil {
+			return nil, err
+		}
+		defer cleanup()
+		path = decompressed
+	}
+
+	args := append(append(append([]string{"-f", path}, limitArgs(limit)...), "-F", "-w"), sinceArgs(since)...)
+	output, err := lac.executeLast(command, args...)
+	if err == nil {
+		if command == "lastb" {
+			return lac.parseLastbOutput(output, limit), nil
+		}
+		return lac.parseLastOutput(output, limit), nil
+	}
+	globalLogger.Debug("%s -f %s 失败，直接读取: %v", command, path, err)
+
+	entries, err := readUtmpTail(path, limit, since, accept)
+	if err != nil {
+		return nil, err
+	}
+	records := make([]protocol.LoginRecord, 0, len(entries))
+	for i := range entries {
+		records = append(records, entries[i].toLoginRecord(status))
+	}
+	return records, nil
+}
+
+// decompressToTemp 将 gz 文件解压到仅当前用户可访问的临时目录，文件名去掉 .gz 后缀
+// (last 输出的 "wtmp.2 begins" 等提示行以文件名开头)，返回解压后的路径和清理函数
+func decompressToTemp(path string) (string, func(), error) {
+	file, err := openLogFile(path)
+	if err != nil {
+		return "", nil, err
+	}
+	defer file.Close()
+
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		return "", nil, err
+	}
+	defer gz.Close()
+
+	dir, err := os.MkdirTemp("", "pika-rotated-")
+	if err != nil {
+		return "", nil, err
+	}
+	cleanup := func() { os.RemoveAll(dir) }
+
+	target := filepath.Join(dir, strings.TrimSuffix(filepath.Base(path), ".gz"))
+	out, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		cleanup()
+		return "", nil, err
+	}
+	_, err = io.Copy(out, gz)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		cleanup()
+		return "", nil, err
+	}
+	return target, cleanup, nil
+}
+
+// mergeNewestRecords 合并当前文件与轮转文件中的记录，按时间从新到旧排列并保留最新的 limit 条
+func mergeNewestRecords(current, rotated []protocol.LoginRecord, limit int) []protocol.LoginRecord {
+	if len(rotated) == 0 {
+		return current
+	}
+	records := append(append([]protocol.LoginRecord(nil), current...), rotated...)
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].Timestamp > records[j].Timestamp
+	})
+	if limit > 0 && len(records) > limit {
+		records = records[:limit]
+	}
+	return records
+}
@@ -0,0 +1,271 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dushixiang/pika/internal/protocol"
+)
+
+// 登录事件类型，与 NDJSON 导出 (protocol.LoginAssets.WriteNDJSON) 一致
+const (
+	LoginEventSuccess = protocol.LoginEventTypeSuccess
+	LoginEventFailed  = protocol.LoginEventTypeFailed
+	LoginEventSession = protocol.LoginEventTypeSession
+)
+
+// LoginEvent 登录事件
+type LoginEvent struct {
+	Type    string                 `json:"type"`              // 事件类型
+	Record  *protocol.LoginRecord  `json:"record,omitempty"`  // 登录记录 (success_login/failed_login)
+	Session *protocol.LoginSession `json:"session,omitempty"` // 登录会话 (session)
+}
+
+// LoginEventSink 登录事件输出
+type LoginEventSink interface {
+	// Emit 输出单个事件，实现不应阻塞收集流程
+	Emit(event LoginEvent) error
+
+	// Close 关闭输出并释放资源
+	Close() error
+}
+
+// loginAssetsEvents 将登录资产拆分为事件
+func loginAssetsEvents(assets *protocol.LoginAssets) []LoginEvent {
+	var events []LoginEvent
+	for i := range assets.SuccessfulLogins {
+		events = append(events, LoginEvent{Type: LoginEventSuccess, Record: &assets.SuccessfulLogins[i]})
+	}
+	for i := range assets.FailedLogins {
+		events = append(events, LoginEvent{Type: LoginEventFailed, Record: &assets.FailedLogins[i]})
+	}
+	for i := range assets.CurrentSessions {
+		events = append(events, LoginEvent{Type: LoginEventSession, Session: &assets.CurrentSessions[i]})
+	}
+	return events
+}
+
+// emitLoginAssets 将登录资产输出到全部事件输出
+func emitLoginAssets(sinks []LoginEventSink, assets *protocol.LoginAssets) {
+	if len(sinks) == 0 || assets == nil {
+		return
+	}
+	for _, event := range loginAssetsEvents(assets) {
+		for _, sink := range sinks {
+			if err := sink.Emit(event); err != nil {
+				globalLogger.Debug("输出登录事件失败: %v", err)
+			}
+		}
+	}
+}
+
+// SocketSinkConfig Unix Socket 事件输出配置
+type SocketSinkConfig struct {
+	// 网络类型: unixgram / unix (流式)
+	Network string
+
+	// Socket 路径，为空时不启用
+	Path string
+
+	// 缓冲事件数量，缓冲满时丢弃新事件
+	BufferSize int
+}
+
+const (
+	socketSinkWriteTimeout   = 5 * time.Second
+	socketSinkMinBackoff     = 500 * time.Millisecond
+	socketSinkMaxBackoff     = 30 * time.Second
+	socketSinkDefaultBufSize = 1024
+	socketSinkMaxAttempts    = 3
+)
+
+// SocketSink 通过 Unix Socket 以 NDJSON 格式输出登录事件
+// 连接失败时自动重连；消费方过慢时丢弃事件并计数，不阻塞收集
+type SocketSink struct {
+	network string
+	path    string
+
+	// 重连的初始等待时间，之后每次加倍，最长 socketSinkMaxBackoff
+	minBackoff time.Duration
+
+	queue   chan []byte
+	done    chan struct{}
+	wg      sync.WaitGroup
+	dropped atomic.Uint64
+	once    sync.Once
+}
+
+// NewSocketSink 创建 Unix Socket 事件输出
+func NewSocketSink(config SocketSinkConfig) (*SocketSink, error) {
+	return newSocketSink(config, socketSinkMinBackoff)
+}
+
+func newSocketSink(config SocketSinkConfig, minBackoff time.Duration) (*SocketSink, error) {
+	network := config.Network
+	if network == "" {
+		network = "unixgram"
+	}
+	if network != "unixgram" && network != "unix" {
+		return nil, fmt.Errorf("不支持的socket类型: %s", network)
+	}
+	if config.Path == "" {
+		return nil, fmt.Errorf("socket路径不能为空")
+	}
+
+	bufferSize := config.BufferSize
+	if bufferSize <= 0 {
+		bufferSize = socketSinkDefaultBufSize
+	}
+
+	sink := &SocketSink{
+		network:    network,
+		path:       config.Path,
+		minBackoff: minBackoff,
+		queue:      make(chan []byte, bufferSize),
+		done:       make(chan struct{}),
+	}
+	sink.wg.Add(1)
+	go sink.run()
+
+	return sink, nil
+}
+
+// Emit 将事件放入缓冲，缓冲已满时丢弃
+func (s *SocketSink) Emit(event LoginEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	select {
+	case <-s.done:
+		return fmt.Errorf("socket输出已关闭")
+	default:
+	}
+
+	select {
+	case s.queue <- data:
+		return nil
+	default:
+		s.dropped.Add(1)
+		return fmt.Errorf("socket输出缓冲已满，事件被丢弃")
+	}
+}
+
+// Dropped 被丢弃的事件数量 (缓冲已满或多次发送失败)
+func (s *SocketSink) Dropped() uint64 {
+	return s.dropped.Load()
+}
+
+// Close 关闭输出，缓冲中剩余的事件会尽力发送一次
+func (s *SocketSink) Close() error {
+	s.once.Do(func() {
+		close(s.done)
+	})
+	s.wg.Wait()
+	return nil
+}
+
+// run 后台发送循环
+func (s *SocketSink) run() {
+	defer s.wg.Done()
+
+	var conn net.Conn
+	defer func() {
+		if conn != nil {
+			conn.Close()
+		}
+	}()
+
+	backoff := s.minBackoff
+	for {
+		var data []byte
+		select {
+		case <-s.done:
+			conn = s.drain(conn, nil)
+			return
+		case data = <-s.queue:
+		}
+
+		// 发送失败时重连并重试当前事件，期间新事件继续进入缓冲
+		for attempts := 0; ; {
+			if conn == nil {
+				c, err := net.Dial(s.network, s.path)
+				if err != nil {
+					globalLogger.Debug("连接socket失败: %s, err: %v", s.path, err)
+					if !s.sleep(backoff) {
+						// 等待重连期间关闭，当前事件和缓冲中的事件尽力发送一次
+						conn = s.drain(conn, data)
+						return
+					}
+					backoff = min(backoff*2, socketSinkMaxBackoff)
+					continue
+				}
+				conn = c
+				backoff = s.minBackoff
+			}
+
+			_ = conn.SetWriteDeadline(time.Now().Add(socketSinkWriteTimeout))
+			if _, err := conn.Write(data); err != nil {
+				globalLogger.Debug("写入socket失败: %s, err: %v", s.path, err)
+				conn.Close()
+				conn = nil
+
+				// 重连后仍写入失败 (如数据报过大)，丢弃该事件避免阻塞后续事件
+				attempts++
+				if attempts >= socketSinkMaxAttempts {
+					s.dropped.Add(1)
+					break
+				}
+				continue
+			}
+			break
+		}
+	}
+}
+
+// drain 关闭时尽力发送 pending (正在发送的事件，可为 nil) 和缓冲中剩余的事件，失败后不再重试，未发送的事件计入丢弃
+func (s *SocketSink) drain(conn net.Conn, pending []byte) net.Conn {
+	for {
+		data := pending
+		pending = nil
+		if data == nil {
+			select {
+			case data = <-s.queue:
+			default:
+				return conn
+			}
+		}
+
+		if conn == nil {
+			c, err := net.Dial(s.network, s.path)
+			if err != nil {
+				s.dropped.Add(uint64(len(s.queue) + 1))
+				return nil
+			}
+			conn = c
+		}
+		_ = conn.SetWriteDeadline(time.Now().Add(socketSinkWriteTimeout))
+		if _, err := conn.Write(data); err != nil {
+			s.dropped.Add(uint64(len(s.queue) + 1))
+			return conn
+		}
+	}
+}
+
+// sleep 等待指定时间，期间关闭则返回 false
+func (s *SocketSink) sleep(d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-s.done:
+		return false
+	case <-timer.C:
+		return true
+	}
+}
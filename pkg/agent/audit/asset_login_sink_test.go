@@ -0,0 +1,89 @@
+package audit
+
+import (
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dushixiang/pika/internal/protocol"
+)
+
+func TestSocketSinkReconnects(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.sock")
+	listen := func() *net.UnixConn {
+		conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return conn
+	}
+	receive := func(conn *net.UnixConn) string {
+		buf := make([]byte, 4096)
+		_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		n, err := conn.Read(buf)
+		if err != nil {
+			t.Fatalf("未收到事件: %v", err)
+		}
+		var event LoginEvent
+		if err := json.Unmarshal(buf[:n], &event); err != nil {
+			t.Fatal(err)
+		}
+		return event.Record.Username
+	}
+
+	listener := listen()
+	sink, err := newSocketSink(SocketSinkConfig{Path: path}, 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+
+	if err := sink.Emit(LoginEvent{Type: LoginEventSuccess, Record: &protocol.LoginRecord{Username: "alice"}}); err != nil {
+		t.Fatal(err)
+	}
+	if got := receive(listener); got != "alice" {
+		t.Fatalf("事件 = %q", got)
+	}
+
+	// 消费方重启：写入失败后按退避重连，事件不丢失
+	listener.Close()
+	_ = os.Remove(path)
+	if err := sink.Emit(LoginEvent{Type: LoginEventSuccess, Record: &protocol.LoginRecord{Username: "bob"}}); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	listener = listen()
+	defer listener.Close()
+	if got := receive(listener); got != "bob" {
+		t.Fatalf("重连后的事件 = %q", got)
+	}
+	if dropped := sink.Dropped(); dropped != 0 {
+		t.Errorf("丢弃 = %d", dropped)
+	}
+}
+
+func TestSocketSinkCountsDroppedEvents(t *testing.T) {
+	// 消费方不存在：缓冲满时丢弃新事件，关闭时正在等待重连的事件和缓冲中的事件同样计入丢弃
+	sink, err := newSocketSink(SocketSinkConfig{Path: filepath.Join(t.TempDir(), "missing.sock"), BufferSize: 1}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, user := range []string{"alice", "bob", "carol", "dave"} {
+		_ = sink.Emit(LoginEvent{Type: LoginEventFailed, Record: &protocol.LoginRecord{Username: user}})
+	}
+	if sink.Dropped() == 0 {
+		t.Error("缓冲满时应丢弃事件")
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if dropped := sink.Dropped(); dropped != 4 {
+		t.Errorf("丢弃 = %d, 期望 4", dropped)
+	}
+	if err := sink.Emit(LoginEvent{Type: LoginEventFailed, Record: &protocol.LoginRecord{Username: "erin"}}); err == nil {
+		t.Error("关闭后 Emit 应返回错误")
+	}
+}
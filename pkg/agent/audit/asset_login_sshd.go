@@ -0,0 +1,221 @@
+package audit
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/dushixiang/pika/internal/protocol"
+)
+
+const (
+	sshdPolicySourceEffective = "sshd -T"
+	sshdPolicySourceFile      = "sshd_config"
+
+	// sshd_config Include 最大嵌套层数 (与 OpenSSH 保持一致)
+	sshdMaxIncludeDepth = 16
+)
+
+// SSHDPolicyCollector sshd 登录策略收集器
+type SSHDPolicyCollector struct {
+	config   *Config
+	executor CommandRunner
+}
+
+// NewSSHDPolicyCollector 创建 sshd 登录策略收集器
+func NewSSHDPolicyCollector(config *Config, executor CommandRunner) *SSHDPolicyCollector {
+	return &SSHDPolicyCollector{
+		config:   config,
+		executor: executor,
+	}
+}
+
+// Collect 收集 sshd 生效的登录策略
+// 优先使用 sshd -T 获取生效配置，不可用时回退到解析 sshd_config
+func (spc *SSHDPolicyCollector) Collect() *protocol.SSHDPolicy {
+	if policy := spc.collectEffective(); policy != nil {
+		return policy
+	}
+	return spc.collectFromFile()
+}
+
+// sshdBinary 查找 sshd 可执行文件
+func (spc *SSHDPolicyCollector) sshdBinary() string {
+	for _, path := range spc.config.SSHConfig.BinaryPaths {
+		if filepath.Base(path) != "sshd" {
+			continue
+		}
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return "sshd"
+}
+
+// collectEffective 通过 sshd -T 获取生效配置
+func (spc *SSHDPolicyCollector) collectEffective() *protocol.SSHDPolicy {
+	output, err := spc.executor.Execute(spc.sshdBinary(), "-T")
+	if err != nil || strings.TrimSpace(output) == "" {
+		globalLogger.Debug("获取sshd生效配置失败: %v", err)
+		return nil
+	}
+
+	policy := newDefaultSSHDPolicy(sshdPolicySourceEffective)
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		// sshd -T 输出的每个键只出现一次 (列表类按值逐行输出)，直接覆盖即可
+		applySSHDPolicyOption(policy, strings.ToLower(fields[0]), fields[1:])
+	}
+
+	return policy
+}
+
+// collectFromFile 解析 sshd_config 文件
+func (spc *SSHDPolicyCollector) collectFromFile() *protocol.SSHDPolicy {
+	for _, path := range spc.config.SSHConfig.ConfigPaths {
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+
+		policy := newDefaultSSHDPolicy(sshdPolicySourceFile)
+		parser := &sshdConfigParser{
+			baseDir: filepath.Dir(path),
+			policy:  policy,
+			seen:    make(map[string]bool),
+		}
+		parser.parseFile(path, 0)
+		if len(policy.ConfigFiles) == 0 {
+			continue
+		}
+		return policy
+	}
+
+	globalLogger.Debug("未找到可读取的sshd配置文件")
+	return nil
+}
+
+// newDefaultSSHDPolicy 按 OpenSSH 默认值初始化登录策略
+func newDefaultSSHDPolicy(source string) *protocol.SSHDPolicy {
+	return &protocol.SSHDPolicy{
+		Source:                 source,
+		PermitRootLogin:        "prohibit-password",
+		PasswordAuthentication: true,
+		PubkeyAuthentication:   true,
+		KbdInteractiveAuth:     true,
+		PermitEmptyPasswords:   false,
+		MaxAuthTries:           6,
+	}
+}
+
+// applySSHDPolicyOption 将单个配置项写入登录策略
+func applySSHDPolicyOption(policy *protocol.SSHDPolicy, key string, values []string) {
+	value := values[0]
+	switch key {
+	case "permitrootlogin":
+		policy.PermitRootLogin = strings.ToLower(value)
+	case "passwordauthentication":
+		policy.PasswordAuthentication = parseBool(value)
+	case "pubkeyauthentication":
+		policy.PubkeyAuthentication = parseBool(value)
+	case "kbdinteractiveauthentication", "challengeresponseauthentication":
+		policy.KbdInteractiveAuth = parseBool(value)
+	case "permitemptypasswords":
+		policy.PermitEmptyPasswords = parseBool(value)
+	case "maxauthtries":
+		if tries := parseInt(value); tries > 0 {
+			policy.MaxAuthTries = tries
+		}
+	case "allowusers":
+		policy.AllowUsers = append(policy.AllowUsers, values...)
+	case "allowgroups":
+		policy.AllowGroups = append(policy.AllowGroups, values...)
+	case "denyusers":
+		policy.DenyUsers = append(policy.DenyUsers, values...)
+	case "denygroups":
+		policy.DenyGroups = append(policy.DenyGroups, values...)
+	}
+}
+
+// sshdConfigParser sshd_config 解析器
+// sshd 对单值配置项采用"首次出现生效"的规则，列表类配置项则累加
+type sshdConfigParser struct {
+	baseDir string
+	policy  *protocol.SSHDPolicy
+	seen    map[string]bool
+	inMatch bool
+}
+
+// parseFile 解析单个配置文件，处理 Include 指令
+func (p *sshdConfigParser) parseFile(path string, depth int) {
+	if depth > sshdMaxIncludeDepth {
+		globalLogger.Debug("sshd配置Include层数过多: %s", path)
+		return
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		globalLogger.Debug("读取sshd配置失败: %s, err: %v", path, err)
+		return
+	}
+	defer file.Close()
+
+	p.policy.ConfigFiles = append(p.policy.ConfigFiles, path)
+
+	// 被包含文件中的 Match 块在文件结束时终止
+	inMatch := p.inMatch
+	defer func() { p.inMatch = inMatch }()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(strings.Replace(line, "=", " ", 1))
+		if len(fields) < 2 {
+			continue
+		}
+		key := strings.ToLower(fields[0])
+
+		switch key {
+		case "match":
+			// Match 块内的配置只对特定连接生效，不计入全局策略
+			p.inMatch = true
+			continue
+		case "include":
+			if p.inMatch {
+				continue
+			}
+			for _, pattern := range fields[1:] {
+				if !filepath.IsAbs(pattern) {
+					pattern = filepath.Join(p.baseDir, pattern)
+				}
+				matches, _ := filepath.Glob(pattern)
+				for _, match := range matches {
+					p.parseFile(match, depth+1)
+				}
+			}
+			continue
+		}
+
+		if p.inMatch {
+			continue
+		}
+
+		switch key {
+		case "allowusers", "allowgroups", "denyusers", "denygroups":
+			applySSHDPolicyOption(p.policy, key, fields[1:])
+		default:
+			if p.seen[key] {
+				continue
+			}
+			p.seen[key] = true
+			applySSHDPolicyOption(p.policy, key, fields[1:])
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package audit
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/dushixiang/pika/internal/protocol"
+)
+
+func TestSSHDConfigFallback(t *testing.T) {
+	config := DefaultConfig()
+	config.SSHConfig.BinaryPaths = nil
+	config.SSHConfig.ConfigPaths = []string{filepath.Join("testdata", "missing_sshd_config"), filepath.Join("testdata", "sshd_config")}
+
+	// sshd -T 不可用时解析配置文件
+	policy := NewSSHDPolicyCollector(config, &fakeCommandRunner{}).Collect()
+	want := &protocol.SSHDPolicy{
+		Source:                 sshdPolicySourceFile,
+		PermitRootLogin:        "no",
+		PasswordAuthentication: false,
+		PubkeyAuthentication:   false,
+		KbdInteractiveAuth:     false,
+		PermitEmptyPasswords:   false,
+		MaxAuthTries:           4,
+		AllowUsers:             []string{"bob", "carol", "alice"},
+		DenyGroups:             []string{"nossh"},
+		ConfigFiles: []string{
+			filepath.Join("testdata", "sshd_config"),
+			filepath.Join("testdata", "sshd_config.d", "10-hardening.conf"),
+			filepath.Join("testdata", "sshd_config.d", "20-access.conf"),
+		},
+	}
+	if !reflect.DeepEqual(policy, want) {
+		t.Errorf("策略 = %+v\n期望 %+v", policy, want)
+	}
+}
+
+func TestSSHDEffectiveConfig(t *testing.T) {
+	output, err := os.ReadFile(filepath.Join("testdata", "sshd_t.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := DefaultConfig()
+	config.SSHConfig.BinaryPaths = nil
+	config.SSHConfig.ConfigPaths = []string{filepath.Join("testdata", "sshd_config")}
+	runner := &fakeCommandRunner{outputs: map[string]string{"sshd -T": string(output)}}
+
+	policy := NewSSHDPolicyCollector(config, runner).Collect()
+	want := &protocol.SSHDPolicy{
+		Source:                 sshdPolicySourceEffective,
+		PermitRootLogin:        "without-password",
+		PasswordAuthentication: false,
+		PubkeyAuthentication:   true,
+		KbdInteractiveAuth:     false,
+		PermitEmptyPasswords:   false,
+		MaxAuthTries:           3,
+		AllowUsers:             []string{"alice", "bob"},
+		DenyGroups:             []string{"nossh"},
+	}
+	if !reflect.DeepEqual(policy, want) {
+		t.Errorf("策略 = %+v\n期望 %+v", policy, want)
+	}
+}
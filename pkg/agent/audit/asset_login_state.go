@@ -0,0 +1,76 @@
+package audit
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+
+	"github.com/dushixiang/pika/internal/protocol"
+	"github.com/dushixiang/pika/pkg/agent/sysutil"
+)
+
+// collectorState 收集器跨运行保存的状态
+// 增量收集的起点只使用已确认发送的水位 (见 TransmittedWatermark)，状态中不再另外保存记录时间
+type collectorState struct {
+	KnownUserIPs map[string][]string `json:"knownUserIPs,omitempty"` // 各用户历史上使用过的来源IP
+}
+
+// loadState 读取状态文件，文件不存在、无法读取或内容损坏时从空状态开始
+func (lac *LoginAssetsCollector) loadState() {
+	path := lac.config.LoginConfig.StatePath
+	if path == "" {
+		return
+	}
+	state, err := readCollectorState(path)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			globalLogger.Warn("读取收集器状态失败，将从空状态开始: %v", err)
+		}
+		return
+	}
+	if state.KnownUserIPs != nil {
+		lac.knownUserIPs = state.KnownUserIPs
+	}
+}
+
+func readCollectorState(path string) (*collectorState, error) {
+	file, err := sysutil.OpenNoFollow(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, err
+	}
+	var state collectorState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+// saveState 将状态写入状态文件，未配置时不保存
+func (lac *LoginAssetsCollector) saveState() error {
+	path := lac.config.LoginConfig.StatePath
+	if path == "" {
+		return nil
+	}
+	data, err := json.Marshal(collectorState{KnownUserIPs: lac.knownUserIPs})
+	if err != nil {
+		return err
+	}
+	return sysutil.WriteFileAtomic(path, data, 0600)
+}
+
+// updateState 用本次收集的结果更新状态，只在配置了状态文件时跟踪
+// 历史来源在统计之后合并，本次首次出现的来源仍会列入 NewSourceLogins；
+// 第一次运行时没有历史来源，不检测，只建立基线
+func (lac *LoginAssetsCollector) updateState(assets *protocol.LoginAssets) {
+	if lac.config.LoginConfig.StatePath == "" {
+		return
+	}
+	lac.knownUserIPs = MergeKnownUserIPs(lac.knownUserIPs, assets.SuccessfulLogins)
+}
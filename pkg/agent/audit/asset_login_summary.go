@@ -0,0 +1,62 @@
+package audit
+
+import (
+	"sort"
+
+	"github.com/dushixiang/pika/internal/protocol"
+)
+
+// summarizeUsers 按用户汇总成功登录、失败登录和当前会话
+// 只有失败登录的用户 (如暴力破解尝试的用户名) 同样输出，失败登录记录数有上限，汇总条数不会无限增长
+func summarizeUsers(assets *protocol.LoginAssets) []protocol.UserLoginSummary {
+	byUser := make(map[string]*protocol.UserLoginSummary)
+	summaryOf := func(username string) *protocol.UserLoginSummary {
+		summary := byUser[username]
+		if summary == nil {
+			summary = &protocol.UserLoginSummary{Username: username}
+			byUser[username] = summary
+		}
+		return summary
+	}
+
+	sources := make(map[string]map[string]bool)
+	for _, login := range assets.SuccessfulLogins {
+		summary := summaryOf(login.Username)
+		summary.SuccessfulLogins++
+		if login.IP != "" {
+			if sources[login.Username] == nil {
+				sources[login.Username] = make(map[string]bool)
+			}
+			sources[login.Username][login.IP] = true
+		}
+		if login.Timestamp <= 0 || login.TimestampEstimated {
+			continue
+		}
+		if summary.FirstLogin == 0 || login.Timestamp < summary.FirstLogin {
+			summary.FirstLogin = login.Timestamp
+		}
+		summary.LastLogin = max(summary.LastLogin, login.Timestamp)
+	}
+	for _, login := range assets.FailedLogins {
+		summaryOf(login.Username).FailedLogins++
+	}
+	for _, session := range assets.CurrentSessions {
+		summary := summaryOf(session.Username)
+		if !session.IsStale {
+			summary.HasActiveSession = true
+		}
+	}
+
+	summaries := make([]protocol.UserLoginSummary, 0, len(byUser))
+	for username, summary := range byUser {
+		for ip := range sources[username] {
+			summary.SourceIPs = append(summary.SourceIPs, ip)
+		}
+		sort.Strings(summary.SourceIPs)
+		summaries = append(summaries, *summary)
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		return summaries[i].Username < summaries[j].Username
+	})
+	return summaries
+}
@@ -0,0 +1,272 @@
+package audit
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dushixiang/pika/internal/protocol"
+)
+
+const (
+	// 启动时间与 wtmp 首条记录之间允许的偏差
+	bootRecordSlack = time.Minute
+
+	// 运行时间超过该值时，空的 wtmp 才视为可疑
+	emptyWtmpMinUptime = time.Hour
+
+	// 当前会话与登录记录的时间允许的偏差 (w 只精确到分钟)
+	sessionMatchSlack = 2 * time.Minute
+)
+
+// logTamperingDetector 登录日志篡改检测
+// 检查 wtmp/btmp 截断、存在会话却没有登录记录、认证日志被替换或截断 (排除正常轮转)
+type logTamperingDetector struct {
+	wtmpPath     string
+	btmpPath     string
+	procStatPath string
+	authLog      func() string
+	now          func() time.Time
+
+	// 上一次收集时的认证日志，用于发现两次收集之间的替换和截断
+	mu          sync.Mutex
+	lastAuthLog *authLogSnapshot
+}
+
+// authLogSnapshot 认证日志的文件信息
+type authLogSnapshot struct {
+	path    string
+	info    os.FileInfo
+	takenAt time.Time
+}
+
+func newLogTamperingDetector(config *Config, now func() time.Time) *logTamperingDetector {
+	return &logTamperingDetector{
+		wtmpPath:     config.LoginConfig.WtmpPath,
+		btmpPath:     config.LoginConfig.BtmpPath,
+		procStatPath: "/proc/stat",
+		authLog:      findAuthLog,
+		now:          now,
+	}
+}
+
+// Detect 检查全部日志，assets 中需要已收集成功登录和当前会话
+func (d *logTamperingDetector) Detect(assets *protocol.LoginAssets, since time.Time) []protocol.LogTamperingSuspicion {
+	var suspicions []protocol.LogTamperingSuspicion
+
+	bootTime, _ := readBootTime(d.procStatPath)
+	suspicions = append(suspicions, d.checkUtmpFile(d.wtmpPath, bootTime, true)...)
+	suspicions = append(suspicions, d.checkUtmpFile(d.btmpPath, bootTime, false)...)
+	suspicions = append(suspicions, d.checkSessions(assets, since)...)
+	if authLog := d.authLog(); authLog != "" {
+		suspicions = append(suspicions, d.checkAuthLog(authLog)...)
+	}
+
+	return suspicions
+}
+
+// checkUtmpFile 检查 wtmp/btmp 的大小和首条记录
+// wtmp 每次启动都会写入启动记录，btmp 在没有失败登录时可以为空，因此只检查对齐
+func (d *logTamperingDetector) checkUtmpFile(path string, bootTime time.Time, isWtmp bool) []protocol.LogTamperingSuspicion {
+	if path == "" {
+		return nil
+	}
+	suspicion := func(kind, confidence, format string, args ...any) []protocol.LogTamperingSuspicion {
+		return []protocol.LogTamperingSuspicion{{
+			Log:         path,
+			Kind:        kind,
+			Confidence:  confidence,
+			Observation: fmt.Sprintf(format, args...),
+		}}
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) && isWtmp && !bootTime.IsZero() {
+			return suspicion(protocol.LogTamperMissing, protocol.ConfidenceMedium,
+				"file does not exist although the host has been up since %s", bootTime.Format(time.RFC3339))
+		}
+		return nil
+	}
+
+	if info.Size()%utmpRecordSize != 0 {
+		return suspicion(protocol.LogTamperMisaligned, protocol.ConfidenceMedium,
+			"size %d is not a multiple of the %d-byte record", info.Size(), utmpRecordSize)
+	}
+	if !isWtmp || bootTime.IsZero() {
+		return nil
+	}
+
+	// 启动后发生过轮转，新文件中没有启动记录是正常的
+	if rotatedSince(path, bootTime) != "" {
+		return nil
+	}
+
+	uptime := d.now().Sub(bootTime)
+	if info.Size() == 0 {
+		if uptime < emptyWtmpMinUptime {
+			return nil
+		}
+		return suspicion(protocol.LogTamperEmpty, protocol.ConfidenceHigh,
+			"file is empty after %s of uptime with no rotation since boot", uptime.Round(time.Minute))
+	}
+
+	first, err := readUtmpHead(path)
+	if err != nil {
+		return nil
+	}
+	if first.Timestamp.After(bootTime.Add(bootRecordSlack)) {
+		return suspicion(protocol.LogTamperMissingBootRecord, protocol.ConfidenceMedium,
+			"first record at %s is after boot at %s with no rotation since boot",
+			first.Timestamp.Format(time.RFC3339), bootTime.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// checkSessions 当前会话在登录记录覆盖的时间范围内却没有对应的登录记录
+func (d *logTamperingDetector) checkSessions(assets *protocol.LoginAssets, since time.Time) []protocol.LogTamperingSuspicion {
+	if len(assets.CurrentSessions) == 0 {
+		return nil
+	}
+
+	// 登录记录有数量上限，只检查最早一条记录之后开始的会话
+	var oldest int64
+	for _, login := range assets.SuccessfulLogins {
+		if oldest == 0 || login.Timestamp < oldest {
+			oldest = login.Timestamp
+		}
+	}
+
+	var suspicions []protocol.LogTamperingSuspicion
+	slack := sessionMatchSlack.Milliseconds()
+	for _, session := range assets.CurrentSessions {
+		if session.LoginTime == 0 || before(session.LoginTime, since) || session.LoginTime < oldest-slack {
+			continue
+		}
+
+		matched := false
+		for _, login := range assets.SuccessfulLogins {
+			diff := login.Timestamp - session.LoginTime
+			if login.Username == session.Username && login.Terminal == session.Terminal && diff <= slack && diff >= -slack {
+				matched = true
+				break
+			}
+		}
+		if matched {
+			continue
+		}
+
+		confidence := protocol.ConfidenceMedium
+		if len(assets.SuccessfulLogins) == 0 {
+			// 有会话却完全没有登录记录
+			confidence = protocol.ConfidenceHigh
+		}
+		suspicions = append(suspicions, protocol.LogTamperingSuspicion{
+			Log:        d.wtmpPath,
+			Kind:       protocol.LogTamperSessionWithoutLogin,
+			Confidence: confidence,
+			Observation: fmt.Sprintf("session of %s on %s since %s has no matching login record",
+				session.Username, session.Terminal, time.UnixMilli(session.LoginTime).Format(time.RFC3339)),
+		})
+	}
+	return suspicions
+}
+
+// checkAuthLog 与上一次收集时的认证日志比较
+// 正常轮转时旧文件会出现在轮转文件中 (rename) 或轮转文件在上次收集之后被写入 (copytruncate)
+func (d *logTamperingDetector) checkAuthLog(path string) []protocol.LogTamperingSuspicion {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil
+	}
+
+	d.mu.Lock()
+	last := d.lastAuthLog
+	d.lastAuthLog = &authLogSnapshot{path: path, info: info, takenAt: d.now()}
+	d.mu.Unlock()
+
+	if last == nil || last.path != path {
+		return nil
+	}
+
+	if !os.SameFile(last.info, info) {
+		for _, rotated := range rotatedLogFiles(path, time.Time{}) {
+			if rotatedInfo, err := os.Stat(rotated); err == nil && os.SameFile(last.info, rotatedInfo) {
+				return nil
+			}
+		}
+		return []protocol.LogTamperingSuspicion{{
+			Log:        path,
+			Kind:       protocol.LogTamperReplaced,
+			Confidence: protocol.ConfidenceMedium,
+			Observation: fmt.Sprintf("file was replaced since %s and the previous file is not among the rotated logs",
+				last.takenAt.Format(time.RFC3339)),
+		}}
+	}
+
+	if info.Size() < last.info.Size() {
+		if rotatedSince(path, last.takenAt) != "" {
+			return nil
+		}
+		return []protocol.LogTamperingSuspicion{{
+			Log:        path,
+			Kind:       protocol.LogTamperTruncated,
+			Confidence: protocol.ConfidenceHigh,
+			Observation: fmt.Sprintf("size shrank from %d to %d bytes since %s without rotation",
+				last.info.Size(), info.Size(), last.takenAt.Format(time.RFC3339)),
+		}}
+	}
+	return nil
+}
+
+// rotatedSince 返回在 t 之后被修改过的轮转文件 (path.1 或 path.1.gz)，没有时返回空
+func rotatedSince(path string, t time.Time) string {
+	for _, rotated := range []string{path + ".1", path + ".1.gz"} {
+		if info, err := os.Stat(rotated); err == nil && !info.ModTime().Before(t) {
+			return rotated
+		}
+	}
+	return ""
+}
+
+// readUtmpHead 读取 utmp 格式文件的第一条记录
+func readUtmpHead(path string) (*utmpEntry, error) {
+	file, err := openLogFile(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	buf := make([]byte, utmpRecordSize)
+	if _, err := file.ReadAt(buf, 0); err != nil {
+		return nil, err
+	}
+	return parseUtmpEntry(buf)
+}
+
+// readBootTime 从 /proc/stat 的 btime 读取系统启动时间
+func readBootTime(path string) (time.Time, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		value, ok := strings.CutPrefix(scanner.Text(), "btime ")
+		if !ok {
+			continue
+		}
+		sec, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return time.Unix(sec, 0), nil
+	}
+	return time.Time{}, fmt.Errorf("btime not found in %s", path)
+}
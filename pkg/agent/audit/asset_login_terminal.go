@@ -0,0 +1,111 @@
+package audit
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/dushixiang/pika/internal/protocol"
+)
+
+// 终端类型
+const (
+	TerminalTypeNetwork   = "network"        // 网络登录分配的伪终端 (pts) 或 ssh 非交互会话
+	TerminalTypeSerial    = "serial-console" // 串口控制台
+	TerminalTypeConsole   = "console"        // 本地虚拟控制台
+	TerminalTypeGraphical = "graphical"      // 图形界面 (X display)
+	TerminalTypeUnknown   = "unknown"
+)
+
+// classifyTerminal 根据终端名称判断终端类型
+func classifyTerminal(terminal string) string {
+	switch {
+	case strings.HasPrefix(terminal, "pts/"), strings.HasPrefix(terminal, "ssh"):
+		return TerminalTypeNetwork
+	case strings.HasPrefix(terminal, "ttyS"), strings.HasPrefix(terminal, "ttyAMA"),
+		strings.HasPrefix(terminal, "ttyUSB"), strings.HasPrefix(terminal, "hvc"):
+		return TerminalTypeSerial
+	case terminal == "console", strings.HasPrefix(terminal, "tty"):
+		return TerminalTypeConsole
+	case strings.HasPrefix(terminal, ":"):
+		return TerminalTypeGraphical
+	default:
+		return TerminalTypeUnknown
+	}
+}
+
+// isNetworkPTYLogin 是否为远程登录分配的伪终端 (本地终端模拟器同样使用 pts，需要排除)
+func isNetworkPTYLogin(record protocol.LoginRecord) bool {
+	if classifyTerminal(record.Terminal) != TerminalTypeNetwork || !strings.HasPrefix(record.Terminal, "pts/") {
+		return false
+	}
+	return record.IP != "" && !strings.HasPrefix(record.IP, "localhost")
+}
+
+// defaultTerminalAliases 内置的终端别名，覆盖常见的命名差异
+var defaultTerminalAliases = map[string]string{
+	"pts*":     "pts/*", // 部分系统记录为 pts0
+	"pts/*":    "pts/*",
+	"ssh:*":    "ssh",  // ssh:notty 等非交互会话
+	"vc/*":     "tty*", // devfs 的虚拟控制台命名
+	"tty/*":    "tty*",
+	"hvsi*":    "hvc*",  // POWER 虚拟串口
+	"ttysclp*": "ttyS*", // s390 串口控制台
+}
+
+// terminalAliases 终端别名表，键以 * 结尾时按前缀匹配，值中的 * 替换为前缀之后的部分
+type terminalAliases struct {
+	exact    map[string]string
+	prefixes []string // 按长度从长到短排列
+	patterns map[string]string
+}
+
+func newTerminalAliases(aliases map[string]string) *terminalAliases {
+	a := &terminalAliases{exact: make(map[string]string), patterns: make(map[string]string)}
+	for from, to := range aliases {
+		if prefix, ok := strings.CutSuffix(from, "*"); ok {
+			a.prefixes = append(a.prefixes, prefix)
+			a.patterns[prefix] = to
+		} else {
+			a.exact[from] = to
+		}
+	}
+	sort.Slice(a.prefixes, func(i, j int) bool {
+		if len(a.prefixes[i]) != len(a.prefixes[j]) {
+			return len(a.prefixes[i]) > len(a.prefixes[j])
+		}
+		return a.prefixes[i] < a.prefixes[j]
+	})
+	return a
+}
+
+// Normalize 去除 /dev/ 前缀后按别名表转换，精确匹配优先，其次是最长的前缀
+func (a *terminalAliases) Normalize(terminal string) string {
+	terminal = strings.TrimPrefix(terminal, "/dev/")
+	if to, ok := a.exact[terminal]; ok {
+		return to
+	}
+	for _, prefix := range a.prefixes {
+		if rest, ok := strings.CutPrefix(terminal, prefix); ok {
+			return strings.Replace(a.patterns[prefix], "*", rest, 1)
+		}
+	}
+	return terminal
+}
+
+// Apply 为全部记录和会话填充规范化的终端和终端类型，原始终端保持不变
+func (a *terminalAliases) Apply(assets *protocol.LoginAssets) {
+	if a == nil {
+		return
+	}
+	for _, records := range [][]protocol.LoginRecord{assets.SuccessfulLogins, assets.FailedLogins} {
+		for i := range records {
+			records[i].NormalizedTerminal = a.Normalize(records[i].Terminal)
+			records[i].TerminalType = classifyTerminal(records[i].NormalizedTerminal)
+		}
+	}
+	for i := range assets.CurrentSessions {
+		session := &assets.CurrentSessions[i]
+		session.NormalizedTerminal = a.Normalize(session.Terminal)
+		session.TerminalType = classifyTerminal(session.NormalizedTerminal)
+	}
+}
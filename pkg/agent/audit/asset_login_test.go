@@ -0,0 +1,3838 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/dushixiang/pika/internal/protocol"
+)
+
+// encodeUtmpEntry 按 glibc 布局编码一条 utmp 记录
+func encodeUtmpEntry(typ int16, user, line, host string, ts time.Time) []byte {
+	buf := make([]byte, utmpRecordSize)
+	le := binary.LittleEndian
+	le.PutUint16(buf[utmpOffsetType:], uint16(typ))
+	le.PutUint32(buf[utmpOffsetPID:], 1234)
+	copy(buf[utmpOffsetLine:utmpOffsetLine+utmpLineSize], line)
+	copy(buf[utmpOffsetUser:utmpOffsetUser+utmpUserSize], user)
+	copy(buf[utmpOffsetHost:utmpOffsetHost+utmpHostSize], host)
+	le.PutUint32(buf[utmpOffsetSec:], uint32(ts.Unix()))
+	le.PutUint32(buf[utmpOffsetUsec:], uint32(ts.Nanosecond()/1000))
+	return buf
+}
+
+// writeBtmpFixture 生成包含 count 条失败登录记录的 btmp 文件
+func writeBtmpFixture(tb testing.TB, count int) string {
+	tb.Helper()
+
+	path := filepath.Join(tb.TempDir(), "btmp")
+	file, err := os.Create(path)
+	if err != nil {
+		tb.Fatalf("创建btmp文件失败: %v", err)
+	}
+	defer file.Close()
+
+	writer := bufio.NewWriter(file)
+	base := time.Unix(1700000000, 0)
+	for i := 0; i < count; i++ {
+		record := encodeUtmpEntry(utmpTypeLoginProcess, fmt.Sprintf("user%d", i), "ssh:notty", "203.0.113.7", base.Add(time.Duration(i)*time.Second))
+		if _, err := writer.Write(record); err != nil {
+			tb.Fatalf("写入btmp文件失败: %v", err)
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		tb.Fatalf("写入btmp文件失败: %v", err)
+	}
+	return path
+}
+
+func TestReadUtmpTail(t *testing.T) {
+	path := writeBtmpFixture(t, 200)
+
+	// 模拟正在追加写入的半条记录
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatalf("打开btmp文件失败: %v", err)
+	}
+	if _, err := file.Write(make([]byte, utmpRecordSize/2)); err != nil {
+		t.Fatalf("写入btmp文件失败: %v", err)
+	}
+	file.Close()
+
+	entries, err := readUtmpTail(path, 10, time.Time{}, isUtmpLoginEntry)
+	if err != nil {
+		t.Fatalf("readUtmpTail 返回错误: %v", err)
+	}
+	if len(entries) != 10 {
+		t.Fatalf("期望读取 10 条记录，实际 %d 条", len(entries))
+	}
+	if entries[0].User != "user199" || entries[9].User != "user190" {
+		t.Errorf("记录顺序错误: 第一条 %s, 最后一条 %s", entries[0].User, entries[9].User)
+	}
+
+	record := entries[0].toLoginRecord("failed")
+	if record.IP != "203.0.113.7" || record.Terminal != "ssh:notty" {
+		t.Errorf("记录转换错误: %+v", record)
+	}
+}
+
+func BenchmarkReadUtmpTail(b *testing.B) {
+	for _, size := range []int{1000, 10000, 100000} {
+		path := writeBtmpFixture(b, size)
+		b.Run(fmt.Sprintf("records=%d", size), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := readUtmpTail(path, 100, time.Time{}, isUtmpLoginEntry); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestRunLoginSubCollectorsIsolatesPanic(t *testing.T) {
+	assets := &protocol.LoginAssets{}
+	collectors := []loginSubCollector{
+		{name: "successful_logins", fn: func(assets *protocol.LoginAssets) error {
+			assets.SuccessfulLogins = []protocol.LoginRecord{{Username: "alice"}}
+			return nil
+		}},
+		{name: "current_sessions", fn: func(assets *protocol.LoginAssets) error {
+			// 模拟畸形的 w 输出导致越界
+			fields := strings.Fields("root")
+			assets.CurrentSessions = []protocol.LoginSession{{Username: fields[0], Terminal: fields[1]}}
+			return nil
+		}},
+		{name: "failed_logins", fn: func(assets *protocol.LoginAssets) error {
+			assets.FailedLogins = []protocol.LoginRecord{{Username: "bob"}}
+			return errors.New("lastb: permission denied")
+		}},
+	}
+
+	errs := runLoginSubCollectors(assets, collectors)
+
+	if len(assets.SuccessfulLogins) != 1 || len(assets.FailedLogins) != 1 {
+		t.Fatalf("其他子收集器的结果不应丢失: %+v", assets)
+	}
+	if assets.CurrentSessions != nil {
+		t.Errorf("panic 的子收集器不应写入结果: %+v", assets.CurrentSessions)
+	}
+	if err := errs["current_sessions"]; err == nil || !strings.HasPrefix(err.Error(), "panic:") {
+		t.Errorf("期望记录 current_sessions 的 panic，实际: %v", err)
+	}
+	if err := errs["failed_logins"]; err == nil {
+		t.Error("期望记录 failed_logins 的错误")
+	}
+	if _, ok := errs["successful_logins"]; ok {
+		t.Error("成功的子收集器不应记录错误")
+	}
+}
+
+func TestConcurrentLoginSubCollectors(t *testing.T) {
+	// 三个并发子收集器都开始执行后才能继续，依次执行时会超时
+	var started sync.WaitGroup
+	started.Add(3)
+	all := make(chan struct{})
+	go func() {
+		started.Wait()
+		close(all)
+	}()
+	wait := func() error {
+		started.Done()
+		select {
+		case <-all:
+			return nil
+		case <-time.After(5 * time.Second):
+			return errors.New("子收集器没有并发执行")
+		}
+	}
+
+	assets := &protocol.LoginAssets{}
+	errs := runLoginSubCollectors(assets, []loginSubCollector{
+		{name: "successful_logins", concurrent: true, fn: func(assets *protocol.LoginAssets) error {
+			assets.SuccessfulLogins = []protocol.LoginRecord{{Username: "alice"}}
+			return wait()
+		}},
+		{name: "failed_logins", concurrent: true, fn: func(assets *protocol.LoginAssets) error {
+			assets.FailedLogins = []protocol.LoginRecord{{Username: "bob"}}
+			if err := wait(); err != nil {
+				return err
+			}
+			return errors.New("lastb: permission denied")
+		}},
+		{name: "current_sessions", concurrent: true, fn: func(assets *protocol.LoginAssets) error {
+			assets.CurrentSessions = []protocol.LoginSession{{Username: "carol"}}
+			return wait()
+		}},
+		// 之后的子收集器在并发子收集器全部完成后执行，能读取合并后的结果
+		{name: "statistics", fn: func(assets *protocol.LoginAssets) error {
+			if len(assets.SuccessfulLogins) != 1 || len(assets.FailedLogins) != 1 || len(assets.CurrentSessions) != 1 {
+				return fmt.Errorf("结果未合并: %+v", assets)
+			}
+			return nil
+		}},
+	})
+	if len(errs) != 1 || errs["failed_logins"] == nil {
+		t.Errorf("errs = %v", errs)
+	}
+}
+
+func TestLoginTransformPipeline(t *testing.T) {
+	tests := []struct {
+		name       string
+		transforms []string
+		in         protocol.LoginRecord
+		want       protocol.LoginRecord
+	}{
+		{
+			name:       "strip realm then lowercase",
+			transforms: []string{TransformStripRealm, TransformLowercaseUser},
+			in:         protocol.LoginRecord{Username: "Alice@CORP.EXAMPLE.COM"},
+			want:       protocol.LoginRecord{Username: "alice"},
+		},
+		{
+			name:       "windows domain",
+			transforms: []string{TransformStripRealm},
+			in:         protocol.LoginRecord{Username: `CORP\Bob`},
+			want:       protocol.LoginRecord{Username: "Bob"},
+		},
+		{
+			name:       "canonicalize ipv6",
+			transforms: []string{TransformCanonicalizeIP},
+			in:         protocol.LoginRecord{IP: "[2001:DB8:0:0:0:0:0:1]"},
+			want:       protocol.LoginRecord{IP: "2001:db8::1"},
+		},
+		{
+			name:       "ipv4 mapped",
+			transforms: []string{TransformCanonicalizeIP},
+			in:         protocol.LoginRecord{IP: "::ffff:192.0.2.10"},
+			want:       protocol.LoginRecord{IP: "192.0.2.10"},
+		},
+		{
+			name:       "non ip left untouched",
+			transforms: []string{TransformCanonicalizeIP, TransformCanonicalizeTerminal},
+			in:         protocol.LoginRecord{IP: "localhost", Terminal: "/dev/pts/3"},
+			want:       protocol.LoginRecord{IP: "localhost", Terminal: "pts/3"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pipeline, err := newLoginTransformPipeline(tt.transforms)
+			if err != nil {
+				t.Fatalf("构建转换流水线失败: %v", err)
+			}
+
+			// 重复执行结果必须一致
+			for i := 0; i < 2; i++ {
+				assets := &protocol.LoginAssets{FailedLogins: []protocol.LoginRecord{tt.in}}
+				pipeline.Apply(assets)
+				if got := assets.FailedLogins[0]; got != tt.want {
+					t.Errorf("第 %d 次转换结果 %+v, 期望 %+v", i+1, got, tt.want)
+				}
+			}
+		})
+	}
+
+	if _, err := newLoginTransformPipeline([]string{"no-such-transform"}); err == nil {
+		t.Error("未知的转换名称应返回错误")
+	}
+}
+
+func TestResolveWindow(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	lac := NewLoginAssetsCollector(DefaultConfig(), NewCommandExecutor(time.Second))
+	lac.SetClock(func() time.Time { return now })
+
+	tests := []struct {
+		window  string
+		want    time.Time
+		wantErr bool
+	}{
+		{window: "-1h", want: now.Add(-time.Hour)},
+		{window: "24h", want: now.Add(-24 * time.Hour)},
+		{window: "7d", want: now.Add(-7 * 24 * time.Hour)},
+		{window: "", wantErr: true},
+		{window: "0s", wantErr: true},
+		{window: "1x", wantErr: true},
+		{window: "3650d", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := lac.resolveWindow(tt.window)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("resolveWindow(%q) err = %v, wantErr %v", tt.window, err, tt.wantErr)
+			continue
+		}
+		if !got.Equal(tt.want) {
+			t.Errorf("resolveWindow(%q) = %v, want %v", tt.window, got, tt.want)
+		}
+	}
+
+	// 显式允许后可以查询超长窗口
+	lac.config.LoginConfig.AllowLongQueryWindow = true
+	if _, err := lac.resolveWindow("3650d"); err != nil {
+		t.Errorf("允许超长窗口后不应报错: %v", err)
+	}
+}
+
+func TestParseUtmpdump(t *testing.T) {
+	tests := []struct {
+		fixture string
+		accept  func(*utmpEntry) bool
+		status  string
+		want    []protocol.LoginRecord
+	}{
+		{
+			fixture: "testdata/utmpdump_wtmp.txt",
+			accept:  isUtmpUserProcess,
+			status:  "success",
+			want: []protocol.LoginRecord{
+				{Username: "root", Terminal: "pts/0", IP: "203.0.113.7", Timestamp: time.Date(2024, 3, 1, 9, 15, 42, 731082000, time.UTC).UnixMilli(), Status: "success"},
+				{Username: "deploy", Terminal: "pts/1", IP: "2001:db8::17", Timestamp: time.Date(2024, 3, 1, 9, 20, 3, 517000, time.UTC).UnixMilli(), Status: "success"},
+				{Username: "alice", Terminal: "tty1", IP: "localhost", Timestamp: time.Date(2024, 3, 1, 10, 2, 55, 190004000, time.UTC).UnixMilli(), Status: "success"},
+				{Username: "root", Terminal: "pts/0", IP: "198.51.100.23", Timestamp: time.Date(2024, 3, 1, 11, 30, 0, 1000, time.UTC).UnixMilli(), Status: "success"},
+			},
+		},
+		{
+			// 旧版 utmpdump 使用 ctime 格式的时间
+			fixture: "testdata/utmpdump_btmp.txt",
+			accept:  isUtmpLoginEntry,
+			status:  "failed",
+			want: []protocol.LoginRecord{
+				{Username: "admin", Terminal: "ssh:notty", IP: "45.148.10.81", Timestamp: time.Date(2024, 3, 1, 9, 1, 7, 0, time.UTC).UnixMilli(), Status: "failed"},
+				{Username: "oracle", Terminal: "ssh:notty", IP: "45.148.10.81", Timestamp: time.Date(2024, 3, 1, 9, 1, 9, 0, time.UTC).UnixMilli(), Status: "failed"},
+				{Username: "root", Terminal: "ssh:notty", IP: "218.92.0.56", Timestamp: time.Date(2024, 3, 1, 9, 3, 30, 0, time.UTC).UnixMilli(), Status: "failed"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		data, err := os.ReadFile(tt.fixture)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var got []protocol.LoginRecord
+		for _, entry := range parseUtmpdump(string(data)) {
+			if tt.accept(&entry) {
+				got = append(got, entry.toLoginRecord(tt.status))
+			}
+		}
+
+		if len(got) != len(tt.want) {
+			t.Fatalf("%s: 解析出 %d 条记录, 期望 %d 条: %+v", tt.fixture, len(got), len(tt.want), got)
+		}
+		for i := range tt.want {
+			if got[i] != tt.want[i] {
+				t.Errorf("%s[%d] = %+v, 期望 %+v", tt.fixture, i, got[i], tt.want[i])
+			}
+		}
+	}
+}
+
+func TestFailedLoginsReadBtmpTail(t *testing.T) {
+	dump, err := os.ReadFile(filepath.Join("testdata", "utmpdump_btmp.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 默认配置 (PreferUtmpdump) 下 btmp 也只从尾部读取，不执行 utmpdump 解析整个文件
+	config := DefaultConfig()
+	config.LoginConfig.BtmpPath = writeBtmpFixture(t, 200)
+	for _, prefer := range []bool{true, false} {
+		config.LoginConfig.PreferUtmpdump = prefer
+		runner := &fakeCommandRunner{outputs: map[string]string{"utmpdump": string(dump)}}
+		lac := NewLoginAssetsCollector(config, runner)
+		records, err := lac.collectFailedLoginsFromCurrent(time.Time{}, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(records) != 10 || records[0].Username != "user199" || records[9].Username != "user190" {
+			t.Errorf("PreferUtmpdump=%t: 记录 = %+v", prefer, records)
+		}
+		if len(runner.calls) != 0 {
+			t.Errorf("PreferUtmpdump=%t: 不应执行命令: %v", prefer, runner.calls)
+		}
+	}
+
+	// 无法直接读取时才使用 utmpdump
+	config.LoginConfig.PreferUtmpdump = true
+	config.LoginConfig.BtmpPath = t.TempDir()
+	lac := NewLoginAssetsCollector(config, &fakeCommandRunner{outputs: map[string]string{"utmpdump": string(dump)}})
+	records, err := lac.collectFailedLoginsFromCurrent(time.Time{}, 10)
+	if err != nil || len(records) != 3 || records[0].IP != "218.92.0.56" {
+		t.Errorf("utmpdump 记录 = %+v, %v", records, err)
+	}
+}
+
+func TestWatchFailedLoginsChannel(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "auth.log")
+	old := "Mar  1 08:59:00 host sshd[99]: Failed password for old from 203.0.113.1 port 50000 ssh2\n"
+	if err := os.WriteFile(path, []byte(old), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	config := DefaultConfig()
+	config.LoginConfig.AuthLogPaths = []string{path}
+	config.LoginConfig.WatchPollInterval = 10 * time.Millisecond
+	lac := NewLoginAssetsCollector(config, &fakeCommandRunner{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	records, err := lac.Watch(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	receive := func() protocol.LoginRecord {
+		t.Helper()
+		select {
+		case record := <-records:
+			return record
+		case <-time.After(5 * time.Second):
+			t.Fatal("没有收到失败登录")
+			return protocol.LoginRecord{}
+		}
+	}
+
+	appendLine := func(path, line string) {
+		f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		fmt.Fprintln(f, line)
+	}
+
+	// 只输出开始跟踪后新增的失败登录
+	appendLine(path, "Mar  1 09:00:00 host sshd[100]: Accepted publickey for alice from 192.0.2.1 port 40000 ssh2")
+	appendLine(path, "Mar  1 09:00:01 host sshd[101]: Failed password for root from 203.0.113.7 port 50001 ssh2")
+	if record := receive(); record.Username != "root" || record.IP != "203.0.113.7" || record.RecordID == "" {
+		t.Errorf("失败登录 = %+v", record)
+	}
+
+	// rename 轮转后继续跟踪新文件
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	appendLine(path, "Mar  1 09:00:02 host sshd[102]: Failed password for admin from 203.0.113.8 port 50002 ssh2")
+	if record := receive(); record.Username != "admin" {
+		t.Errorf("轮转后的失败登录 = %+v", record)
+	}
+
+	// ctx 取消后关闭 channel
+	cancel()
+	select {
+	case _, ok := <-records:
+		if ok {
+			t.Error("取消后不应再输出记录")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("取消后 channel 没有关闭")
+	}
+
+	// 没有认证日志时返回错误
+	config.LoginConfig.AuthLogPaths = []string{filepath.Join(dir, "missing.log")}
+	if _, err := lac.Watch(context.Background()); err == nil {
+		t.Error("没有认证日志时应返回错误")
+	}
+}
+
+func TestWatchFailedLoginsDedupAcrossCopyTruncate(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "auth.log")
+	if err := os.WriteFile(path, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	appendLines := func(lines ...string) {
+		f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		for _, line := range lines {
+			fmt.Fprintln(f, line)
+		}
+	}
+
+	now := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+	lac := NewLoginAssetsCollector(DefaultConfig(), NewCommandExecutor(time.Second))
+	lac.SetClock(func() time.Time { return now })
+
+	follower, err := openLogFollower(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer follower.Close()
+	w := &failedLoginWatcher{
+		lac:      lac,
+		follower: follower,
+		dedup:    &dedupWindow{window: 30 * time.Second},
+	}
+
+	var got []string
+	step := func() {
+		t.Helper()
+		if err := w.step(func(record protocol.LoginRecord) {
+			got = append(got, record.Username+"@"+record.IP)
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	l1 := "Mar  1 09:00:01 host sshd[101]: Failed password for root from 203.0.113.7 port 50001 ssh2"
+	l2 := "Mar  1 09:00:02 host sshd[102]: Failed password for admin from 203.0.113.8 port 50002 ssh2"
+	l3 := "Mar  1 09:00:03 host sshd[103]: Failed password for oracle from 203.0.113.9 port 50003 ssh2"
+
+	appendLines(l1, "Mar  1 09:00:01 host sshd[100]: Accepted publickey for alice", l2)
+	step()
+
+	// copytruncate: 复制到 auth.log.1 后截断，截断前的最后一行在新文件中再次出现
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path+".1", data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Truncate(path, 0); err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(time.Second)
+	step()
+	appendLines(l2, l3)
+	now = now.Add(time.Second)
+	step()
+
+	// 相隔超过去重窗口的相同行是真实的重复尝试
+	now = now.Add(time.Minute)
+	appendLines(l3)
+	step()
+
+	want := []string{"root@203.0.113.7", "admin@203.0.113.8", "oracle@203.0.113.9", "oracle@203.0.113.9"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("输出事件 = %v, 期望 %v", got, want)
+	}
+}
+
+func TestCollectorStatePersistence(t *testing.T) {
+	dir := t.TempDir()
+	base := time.Unix(1700000000, 0)
+	wtmp := encodeUtmpEntry(utmpTypeUserProcess, "alice", "pts/0", "203.0.113.7", base)
+
+	config := DefaultConfig()
+	config.PerformanceConfig.NoExec = true
+	config.LoginConfig.WtmpPath = filepath.Join(dir, "wtmp")
+	config.LoginConfig.BtmpPath = filepath.Join(dir, "btmp")
+	config.LoginConfig.UtmpPath = filepath.Join(dir, "utmp")
+	config.LoginConfig.StatePath = filepath.Join(dir, "state.json")
+	if err := os.WriteFile(config.LoginConfig.WtmpPath, wtmp, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	newCollector := func() *LoginAssetsCollector {
+		executor := NewCommandExecutor(time.Second)
+		executor.SetNoExec(true)
+		return NewLoginAssetsCollector(config, executor)
+	}
+
+	// 第一次运行只建立基线
+	lac := newCollector()
+	if got := lac.Collect().Statistics.NewSourceLogins; got != nil {
+		t.Errorf("没有历史来源时不应检测: %+v", got)
+	}
+	if err := lac.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	wtmp = append(wtmp, encodeUtmpEntry(utmpTypeUserProcess, "alice", "pts/1", "198.51.100.1", base.Add(time.Minute))...)
+	if err := os.WriteFile(config.LoginConfig.WtmpPath, wtmp, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	lac = newCollector()
+	if got := lac.knownUserIPs["alice"]; !slices.Equal(got, []string{"203.0.113.7"}) {
+		t.Errorf("恢复的历史来源 = %v", got)
+	}
+	found := lac.Collect().Statistics.NewSourceLogins
+	if len(found) != 1 || found[0].IP != "198.51.100.1" {
+		t.Errorf("NewSourceLogins = %+v", found)
+	}
+
+	// 状态文件损坏时从空状态开始
+	if err := os.WriteFile(config.LoginConfig.StatePath, []byte("{not json"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	lac = newCollector()
+	if lac.knownUserIPs != nil {
+		t.Errorf("损坏的状态文件应被忽略: %v", lac.knownUserIPs)
+	}
+}
+
+func TestAckTransmitted(t *testing.T) {
+	dir := t.TempDir()
+	base := time.Unix(1700000000, 0)
+	var wtmp []byte
+	for i, user := range []string{"alice", "bob", "carol"} {
+		wtmp = append(wtmp, encodeUtmpEntry(utmpTypeUserProcess, user, fmt.Sprintf("pts/%d", i), "203.0.113.7", base.Add(time.Duration(i+1)*time.Minute))...)
+	}
+
+	config := DefaultConfig()
+	config.PerformanceConfig.NoExec = true
+	config.LoginConfig.WtmpPath = filepath.Join(dir, "wtmp")
+	config.LoginConfig.BtmpPath = filepath.Join(dir, "btmp")
+	config.LoginConfig.UtmpPath = filepath.Join(dir, "utmp")
+	config.LoginConfig.WatermarkPath = filepath.Join(dir, "watermark.json")
+	if err := os.WriteFile(config.LoginConfig.WtmpPath, wtmp, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	newCollector := func() *LoginAssetsCollector {
+		executor := NewCommandExecutor(time.Second)
+		executor.SetNoExec(true)
+		return NewLoginAssetsCollector(config, executor)
+	}
+	byUser := func(assets *protocol.LoginAssets) map[string]string {
+		ids := make(map[string]string)
+		for _, login := range assets.SuccessfulLogins {
+			ids[login.Username] = login.RecordID
+		}
+		return ids
+	}
+
+	lac := newCollector()
+	first := byUser(lac.CollectPending().Assets)
+	if len(first) != 3 {
+		t.Fatalf("首次收集 = %v", first)
+	}
+
+	// 未确认时 (发送失败) 下一次收集仍包含全部记录
+	if got := byUser(lac.CollectPending().Assets); len(got) != 3 {
+		t.Fatalf("未确认时 = %v", got)
+	}
+
+	if err := lac.AckTransmitted("unknown"); err == nil {
+		t.Error("未知记录应返回错误")
+	}
+	if err := lac.AckTransmitted(first["bob"]); err != nil {
+		t.Fatal(err)
+	}
+	if got := lac.TransmittedWatermark(); !got.Equal(base.Add(2 * time.Minute)) {
+		t.Errorf("水位 = %v", got)
+	}
+
+	// 水位持久化，重启后从水位开始收集 (与水位同一时间的记录再次出现)
+	got := byUser(newCollector().CollectPending().Assets)
+	if len(got) != 2 || got["bob"] == "" || got["carol"] == "" {
+		t.Errorf("确认后收集 = %v", got)
+	}
+}
+
+func TestCollectPendingKeepsUnsentRecords(t *testing.T) {
+	dir := t.TempDir()
+	base := time.Unix(1700000000, 0)
+	minute := func(i int) time.Time { return base.Add(time.Duration(i) * time.Minute) }
+	var wtmp, btmp []byte
+	for _, i := range []int{1, 2, 3, 4, 5, 6} {
+		wtmp = append(wtmp, encodeUtmpEntry(utmpTypeUserProcess, fmt.Sprintf("user%d", i), fmt.Sprintf("pts/%d", i), "203.0.113.7", minute(i))...)
+	}
+	for _, i := range []int{1, 2, 3} {
+		btmp = append(btmp, encodeUtmpEntry(utmpTypeLoginProcess, fmt.Sprintf("admin%d", i), "ssh:notty", "45.148.10.81", minute(i))...)
+	}
+
+	config := DefaultConfig()
+	config.PerformanceConfig.NoExec = true
+	config.LoginConfig.WtmpPath = filepath.Join(dir, "wtmp")
+	config.LoginConfig.BtmpPath = filepath.Join(dir, "btmp")
+	config.LoginConfig.UtmpPath = filepath.Join(dir, "utmp")
+	config.LoginConfig.WatermarkPath = filepath.Join(dir, "watermark.json")
+	config.LoginConfig.MaxLoginRecords = 2
+	for path, data := range map[string][]byte{config.LoginConfig.WtmpPath: wtmp, config.LoginConfig.BtmpPath: btmp} {
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 已有水位 (早于全部记录)
+	if err := os.WriteFile(config.LoginConfig.WatermarkPath, []byte(fmt.Sprintf(`{"timestamp":%d}`, base.UnixMilli())), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	executor := NewCommandExecutor(time.Second)
+	executor.SetNoExec(true)
+	lac := NewLoginAssetsCollector(config, executor)
+	usernames := func(records []protocol.LoginRecord) []string {
+		var names []string
+		for _, record := range records {
+			names = append(names, record.Username)
+		}
+		return names
+	}
+
+	// 超过条数上限时返回最早的记录
+	assets := lac.CollectPending().Assets
+	if got := usernames(assets.SuccessfulLogins); !slices.Equal(got, []string{"user2", "user1"}) {
+		t.Fatalf("成功登录 = %v", got)
+	}
+	if got := usernames(assets.FailedLogins); !slices.Equal(got, []string{"admin2", "admin1"}) {
+		t.Fatalf("失败登录 = %v", got)
+	}
+	// 水位不越过未返回的 admin3、user3
+	if err := lac.AckTransmitted(assets.SuccessfulLogins[0].RecordID); err != nil {
+		t.Fatal(err)
+	}
+	if got := lac.TransmittedWatermark(); !got.Equal(minute(2)) {
+		t.Fatalf("水位 = %v", got)
+	}
+	assets = lac.CollectPending().Assets
+	if got := usernames(assets.FailedLogins); !slices.Equal(got, []string{"admin3", "admin2"}) {
+		t.Fatalf("确认后的失败登录 = %v", got)
+	}
+
+	// 超过大小上限时丢弃最新的记录，水位最多前进到被丢弃的记录
+	config.LoginConfig.MaxLoginRecords = 10
+	full := payloadSize(lac.CollectPending().Assets)
+	config.LoginConfig.MaxPayloadBytes = full - 1
+	assets = lac.CollectPending().Assets
+	if assets.Trimmed == nil || assets.Trimmed.DroppedSuccessfulLogins != 1 {
+		t.Fatalf("裁剪 = %+v", assets.Trimmed)
+	}
+	if got := usernames(assets.SuccessfulLogins); !slices.Equal(got, []string{"user5", "user4", "user3", "user2"}) {
+		t.Fatalf("裁剪后的成功登录 = %v", got)
+	}
+	if err := lac.AckTransmitted(assets.SuccessfulLogins[0].RecordID); err != nil {
+		t.Fatal(err)
+	}
+	config.LoginConfig.MaxPayloadBytes = 0
+	assets = lac.CollectPending().Assets
+	if got := usernames(assets.SuccessfulLogins); !slices.Equal(got, []string{"user6", "user5"}) {
+		t.Errorf("裁剪后确认再收集 = %v", got)
+	}
+}
+
+func TestCollectAfter(t *testing.T) {
+	dir := t.TempDir()
+	base := time.Unix(1700000000, 0)
+	minute := func(i int) time.Time { return base.Add(time.Duration(i) * time.Minute) }
+	wtmp := slices.Concat(
+		encodeUtmpEntry(utmpTypeUserProcess, "user1", "pts/1", "203.0.113.7", minute(1)),
+		encodeUtmpEntry(utmpTypeUserProcess, "user2", "pts/2", "203.0.113.7", minute(2)),
+		encodeUtmpEntry(utmpTypeUserProcess, "user3", "pts/3", "203.0.113.7", minute(2).Add(250*time.Millisecond)),
+	)
+	btmp := slices.Concat(
+		encodeUtmpEntry(utmpTypeLoginProcess, "admin1", "ssh:notty", "45.148.10.81", minute(1)),
+		encodeUtmpEntry(utmpTypeLoginProcess, "admin2", "ssh:notty", "45.148.10.81", minute(2)),
+	)
+	utmp := encodeUtmpEntry(utmpTypeUserProcess, "user1", "pts/1", "203.0.113.7", minute(1))
+
+	config := DefaultConfig()
+	config.PerformanceConfig.NoExec = true
+	config.LoginConfig.WtmpPath = filepath.Join(dir, "wtmp")
+	config.LoginConfig.BtmpPath = filepath.Join(dir, "btmp")
+	config.LoginConfig.UtmpPath = filepath.Join(dir, "utmp")
+	for path, data := range map[string][]byte{config.LoginConfig.WtmpPath: wtmp, config.LoginConfig.BtmpPath: btmp, config.LoginConfig.UtmpPath: utmp} {
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	executor := NewCommandExecutor(time.Second)
+	executor.SetNoExec(true)
+	lac := NewLoginAssetsCollector(config, executor)
+	usernames := func(records []protocol.LoginRecord) []string {
+		var names []string
+		for _, record := range records {
+			names = append(names, record.Username)
+		}
+		return names
+	}
+
+	// 严格大于水位：与水位同一毫秒的 user2、admin2 不再返回，同一秒内稍晚的 user3 仍返回
+	assets := lac.CollectAfter(minute(2).UnixMilli())
+	if got := usernames(assets.SuccessfulLogins); !slices.Equal(got, []string{"user3"}) {
+		t.Errorf("成功登录 = %v", got)
+	}
+	if len(assets.FailedLogins) != 0 {
+		t.Errorf("失败登录 = %v", usernames(assets.FailedLogins))
+	}
+	// 当前会话始终完整返回
+	if len(assets.CurrentSessions) != 1 || assets.CurrentSessions[0].Username != "user1" {
+		t.Errorf("当前会话 = %+v", assets.CurrentSessions)
+	}
+
+	// CollectSince 的边界是包含的
+	if got := usernames(lac.CollectSince(minute(2)).Assets.SuccessfulLogins); !slices.Equal(got, []string{"user3", "user2"}) {
+		t.Errorf("CollectSince 成功登录 = %v", got)
+	}
+	if got := usernames(lac.CollectAfter(0).SuccessfulLogins); !slices.Equal(got, []string{"user3", "user2", "user1"}) {
+		t.Errorf("不限制时成功登录 = %v", got)
+	}
+
+	// last 的 --since 只精确到秒，输出中早于水位的记录同样被过滤
+	output, err := os.ReadFile(filepath.Join("testdata", "last_numeric.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lac = NewLoginAssetsCollector(DefaultConfig(), &fakeCommandRunner{outputs: map[string]string{"last": string(output)}})
+	all := lac.CollectAfter(0).SuccessfulLogins
+	if len(all) != 4 || all[1].Username != "root" {
+		t.Fatalf("last 成功登录 = %v", usernames(all))
+	}
+	if got := usernames(lac.CollectAfter(all[1].Timestamp).SuccessfulLogins); !slices.Equal(got, []string{"carol"}) {
+		t.Errorf("last 水位之后的成功登录 = %v", got)
+	}
+}
+
+func TestMaxLoginRecords(t *testing.T) {
+	dir := t.TempDir()
+	base := time.Unix(1700000000, 0)
+	var wtmp, btmp []byte
+	for i := 0; i < 5; i++ {
+		ts := base.Add(time.Duration(i) * time.Minute)
+		wtmp = append(wtmp, encodeUtmpEntry(utmpTypeUserProcess, fmt.Sprintf("user%d", i), fmt.Sprintf("pts/%d", i), "203.0.113.7", ts)...)
+		btmp = append(btmp, encodeUtmpEntry(utmpTypeLoginProcess, fmt.Sprintf("admin%d", i), "ssh:notty", "45.148.10.81", ts)...)
+	}
+
+	config := DefaultConfig()
+	config.PerformanceConfig.NoExec = true
+	config.LoginConfig.MaxLoginRecords = 3
+	config.LoginConfig.WtmpPath = filepath.Join(dir, "wtmp")
+	config.LoginConfig.BtmpPath = filepath.Join(dir, "btmp")
+	config.LoginConfig.UtmpPath = filepath.Join(dir, "utmp")
+	for path, data := range map[string][]byte{config.LoginConfig.WtmpPath: wtmp, config.LoginConfig.BtmpPath: btmp} {
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	executor := NewCommandExecutor(time.Second)
+	executor.SetNoExec(true)
+	assets := NewLoginAssetsCollector(config, executor).Collect()
+
+	// 保留最新的记录
+	for name, records := range map[string][]protocol.LoginRecord{"成功登录": assets.SuccessfulLogins, "失败登录": assets.FailedLogins} {
+		if len(records) != 3 {
+			t.Errorf("%s = %d 条, 期望 3", name, len(records))
+			continue
+		}
+		for _, record := range records {
+			if record.Timestamp < base.Add(2*time.Minute).UnixMilli() {
+				t.Errorf("%s 包含较早的记录: %+v", name, record)
+			}
+		}
+	}
+	if assets.Statistics.TotalLogins != 3 || assets.Statistics.FailedLogins != 3 {
+		t.Errorf("统计 = %+v", assets.Statistics)
+	}
+
+	// 未配置时默认 100
+	config.LoginConfig.MaxLoginRecords = 0
+	if got := maxLoginRecords(config); got != 100 {
+		t.Errorf("默认上限 = %d", got)
+	}
+}
+
+func TestParseJournalFailedLogins(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "journal_sshd.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lac := NewLoginAssetsCollector(DefaultConfig(), NewCommandExecutor(time.Second))
+
+	records := lac.parseJournalFailedLogins(string(data), time.Time{})
+	if len(records) != 3 {
+		t.Fatalf("失败登录 = %+v", records)
+	}
+	tz := time.FixedZone("CST", 8*3600)
+	for i, want := range []struct {
+		username string
+		ip       string
+		at       time.Time
+	}{
+		{"admin", "203.0.113.7", time.Date(2024, 3, 1, 9, 0, 1, 0, tz)},
+		{"root", "45.148.10.81", time.Date(2024, 3, 1, 9, 0, 9, 123000000, tz)},
+		{"root", "45.148.10.81", time.Date(2024, 3, 1, 9, 0, 12, 0, tz)},
+	} {
+		got := records[i]
+		if got.Username != want.username || got.IP != want.ip || got.Timestamp != want.at.UnixMilli() || got.Status != "failed" {
+			t.Errorf("第 %d 条 = %+v, 期望 %s %s %v", i, got, want.username, want.ip, want.at)
+		}
+	}
+
+	// 按 since 过滤
+	since := time.Date(2024, 3, 1, 9, 0, 10, 0, tz)
+	if records := lac.parseJournalFailedLogins(string(data), since); len(records) != 1 {
+		t.Errorf("since 过滤后 = %+v", records)
+	}
+}
+
+func TestCollectNoExec(t *testing.T) {
+	dir := t.TempDir()
+	base := time.Unix(1700000000, 0)
+	writeUtmp := func(name string, entries ...[]byte) string {
+		path := filepath.Join(dir, name)
+		var data []byte
+		for _, entry := range entries {
+			data = append(data, entry...)
+		}
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	config := DefaultConfig()
+	config.PerformanceConfig.NoExec = true
+	config.LoginConfig.WtmpPath = writeUtmp("wtmp",
+		encodeUtmpEntry(utmpTypeBootTime, "reboot", "~", "6.1.0", base),
+		encodeUtmpEntry(utmpTypeUserProcess, "root", "pts/0", "203.0.113.7", base.Add(time.Minute)),
+	)
+	config.LoginConfig.BtmpPath = writeUtmp("btmp",
+		encodeUtmpEntry(utmpTypeLoginProcess, "admin", "ssh:notty", "45.148.10.81", base),
+	)
+	config.LoginConfig.UtmpPath = writeUtmp("utmp",
+		encodeUtmpEntry(utmpTypeUserProcess, "root", "pts/0", "203.0.113.7", base.Add(time.Minute)),
+	)
+	config.SSHConfig.ConfigPaths = []string{filepath.Join(dir, "sshd_config")}
+
+	executor := NewCommandExecutor(time.Second)
+	executor.SetNoExec(true)
+	lac := NewLoginAssetsCollector(config, executor)
+
+	result := lac.CollectWithResult()
+	assets := result.Assets
+
+	if len(assets.SuccessfulLogins) != 1 || assets.SuccessfulLogins[0].Username != "root" {
+		t.Errorf("成功登录 = %+v", assets.SuccessfulLogins)
+	}
+	if len(assets.FailedLogins) != 1 || assets.FailedLogins[0].Username != "admin" {
+		t.Errorf("失败登录 = %+v", assets.FailedLogins)
+	}
+	if len(assets.CurrentSessions) != 1 || assets.CurrentSessions[0].IP != "203.0.113.7" {
+		t.Errorf("当前会话 = %+v", assets.CurrentSessions)
+	}
+
+	// 只能通过命令获取的数据应在诊断中说明
+	if err := result.Errors["account_lockouts"]; !errors.Is(err, ErrNoExec) {
+		t.Errorf("account_lockouts 错误 = %v, 期望 ErrNoExec", err)
+	}
+}
+
+func TestScanFailedLoginHistory(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "auth.log")
+	failed := func(user string) string {
+		return "Mar  1 09:00:01 host sshd[101]: Failed password for " + user + " from 203.0.113.7 port 50001 ssh2\n"
+	}
+
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write([]byte(failed("oldest") + "Mar  1 09:00:00 host CRON[1]: session opened\n"))
+	zw.Close()
+	files := map[string][]byte{
+		path + ".2.gz": gz.Bytes(),
+		path + ".1":    []byte(failed("older")),
+		path:           []byte(failed("newest")),
+	}
+	for name, data := range files {
+		if err := os.WriteFile(name, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	lac := NewLoginAssetsCollector(DefaultConfig(), NewCommandExecutor(time.Second))
+	paths := rotatedLogFiles(path, time.Time{})
+
+	var last ScanProgress
+	records, err := lac.scanFailedLoginFiles(context.Background(), paths, time.Time{}, func(p ScanProgress) {
+		last = p
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var users []string
+	for _, record := range records {
+		users = append(users, record.Username)
+	}
+	if strings.Join(users, ",") != "oldest,older,newest" {
+		t.Errorf("扫描顺序 = %v", users)
+	}
+	if last.FilesProcessed != 3 || last.Records != 3 || last.Percent() != 100 {
+		t.Errorf("最终进度 = %+v (%.1f%%)", last, last.Percent())
+	}
+
+	// 取消后在下一个文件之前停止
+	ctx, cancel := context.WithCancel(context.Background())
+	records, err = lac.scanFailedLoginFiles(ctx, paths, time.Time{}, func(p ScanProgress) {
+		if p.FilesProcessed == 1 {
+			cancel()
+		}
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("取消后错误 = %v", err)
+	}
+	if len(records) != 1 {
+		t.Errorf("取消前应只扫描了第一个文件, 实际记录 %d 条", len(records))
+	}
+}
+
+func TestHostLocatorCachesAndRefreshes(t *testing.T) {
+	now := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	h := newHostLocator(HostLocationConfig{
+		Method:          HostLocationAPI,
+		APIURL:          "http://ip.example.com",
+		RefreshInterval: time.Hour,
+	}, func() time.Time { return now })
+
+	calls := 0
+	ip := "198.51.100.1"
+	var fetchErr error
+	h.fetch = func(string) (string, error) {
+		calls++
+		return ip, fetchErr
+	}
+
+	get := func() *protocol.HostLocation {
+		t.Helper()
+		location, _ := h.Get()
+		if location == nil {
+			t.Fatal("主机位置不应为空")
+		}
+		return location
+	}
+
+	get()
+	now = now.Add(30 * time.Minute)
+	if got := get(); got.IP != "198.51.100.1" || calls != 1 {
+		t.Errorf("刷新间隔内应使用缓存: %+v, 探测 %d 次", got, calls)
+	}
+
+	// 到期后刷新
+	ip = "198.51.100.2"
+	now = now.Add(time.Hour)
+	if got := get(); got.IP != "198.51.100.2" || calls != 2 {
+		t.Errorf("到期后应重新探测: %+v, 探测 %d 次", got, calls)
+	}
+
+	// 探测失败时保留上一次的结果
+	fetchErr = errors.New("timeout")
+	now = now.Add(2 * time.Hour)
+	location, err := h.Get()
+	if err == nil || location == nil || location.IP != "198.51.100.2" {
+		t.Errorf("探测失败时应返回上一次结果和错误: %+v, %v", location, err)
+	}
+}
+
+func TestScriptedTimingAnalyzer(t *testing.T) {
+	base := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC).UnixMilli()
+	var failed []protocol.LoginRecord
+
+	// 每 30 秒一次，抖动不超过 200ms
+	for i, jitter := range []int64{0, 120, -80, 200, -150, 60} {
+		failed = append(failed, protocol.LoginRecord{Username: "root", IP: "203.0.113.7", Timestamp: base + int64(i)*30000 + jitter})
+	}
+	// 人工尝试，间隔不规律
+	for _, offset := range []int64{0, 4000, 65000, 71000, 300000, 302000} {
+		failed = append(failed, protocol.LoginRecord{Username: "alice", IP: "198.51.100.9", Timestamp: base + offset})
+	}
+	// 次数不足
+	for i := int64(0); i < 3; i++ {
+		failed = append(failed, protocol.LoginRecord{Username: "admin", IP: "192.0.2.1", Timestamp: base + i*10000})
+	}
+
+	a := newScriptedTimingAnalyzer(DefaultConfig())
+	assets := &protocol.LoginAssets{FailedLogins: failed}
+
+	attacks := a.Analyze(assets)
+	if len(attacks) != 1 || attacks[0].IP != "203.0.113.7" || attacks[0].Attempts != 6 {
+		t.Fatalf("脚本化尝试 = %+v", attacks)
+	}
+
+	for _, tt := range []struct {
+		ip    string
+		fired bool
+	}{
+		{"203.0.113.7", true},
+		{"198.51.100.9", false},
+		{"192.0.2.1", false},
+	} {
+		if got := a.Explain(assets, protocol.LoginRecord{IP: tt.ip}); got.Fired != tt.fired {
+			t.Errorf("Explain(%s) = %+v", tt.ip, got)
+		}
+	}
+}
+
+func TestParseLastOutputSessionEnd(t *testing.T) {
+	data, err := os.ReadFile("testdata/last_crash.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lac := NewLoginAssetsCollector(DefaultConfig(), NewCommandExecutor(time.Second))
+	records := lac.parseLastOutput(string(data), 100)
+
+	want := []struct {
+		username  string
+		endReason string
+		duration  int64
+		hasLogout bool
+	}{
+		{"root", protocol.SessionEndStillLoggedIn, 0, false},
+		{"deploy", protocol.SessionEndLogout, 30 * 60, true},
+		{"root", protocol.SessionEndCrash, 26*3600 + 3*60, false},
+		{"alice", protocol.SessionEndDown, 12 * 60, false},
+		{"bob", protocol.SessionEndGone, 0, false},
+	}
+	if len(records) != len(want) {
+		t.Fatalf("解析出 %d 条记录, 期望 %d 条: %+v", len(records), len(want), records)
+	}
+	for i, w := range want {
+		got := records[i]
+		if got.Username != w.username || got.EndReason != w.endReason || got.DurationSeconds != w.duration || (got.LogoutTime != 0) != w.hasLogout {
+			t.Errorf("记录 %d = %+v, 期望 %+v", i, got, w)
+		}
+	}
+
+	// 登录时间不受结束部分影响
+	if records[2].Timestamp != time.Date(2024, 2, 29, 8, 15, 0, 0, time.UTC).UnixMilli() {
+		t.Errorf("crash 会话登录时间 = %d", records[2].Timestamp)
+	}
+
+	stats := lac.calculateStatistics(&protocol.LoginAssets{SuccessfulLogins: records})
+	if stats.CrashTerminatedSessions != 1 {
+		t.Errorf("崩溃结束的会话数 = %d", stats.CrashTerminatedSessions)
+	}
+}
+
+func TestParseLastOutputAnchorsOnTime(t *testing.T) {
+	data, err := os.ReadFile("testdata/last_console.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lac := NewLoginAssetsCollector(DefaultConfig(), NewCommandExecutor(time.Second))
+	records := lac.parseLastOutput(string(data), 100)
+	if len(records) != 3 {
+		t.Fatalf("解析出 %d 条记录: %+v", len(records), records)
+	}
+
+	// FROM 为空的控制台登录，来源不能取自时间
+	console := records[0]
+	if console.Username != "root" || console.Terminal != "tty1" || console.IP != localSource ||
+		console.TimestampEstimated || console.Timestamp != time.Date(2024, 3, 1, 11, 30, 0, 0, time.UTC).UnixMilli() ||
+		console.EndReason != protocol.SessionEndStillLoggedIn {
+		t.Errorf("控制台登录 = %+v", console)
+	}
+
+	if tmux := records[1]; tmux.Terminal != "tmux(4242).%0" || tmux.IP != "203.0.113.9" || tmux.DurationSeconds != 30*60 {
+		t.Errorf("tmux 登录 = %+v", tmux)
+	}
+	if display := records[2]; display.IP != "localhost:1" || display.EndReason != protocol.SessionEndDown || display.TimestampEstimated {
+		t.Errorf("图形界面登录 = %+v", display)
+	}
+
+	// 终端名带空格时中间的字段都属于终端
+	line, ok := splitLastLine(strings.Fields("gdm   seat0 login  :0   Fri Mar  1 09:00:00 2024   still logged in"))
+	if !ok || line.username != "gdm" || line.terminal != "seat0 login" || line.source != ":0" || line.times[0] != "Fri" {
+		t.Errorf("splitLastLine = %+v", line)
+	}
+}
+
+func TestAcceptedKeyFingerprint(t *testing.T) {
+	lac := NewLoginAssetsCollector(DefaultConfig(), &fakeCommandRunner{})
+	for _, tc := range []struct {
+		line        string
+		keyType     string
+		fingerprint string
+	}{
+		{"Mar  1 09:00:02 host sshd[100]: Accepted publickey for deploy from 198.51.100.9 port 50022 ssh2: RSA SHA256:uN4kOk1m0K3pLz8m1vJ0Ye4TqGZ2cH9dQ4xS7rW8bA0", "RSA", "SHA256:uN4kOk1m0K3pLz8m1vJ0Ye4TqGZ2cH9dQ4xS7rW8bA0"},
+		{"Mar  1 09:00:03 host sshd[101]: Accepted publickey for alice from 2001:db8::1 port 50023 ssh2: ED25519 SHA256:3q5n0VYd9bB2cE6kP1rT4wX7zA8sD0fG2hJ5kL7mN9o", "ED25519", "SHA256:3q5n0VYd9bB2cE6kP1rT4wX7zA8sD0fG2hJ5kL7mN9o"},
+		{"Mar  1 09:00:04 host sshd[102]: Accepted publickey for ci from 192.0.2.8 port 50024 ssh2: ED25519-CERT SHA256:Zx9yW8vU7tS6rQ5pO4nM3lK2jI1hG0fE9dC8bA7zY6x ID ci@example (serial 7) CA ED25519 SHA256:caKey", "ED25519-CERT", "SHA256:Zx9yW8vU7tS6rQ5pO4nM3lK2jI1hG0fE9dC8bA7zY6x"},
+		// 较早的 sshd 输出 MD5 指纹
+		{"Mar  1 09:00:05 host sshd[103]: Accepted publickey for old from 192.0.2.9 port 50025 ssh2: RSA 12:f8:7e:78:61:b4:bf:e2:de:24:15:96:4e:d4:72:53", "", ""},
+		{"Mar  1 09:05:01 host sshd[104]: Accepted password for root from 203.0.113.7 port 40022 ssh2", "", ""},
+	} {
+		login, ok := lac.parseAcceptedLine(tc.line)
+		if !ok || login.keyType != tc.keyType || login.keyFingerprint != tc.fingerprint {
+			t.Errorf("%s: 密钥 %q %q, 期望 %q %q", tc.line, login.keyType, login.keyFingerprint, tc.keyType, tc.fingerprint)
+		}
+	}
+
+	// 从认证日志收集的成功登录和按认证日志补充的记录都带有指纹
+	authLog := filepath.Join(t.TempDir(), "auth.log")
+	line := "Mar  1 09:00:02 host sshd[100]: Accepted publickey for deploy from 198.51.100.9 port 50022 ssh2: RSA SHA256:abc\n"
+	if err := os.WriteFile(authLog, []byte(line), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	records := lac.collectSuccessfulLoginsFromAuthLog([]string{authLog}, time.Time{}, 10)
+	if len(records) != 1 || records[0].KeyType != "RSA" || records[0].KeyFingerprint != "SHA256:abc" {
+		t.Errorf("认证日志中的成功登录 = %+v", records)
+	}
+	wtmpRecords := []protocol.LoginRecord{{Username: "deploy", IP: "198.51.100.9", Timestamp: records[0].Timestamp}}
+	if err := lac.annotateAuthMethods(wtmpRecords, []string{authLog}); err != nil {
+		t.Fatal(err)
+	}
+	if wtmpRecords[0].KeyType != "RSA" || wtmpRecords[0].KeyFingerprint != "SHA256:abc" {
+		t.Errorf("补充的记录 = %+v", wtmpRecords[0])
+	}
+}
+
+func TestKeyOnlyAuthAnalyzer(t *testing.T) {
+	dir := t.TempDir()
+	authLog := filepath.Join(dir, "auth.log")
+	lines := []string{
+		"Mar  1 09:00:02 host sshd[100]: Accepted publickey for deploy from 198.51.100.9 port 50022 ssh2: ED25519 SHA256:abc",
+		"Mar  1 09:05:01 host sshd[101]: Accepted password for root from 203.0.113.7 port 40022 ssh2",
+		"Mar  1 09:10:00 host sshd[102]: Accepted keyboard-interactive/pam for alice from 192.0.2.1 port 40100 ssh2",
+		"Mar  1 09:20:00 host sshd[103]: Failed password for root from 203.0.113.7 port 40023 ssh2",
+	}
+	if err := os.WriteFile(authLog, []byte(strings.Join(lines, "\n")+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	config := DefaultConfig()
+	config.LoginConfig.KeyOnlyAuth = true
+	lac := NewLoginAssetsCollector(config, NewCommandExecutor(time.Second))
+
+	year := time.Now().Year()
+	if time.Date(year, 3, 1, 9, 0, 0, 0, time.UTC).After(time.Now()) {
+		year--
+	}
+	at := func(hour, minute int) int64 {
+		return time.Date(year, 3, 1, hour, minute, 0, 0, time.UTC).UnixMilli()
+	}
+	records := []protocol.LoginRecord{
+		{Username: "deploy", IP: "198.51.100.9", Timestamp: at(9, 0)},
+		{Username: "root", IP: "203.0.113.7", Timestamp: at(9, 5)},
+		{Username: "alice", IP: "192.0.2.1", Timestamp: at(9, 10)},
+		// 超出匹配窗口
+		{Username: "root", IP: "203.0.113.7", Timestamp: at(11, 0)},
+	}
+	if err := lac.annotateAuthMethods(records, []string{authLog}); err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []string{protocol.AuthMethodPublicKey, protocol.AuthMethodPassword, protocol.AuthMethodKeyboardInteractive, ""} {
+		if records[i].AuthMethod != want {
+			t.Errorf("记录 %d 认证方式 = %q, 期望 %q", i, records[i].AuthMethod, want)
+		}
+	}
+
+	assets := &protocol.LoginAssets{
+		SuccessfulLogins: records,
+		SSHDPolicy:       &protocol.SSHDPolicy{Source: "sshd -T", PasswordAuthentication: true},
+	}
+	stats := lac.calculateStatistics(assets)
+	if len(stats.UnexpectedAuthMethods) != 2 {
+		t.Fatalf("密码认证告警 = %+v", stats.UnexpectedAuthMethods)
+	}
+	if got := stats.UnexpectedAuthMethods[0]; got.Username != "root" || !got.PasswordAuthEnabled || got.PolicySource != "sshd -T" {
+		t.Errorf("password 告警 = %+v", got)
+	}
+	// 键盘交互认证以 KbdInteractiveAuth 为准
+	if got := stats.UnexpectedAuthMethods[1]; got.Username != "alice" || got.PasswordAuthEnabled {
+		t.Errorf("keyboard-interactive 告警 = %+v", got)
+	}
+
+	a := &keyOnlyAuthAnalyzer{}
+	if got := a.Explain(assets, records[0]); got.Fired {
+		t.Errorf("公钥登录不应命中: %+v", got)
+	}
+	if got := a.Explain(assets, records[1]); !got.Fired {
+		t.Errorf("密码登录应命中: %+v", got)
+	}
+}
+
+func TestLogTamperingDetector(t *testing.T) {
+	dir := t.TempDir()
+	boot := time.Date(2024, 3, 1, 8, 0, 0, 0, time.UTC)
+	now := boot.Add(6 * time.Hour)
+
+	procStat := filepath.Join(dir, "stat")
+	if err := os.WriteFile(procStat, []byte(fmt.Sprintf("cpu  1 2 3\nbtime %d\nprocesses 100\n", boot.Unix())), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	// wtmp 首条记录在启动之后且没有轮转文件
+	wtmp := filepath.Join(dir, "wtmp")
+	if err := os.WriteFile(wtmp, encodeUtmpEntry(utmpTypeUserProcess, "root", "pts/0", "203.0.113.7", boot.Add(3*time.Hour)), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	// btmp 大小没有对齐到记录长度
+	btmp := filepath.Join(dir, "btmp")
+	if err := os.WriteFile(btmp, make([]byte, utmpRecordSize+10), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	authLog := filepath.Join(dir, "auth.log")
+	if err := os.WriteFile(authLog, []byte(strings.Repeat("Mar  1 09:00:00 host sshd[1]: line\n", 10)), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	d := &logTamperingDetector{
+		wtmpPath:     wtmp,
+		btmpPath:     btmp,
+		procStatPath: procStat,
+		authLog:      func() string { return authLog },
+		now:          func() time.Time { return now },
+	}
+
+	assets := &protocol.LoginAssets{
+		SuccessfulLogins: []protocol.LoginRecord{{Username: "root", Terminal: "pts/0", Timestamp: boot.Add(3 * time.Hour).UnixMilli()}},
+		CurrentSessions: []protocol.LoginSession{
+			{Username: "root", Terminal: "pts/0", LoginTime: boot.Add(3*time.Hour + time.Minute).UnixMilli()},
+			{Username: "ghost", Terminal: "pts/3", LoginTime: boot.Add(4 * time.Hour).UnixMilli()},
+		},
+	}
+
+	kinds := func(suspicions []protocol.LogTamperingSuspicion) map[string]string {
+		m := make(map[string]string)
+		for _, s := range suspicions {
+			if s.Observation == "" {
+				t.Errorf("缺少观察说明: %+v", s)
+			}
+			m[s.Kind] = s.Log
+		}
+		return m
+	}
+
+	got := kinds(d.Detect(assets, time.Time{}))
+	want := map[string]string{
+		protocol.LogTamperMissingBootRecord:   wtmp,
+		protocol.LogTamperMisaligned:          btmp,
+		protocol.LogTamperSessionWithoutLogin: wtmp,
+	}
+	if len(got) != len(want) {
+		t.Fatalf("迹象 = %v, 期望 %v", got, want)
+	}
+	for kind, log := range want {
+		if got[kind] != log {
+			t.Errorf("%s = %q, 期望 %q", kind, got[kind], log)
+		}
+	}
+
+	// 启动后发生过轮转，首条记录晚于启动时间是正常的
+	if err := os.WriteFile(wtmp+".1", nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if got := kinds(d.checkUtmpFile(wtmp, boot, true)); len(got) != 0 {
+		t.Errorf("轮转后不应有迹象: %v", got)
+	}
+
+	// 认证日志在两次收集之间变小且没有轮转
+	if err := os.WriteFile(authLog, []byte("Mar  1 14:00:00 host sshd[1]: line\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if got := kinds(d.checkAuthLog(authLog)); got[protocol.LogTamperTruncated] != authLog {
+		t.Errorf("认证日志截断 = %v", got)
+	}
+
+	// 按 rename 方式轮转
+	if err := os.Rename(authLog, authLog+".1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(authLog, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if got := kinds(d.checkAuthLog(authLog)); len(got) != 0 {
+		t.Errorf("正常轮转不应有迹象: %v", got)
+	}
+}
+
+func TestMergeLastRecords(t *testing.T) {
+	lac := NewLoginAssetsCollector(DefaultConfig(), NewCommandExecutor(time.Second))
+	parse := func(name string) []protocol.LoginRecord {
+		data, err := os.ReadFile(filepath.Join("testdata", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return lac.parseLastOutput(string(data), 100)
+	}
+
+	// 两次运行之间 alice 的记录 (只在主机名输出中) 和 carol 的记录 (只在数字IP输出中) 各多出一条
+	merged := mergeLastRecords(parse("last_named.txt"), parse("last_numeric.txt"), 100)
+
+	want := []struct {
+		username, ip, hostname string
+	}{
+		{"carol", "192.0.2.80", ""},
+		{"alice", "unknown", "vpn.example.com"},
+		{"root", "203.0.113.7", "bastion.example.com"},
+		{"deploy", "198.51.100.23", ""},
+		{"bob", "localhost", "localhost"},
+	}
+	if len(merged) != len(want) {
+		t.Fatalf("合并后 %d 条记录, 期望 %d 条: %+v", len(merged), len(want), merged)
+	}
+	for i, w := range want {
+		if got := merged[i]; got.Username != w.username || got.IP != w.ip || got.Hostname != w.hostname {
+			t.Errorf("记录 %d = %+v, 期望 %+v", i, got, w)
+		}
+	}
+	if merged[4].EndReason != protocol.SessionEndDown {
+		t.Errorf("合并后丢失了会话结束方式: %+v", merged[4])
+	}
+
+	if got := mergeLastRecords(parse("last_named.txt"), parse("last_numeric.txt"), 2); len(got) != 2 || got[0].Username != "carol" {
+		t.Errorf("数量限制 = %+v", got)
+	}
+}
+
+func TestParseIdleTimeFormats(t *testing.T) {
+	lac := NewLoginAssetsCollector(DefaultConfig(), NewCommandExecutor(time.Second))
+	now := time.Date(2024, 1, 21, 12, 0, 0, 0, time.Local)
+	lac.SetClock(func() time.Time { return now })
+
+	for _, tt := range []struct {
+		input string
+		want  int
+	}{
+		{"12.00s", 12},
+		{"0.50s", 0},
+		{"2:30", 150},   // 分:秒
+		{"1:05m", 3900}, // 时:分
+		{"2:03m", 7380},
+		{"45m", 2700}, // 只有分钟
+		{"7days", 7 * 86400},
+		{"1day", 86400},
+		{"14Jan24", int(now.Sub(time.Date(2024, 1, 14, 0, 0, 0, 0, time.Local)).Seconds())},
+		{"22Jan24", 0}, // 晚于当前时间
+		{"-", 0},
+		{"?", 0},
+		{"garbage", 0},
+	} {
+		if got := lac.parseIdleTime(tt.input); got != tt.want {
+			t.Errorf("parseIdleTime(%q) = %d, 期望 %d", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestSessionIdleClassification(t *testing.T) {
+	lac := NewLoginAssetsCollector(DefaultConfig(), NewCommandExecutor(time.Second))
+
+	for input, want := range map[string]int{
+		"12.00s": 12,
+		"2:30":   150,  // 分:秒
+		"1:05m":  3900, // 时:分
+		"3days":  259200,
+		"-":      0,
+	} {
+		if got := lac.parseIdleTime(input); got != want {
+			t.Errorf("parseIdleTime(%q) = %d, 期望 %d", input, got, want)
+		}
+	}
+
+	sessions := []protocol.LoginSession{
+		{Username: "alice", IdleTime: 60},
+		{Username: "bob", IdleTime: 45 * 60},
+		{Username: "root", IdleTime: 9 * 3600},
+		{Username: "carol", IdleTime: 3 * 86400},
+	}
+	lac.classifySessions(sessions)
+
+	want := []struct{ idle, stale bool }{{false, false}, {true, false}, {true, true}, {true, true}}
+	for i, w := range want {
+		if sessions[i].IsIdle != w.idle || sessions[i].IsStale != w.stale {
+			t.Errorf("会话 %s: IsIdle=%v IsStale=%v, 期望 %v %v", sessions[i].Username, sessions[i].IsIdle, sessions[i].IsStale, w.idle, w.stale)
+		}
+	}
+
+	stats := lac.calculateStatistics(&protocol.LoginAssets{CurrentSessions: sessions})
+	if stats.ActiveSessions != 1 || stats.IdleSessions != 1 || stats.StaleSessions != 2 || stats.StaleRootSessions != 1 {
+		t.Errorf("会话统计 = active %d idle %d stale %d root %d",
+			stats.ActiveSessions, stats.IdleSessions, stats.StaleSessions, stats.StaleRootSessions)
+	}
+}
+
+func TestOpenLogFileRefusesSymlinks(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "shadow")
+	if err := os.WriteFile(target, []byte("root:$6$secret:19000::::::\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	authLog := filepath.Join(dir, "auth.log")
+	if err := os.Symlink(target, authLog); err != nil {
+		t.Fatal(err)
+	}
+
+	if file, err := openLogFile(authLog); err == nil {
+		file.Close()
+		t.Fatal("符号链接的认证日志应被拒绝")
+	}
+	if err := checkLogPath(authLog); err == nil {
+		t.Fatal("checkLogPath 应拒绝符号链接")
+	}
+
+	// 读取认证日志的收集器不应返回链接目标的内容
+	lac := NewLoginAssetsCollector(DefaultConfig(), NewCommandExecutor(time.Second))
+	if _, err := lac.readAcceptedLogins(authLog); err == nil {
+		t.Error("readAcceptedLogins 应拒绝符号链接")
+	}
+
+	// 其他用户可写且没有 sticky 位的目录不可信
+	open := filepath.Join(dir, "open")
+	if err := os.Mkdir(open, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(open, 0777); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(open, "wtmp"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readUtmpTail(filepath.Join(open, "wtmp"), 10, time.Time{}, isUtmpUserProcess); err == nil {
+		t.Error("不可信目录中的 wtmp 应被拒绝")
+	}
+
+	// 普通文件正常读取
+	regular := filepath.Join(dir, "secure")
+	if err := os.WriteFile(regular, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	file, err := openLogFile(regular)
+	if err != nil {
+		t.Fatalf("普通文件: %v", err)
+	}
+	file.Close()
+}
+
+func TestTimingPatternAnalyzer(t *testing.T) {
+	config := DefaultConfig()
+	config.LoginConfig.Holidays = []string{"2026-03-18", "not-a-date"}
+	analyzer := newTimingPatternAnalyzer(config)
+	analyzer.location = time.UTC
+
+	at := func(day, hour int) int64 {
+		return time.Date(2026, time.March, day, hour, 17, 0, 0, time.UTC).UnixMilli()
+	}
+
+	// 2026-03-02 为周一，覆盖四周
+	// 失败登录集中在周末夜间，成功登录一半在节假日 (周三)、其余在工作日白天
+	assets := &protocol.LoginAssets{}
+	for _, day := range []int{7, 8, 14, 15, 21, 22, 28, 29} {
+		for _, hour := range []int{1, 2, 3} {
+			assets.FailedLogins = append(assets.FailedLogins, protocol.LoginRecord{IP: "192.0.2.9", Status: "failed", Timestamp: at(day, hour)})
+		}
+	}
+	assets.FailedLogins = append(assets.FailedLogins,
+		protocol.LoginRecord{IP: "192.0.2.9", Status: "failed", Timestamp: at(2, 10)},
+		protocol.LoginRecord{IP: "192.0.2.9", Status: "failed", Timestamp: at(27, 14)},
+	)
+	for i := 0; i < 12; i++ {
+		assets.SuccessfulLogins = append(assets.SuccessfulLogins,
+			protocol.LoginRecord{Username: "ops", Status: "success", Timestamp: at(18, 9+i%8)},
+			protocol.LoginRecord{Username: "ops", Status: "success", Timestamp: at(3+i%4, 9+i%8)},
+		)
+	}
+
+	found := make(map[string]protocol.TimingPattern)
+	for _, pattern := range analyzer.Analyze(assets) {
+		found[pattern.Status+"/"+pattern.Category] = pattern
+	}
+	for _, key := range []string{"failed/weekend", "failed/overnight", "success/holiday"} {
+		if _, ok := found[key]; !ok {
+			t.Errorf("缺少 %s, 结果 %+v", key, found)
+		}
+	}
+	if len(found) != 3 {
+		t.Errorf("结果 = %+v", found)
+	}
+	if weekend := found["failed/weekend"]; weekend.Events != 24 || weekend.TotalEvents != 26 || weekend.ByWeekday[time.Saturday] != 12 {
+		t.Errorf("周末分布 = %+v", weekend)
+	}
+
+	holiday := protocol.LoginRecord{Username: "ops", Status: "success", Timestamp: at(18, 11)}
+	if explanation := analyzer.Explain(assets, holiday); !explanation.Fired || !strings.Contains(explanation.Detail, "holiday") {
+		t.Errorf("节假日登录解释 = %+v", explanation)
+	}
+	weekday := protocol.LoginRecord{Username: "ops", Status: "success", Timestamp: at(4, 11)}
+	if explanation := analyzer.Explain(assets, weekday); explanation.Fired {
+		t.Errorf("工作日白天登录不应命中: %+v", explanation)
+	}
+
+	// 记录不足时不判断
+	config.LoginConfig.TimingMinEvents = 100
+	analyzer = newTimingPatternAnalyzer(config)
+	analyzer.location = time.UTC
+	if patterns := analyzer.Analyze(assets); len(patterns) != 0 {
+		t.Errorf("记录不足时 = %+v", patterns)
+	}
+}
+
+func TestCollectByHost(t *testing.T) {
+	config := DefaultConfig()
+	config.LoginConfig.AggregateLogPath = filepath.Join("testdata", "auth_aggregate.log")
+	lac := NewLoginAssetsCollector(config, NewCommandExecutor(time.Second))
+
+	byHost, err := lac.CollectByHost(time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	localHost, _ := os.Hostname()
+	if localHost == "" {
+		localHost = "localhost"
+	}
+	want := map[string]struct{ success, failed int }{
+		"web01.prod.example.com": {1, 1},
+		"db-1":                   {1, 2},
+		localHost:                {1, 0},
+	}
+	if len(byHost) != len(want) {
+		t.Fatalf("主机 = %v", slices.Collect(maps.Keys(byHost)))
+	}
+	for host, w := range want {
+		assets := byHost[host]
+		if assets == nil {
+			t.Errorf("缺少主机 %s", host)
+			continue
+		}
+		if len(assets.SuccessfulLogins) != w.success || len(assets.FailedLogins) != w.failed {
+			t.Errorf("%s: 成功 %d 失败 %d, 期望 %d %d", host, len(assets.SuccessfulLogins), len(assets.FailedLogins), w.success, w.failed)
+		}
+		if assets.Statistics == nil {
+			t.Errorf("%s: 缺少统计信息", host)
+		}
+	}
+
+	if got := byHost["db-1"].SuccessfulLogins[0]; got.Username != "dba" || got.AuthMethod != "keyboard-interactive" ||
+		got.Timestamp != time.Date(2026, time.March, 3, 9, 15, 30, 123000000, time.UTC).UnixMilli() {
+		t.Errorf("db-1 成功登录 = %+v", got)
+	}
+	if got := byHost[localHost].SuccessfulLogins[0]; got.Username != "admin" || got.IP != "192.0.2.10" {
+		t.Errorf("本机登录 = %+v", got)
+	}
+
+	for line, host := range map[string]string{
+		"Mar  3 09:12:01 web01.prod.example.com sshd[1]: x": "web01.prod.example.com",
+		"Mar  3 09:12:01 sshd[1]: x":                        "",
+		"Mar  3 09:12:01 sshd: x":                           "",
+		"2026-03-03T09:15:30+08:00 host.a.b sshd[9]: x":     "host.a.b",
+	} {
+		if got := syslogHost(line); got != host {
+			t.Errorf("syslogHost(%q) = %q, 期望 %q", line, got, host)
+		}
+	}
+}
+
+func TestHostContextCollector(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	executor := NewCommandExecutor(time.Second)
+	executor.SetNoExec(true)
+
+	config := DefaultConfig().LoginConfig.HostContext
+	collector := newHostContextCollector(config, executor)
+	if got := collector.Collect(); got != nil {
+		t.Fatalf("未启用时 = %+v", got)
+	}
+
+	config.Enabled = true
+	config.Hostname = false
+	collector = newHostContextCollector(config, executor)
+	collector.osReleasePath = write("os-release", "NAME=\"Debian GNU/Linux\"\nVERSION_ID=\"12\"\nPRETTY_NAME=\"Debian GNU/Linux 12 (bookworm)\"\n")
+	collector.kernelPath = write("osrelease", "6.1.0-18-amd64\n")
+	collector.instanceIDPath = write("instance-id", "i-0abc123def456\n")
+
+	got := collector.Collect()
+	want := protocol.HostContext{
+		Distro:       "Debian GNU/Linux 12 (bookworm)",
+		Kernel:       "6.1.0-18-amd64",
+		AgentVersion: got.AgentVersion,
+		InstanceID:   "i-0abc123def456",
+	}
+	if *got != want || got.AgentVersion == "" {
+		t.Errorf("主机环境 = %+v, 期望 %+v", *got, want)
+	}
+
+	// 没有 PRETTY_NAME 时使用 NAME VERSION_ID，实例ID不存在时为空
+	collector.osReleasePath = write("os-release-min", "NAME=Alpine\nVERSION_ID=3.19.1\n")
+	collector.instanceIDPath = filepath.Join(dir, "missing")
+	if got := collector.Collect(); got.Distro != "Alpine 3.19.1" || got.InstanceID != "" {
+		t.Errorf("主机环境 = %+v", got)
+	}
+}
+
+func TestBastionBypassAnalyzer(t *testing.T) {
+	config := DefaultConfig()
+	config.LoginConfig.BastionSources = []string{"10.0.0.10", "10.20.0.0/24", "2001:db8:1::/48", "Bastion-2.example.com."}
+	analyzer := newBastionBypassAnalyzer(config)
+
+	login := func(ip, hostname, terminal string) protocol.LoginRecord {
+		return protocol.LoginRecord{Username: "ops", IP: ip, Hostname: hostname, Terminal: terminal, Timestamp: 1, Status: "success"}
+	}
+	assets := &protocol.LoginAssets{SuccessfulLogins: []protocol.LoginRecord{
+		login("10.0.0.10", "", "pts/0"),                       // 堡垒机
+		login("::ffff:10.20.0.7", "", "pts/1"),                // 堡垒机网段 (IPv4 映射地址)
+		login("2001:db8:1:5::9", "", "ssh"),                   // 堡垒机 IPv6 网段
+		login("bastion-2.example.com", "", "pts/2"),           // last 输出的主机名
+		login("192.0.2.44", "bastion-2.example.com", "pts/3"), // 反向解析的主机名
+		login("", "", "tty1"),                                 // 本地控制台
+		login("127.0.0.1", "", "pts/4"),                       // 本机端口转发
+		login("10.0.0.11", "", "pts/5"),                       // 绕过
+		login("jump.evil.example", "", "pts/6"),               // 绕过
+	}}
+
+	findings := analyzer.Analyze(assets)
+	if len(findings) != 2 || findings[0].IP != "10.0.0.11" || findings[1].IP != "jump.evil.example" {
+		t.Fatalf("绕过 = %+v", findings)
+	}
+
+	for i, record := range assets.SuccessfulLogins {
+		explanation := analyzer.Explain(assets, record)
+		if want := i >= 7; explanation.Fired != want {
+			t.Errorf("记录 %d: %+v", i, explanation)
+		}
+	}
+
+	// 未配置堡垒机时不启用
+	if slices.Contains(Capabilities(DefaultConfig()).LoginAnalyzers, analyzer.Name()) {
+		t.Error("未配置堡垒机时不应启用")
+	}
+}
+
+func TestIPv6SourceExtraction(t *testing.T) {
+	lac := NewLoginAssetsCollector(DefaultConfig(), NewCommandExecutor(time.Second))
+
+	for _, tc := range []struct {
+		line string
+		ip   string
+		ok   bool
+	}{
+		{"Dec 25 10:30:00 host sshd[1234]: Failed password for root from 2001:db8::1 port 22 ssh2", "2001:db8::1", true},
+		{"Dec 25 10:30:00 host sshd[1234]: Failed password for root from fe80::1%eth0 port 22 ssh2", "fe80::1", true},
+		{"Dec 25 10:30:00 host sshd[1234]: Failed password for root from [2001:DB8:0:0::7]:2222 port 22 ssh2", "2001:db8::7", true},
+		{"Dec 25 10:30:00 host sshd[1234]: Failed password for invalid user admin from ::ffff:203.0.113.5 port 22 ssh2", "203.0.113.5", true},
+		{"Dec 25 10:30:00 host sshd[1234]: pam_unix(sshd:auth): authentication failure; logname= uid=0 euid=0 tty=ssh ruser= rhost=2001:db8::2%ens3  user=root", "2001:db8::2", true},
+		{"Dec 25 10:30:00 host sshd[1234]: Failed password for root from attacker.example port 22 ssh2", "attacker.example", false},
+	} {
+		record := lac.parseFailedLoginFromLog(tc.line)
+		if record.IP != tc.ip || record.IPParseOK != tc.ok {
+			t.Errorf("%s: 来源 %q (%v), 期望 %q (%v)", tc.line, record.IP, record.IPParseOK, tc.ip, tc.ok)
+		}
+	}
+
+	// w 的 FROM 列默认截断为 16 个字符，截断的 IPv6 不是有效 IP，作为主机名保留
+	runner := &fakeCommandRunner{outputs: map[string]string{
+		"w": "root     pts/0    2001:db8::3      10:00    1.00s  0.01s  0.00s -bash\n" +
+			"alice    pts/1    2001:db8:85a3:0  10:05    2:30   0.01s  0.00s -bash\n" +
+			"bob      pts/2    10.0.0.5:22      10:06    2:30   0.01s  0.00s -bash\n" +
+			"carol    tty1     -                09:00    1:00m  0.01s  0.00s -bash\n",
+	}}
+	lac = NewLoginAssetsCollector(DefaultConfig(), runner)
+	want := []struct {
+		ip string
+		ok bool
+	}{{"2001:db8::3", true}, {"", false}, {"10.0.0.5", true}, {"localhost", false}}
+	sessions, err := lac.collectCurrentSessions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != len(want) {
+		t.Fatalf("会话数 = %d", len(sessions))
+	}
+	for i, session := range sessions {
+		if session.IP != want[i].ip || session.IPParseOK != want[i].ok {
+			t.Errorf("会话 %d: 来源 %q (%v), 期望 %q (%v)", i, session.IP, session.IPParseOK, want[i].ip, want[i].ok)
+		}
+	}
+	if sessions[1].Hostname != "2001:db8:85a3:0" {
+		t.Errorf("截断的来源应记录为主机名: %q", sessions[1].Hostname)
+	}
+}
+
+func TestSessionProcessAndPID(t *testing.T) {
+	runner := &fakeCommandRunner{outputs: map[string]string{
+		"w": "root     pts/0    203.0.113.7      10:00    1.00s  0.01s  0.00s vim /etc/ssh/sshd_config\n" +
+			"alice    pts/1    198.51.100.1     10:05    2:30   0.01s  0.00s -bash\n" +
+			"bob      tty1     -                09:00    1:00m  0.01s  0.00s\n",
+		"loginctl list-sessions --no-legend --no-pager": "    3 0 root       pts/0\n   12 1000 alice seat0 pts/1\n   c1 0 root\n",
+		"loginctl show-session --no-pager -p Name -p TTY -p Leader 3 12 c1": "Name=root\nTTY=pts/0\nLeader=1234\n\n" +
+			"Name=alice\nTTY=pts/1\nLeader=2345\n\nName=root\nTTY=\nLeader=99\n",
+	}}
+	config := DefaultConfig()
+	config.LoginConfig.ResolveSessionPIDs = true
+	config.LoginConfig.UtmpPath = filepath.Join(t.TempDir(), "utmp")
+	lac := NewLoginAssetsCollector(config, runner)
+	lac.systemdBooted = func() bool { return true }
+
+	sessions, err := lac.collectCurrentSessions()
+	if err != nil || len(sessions) != 3 {
+		t.Fatalf("会话 = %+v, %v", sessions, err)
+	}
+	for i, want := range []struct {
+		process string
+		pid     int
+	}{
+		{"vim /etc/ssh/sshd_config", 1234},
+		{"-bash", 2345},
+		{"", 0},
+	} {
+		if sessions[i].CurrentProcess != want.process || sessions[i].PID != want.pid {
+			t.Errorf("会话 %d: 命令 %q PID %d, 期望 %q %d", i, sessions[i].CurrentProcess, sessions[i].PID, want.process, want.pid)
+		}
+	}
+
+	// 主机不是以 systemd 启动时不执行 loginctl
+	runner.calls = nil
+	lac.systemdBooted = func() bool { return false }
+	sessions, _ = lac.collectCurrentSessions()
+	if sessions[0].PID != 0 || slices.ContainsFunc(runner.calls, func(call string) bool { return strings.HasPrefix(call, "loginctl") }) {
+		t.Errorf("未以 systemd 启动: %+v, 调用 %v", sessions[0], runner.calls)
+	}
+}
+
+func TestSessionHostnames(t *testing.T) {
+	runner := &fakeCommandRunner{outputs: map[string]string{
+		"w": "root     pts/0    bastion.example  10:00    1.00s  0.01s  0.00s -bash\n" +
+			"alice    pts/1    203.0.113.9      10:05    2:30   0.01s  0.00s -bash\n" +
+			"bob      pts/2    unknown.example  10:06    2:30   0.01s  0.00s -bash\n" +
+			"carol    pts/3    :0               09:00    1:00m  0.01s  0.00s -bash\n",
+	}}
+
+	// 默认只记录主机名，不解析
+	lac := NewLoginAssetsCollector(DefaultConfig(), runner)
+	var lookups []string
+	lac.lookupHost = func(ctx context.Context, host string) ([]string, error) {
+		lookups = append(lookups, host)
+		if host == "bastion.example" {
+			return []string{"2001:db8::10", "192.0.2.10"}, nil
+		}
+		return nil, fmt.Errorf("no such host")
+	}
+	sessions, err := lac.collectCurrentSessions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 4 {
+		t.Fatalf("会话数 = %d", len(sessions))
+	}
+	if sessions[0].IP != "" || sessions[0].Hostname != "bastion.example" || sessions[0].IPParseOK {
+		t.Errorf("主机名来源: %+v", sessions[0])
+	}
+	if sessions[1].IP != "203.0.113.9" || sessions[1].Hostname != "" || !sessions[1].IPParseOK {
+		t.Errorf("IP 来源: %+v", sessions[1])
+	}
+	if sessions[3].IP != "localhost" || sessions[3].Hostname != "" {
+		t.Errorf("本地显示会话: %+v", sessions[3])
+	}
+	if len(lookups) != 0 {
+		t.Errorf("未开启时不应解析: %v", lookups)
+	}
+
+	// 开启后解析主机名填充 IP，解析失败时只保留主机名
+	lac.config.LoginConfig.ResolveSessionHostnames = true
+	sessions, err = lac.collectCurrentSessions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sessions[0].IP != "2001:db8::10" || sessions[0].Hostname != "bastion.example" || !sessions[0].IPParseOK {
+		t.Errorf("解析后的来源: %+v", sessions[0])
+	}
+	if sessions[2].IP != "" || sessions[2].Hostname != "unknown.example" || sessions[2].IPParseOK {
+		t.Errorf("解析失败的来源: %+v", sessions[2])
+	}
+	if len(lookups) != 2 {
+		t.Errorf("解析次数 = %d: %v", len(lookups), lookups)
+	}
+}
+
+func TestWHeaderAndBanner(t *testing.T) {
+	// procps 的 w 在部分环境忽略 -h，输出 uptime 行和标题行
+	runner := &fakeCommandRunner{outputs: map[string]string{
+		"w": " 10:15:01 up 3 days,  2:10,  2 users,  load average: 0.00, 0.01, 0.05\n" +
+			"USER     TTY      FROM             LOGIN@   IDLE   JCPU   PCPU WHAT\n" +
+			"root     pts/0    203.0.113.9      10:00    1.00s  0.01s  0.00s -bash\n",
+	}}
+	lac := NewLoginAssetsCollector(DefaultConfig(), runner)
+	sessions, err := lac.collectCurrentSessions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 1 || sessions[0].Username != "root" || sessions[0].IP != "203.0.113.9" || sessions[0].IdleTime != 1 {
+		t.Fatalf("会话 = %+v", sessions)
+	}
+
+	// BusyBox 的 w 不支持 -h，不带参数重试后按其列格式解析
+	data, err := os.ReadFile(filepath.Join("testdata", "w_busybox.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	runner = &fakeCommandRunner{outputs: map[string]string{"w": string(data)}, failing: []string{"w -h"}}
+	lac = NewLoginAssetsCollector(DefaultConfig(), runner)
+	sessions, err = lac.collectCurrentSessions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(runner.calls[:2], []string{"w -h", "w"}) {
+		t.Errorf("命令 = %v", runner.calls)
+	}
+	want := []struct {
+		username, terminal, ip string
+		idle                   int
+	}{
+		{"root", "pts/0", "192.168.1.20", 0},
+		{"alice", "pts/1", "2001:db8::5", 2*3600 + 15*60},
+		{"bob", "tty1", "localhost", 86400},
+	}
+	if len(sessions) != len(want) {
+		t.Fatalf("会话 = %+v", sessions)
+	}
+	for i, w := range want {
+		s := sessions[i]
+		if s.Username != w.username || s.Terminal != w.terminal || s.IP != w.ip || s.IdleTime != w.idle {
+			t.Errorf("会话 %d = %+v, 期望 %+v", i, s, w)
+		}
+	}
+}
+
+func TestAuthLogPaths(t *testing.T) {
+	dir := t.TempDir()
+	line := func(user string) string {
+		return "Dec 25 10:30:00 host sshd[1234]: Failed password for " + user + " from 203.0.113.5 port 22 ssh2\n"
+	}
+	var gz bytes.Buffer
+	writer := gzip.NewWriter(&gz)
+	writer.Write([]byte(line("dave")))
+	writer.Close()
+
+	base := time.Now().Add(-time.Hour)
+	for i, file := range []struct {
+		name string
+		data []byte
+	}{
+		{"auth.log.2.gz", gz.Bytes()},
+		{"auth.log.1", []byte(line("carol"))},
+		{"auth.log", []byte(line("alice") + line("bob"))},
+	} {
+		path := filepath.Join(dir, file.name)
+		if err := os.WriteFile(path, file.data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		modTime := base.Add(time.Duration(i) * time.Minute)
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 匹配到的符号链接不读取
+	if err := os.Symlink(filepath.Join(dir, "auth.log"), filepath.Join(dir, "auth.log.link")); err != nil {
+		t.Fatal(err)
+	}
+
+	config := DefaultConfig()
+	config.LoginConfig.AuthLogPaths = []string{filepath.Join(dir, "auth.log*"), filepath.Join(dir, "auth.log")}
+	lac := NewLoginAssetsCollector(config, &fakeCommandRunner{outputs: map[string]string{}})
+
+	want := []string{
+		filepath.Join(dir, "auth.log.2.gz"),
+		filepath.Join(dir, "auth.log.1"),
+		filepath.Join(dir, "auth.log"),
+	}
+	if got := lac.authLogFiles(); !slices.Equal(got, want) {
+		t.Errorf("authLogFiles = %v, 期望 %v", got, want)
+	}
+
+	usernames := func(records []protocol.LoginRecord) []string {
+		var names []string
+		for _, record := range records {
+			names = append(names, record.Username)
+		}
+		return names
+	}
+	// 从旧到新读取，最新的失败登录排在最后
+	if got := usernames(lac.collectFailedLoginsFromAuthLog(time.Time{}, maxLoginRecords(config))); !slices.Equal(got, []string{"dave", "carol", "alice", "bob"}) {
+		t.Errorf("失败登录 = %v", got)
+	}
+	// 超过上限时保留最新的记录
+	config.LoginConfig.MaxLoginRecords = 2
+	if got := usernames(lac.collectFailedLoginsFromAuthLog(time.Time{}, maxLoginRecords(config))); !slices.Equal(got, []string{"alice", "bob"}) {
+		t.Errorf("截取后的失败登录 = %v", got)
+	}
+
+	// 成功登录的备用来源和认证方式同样读取配置的文件
+	config.LoginConfig.MaxLoginRecords = 100
+	config.LoginConfig.WtmpPath = filepath.Join(dir, "wtmp")
+	config.LoginConfig.BtmpPath = filepath.Join(dir, "btmp")
+	config.LoginConfig.UtmpPath = filepath.Join(dir, "utmp")
+	loginAt := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+	accepted := loginAt.Format(time.RFC3339) + " host sshd[1300]: Accepted password for erin from 203.0.113.5 port 40022 ssh2\n"
+	if err := os.WriteFile(filepath.Join(dir, "auth.log.1"), []byte(line("carol")+accepted), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(config.LoginConfig.WtmpPath, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	successful, err := lac.collectSuccessfulLogins(time.Time{}, maxLoginRecords(config))
+	if err != nil || len(successful) != 1 || successful[0].Username != "erin" {
+		t.Errorf("认证日志中的成功登录 = %+v, %v", successful, err)
+	}
+
+	wtmp := encodeUtmpEntry(utmpTypeUserProcess, "erin", "pts/0", "203.0.113.5", loginAt.Add(30*time.Second))
+	if err := os.WriteFile(config.LoginConfig.WtmpPath, wtmp, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	result := lac.CollectSince(time.Time{})
+	if got := result.Assets.SuccessfulLogins; len(got) != 1 || got[0].AuthMethod != protocol.AuthMethodPassword {
+		t.Errorf("补充认证方式的成功登录 = %+v", got)
+	}
+
+	// 没有匹配的文件时不回退到默认路径
+	config.LoginConfig.AuthLogPaths = []string{filepath.Join(dir, "secure*")}
+	if got := lac.authLogFiles(); len(got) != 0 {
+		t.Errorf("authLogFiles = %v", got)
+	}
+}
+
+// fakeLocationResolver 固定返回结果的归属地查询，status 为数据库状态
+type fakeLocationResolver struct {
+	status error
+}
+
+func (r *fakeLocationResolver) LookupIP(ip string) string { return "" }
+
+func (r *fakeLocationResolver) Status() error { return r.status }
+
+func TestDiagnose(t *testing.T) {
+	dir := t.TempDir()
+	config := DefaultConfig()
+	config.LoginConfig.WtmpPath = filepath.Join(dir, "wtmp")
+	config.LoginConfig.BtmpPath = filepath.Join(dir, "btmp")
+	config.LoginConfig.UtmpPath = filepath.Join(dir, "utmp")
+	config.LoginConfig.AuthLogPaths = []string{filepath.Join(dir, "secure*")}
+	if err := os.WriteFile(config.LoginConfig.WtmpPath, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(config.LoginConfig.WtmpPath, config.LoginConfig.UtmpPath); err != nil {
+		t.Fatal(err)
+	}
+
+	runner := &fakeCommandRunner{outputs: map[string]string{"last": "", "lastb": ""}, failing: []string{"lastb -n 1"}}
+	lac := NewLoginAssetsCollector(config, runner)
+	lac.lookPath = func(file string) (string, error) {
+		if file == "w" {
+			return "", exec.ErrNotFound
+		}
+		return "/usr/bin/" + file, nil
+	}
+
+	report := lac.Diagnose()
+	commands := make(map[string]protocol.CommandDiagnostic)
+	for _, command := range report.Commands {
+		commands[command.Name] = command
+	}
+	if c := commands["last"]; !c.Found || !c.Runnable || c.Path != "/usr/bin/last" {
+		t.Errorf("last = %+v", c)
+	}
+	if c := commands["lastb"]; !c.Found || c.Runnable || c.Error == "" {
+		t.Errorf("lastb = %+v", c)
+	}
+	if c := commands["w"]; c.Found || c.Runnable || c.Error == "" {
+		t.Errorf("w = %+v", c)
+	}
+	if slices.Contains(runner.calls, "w -h") {
+		t.Error("PATH 中不存在的命令不应执行")
+	}
+
+	files := make(map[string]protocol.FileDiagnostic)
+	for _, file := range report.Files {
+		files[file.Purpose] = file
+	}
+	if f := files["wtmp"]; !f.Exists || !f.Readable {
+		t.Errorf("wtmp = %+v", f)
+	}
+	if f := files["btmp"]; f.Exists || f.Readable || f.Error == "" {
+		t.Errorf("btmp = %+v", f)
+	}
+	// 与收集时相同，不跟随符号链接
+	if f := files["utmp"]; !f.Exists || f.Readable {
+		t.Errorf("utmp = %+v", f)
+	}
+	// 配置的认证日志没有匹配时报告模式本身
+	if f := files["auth_log"]; f.Path != config.LoginConfig.AuthLogPaths[0] || f.Exists {
+		t.Errorf("auth_log = %+v", f)
+	}
+
+	if report.GeoIP != nil {
+		t.Errorf("未设置归属地查询时不报告: %+v", report.GeoIP)
+	}
+	lac.SetLocationResolver(&fakeLocationResolver{status: errors.New("GeoIP database not loaded")})
+	if geoip := lac.Diagnose().GeoIP; geoip == nil || geoip.Loaded || geoip.Error != "GeoIP database not loaded" {
+		t.Errorf("GeoIP = %+v", geoip)
+	}
+	lac.SetLocationResolver(&fakeLocationResolver{})
+	if geoip := lac.Diagnose().GeoIP; geoip == nil || !geoip.Loaded {
+		t.Errorf("GeoIP = %+v", geoip)
+	}
+}
+
+func TestNormalizeSource(t *testing.T) {
+	for _, tc := range []struct {
+		raw, want string
+		local     bool
+	}{
+		{"", "localhost", true},
+		{"-", "localhost", true},
+		{":0", "localhost", true},
+		{":0.0", "localhost", true},
+		{":1", "localhost:1", true},
+		{":1.0", "localhost:1", true},
+		{":10.2", "localhost:10", true},
+		{"localhost", "localhost", true},
+		{"127.0.0.1", "127.0.0.1", false},
+		{"::1", "::1", false},
+		{"2001:db8::1", "2001:db8::1", false},
+		{"203.0.113.5", "203.0.113.5", false},
+		{"Bastion.Example.", "bastion.example", false},
+		{"localhost.example", "localhost.example", false},
+	} {
+		got := normalizeSource(tc.raw)
+		if got != tc.want || isLocalSource(got) != tc.local {
+			t.Errorf("normalizeSource(%q) = %q (本地 %v), 期望 %q (本地 %v)", tc.raw, got, isLocalSource(got), tc.want, tc.local)
+		}
+	}
+
+	// last、lastb、w 和 utmp 中相同的本地来源结果一致
+	runner := &fakeCommandRunner{outputs: map[string]string{
+		"last":  "alice    tty7         :1               Mon Mar  4 09:00:00 2024   still logged in\n",
+		"lastb": "bob      tty7         :1               Mon Mar  4 09:00:00 2024 - 09:00  (00:00)\n",
+		"w":     "carol    tty7     :1               09:00    1:00m  0.01s  0.00s -bash\n",
+	}}
+	lac := NewLoginAssetsCollector(DefaultConfig(), runner)
+	success := lac.parseLastOutput(runner.outputs["last"], 10)
+	failed := lac.parseLastbOutput(runner.outputs["lastb"], 10)
+	sessions, err := lac.collectCurrentSessions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry, err := parseUtmpEntry(encodeUtmpEntry(utmpTypeUserProcess, "dave", "tty7", ":1.0", time.Unix(1700000000, 0)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := []string{success[0].IP, failed[0].IP, sessions[0].IP, entry.toLoginRecord("success").IP}
+	if !slices.Equal(got, []string{"localhost:1", "localhost:1", "localhost:1", "localhost:1"}) {
+		t.Errorf("本地来源 = %v", got)
+	}
+}
+
+func TestUnicodeUsernamesAndHostnames(t *testing.T) {
+	lac := NewLoginAssetsCollector(DefaultConfig(), NewCommandExecutor(time.Second))
+
+	data, err := os.ReadFile(filepath.Join("testdata", "auth_unicode.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+
+	for i, want := range []struct{ username, ip string }{
+		{"jörg müller", "203.0.113.9"},
+		{"用户", "xn--bcher-kva.example"},
+	} {
+		record := lac.parseFailedLoginFromLog(lines[i])
+		if record.Username != want.username || record.IP != want.ip {
+			t.Errorf("第 %d 行: 用户 %q 来源 %q, 期望 %q %q", i+1, record.Username, record.IP, want.username, want.ip)
+		}
+	}
+
+	accepted, ok := lac.parseAcceptedLine(lines[2])
+	if !ok || accepted.username != "josé" || accepted.ip != "xn--mnchen-3ya.example.com" {
+		t.Errorf("认证成功 = %+v", accepted)
+	}
+
+	// lastb 输出的用户名同样规范化为有效的 UTF-8
+	lastb, err := os.ReadFile(filepath.Join("testdata", "lastb_unicode.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	failed := lac.parseLastbOutput(string(lastb), 10)
+	if len(failed) != 3 {
+		t.Fatalf("lastb 记录 = %+v", failed)
+	}
+	for i, want := range []string{"josé", "用户", "运维"} {
+		if failed[i].Username != want {
+			t.Errorf("lastb 第 %d 条用户名 = %q, 期望 %q", i+1, failed[i].Username, want)
+		}
+	}
+
+	// utmp 用户名字段只有 32 字节，截断落在多字节字符中间
+	long := "δοκιμαστής-χρήστης"
+	entry, err := parseUtmpEntry(encodeUtmpEntry(utmpTypeUserProcess, long, "pts/0", "Bücher.example", time.Unix(1700000000, 0)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	record := entry.toLoginRecord("success")
+	if !utf8.ValidString(record.Username) || !strings.HasPrefix(long, record.Username) || len(record.Username) > utmpUserSize {
+		t.Errorf("截断的用户名 = %q", record.Username)
+	}
+	if record.IP != "xn--bcher-kva.example" {
+		t.Errorf("来源 = %q", record.IP)
+	}
+
+	// 同一 IDN 主机的 Unicode 和 punycode 写法匹配同一个堡垒机配置
+	matcher := newSourceMatcher([]string{"Bastion.Bücher.example"})
+	if _, ok := matcher.Match("bastion.xn--bcher-kva.example", ""); !ok {
+		t.Error("punycode 写法应匹配 Unicode 配置")
+	}
+
+	for input, want := range map[string]string{
+		"abc\xe4\xbd": "abc",
+		"a\xffb":      "a\uFFFDb",
+		"完整":          "完整",
+	} {
+		if got := sanitizeUTF8(input); got != want {
+			t.Errorf("sanitizeUTF8(%q) = %q, 期望 %q", input, got, want)
+		}
+	}
+}
+
+func TestAnalyzeArchive(t *testing.T) {
+	config := DefaultConfig()
+	config.LoginConfig.BastionSources = []string{"10.0.0.10"}
+	config.LoginConfig.RecordTransforms = []string{TransformLowercaseUser}
+	config.LoginConfig.TimeZone = "Asia/Shanghai"
+
+	// 反序列化得到的历史数据: 间隔固定的失败尝试、一次绕过堡垒机的登录和一个长期空闲的 root 会话
+	base := time.Date(2025, time.June, 1, 3, 0, 0, 0, time.UTC).UnixMilli()
+	var records []protocol.LoginRecord
+	for i := 0; i < 8; i++ {
+		records = append(records, protocol.LoginRecord{Username: "admin", IP: "198.51.100.3", Terminal: "ssh:notty", Timestamp: base + int64(i)*10000, Status: "failed"})
+	}
+	records = append(records,
+		protocol.LoginRecord{Username: "Ops", IP: "10.0.0.10", Terminal: "pts/0", Timestamp: base, Status: "success"},
+		protocol.LoginRecord{Username: "Ops", IP: "10.0.0.99", Terminal: "pts/1", Timestamp: base + 60000, Status: "success"},
+	)
+	sessions := []protocol.LoginSession{{Username: "root", Terminal: "pts/2", IP: "10.0.0.10", IdleTime: 12 * 3600}}
+
+	assets := AnalyzeArchive(records, sessions, config)
+
+	if len(assets.FailedLogins) != 8 || len(assets.SuccessfulLogins) != 2 {
+		t.Fatalf("成功 %d 失败 %d", len(assets.SuccessfulLogins), len(assets.FailedLogins))
+	}
+	stats := assets.Statistics
+	if stats == nil || len(stats.ScriptedAttacks) != 1 || len(stats.BastionBypasses) != 1 || stats.StaleRootSessions != 1 {
+		t.Fatalf("统计 = %+v", stats)
+	}
+	if stats.BastionBypasses[0].IP != "10.0.0.99" || stats.BastionBypasses[0].Username != "ops" {
+		t.Errorf("绕过 = %+v", stats.BastionBypasses[0])
+	}
+	if !assets.CurrentSessions[0].IsStale {
+		t.Errorf("会话 = %+v", assets.CurrentSessions[0])
+	}
+	for _, record := range assets.SuccessfulLogins {
+		if record.RecordID != protocol.LoginRecordID(record) {
+			t.Errorf("记录标识 = %+v", record)
+		}
+	}
+
+	// 传入的数据不被修改
+	if records[8].Username != "Ops" || records[8].RecordID != "" || sessions[0].IsStale {
+		t.Error("AnalyzeArchive 修改了传入的数据")
+	}
+
+	// 按配置的时区分析: 03:00 UTC 为上海时间 11:00，不属于夜间
+	analyzer := newTimingPatternAnalyzer(config)
+	if got := time.UnixMilli(base).In(analyzer.location).Hour(); got != 11 {
+		t.Errorf("分析时区的小时 = %d", got)
+	}
+}
+
+func TestUserSummaries(t *testing.T) {
+	base := time.Date(2024, 3, 4, 10, 0, 0, 0, time.UTC).UnixMilli()
+	records := []protocol.LoginRecord{
+		{Username: "alice", IP: "203.0.113.7", Terminal: "pts/0", Timestamp: base, Status: "success"},
+		{Username: "alice", IP: "198.51.100.1", Terminal: "pts/1", Timestamp: base + 3600000, Status: "success"},
+		{Username: "alice", IP: "203.0.113.7", Terminal: "pts/2", Timestamp: base + 1800000, Status: "success"},
+		{Username: "bob", IP: "192.0.2.4", Terminal: "pts/3", Timestamp: base + 60000, Status: "success"},
+		{Username: "alice", IP: "192.0.2.9", Terminal: "ssh:notty", Timestamp: base - 60000, Status: "failed"},
+		{Username: "admin", IP: "192.0.2.9", Terminal: "ssh:notty", Timestamp: base - 30000, Status: "failed"},
+	}
+	sessions := []protocol.LoginSession{
+		{Username: "alice", Terminal: "pts/1", IP: "198.51.100.1", LoginTime: base + 3600000},
+		{Username: "bob", Terminal: "pts/3", IP: "192.0.2.4", LoginTime: base + 60000, IsStale: true},
+	}
+
+	assets := &protocol.LoginAssets{SuccessfulLogins: records[:4], FailedLogins: records[4:], CurrentSessions: sessions}
+	lac := NewLoginAssetsCollector(DefaultConfig(), NewCommandExecutor(time.Second))
+	assets.Statistics = lac.calculateStatistics(assets)
+	want := []protocol.UserLoginSummary{
+		{Username: "admin", FailedLogins: 1},
+		{Username: "alice", SuccessfulLogins: 3, FailedLogins: 1, SourceIPs: []string{"198.51.100.1", "203.0.113.7"},
+			FirstLogin: base, LastLogin: base + 3600000, HasActiveSession: true},
+		{Username: "bob", SuccessfulLogins: 1, SourceIPs: []string{"192.0.2.4"}, FirstLogin: base + 60000, LastLogin: base + 60000},
+	}
+	if !reflect.DeepEqual(assets.UserSummaries, want) {
+		t.Fatalf("用户汇总 = %+v", assets.UserSummaries)
+	}
+
+	// 增量只保留变化的汇总
+	current := *assets
+	current.UserSummaries = append([]protocol.UserLoginSummary(nil), want...)
+	current.UserSummaries[2].HasActiveSession = true
+	delta := ComputeDelta(assets, &current)
+	if len(delta.UserSummaries) != 1 || delta.UserSummaries[0].Username != "bob" {
+		t.Errorf("增量汇总 = %+v", delta.UserSummaries)
+	}
+}
+
+func TestUserFilter(t *testing.T) {
+	config := DefaultConfig()
+	config.LoginConfig.IncludeUsers = []string{"ops-*", "root"}
+	config.LoginConfig.ExcludeUsers = []string{"ops-monitor", "[bad"}
+	lac := NewLoginAssetsCollector(config, NewCommandExecutor(time.Second))
+
+	assets := &protocol.LoginAssets{
+		SuccessfulLogins: []protocol.LoginRecord{
+			{Username: "ops-alice", IP: "203.0.113.7", Terminal: "pts/0", Timestamp: 1000, Status: "success"},
+			{Username: "ops-monitor", IP: "192.0.2.1", Terminal: "pts/1", Timestamp: 2000, Status: "success"},
+			{Username: "bob", IP: "192.0.2.4", Terminal: "pts/2", Timestamp: 3000, Status: "success"},
+		},
+		FailedLogins: []protocol.LoginRecord{
+			{Username: "root", IP: "192.0.2.9", Terminal: "ssh:notty", Timestamp: 4000, Status: "failed"},
+			{Username: "admin", IP: "192.0.2.9", Terminal: "ssh:notty", Timestamp: 5000, Status: "failed"},
+		},
+		CurrentSessions: []protocol.LoginSession{
+			{Username: "ops-alice", Terminal: "pts/0", IP: "203.0.113.7"},
+			{Username: "ops-monitor", Terminal: "pts/1", IP: "192.0.2.1"},
+		},
+		LastLogins: []protocol.LastLoginEntry{
+			{Username: "root", Port: "pts/0", Latest: 1000},
+			{Username: "nobody", NeverLoggedIn: true},
+		},
+		AccountLockouts: []protocol.AccountLockout{
+			{Username: "ops-bob", Module: "pam_faillock", Source: "faillock", Locked: true},
+			{Username: "ops-monitor", Module: "pam_faillock", Source: "faillock", Locked: true},
+		},
+	}
+	lac.normalize(assets)
+	if len(assets.SuccessfulLogins) != 1 || assets.SuccessfulLogins[0].Username != "ops-alice" {
+		t.Errorf("成功登录 = %+v", assets.SuccessfulLogins)
+	}
+	if len(assets.FailedLogins) != 1 || assets.FailedLogins[0].Username != "root" {
+		t.Errorf("失败登录 = %+v", assets.FailedLogins)
+	}
+	if len(assets.CurrentSessions) != 1 || assets.CurrentSessions[0].Username != "ops-alice" {
+		t.Errorf("当前会话 = %+v", assets.CurrentSessions)
+	}
+	if len(assets.LastLogins) != 1 || assets.LastLogins[0].Username != "root" {
+		t.Errorf("最近登录 = %+v", assets.LastLogins)
+	}
+	if len(assets.AccountLockouts) != 1 || assets.AccountLockouts[0].Username != "ops-bob" {
+		t.Errorf("账户锁定 = %+v", assets.AccountLockouts)
+	}
+
+	// 提权记录按发起提权的用户过滤
+	config.LoginConfig.IncludeUsers = []string{"alice", "carol"}
+	lac = NewLoginAssetsCollector(config, NewCommandExecutor(time.Second))
+	file, err := os.Open(filepath.Join("testdata", "auth_privilege.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	escalations, err := lac.scanPrivilegeEscalations(file, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(escalations) != 2 || escalations[0].Username != "carol" || escalations[1].Username != "alice" {
+		t.Errorf("提权记录 = %+v", escalations)
+	}
+
+	// 白名单条目全部无效时仍为严格白名单
+	if f := newUserFilter([]string{"[bad"}, nil); f.Allows("root") {
+		t.Error("无效白名单不应放行用户")
+	}
+	if f := newUserFilter(nil, nil); f != nil || !f.Allows("root") {
+		t.Error("未配置过滤时应保留所有用户")
+	}
+	if f := newUserFilter(nil, []string{"svc-?"}); f.Allows("svc-a") || !f.Allows("svc-ab") {
+		t.Error("黑名单通配符匹配错误")
+	}
+}
+
+func TestHighFrequencyIPRate(t *testing.T) {
+	config := DefaultConfig()
+	config.LoginConfig.HighFrequencyIPThreshold = 10
+
+	base := time.Date(2024, 3, 4, 10, 0, 0, 0, time.UTC)
+	var records []protocol.LoginRecord
+	for i := 0; i < 10; i++ {
+		// 一分钟内10次
+		records = append(records, protocol.LoginRecord{Username: "ops", IP: "203.0.113.7", Status: "success",
+			Timestamp: base.Add(time.Duration(i) * 6 * time.Second).UnixMilli()})
+		// 一个月内10次
+		records = append(records, protocol.LoginRecord{Username: "ops", IP: "198.51.100.1", Status: "success",
+			Timestamp: base.AddDate(0, 0, -3*i).UnixMilli()})
+	}
+	// 一天内30次，每小时1.25次
+	for i := 0; i < 30; i++ {
+		records = append(records, protocol.LoginRecord{Username: "ops", IP: "192.0.2.9", Status: "success",
+			Timestamp: base.Add(-time.Duration(i) * 48 * time.Minute).UnixMilli()})
+	}
+
+	assets := AnalyzeArchive(records, nil, config)
+	stats := assets.Statistics
+	if len(stats.HighFrequencyIPs) != 1 {
+		t.Fatalf("高频IP = %+v", stats.HighFrequencyIPs)
+	}
+	spike := stats.HighFrequencyIPs[0]
+	if spike.IP != "203.0.113.7" || spike.Count != 10 || spike.RatePerHour != 10 ||
+		spike.FirstLogin != base.UnixMilli() || spike.LastLogin != base.Add(54*time.Second).UnixMilli() {
+		t.Errorf("突发登录 = %+v", spike)
+	}
+
+	lac := &LoginAssetsCollector{config: config, analyzers: defaultLoginAnalyzers(config, time.Now)}
+	for _, tt := range []struct {
+		ip    string
+		fired bool
+	}{
+		{"203.0.113.7", true},
+		{"198.51.100.1", false},
+		{"192.0.2.9", false},
+	} {
+		for _, explanation := range lac.Explain(assets, protocol.LoginRecord{IP: tt.ip, Status: "success"}) {
+			if explanation.Analyzer == "high-frequency-ip" && explanation.Fired != tt.fired {
+				t.Errorf("%s: %+v", tt.ip, explanation)
+			}
+		}
+	}
+}
+
+func TestNATEgressSources(t *testing.T) {
+	config := DefaultConfig()
+	config.LoginConfig.NATEgressSources = []string{"198.51.100.0/28", "office-gw.example.com"}
+	config.LoginConfig.HighFrequencyIPThreshold = 3
+	config.LoginConfig.TerminalBurstThreshold = 3
+
+	base := time.Date(2024, 3, 4, 10, 0, 0, 0, time.UTC).UnixMilli()
+	var records []protocol.LoginRecord
+	for i := 0; i < 5; i++ {
+		for _, ip := range []string{"198.51.100.5", "203.0.113.7"} {
+			records = append(records, protocol.LoginRecord{
+				Username:  fmt.Sprintf("user%d", i),
+				IP:        ip,
+				Terminal:  fmt.Sprintf("pts/%d", i),
+				Timestamp: base + int64(i)*1000,
+				Status:    "success",
+			})
+		}
+	}
+	sessions := []protocol.LoginSession{
+		{Username: "user0", Terminal: "pts/0", IP: "office-gw.example.com"},
+		{Username: "user1", Terminal: "pts/1", IP: "203.0.113.7"},
+	}
+
+	assets := AnalyzeArchive(records, sessions, config)
+	for _, record := range assets.SuccessfulLogins {
+		if want := record.IP == "198.51.100.5"; record.BehindNAT != want {
+			t.Errorf("%s: BehindNAT = %v", record.IP, record.BehindNAT)
+		}
+	}
+	if !assets.CurrentSessions[0].BehindNAT || assets.CurrentSessions[1].BehindNAT {
+		t.Errorf("会话 = %+v", assets.CurrentSessions)
+	}
+
+	// NAT 出口不参与按来源IP的判断，普通来源不受影响
+	stats := assets.Statistics
+	if len(stats.HighFrequencyIPs) != 1 || stats.HighFrequencyIPs[0].IP != "203.0.113.7" || stats.HighFrequencyIPs[0].Count != 5 {
+		t.Errorf("高频IP = %v", stats.HighFrequencyIPs)
+	}
+	if len(stats.AutomationSuspicions) != 1 || stats.AutomationSuspicions[0].IP != "203.0.113.7" {
+		t.Errorf("终端突发 = %+v", stats.AutomationSuspicions)
+	}
+
+	lac := &LoginAssetsCollector{config: config, analyzers: defaultLoginAnalyzers(config, time.Now)}
+	for _, explanation := range lac.Explain(assets, assets.SuccessfulLogins[0]) {
+		if explanation.Fired {
+			t.Errorf("NAT 来源不应命中: %+v", explanation)
+		}
+	}
+
+	// 未配置时不标记
+	for _, record := range AnalyzeArchive(records, nil, DefaultConfig()).SuccessfulLogins {
+		if record.BehindNAT {
+			t.Fatalf("未配置 NAT 出口时不应标记: %+v", record)
+		}
+	}
+}
+
+func TestComputeDelta(t *testing.T) {
+	login := func(user string, minute int) protocol.LoginRecord {
+		record := protocol.LoginRecord{Username: user, IP: "203.0.113.7", Terminal: "pts/0", Timestamp: int64(minute) * 60000, Status: "success"}
+		record.RecordID = protocol.LoginRecordID(record)
+		return record
+	}
+	session := func(user, terminal string, idle int) protocol.LoginSession {
+		return protocol.LoginSession{Username: user, Terminal: terminal, IP: "203.0.113.7", LoginTime: 60000, IdleTime: idle}
+	}
+	policy := &protocol.SSHDPolicy{PermitRootLogin: "no"}
+
+	previous := &protocol.LoginAssets{
+		SuccessfulLogins: []protocol.LoginRecord{login("alice", 1), login("bob", 2)},
+		CurrentSessions:  []protocol.LoginSession{session("alice", "pts/0", 0), session("bob", "pts/1", 0)},
+		SSHDPolicy:       policy,
+		Statistics: &protocol.LoginStatistics{
+			TotalLogins:      2,
+			HighFrequencyIPs: []protocol.HighFrequencyIP{{IP: "203.0.113.7", Count: 11, RatePerHour: 11}},
+			BastionBypasses:  []protocol.BastionBypass{{Username: "bob", IP: "203.0.113.7", Timestamp: 120000}},
+		},
+	}
+	current := &protocol.LoginAssets{
+		SuccessfulLogins: []protocol.LoginRecord{login("alice", 1), login("bob", 2), login("carol", 3)},
+		// 空闲时间变化不视为新会话
+		CurrentSessions: []protocol.LoginSession{session("alice", "pts/0", 300), session("carol", "pts/2", 0)},
+		SSHDPolicy:      &protocol.SSHDPolicy{PermitRootLogin: "no"},
+		Trimmed:         &protocol.PayloadTrimming{MaxBytes: 4096, OriginalBytes: 8192, TrimmedBytes: 4000, DroppedSuccessfulLogins: 2},
+		Statistics: &protocol.LoginStatistics{
+			TotalLogins:      3,
+			HighFrequencyIPs: []protocol.HighFrequencyIP{{IP: "203.0.113.7", Count: 12, RatePerHour: 12}, {IP: "198.51.100.1", Count: 11, RatePerHour: 11}},
+			BastionBypasses: []protocol.BastionBypass{
+				{Username: "bob", IP: "203.0.113.7", Timestamp: 120000},
+				{Username: "carol", IP: "203.0.113.7", Timestamp: 180000},
+			},
+		},
+	}
+
+	delta := ComputeDelta(previous, current)
+	if len(delta.SuccessfulLogins) != 1 || delta.SuccessfulLogins[0].Username != "carol" {
+		t.Errorf("新增登录 = %+v", delta.SuccessfulLogins)
+	}
+	if len(delta.CurrentSessions) != 1 || delta.CurrentSessions[0].Username != "carol" {
+		t.Errorf("新增会话 = %+v", delta.CurrentSessions)
+	}
+	if len(delta.EndedSessions) != 1 || delta.EndedSessions[0].Username != "bob" {
+		t.Errorf("结束会话 = %+v", delta.EndedSessions)
+	}
+	if delta.SSHDPolicy != nil {
+		t.Errorf("未变化的快照应省略: %+v", delta.SSHDPolicy)
+	}
+	if delta.Trimmed == nil || *delta.Trimmed != *current.Trimmed || delta.Trimmed == current.Trimmed {
+		t.Errorf("裁剪信息应复制 current 的值: %+v", delta.Trimmed)
+	}
+	stats := delta.Statistics
+	if stats.TotalLogins != 3 || len(stats.HighFrequencyIPs) != 1 || stats.HighFrequencyIPs[0].IP != "198.51.100.1" {
+		t.Errorf("统计 = %+v", stats)
+	}
+	if len(stats.BastionBypasses) != 1 || stats.BastionBypasses[0].Username != "carol" {
+		t.Errorf("新增告警 = %+v", stats.BastionBypasses)
+	}
+
+	// 输入不被修改
+	if len(current.CurrentSessions) != 2 || len(current.Statistics.BastionBypasses) != 2 || len(current.Statistics.HighFrequencyIPs) != 2 {
+		t.Error("current 被修改")
+	}
+
+	// 没有上次结果时返回全部内容
+	full := ComputeDelta(nil, current)
+	if len(full.SuccessfulLogins) != 3 || len(full.CurrentSessions) != 2 || full.SSHDPolicy == nil || len(full.EndedSessions) != 0 {
+		t.Errorf("全量 = %+v", full)
+	}
+	if ComputeDelta(previous, nil) != nil {
+		t.Error("current 为 nil 时应返回 nil")
+	}
+}
+
+func TestLongLivedSessionAnalyzer(t *testing.T) {
+	now := time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+	config := DefaultConfig()
+	config.LoginConfig.ServiceAccounts = []string{"deploy"}
+	config.LoginConfig.SessionMaxAge = SessionMaxAgeConfig{Root: 12 * time.Hour, Service: 24 * time.Hour, Human: 72 * time.Hour}
+	analyzer := newLongLivedSessionAnalyzer(config, func() time.Time { return now })
+
+	session := func(user string, age time.Duration) protocol.LoginSession {
+		return protocol.LoginSession{Username: user, Terminal: "pts/0", IP: "203.0.113.7", LoginTime: now.Add(-age).UnixMilli()}
+	}
+	assets := &protocol.LoginAssets{CurrentSessions: []protocol.LoginSession{
+		session("root", 13*time.Hour),   // 超过 root 上限
+		session("deploy", 13*time.Hour), // 服务账户未超限
+		session("deploy", 30*time.Hour), // 超过服务账户上限
+		session("alice", 30*time.Hour),  // 普通用户未超限
+		session("alice", 100*time.Hour), // 超过普通用户上限
+	}}
+
+	findings := analyzer.Analyze(assets)
+	if len(findings) != 3 {
+		t.Fatalf("超长会话 = %+v", findings)
+	}
+	// 按持续时间从长到短
+	for i, want := range []struct{ user, class string }{
+		{"alice", protocol.AccountClassHuman},
+		{"deploy", protocol.AccountClassService},
+		{"root", protocol.AccountClassRoot},
+	} {
+		if findings[i].Username != want.user || findings[i].AccountClass != want.class {
+			t.Errorf("第 %d 条 = %+v", i, findings[i])
+		}
+	}
+	if findings[2].AgeSeconds != 13*3600 || findings[2].MaxAgeSeconds != 12*3600 {
+		t.Errorf("root 时长 = %+v", findings[2])
+	}
+
+	lac := &LoginAssetsCollector{config: config, analyzers: []LoginAnalyzer{analyzer}}
+	for i, session := range assets.CurrentSessions {
+		explanation := lac.ExplainSession(assets, session)[0]
+		if want := i%2 == 0; explanation.Fired != want {
+			t.Errorf("会话 %d: %+v", i, explanation)
+		}
+	}
+
+	// 上限为 0 时不检查该类别
+	config.LoginConfig.SessionMaxAge.Root = 0
+	if findings := newLongLivedSessionAnalyzer(config, func() time.Time { return now }).Analyze(assets); len(findings) != 2 {
+		t.Errorf("关闭 root 检查后 = %+v", findings)
+	}
+}
+
+// countingRecorder 记录计数器的累计值
+type countingRecorder struct {
+	counters map[string]int64
+}
+
+func (r *countingRecorder) AddCounter(name string, labels map[string]string, delta int64) {
+	r.counters[name+"/"+labels["analyzer"]] += delta
+}
+
+func TestAnalyzerMetrics(t *testing.T) {
+	config := DefaultConfig()
+	config.LoginConfig.HighFrequencyIPThreshold = 2
+	lac := NewLoginAssetsCollector(config, NewCommandExecutor(time.Second))
+	recorder := &countingRecorder{counters: make(map[string]int64)}
+	lac.SetMetricsRecorder(recorder)
+
+	assets := &protocol.LoginAssets{}
+	for _, ip := range []string{"203.0.113.7", "203.0.113.7", "203.0.113.7", "198.51.100.1", "198.51.100.1", "198.51.100.1", "192.0.2.1"} {
+		assets.SuccessfulLogins = append(assets.SuccessfulLogins, protocol.LoginRecord{Username: "ops", IP: ip, Terminal: "pts/0", Status: "success"})
+	}
+	for i := 0; i < 2; i++ {
+		lac.calculateStatistics(assets)
+	}
+
+	for key, want := range map[string]int64{
+		MetricAnalyzerEvaluations + "/high-frequency-ip": 2,
+		MetricAnalyzerFirings + "/high-frequency-ip":     4,
+		MetricAnalyzerEvaluations + "/terminal-burst":    2,
+		MetricAnalyzerFirings + "/terminal-burst":        0,
+	} {
+		if got := recorder.counters[key]; got != want {
+			t.Errorf("%s = %d, 期望 %d", key, got, want)
+		}
+	}
+}
+
+func TestAnalyzerExplanationsMatchFindings(t *testing.T) {
+	now := time.Date(2024, 3, 6, 12, 0, 0, 0, time.UTC)
+	config := DefaultConfig()
+	config.LoginConfig.TimeZone = "UTC"
+	config.LoginConfig.KeyOnlyAuth = true
+	config.LoginConfig.BastionSources = []string{"10.0.0.0/8"}
+	config.LoginConfig.ExpectedCountries = []string{"China"}
+	config.LoginConfig.SharedAccounts = map[string]SharedAccountPolicy{"alice": {MaxNetworks: 1}}
+	lac := NewLoginAssetsCollector(config, NewCommandExecutor(time.Second))
+	lac.SetClock(func() time.Time { return now })
+
+	// 夜间 (工作时间以外) 一分钟内来自同一来源的大量密码登录，当前会话都有对应的登录记录
+	overnight := time.Date(2024, 3, 6, 2, 0, 0, 0, time.UTC)
+	noisy := &protocol.LoginAssets{
+		CurrentSessions: []protocol.LoginSession{
+			{Username: "alice", Terminal: "pts/0", IP: "203.0.113.7", LoginTime: overnight.UnixMilli()},
+			{Username: "alice", Terminal: "pts/30", IP: "198.51.100.4", LoginTime: now.Add(-24 * time.Hour).UnixMilli()},
+			{Username: "root", Terminal: "pts/31", IP: "192.0.2.9", LoginTime: now.Add(-30 * time.Hour).UnixMilli()},
+		},
+	}
+	for i := 0; i < 21; i++ {
+		noisy.SuccessfulLogins = append(noisy.SuccessfulLogins, protocol.LoginRecord{
+			Username: "alice", IP: "203.0.113.7", Terminal: fmt.Sprintf("pts/%d", i), Location: "Germany-Hesse",
+			AuthMethod: "password", Status: "success", Timestamp: overnight.Add(time.Duration(i) * 2 * time.Second).UnixMilli(),
+		})
+	}
+	for _, session := range noisy.CurrentSessions[1:] {
+		noisy.SuccessfulLogins = append(noisy.SuccessfulLogins, protocol.LoginRecord{
+			Username: session.Username, IP: session.IP, Terminal: session.Terminal, Status: "success",
+			Timestamp: session.LoginTime, EndReason: "still_logged_in",
+		})
+	}
+	// 间隔完全相同的失败登录
+	for i := 0; i < 12; i++ {
+		noisy.FailedLogins = append(noisy.FailedLogins, protocol.LoginRecord{
+			Username: "root", IP: "192.0.2.50", Terminal: "ssh:notty", Status: "failed", Timestamp: now.Add(time.Duration(i) * 5 * time.Second).UnixMilli(),
+		})
+	}
+
+	quiet := &protocol.LoginAssets{
+		CurrentSessions: []protocol.LoginSession{
+			{Username: "bob", Terminal: "pts/0", IP: "10.1.2.3", LoginTime: now.Add(-2 * time.Hour).UnixMilli()},
+		},
+		SuccessfulLogins: []protocol.LoginRecord{
+			{Username: "bob", IP: "10.1.2.3", Terminal: "pts/0", AuthMethod: "publickey", Status: "success", Timestamp: now.Add(-2 * time.Hour).UnixMilli()},
+		},
+		FailedLogins: []protocol.LoginRecord{
+			{Username: "bob", IP: "10.1.2.3", Terminal: "ssh:notty", Status: "failed", Timestamp: now.Add(-3 * time.Hour).UnixMilli()},
+		},
+	}
+
+	for name, tt := range map[string]struct {
+		assets   *protocol.LoginAssets
+		findings bool
+	}{
+		"noisy": {noisy, true},
+		"quiet": {quiet, false},
+	} {
+		var records []protocol.LoginRecord
+		var explanations [][]AnalyzerExplanation
+		for _, record := range slices.Concat(tt.assets.SuccessfulLogins, tt.assets.FailedLogins) {
+			records = append(records, record)
+			explanations = append(explanations, lac.Explain(tt.assets, record))
+		}
+		for _, session := range tt.assets.CurrentSessions {
+			records = append(records, protocol.LoginRecord{Username: session.Username, IP: session.IP, Status: "session"})
+			explanations = append(explanations, lac.ExplainSession(tt.assets, session))
+		}
+
+		for i, analyzer := range lac.analyzers {
+			for j := range records {
+				if got := explanations[j][i]; got.Analyzer != analyzer.Name() || got.Detail == "" {
+					t.Fatalf("%s: 第 %d 条记录的解释 = %+v, 期望 %s", name, j, got, analyzer.Name())
+				}
+			}
+
+			stats := &protocol.LoginStatistics{}
+			analyzer.(findingAnalyzer).AnalyzeInto(tt.assets, stats)
+			if got := analyzerFindings(stats) > 0; got != tt.findings {
+				t.Errorf("%s: %s 告警 = %t, 期望 %t", name, analyzer.Name(), got, tt.findings)
+			}
+
+			// 命中的记录必须出现在告警中，有告警时至少一条记录命中
+			keys := findingKeys(stats)
+			fired := false
+			for j, record := range records {
+				if !explanations[j][i].Fired {
+					continue
+				}
+				fired = true
+				status := "success"
+				if record.Status == "failed" {
+					status = "failed"
+				}
+				if !keys[record.IP] && !keys[record.Username] && !keys["status:"+status] {
+					t.Errorf("%s: %s 命中了告警以外的记录 %+v: %s", name, analyzer.Name(), record, explanations[j][i].Detail)
+				}
+			}
+			if fired != tt.findings {
+				t.Errorf("%s: %s 记录命中 = %t, 期望 %t", name, analyzer.Name(), fired, tt.findings)
+			}
+		}
+	}
+}
+
+// findingKeys 告警涉及的来源IP、用户名和时段规律的登录结果
+func findingKeys(stats *protocol.LoginStatistics) map[string]bool {
+	keys := make(map[string]bool)
+	for _, f := range stats.HighFrequencyIPs {
+		keys[f.IP] = true
+	}
+	for _, f := range stats.AutomationSuspicions {
+		keys[f.IP] = true
+	}
+	for _, f := range stats.ScriptedAttacks {
+		keys[f.IP] = true
+	}
+	for _, f := range stats.BruteForceAttempts {
+		keys[f.IP] = true
+	}
+	for _, f := range stats.TimingPatterns {
+		keys["status:"+f.Status] = true
+	}
+	for _, f := range stats.LongLivedSessions {
+		keys[f.Username] = true
+	}
+	for _, f := range stats.ConcurrentAccess {
+		keys[f.Username] = true
+	}
+	for _, f := range stats.SharedAccountAlerts {
+		keys[f.Username] = true
+	}
+	for _, f := range stats.UnexpectedAuthMethods {
+		keys[f.Username] = true
+	}
+	for _, f := range stats.BastionBypasses {
+		keys[f.IP] = true
+	}
+	for _, f := range slices.Concat(stats.OffHoursLogins, stats.ForeignLogins) {
+		keys[f.IP] = true
+	}
+	return keys
+}
+
+func TestDensestWindow(t *testing.T) {
+	base := time.Date(2024, 3, 4, 10, 0, 0, 0, time.UTC).UnixMilli()
+	var logins []protocol.LoginRecord
+	for _, second := range []int64{0, 10, 20, 70, 75, 80, 85} {
+		logins = append(logins, protocol.LoginRecord{Timestamp: base + second*1000})
+	}
+
+	for _, tt := range []struct {
+		name       string
+		within     int64
+		start, end int
+	}{
+		// 窗口两端都包含：20s 与 80s 相差正好 1 分钟
+		{"最密集的窗口", 0, 2, 5},
+		{"包含第一条记录的窗口", base, 0, 2},
+		{"包含最后一条记录的窗口", base + 85000, 3, 6},
+	} {
+		start, end := densestWindow(logins, time.Minute, tt.within)
+		if start != tt.start || end != tt.end {
+			t.Errorf("%s: [%d, %d], 期望 [%d, %d]", tt.name, start, end, tt.start, tt.end)
+		}
+	}
+	if start, end := densestWindow(nil, time.Minute, 0); end-start+1 != 0 {
+		t.Errorf("没有记录时 = [%d, %d]", start, end)
+	}
+}
+
+func TestTerminalBurstAnalyzer(t *testing.T) {
+	config := DefaultConfig()
+	config.LoginConfig.TerminalBurstWindow = time.Minute
+	config.LoginConfig.TerminalBurstThreshold = 3
+	analyzer := newTerminalBurstAnalyzer(config)
+
+	base := time.Date(2024, 3, 4, 10, 0, 0, 0, time.UTC).UnixMilli()
+	logins := func(ip string, n int, natted bool) []protocol.LoginRecord {
+		var records []protocol.LoginRecord
+		for i := 0; i < n; i++ {
+			records = append(records, protocol.LoginRecord{
+				Username:  "deploy",
+				IP:        ip,
+				Terminal:  fmt.Sprintf("pts/%d", i),
+				Timestamp: base + int64(i)*10000,
+				Status:    "success",
+				BehindNAT: natted,
+			})
+		}
+		return records
+	}
+
+	var records []protocol.LoginRecord
+	records = append(records, logins("203.0.113.7", 3, false)...)  // 等于阈值，不告警
+	records = append(records, logins("198.51.100.4", 4, false)...) // 超过阈值
+	records = append(records, logins("192.0.2.1", 6, true)...)     // NAT 出口
+	// 本地终端模拟器和非交互会话不计入
+	records = append(records,
+		protocol.LoginRecord{Username: "deploy", IP: localSource, Terminal: "pts/9", Timestamp: base},
+		protocol.LoginRecord{Username: "deploy", IP: "198.51.100.4", Terminal: "ssh:notty", Timestamp: base + 1000},
+	)
+	assets := &protocol.LoginAssets{SuccessfulLogins: records}
+
+	suspicions := analyzer.Analyze(assets)
+	if len(suspicions) != 1 {
+		t.Fatalf("告警 = %+v", suspicions)
+	}
+	if got := suspicions[0]; got.IP != "198.51.100.4" || got.TerminalCount != 4 || got.WindowStart != base || got.WindowEnd != base+30000 ||
+		!slices.Equal(got.Terminals, []string{"pts/0", "pts/1", "pts/2", "pts/3"}) || !slices.Equal(got.Usernames, []string{"deploy"}) {
+		t.Errorf("告警 = %+v", got)
+	}
+
+	// Explain 与 Analyze 一致
+	for _, record := range records {
+		fired := analyzer.Explain(assets, record).Fired
+		if want := record.IP == "198.51.100.4" && record.Terminal != "ssh:notty"; fired != want {
+			t.Errorf("%s %s: Fired = %v", record.IP, record.Terminal, fired)
+		}
+	}
+}
+
+func TestClassifyTerminal(t *testing.T) {
+	for terminal, want := range map[string]string{
+		"pts/0":     TerminalTypeNetwork,
+		"ssh:notty": TerminalTypeNetwork,
+		"ttyS0":     TerminalTypeSerial,
+		"ttyAMA0":   TerminalTypeSerial,
+		"ttyUSB1":   TerminalTypeSerial,
+		"hvc0":      TerminalTypeSerial,
+		"tty1":      TerminalTypeConsole,
+		"console":   TerminalTypeConsole,
+		":0":        TerminalTypeGraphical,
+		"web":       TerminalTypeUnknown,
+	} {
+		if got := classifyTerminal(terminal); got != want {
+			t.Errorf("classifyTerminal(%q) = %q, 期望 %q", terminal, got, want)
+		}
+	}
+
+	for _, tt := range []struct {
+		record protocol.LoginRecord
+		want   bool
+	}{
+		{protocol.LoginRecord{Terminal: "pts/0", IP: "203.0.113.7"}, true},
+		{protocol.LoginRecord{Terminal: "pts/0", IP: "2001:db8::1"}, true},
+		{protocol.LoginRecord{Terminal: "pts/0", IP: localSource}, false},
+		{protocol.LoginRecord{Terminal: "pts/0"}, false},
+		{protocol.LoginRecord{Terminal: "ssh:notty", IP: "203.0.113.7"}, false},
+		{protocol.LoginRecord{Terminal: "tty1", IP: "203.0.113.7"}, false},
+	} {
+		if got := isNetworkPTYLogin(tt.record); got != tt.want {
+			t.Errorf("isNetworkPTYLogin(%s, %q) = %v", tt.record.Terminal, tt.record.IP, got)
+		}
+	}
+}
+
+func TestSharedAccountAnalyzer(t *testing.T) {
+	config := DefaultConfig()
+	config.LoginConfig.SharedAccountWindow = time.Hour
+	config.LoginConfig.SharedAccounts = map[string]SharedAccountPolicy{
+		"deploy": {MaxNetworks: 2},
+		"ops":    {MaxCountries: 1},
+	}
+	analyzer := newSharedAccountAnalyzer(config)
+
+	end := time.Date(2024, 3, 4, 10, 0, 0, 0, time.UTC).UnixMilli()
+	start := end - time.Hour.Milliseconds()
+	records := []protocol.LoginRecord{
+		// 窗口起点之前，不计入
+		{Username: "deploy", IP: "192.0.2.1", Timestamp: start - 1},
+		// 窗口两端都包含，同一 /24 只计一次
+		{Username: "deploy", IP: "203.0.113.7", Timestamp: start},
+		{Username: "deploy", IP: "203.0.113.99", Timestamp: start + 1000},
+		{Username: "deploy", IP: "198.51.100.4", Timestamp: end},
+		// 同一 /48 的 IPv6 来源是一个网段，但来自两个国家
+		{Username: "ops", IP: "2001:db8:1:a::1", Location: "Japan-Tokyo", Timestamp: end - 1000},
+		{Username: "ops", IP: "2001:db8:1:b::2", Location: "Germany-Hesse", Timestamp: end},
+		// 未配置为共享账户
+		{Username: "alice", IP: "203.0.113.7", Location: "Japan", Timestamp: end},
+		{Username: "alice", IP: "198.51.100.4", Location: "Germany", Timestamp: end},
+		{Username: "alice", IP: "192.0.2.1", Location: "France", Timestamp: end},
+	}
+	assets := &protocol.LoginAssets{SuccessfulLogins: records}
+
+	if b := analyzer.breadth(assets, "deploy", 0); !slices.Equal(b.networks, []string{"198.51.100.0/24", "203.0.113.0/24"}) ||
+		b.windowStart != start || b.windowEnd != end {
+		t.Errorf("deploy 来源广度 = %+v", b)
+	}
+
+	alerts := analyzer.Analyze(assets)
+	if len(alerts) != 1 {
+		t.Fatalf("告警 = %+v", alerts)
+	}
+	if got := alerts[0]; got.Username != "ops" || !slices.Equal(got.Networks, []string{"2001:db8:1::/48"}) ||
+		!slices.Equal(got.Countries, []string{"Germany", "Japan"}) || got.MaxCountries != 1 {
+		t.Errorf("告警 = %+v", got)
+	}
+
+	// 网段数超过账户自身的阈值
+	strict := DefaultConfig()
+	strict.LoginConfig.SharedAccountWindow = time.Hour
+	strict.LoginConfig.SharedAccounts = map[string]SharedAccountPolicy{"deploy": {MaxNetworks: 1}, "ops": {MaxCountries: 1}}
+	if alerts := newSharedAccountAnalyzer(strict).Analyze(assets); len(alerts) != 2 || alerts[0].Username != "deploy" {
+		t.Errorf("MaxNetworks=1 告警 = %+v", alerts)
+	}
+
+	// Explain 以记录时间为窗口终点
+	if explanation := analyzer.Explain(assets, records[5]); !explanation.Fired {
+		t.Errorf("ops: %+v", explanation)
+	}
+	if explanation := analyzer.Explain(assets, records[3]); explanation.Fired {
+		t.Errorf("deploy: %+v", explanation)
+	}
+	if explanation := analyzer.Explain(assets, records[6]); explanation.Fired {
+		t.Errorf("alice: %+v", explanation)
+	}
+
+	for ip, want := range map[string]string{
+		"203.0.113.7":        "203.0.113.0/24",
+		"::ffff:203.0.113.7": "203.0.113.0/24",
+		"2001:db8:1:a::1":    "2001:db8:1::/48",
+		"127.0.0.1":          "",
+		localSource:          "",
+	} {
+		if got := sourceNetwork(ip); got != want {
+			t.Errorf("sourceNetwork(%q) = %q, 期望 %q", ip, got, want)
+		}
+	}
+}
+
+func TestTerminalAliases(t *testing.T) {
+	aliases := newTerminalAliases(DefaultConfig().LoginConfig.TerminalAliases)
+	for _, tc := range []struct{ raw, normalized, typ string }{
+		{"pts/0", "pts/0", TerminalTypeNetwork},
+		{"pts0", "pts/0", TerminalTypeNetwork},
+		{"/dev/pts/3", "pts/3", TerminalTypeNetwork},
+		{"ssh:notty", "ssh", TerminalTypeNetwork},
+		{"ttyS0", "ttyS0", TerminalTypeSerial},
+		{"hvsi0", "hvc0", TerminalTypeSerial},
+		{"ttysclp0", "ttyS0", TerminalTypeSerial},
+		{"console", "console", TerminalTypeConsole},
+		{"vc/2", "tty2", TerminalTypeConsole},
+		{":0", ":0", TerminalTypeGraphical},
+		{"", "", TerminalTypeUnknown},
+	} {
+		normalized := aliases.Normalize(tc.raw)
+		if normalized != tc.normalized || classifyTerminal(normalized) != tc.typ {
+			t.Errorf("%q -> %q (%s), 期望 %q (%s)", tc.raw, normalized, classifyTerminal(normalized), tc.normalized, tc.typ)
+		}
+	}
+
+	// 自定义别名，原始终端保持不变
+	config := DefaultConfig()
+	config.LoginConfig.TerminalAliases["bmc-sol*"] = "ttyS*"
+	assets := AnalyzeArchive([]protocol.LoginRecord{
+		{Username: "ops", Terminal: "bmc-sol1", Timestamp: 1, Status: "success"},
+	}, []protocol.LoginSession{
+		{Username: "ops", Terminal: "pts0", IP: "203.0.113.7"},
+	}, config)
+	record := assets.SuccessfulLogins[0]
+	if record.Terminal != "bmc-sol1" || record.NormalizedTerminal != "ttyS1" || record.TerminalType != TerminalTypeSerial {
+		t.Errorf("记录 = %+v", record)
+	}
+	session := assets.CurrentSessions[0]
+	if session.Terminal != "pts0" || session.NormalizedTerminal != "pts/0" || session.TerminalType != TerminalTypeNetwork {
+		t.Errorf("会话 = %+v", session)
+	}
+}
+
+// staticFileAccessSource 返回固定的访问事件
+type staticFileAccessSource struct {
+	events       []FileAccessEvent
+	since, until time.Time
+}
+
+func (s *staticFileAccessSource) FileAccessEvents(since, until time.Time) ([]FileAccessEvent, error) {
+	s.since, s.until = since, until
+	return s.events, nil
+}
+
+func TestCorrelateFileAccess(t *testing.T) {
+	base := time.Date(2024, 3, 4, 10, 0, 0, 0, time.UTC)
+	at := func(d time.Duration) int64 { return base.Add(d).UnixMilli() }
+	logins := []protocol.LoginRecord{
+		{Username: "alice", IP: "203.0.113.7", Terminal: "pts/0", Timestamp: at(0), RecordID: "a0", Status: "success"},
+		{Username: "alice", IP: "198.51.100.1", Terminal: "pts/1", Timestamp: at(2 * time.Minute), RecordID: "a1", Status: "success"},
+		{Username: "bob", IP: "192.0.2.5", Terminal: "pts/2", Timestamp: at(0), LogoutTime: at(time.Minute), RecordID: "b0", Status: "success"},
+	}
+	events := []FileAccessEvent{
+		{Username: "alice", Terminal: "pts/1", Path: "/etc/shadow", Operation: "read", Timestamp: at(2*time.Minute + 30*time.Second)},
+		{Username: "alice", Terminal: "pts/0", Path: "/etc/sudoers", Operation: "write", Timestamp: at(3 * time.Minute)},
+		{Username: "alice", Path: "/root/.ssh/authorized_keys", Timestamp: at(30 * time.Minute)}, // 超出窗口
+		{Username: "bob", Path: "/etc/shadow", Timestamp: at(2 * time.Minute)},                   // 已登出
+		{Username: "carol", Path: "/etc/shadow", Timestamp: at(time.Minute)},                     // 没有登录记录
+	}
+
+	accesses := CorrelateFileAccess(logins, events, 5*time.Minute)
+	if len(accesses) != 2 {
+		t.Fatalf("关联结果 = %+v", accesses)
+	}
+	// 按终端关联到对应的登录，而不是最近的一次
+	if got := accesses[0]; got.RecordID != "a1" || got.Path != "/etc/shadow" || got.DelaySeconds != 30 || got.IP != "198.51.100.1" {
+		t.Errorf("第 1 条 = %+v", got)
+	}
+	if got := accesses[1]; got.RecordID != "a0" || got.DelaySeconds != 180 {
+		t.Errorf("第 2 条 = %+v", got)
+	}
+
+	// 通过收集器关联，查询范围从最早的登录开始
+	source := &staticFileAccessSource{events: events}
+	lac := NewLoginAssetsCollector(DefaultConfig(), NewCommandExecutor(time.Second))
+	lac.SetClock(func() time.Time { return base.Add(time.Hour) })
+	lac.SetFileAccessSource(source)
+	assets := &protocol.LoginAssets{SuccessfulLogins: logins, Statistics: &protocol.LoginStatistics{}}
+	if err := lac.correlateFileAccess(assets); err != nil {
+		t.Fatal(err)
+	}
+	if len(assets.Statistics.PostLoginFileAccesses) != 2 || !source.since.Equal(base) || !source.until.Equal(base.Add(time.Hour)) {
+		t.Errorf("关联结果 = %+v, 查询范围 %v - %v", assets.Statistics.PostLoginFileAccesses, source.since, source.until)
+	}
+}
+
+func TestTrimLoginAssets(t *testing.T) {
+	build := func() *protocol.LoginAssets {
+		assets := &protocol.LoginAssets{
+			CurrentSessions: []protocol.LoginSession{{Username: "root", Terminal: "pts/0", IP: "203.0.113.7", LoginTime: 1}},
+			Statistics: &protocol.LoginStatistics{
+				TotalLogins:     40,
+				FailedLogins:    40,
+				BastionBypasses: []protocol.BastionBypass{{Username: "root", IP: "203.0.113.7", Terminal: "pts/0", Timestamp: 1}},
+			},
+		}
+		for i := 0; i < 40; i++ {
+			assets.SuccessfulLogins = append(assets.SuccessfulLogins, protocol.LoginRecord{Username: "ops", IP: "203.0.113.7", Terminal: "pts/1", Timestamp: int64(i), Status: "success"})
+			assets.FailedLogins = append(assets.FailedLogins, protocol.LoginRecord{Username: "admin", IP: "45.148.10.81", Terminal: "ssh:notty", Timestamp: int64(i), Status: "failed"})
+		}
+		return assets
+	}
+	full := payloadSize(build())
+	withoutSuccess := build()
+	withoutSuccess.SuccessfulLogins = nil
+
+	// 不超出上限时不裁剪
+	assets := build()
+	trimLoginAssets(assets, full, false)
+	if assets.Trimmed != nil || len(assets.SuccessfulLogins) != 40 {
+		t.Fatalf("未超出时不应裁剪: %+v", assets.Trimmed)
+	}
+
+	// 先丢弃最早的成功登录
+	assets = build()
+	trimLoginAssets(assets, full-500, false)
+	trimmed := assets.Trimmed
+	if trimmed == nil || trimmed.DroppedSuccessfulLogins == 0 || trimmed.DroppedFailedLogins != 0 || trimmed.Exceeded {
+		t.Fatalf("裁剪 = %+v", trimmed)
+	}
+	if len(assets.FailedLogins) != 40 || assets.SuccessfulLogins[0].Timestamp != 39 || len(assets.SuccessfulLogins)+trimmed.DroppedSuccessfulLogins != 40 {
+		t.Errorf("保留的成功登录 = %d 条, 最新 %d", len(assets.SuccessfulLogins), assets.SuccessfulLogins[0].Timestamp)
+	}
+	if trimmed.TrimmedBytes > trimmed.MaxBytes || trimmed.TrimmedBytes != payloadSize(assets) {
+		t.Errorf("裁剪后大小 = %d, 实际 %d", trimmed.TrimmedBytes, payloadSize(assets))
+	}
+
+	// 成功登录全部丢弃后再丢弃最早的失败登录，统计和告警保留
+	assets = build()
+	trimLoginAssets(assets, payloadSize(withoutSuccess)-500, false)
+	trimmed = assets.Trimmed
+	if len(assets.SuccessfulLogins) != 0 || trimmed.DroppedSuccessfulLogins != 40 || trimmed.DroppedFailedLogins == 0 || trimmed.DroppedSessions != 0 {
+		t.Fatalf("裁剪 = %+v", trimmed)
+	}
+	if assets.FailedLogins[0].Timestamp != 39 || assets.Statistics.TotalLogins != 40 || len(assets.Statistics.BastionBypasses) != 1 {
+		t.Errorf("失败登录 = %d 条, 统计 = %+v", len(assets.FailedLogins), assets.Statistics)
+	}
+
+	// 丢弃全部原始记录仍超出时标记
+	assets = build()
+	trimLoginAssets(assets, 10, false)
+	if !assets.Trimmed.Exceeded || assets.Trimmed.DroppedSessions != 1 || assets.Statistics == nil {
+		t.Errorf("裁剪 = %+v", assets.Trimmed)
+	}
+}
+
+func TestBruteForceAnalyzer(t *testing.T) {
+	base := time.Date(2024, 3, 4, 3, 0, 0, 0, time.UTC).UnixMilli()
+	failed := func(ip, user string, offset time.Duration) protocol.LoginRecord {
+		return protocol.LoginRecord{Username: user, IP: ip, Terminal: "ssh:notty", Timestamp: base + offset.Milliseconds(), Status: "failed"}
+	}
+
+	assets := &protocol.LoginAssets{}
+	// lastb 的输出顺序不保证按时间排列
+	for _, i := range []int{7, 2, 11, 0, 5, 9, 1, 10, 3, 8, 6, 4} {
+		user := "root"
+		if i%2 == 1 {
+			user = "admin"
+		}
+		assets.FailedLogins = append(assets.FailedLogins, failed("45.148.10.81", user, time.Duration(i)*4*time.Second))
+	}
+	// 次数足够但分散在较长时间内
+	for i := 0; i < 12; i++ {
+		assets.FailedLogins = append(assets.FailedLogins, failed("203.0.113.7", "ops", time.Duration(i)*time.Minute))
+	}
+
+	config := DefaultConfig()
+	lac := NewLoginAssetsCollector(config, NewCommandExecutor(time.Second))
+	alerts := lac.calculateStatistics(assets).BruteForceAttempts
+	if len(alerts) != 1 {
+		t.Fatalf("暴力破解 = %+v", alerts)
+	}
+	alert := alerts[0]
+	if alert.IP != "45.148.10.81" || alert.Count != 12 || alert.WindowStart != base || alert.WindowEnd != base+44000 {
+		t.Errorf("告警 = %+v", alert)
+	}
+	if !slices.Equal(alert.Usernames, []string{"root", "admin"}) {
+		t.Errorf("用户名 = %v", alert.Usernames)
+	}
+
+	analyzer := newBruteForceAnalyzer(config)
+	if explanation := analyzer.Explain(assets, assets.FailedLogins[0]); !explanation.Fired {
+		t.Errorf("应命中: %+v", explanation)
+	}
+	if explanation := analyzer.Explain(assets, assets.FailedLogins[12]); explanation.Fired {
+		t.Errorf("不应命中: %+v", explanation)
+	}
+}
+
+// mapLocationResolver 按表返回归属地并记录查询次数
+type mapLocationResolver struct {
+	locations map[string]string
+	lookups   map[string]int
+}
+
+func (r *mapLocationResolver) LookupIP(ip string) string {
+	if r.lookups == nil {
+		r.lookups = make(map[string]int)
+	}
+	r.lookups[ip]++
+	return r.locations[ip]
+}
+
+func TestDeduplicateRecords(t *testing.T) {
+	newAssets := func() *protocol.LoginAssets {
+		return &protocol.LoginAssets{
+			SuccessfulLogins: []protocol.LoginRecord{
+				{Username: "alice", Terminal: "pts/0", IP: "203.0.113.7", Timestamp: 1000, LogoutTime: 5000},
+				{Username: "alice", Terminal: "pts/0", IP: "203.0.113.7", Timestamp: 1000},
+				{Username: "alice", Terminal: "pts/1", IP: "203.0.113.7", Timestamp: 1000},
+			},
+			FailedLogins: []protocol.LoginRecord{
+				{Username: "root", Terminal: "ssh:notty", IP: "45.148.10.81", Timestamp: 2000},
+				{Username: "root", Terminal: "ssh:notty", IP: "45.148.10.81", Timestamp: 2000},
+			},
+		}
+	}
+
+	// 默认保留原始记录
+	lac := NewLoginAssetsCollector(DefaultConfig(), NewCommandExecutor(time.Second))
+	assets := newAssets()
+	lac.normalize(assets)
+	if len(assets.SuccessfulLogins) != 3 || len(assets.FailedLogins) != 2 {
+		t.Fatalf("未开启去重时不应去除记录: %d, %d", len(assets.SuccessfulLogins), len(assets.FailedLogins))
+	}
+
+	config := DefaultConfig()
+	config.LoginConfig.DeduplicateRecords = true
+	lac = NewLoginAssetsCollector(config, NewCommandExecutor(time.Second))
+	assets = newAssets()
+	lac.normalize(assets)
+	if len(assets.SuccessfulLogins) != 2 || len(assets.FailedLogins) != 1 {
+		t.Fatalf("去重后 = %d, %d", len(assets.SuccessfulLogins), len(assets.FailedLogins))
+	}
+	if assets.SuccessfulLogins[0].LogoutTime != 5000 {
+		t.Error("应保留第一条记录")
+	}
+	if stats := lac.calculateStatistics(assets); stats.TotalLogins != 2 {
+		t.Errorf("TotalLogins = %d", stats.TotalLogins)
+	}
+}
+
+func TestResolveLocations(t *testing.T) {
+	newAssets := func() *protocol.LoginAssets {
+		return &protocol.LoginAssets{
+			SuccessfulLogins: []protocol.LoginRecord{
+				{Username: "alice", IP: "203.0.113.7", Terminal: "pts/0", Timestamp: 1000},
+				{Username: "bob", IP: "203.0.113.7", Terminal: "pts/1", Timestamp: 2000},
+				{Username: "carol", IP: "198.51.100.1", Terminal: "pts/2", Timestamp: 3000, Location: "已有归属地"},
+			},
+			FailedLogins: []protocol.LoginRecord{
+				{Username: "root", IP: "unknown", Terminal: "ssh:notty", Timestamp: 4000},
+			},
+			CurrentSessions: []protocol.LoginSession{
+				{Username: "alice", IP: "203.0.113.7", Terminal: "pts/0", LoginTime: 1000},
+			},
+		}
+	}
+
+	// 未设置查询时不填充
+	lac := NewLoginAssetsCollector(DefaultConfig(), NewCommandExecutor(time.Second))
+	assets := newAssets()
+	lac.normalize(assets)
+	if assets.SuccessfulLogins[0].Location != "" {
+		t.Fatalf("未设置归属地查询时不应填充: %q", assets.SuccessfulLogins[0].Location)
+	}
+
+	resolver := &mapLocationResolver{locations: map[string]string{"203.0.113.7": "美国-加利福尼亚州"}}
+	lac.SetLocationResolver(resolver)
+	assets = newAssets()
+	lac.normalize(assets)
+
+	if got := assets.SuccessfulLogins[0].Location; got != "美国-加利福尼亚州" {
+		t.Errorf("成功登录归属地 = %q", got)
+	}
+	if got := assets.CurrentSessions[0].Location; got != "美国-加利福尼亚州" {
+		t.Errorf("会话归属地 = %q", got)
+	}
+	if got := assets.SuccessfulLogins[2].Location; got != "已有归属地" {
+		t.Errorf("已有归属地不应覆盖: %q", got)
+	}
+	if resolver.lookups["203.0.113.7"] != 1 {
+		t.Errorf("同一 IP 应只查询一次, 实际 %d 次", resolver.lookups["203.0.113.7"])
+	}
+	if resolver.lookups["unknown"] != 0 || resolver.lookups["198.51.100.1"] != 0 {
+		t.Errorf("不应查询未知 IP 或已有归属地的记录: %v", resolver.lookups)
+	}
+
+	// 填充归属地之后执行转换，用户过滤匹配转换后的用户名
+	config := DefaultConfig()
+	config.LoginConfig.RecordTransforms = []string{TransformLowercaseUser}
+	config.LoginConfig.IncludeUsers = []string{"alice"}
+	lac = NewLoginAssetsCollector(config, NewCommandExecutor(time.Second))
+	lac.SetLocationResolver(resolver)
+	assets = newAssets()
+	assets.SuccessfulLogins[0].Username = "ALICE"
+	lac.normalize(assets)
+	if len(assets.SuccessfulLogins) != 1 || assets.SuccessfulLogins[0].Username != "alice" ||
+		assets.SuccessfulLogins[0].Location != "美国-加利福尼亚州" {
+		t.Errorf("转换后的成功登录 = %+v", assets.SuccessfulLogins)
+	}
+}
+
+func TestLastNonEnglishLocale(t *testing.T) {
+	german, err := os.ReadFile(filepath.Join("testdata", "last_german.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !hasUnparsableLastTime(string(german)) {
+		t.Fatal("德语 locale 的时间应判定为无法解析")
+	}
+	english, err := os.ReadFile(filepath.Join("testdata", "last_named.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hasUnparsableLastTime(string(english)) {
+		t.Fatal("英文输出不应判定为无法解析")
+	}
+
+	// 模拟德语 locale 的 last，只有 LC_TIME=C 且未设置 LC_ALL 时输出英文
+	dir := t.TempDir()
+	germanPath, _ := filepath.Abs(filepath.Join("testdata", "last_german.txt"))
+	cPath, _ := filepath.Abs(filepath.Join("testdata", "last_german_c.txt"))
+	script := fmt.Sprintf("#!/bin/sh\nif [ \"$LC_TIME\" = C ] && [ -z \"$LC_ALL\" ]; then cat %q; else cat %q; fi\n", cPath, germanPath)
+	if err := os.WriteFile(filepath.Join(dir, "last"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	t.Setenv("LC_ALL", "de_DE.UTF-8")
+
+	config := DefaultConfig()
+	config.LoginConfig.PreferUtmpdump = false
+	config.LoginConfig.LastWithNumericIPs = false
+	lac := NewLoginAssetsCollector(config, NewCommandExecutor(time.Second))
+
+	records, err := lac.collectSuccessfulLoginsFromWtmpSources(time.Time{}, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("登录记录 = %+v", records)
+	}
+	if want := time.Date(2024, 3, 1, 10, 2, 55, 0, time.UTC).UnixMilli(); records[0].Timestamp != want {
+		t.Errorf("登录时间 = %d, 期望 %d", records[0].Timestamp, want)
+	}
+	if want := time.Date(2024, 3, 1, 10, 32, 55, 0, time.UTC).UnixMilli(); records[0].LogoutTime != want {
+		t.Errorf("登出时间 = %d, 期望 %d", records[0].LogoutTime, want)
+	}
+	if want := time.Date(2023, 12, 28, 23, 59, 1, 0, time.UTC).UnixMilli(); records[1].Timestamp != want {
+		t.Errorf("跨年的登录时间 = %d, 期望 %d", records[1].Timestamp, want)
+	}
+}
+
+func TestCollectSuccessfulLoginsFromAuthLog(t *testing.T) {
+	lac := NewLoginAssetsCollector(DefaultConfig(), NewCommandExecutor(time.Second))
+
+	records := lac.collectSuccessfulLoginsFromAuthLog([]string{filepath.Join("testdata", "auth_success.log")}, time.Time{}, 100)
+	// 按时间从新到旧；sshd 的会话打开日志与 Accepted 重复，cron 和 sudo 不是登录
+	want := []struct {
+		username, ip, terminal, method string
+	}{
+		{"root", "", "console", ""},
+		{"alice", "198.51.100.20", "ssh", protocol.AuthMethodPassword},
+		{"deploy", "203.0.113.7", "ssh", protocol.AuthMethodPublicKey},
+	}
+	if len(records) != len(want) {
+		t.Fatalf("成功登录 = %+v", records)
+	}
+	for i, w := range want {
+		got := records[i]
+		if got.Username != w.username || got.IP != w.ip || got.Terminal != w.terminal || got.AuthMethod != w.method || got.Status != "success" {
+			t.Errorf("记录 %d = %+v, 期望 %+v", i, got, w)
+		}
+	}
+
+	if got := lac.collectSuccessfulLoginsFromAuthLog([]string{filepath.Join("testdata", "auth_success.log")}, time.Time{}, 1); len(got) != 1 || got[0].Username != "root" {
+		t.Errorf("应只保留最新的记录: %+v", got)
+	}
+}
+
+func TestConcurrentSessions(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	at := func(hour int) int64 { return time.Date(2024, 3, 1, hour, 0, 0, 0, time.UTC).UnixMilli() }
+
+	config := DefaultConfig()
+	lac := NewLoginAssetsCollector(config, NewCommandExecutor(time.Second))
+	lac.SetClock(func() time.Time { return now })
+
+	assets := &protocol.LoginAssets{
+		CurrentSessions: []protocol.LoginSession{
+			{Username: "alice", Terminal: "pts/0", IP: "203.0.113.7", Location: "中国", LoginTime: at(9)},
+			{Username: "alice", Terminal: "pts/1", IP: "198.51.100.1", Location: "Russia", LoginTime: at(11)},
+			{Username: "alice", Terminal: "pts/2", IP: "203.0.113.7", LoginTime: at(10)},
+			// 本机和 NAT 出口不计入
+			{Username: "bob", Terminal: "pts/3", IP: "192.0.2.1", LoginTime: at(8)},
+			{Username: "bob", Terminal: "tty1", IP: "localhost", LoginTime: at(8)},
+			{Username: "bob", Terminal: "pts/4", IP: "::1", LoginTime: at(8)},
+			{Username: "bob", Terminal: "pts/5", IP: "192.0.2.200", BehindNAT: true, LoginTime: at(8)},
+		},
+		SuccessfulLogins: []protocol.LoginRecord{
+			{Username: "carol", Terminal: "pts/6", IP: "192.0.2.5", Timestamp: at(1), LogoutTime: at(3), Status: "success"},
+			{Username: "carol", Terminal: "pts/7", IP: "192.0.2.6", Timestamp: at(2), LogoutTime: at(4), Status: "success"},
+			{Username: "carol", Terminal: "pts/8", IP: "192.0.2.7", Timestamp: at(5), LogoutTime: at(6), Status: "success"},
+		},
+	}
+
+	stats := lac.calculateStatistics(assets)
+	if len(stats.ConcurrentAccess) != 1 {
+		t.Fatalf("ConcurrentAccess = %+v", stats.ConcurrentAccess)
+	}
+	alert := stats.ConcurrentAccess[0]
+	if alert.Username != "alice" || !slices.Equal(alert.IPs, []string{"198.51.100.1", "203.0.113.7"}) || len(alert.Sources) != 3 {
+		t.Errorf("告警 = %+v", alert)
+	}
+	if alert.Sources[0].Terminal != "pts/0" || !alert.Sources[0].Active || alert.Sources[2].Location != "Russia" {
+		t.Errorf("来源应按登录时间排列: %+v", alert.Sources)
+	}
+	for _, explanation := range lac.ExplainSession(assets, assets.CurrentSessions[1]) {
+		if explanation.Analyzer == "concurrent-sessions" && !explanation.Fired {
+			t.Errorf("当前会话应触发: %+v", explanation)
+		}
+	}
+
+	// 开启后检查历史登录中时间重叠的会话
+	config.LoginConfig.ConcurrentSessionHistory = true
+	lac = NewLoginAssetsCollector(config, NewCommandExecutor(time.Second))
+	lac.SetClock(func() time.Time { return now })
+	stats = lac.calculateStatistics(assets)
+	if len(stats.ConcurrentAccess) != 2 || stats.ConcurrentAccess[1].Username != "carol" ||
+		!slices.Equal(stats.ConcurrentAccess[1].IPs, []string{"192.0.2.5", "192.0.2.6"}) {
+		t.Errorf("历史登录 = %+v", stats.ConcurrentAccess)
+	}
+
+	explanation := newConcurrentSessionAnalyzer(config, lac.now).Explain(assets, assets.SuccessfulLogins[2])
+	if explanation.Fired {
+		t.Errorf("未重叠的登录不应触发: %+v", explanation)
+	}
+}
+
+func TestLoginsByHourAndOffHours(t *testing.T) {
+	config := DefaultConfig()
+	config.LoginConfig.TimeZone = "Asia/Shanghai"
+	lac := NewLoginAssetsCollector(config, NewCommandExecutor(time.Second))
+
+	cst := time.FixedZone("CST", 8*3600)
+	at := func(hour, minute int) int64 {
+		return time.Date(2024, 3, 1, hour, minute, 0, 0, cst).UnixMilli()
+	}
+	assets := &protocol.LoginAssets{
+		SuccessfulLogins: []protocol.LoginRecord{
+			{Username: "alice", IP: "203.0.113.7", Terminal: "pts/0", Timestamp: at(9, 15), Status: "success"},
+			{Username: "alice", IP: "203.0.113.7", Terminal: "pts/0", Timestamp: at(9, 45), Status: "success"},
+			{Username: "bob", IP: "203.0.113.8", Terminal: "pts/1", Timestamp: at(7, 59), Status: "success"},
+			{Username: "root", IP: "45.148.10.81", Terminal: "pts/2", Timestamp: at(23, 30), Status: "success"},
+			{Username: "carol", IP: "203.0.113.9", Terminal: "pts/3", Timestamp: at(20, 0), Status: "success"},
+			// 时间无法解析，使用收集时间代替
+			{Username: "dave", IP: "203.0.113.10", Terminal: "pts/4", Timestamp: at(3, 0), Status: "success", TimestampEstimated: true},
+		},
+	}
+	stats := lac.calculateStatistics(assets)
+
+	var want [24]int
+	want[9], want[7], want[23], want[20] = 2, 1, 1, 1
+	if stats.LoginsByHour != want {
+		t.Errorf("LoginsByHour = %v", stats.LoginsByHour)
+	}
+
+	var offHours []string
+	for _, login := range stats.OffHoursLogins {
+		offHours = append(offHours, login.Username)
+	}
+	if !slices.Equal(offHours, []string{"bob", "root", "carol"}) {
+		t.Errorf("OffHoursLogins = %v", offHours)
+	}
+
+	// 工作时间相同时不检测
+	config.LoginConfig.BusinessHoursStart, config.LoginConfig.BusinessHoursEnd = 0, 0
+	lac = NewLoginAssetsCollector(config, NewCommandExecutor(time.Second))
+	if got := lac.calculateStatistics(assets).OffHoursLogins; got != nil {
+		t.Errorf("未配置工作时间时不应检测: %+v", got)
+	}
+}
+
+func TestNewSourceLogins(t *testing.T) {
+	logins := []protocol.LoginRecord{
+		{Username: "alice", IP: "203.0.113.7", Terminal: "pts/0", Timestamp: 1000, Status: "success"},
+		{Username: "alice", IP: "198.51.100.1", Terminal: "pts/1", Timestamp: 2000, Status: "success"},
+		{Username: "bob", IP: "203.0.113.7", Terminal: "pts/2", Timestamp: 3000, Status: "success"},
+		{Username: "alice", IP: "198.51.100.1", Terminal: "pts/3", Timestamp: 4000, Status: "success"},
+		{Username: "carol", IP: "localhost", Terminal: "tty1", Timestamp: 5000, Status: "success"},
+	}
+	known := map[string][]string{"alice": {"203.0.113.7"}}
+
+	// 未设置历史来源时不检测
+	lac := NewLoginAssetsCollector(DefaultConfig(), NewCommandExecutor(time.Second))
+	assets := &protocol.LoginAssets{SuccessfulLogins: logins}
+	if got := lac.calculateStatistics(assets).NewSourceLogins; got != nil {
+		t.Fatalf("未设置历史来源时不应检测: %+v", got)
+	}
+
+	lac.SetKnownUserIPs(known)
+	found := lac.calculateStatistics(assets).NewSourceLogins
+	var got []int64
+	for _, login := range found {
+		got = append(got, login.Timestamp)
+	}
+	// 同一 IP 对其他用户是新来源；本地登录不检测
+	if !slices.Equal(got, []int64{2000, 3000, 4000}) {
+		t.Errorf("NewSourceLogins = %v", got)
+	}
+	if len(known["alice"]) != 1 {
+		t.Error("检测不应修改历史来源")
+	}
+
+	merged := MergeKnownUserIPs(known, logins)
+	if !slices.Equal(merged["alice"], []string{"203.0.113.7", "198.51.100.1"}) || !slices.Equal(merged["bob"], []string{"203.0.113.7"}) {
+		t.Errorf("合并后的历史来源 = %v", merged)
+	}
+	if _, ok := merged["carol"]; ok {
+		t.Error("本地登录不应加入历史来源")
+	}
+	if got := FindNewSourceLogins(logins, merged); got != nil {
+		t.Errorf("合并后不应再有新来源: %+v", got)
+	}
+}
+
+func TestPrivilegeEscalations(t *testing.T) {
+	lac := NewLoginAssetsCollector(DefaultConfig(), NewCommandExecutor(time.Second))
+
+	data, err := os.ReadFile(filepath.Join("testdata", "auth_privilege.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		if record, ok := lac.parsePrivilegeEscalationLine(line); ok {
+			got = append(got, fmt.Sprintf("%s/%s/%s/%s", record.AuthMethod, record.Username, record.Terminal, record.Status))
+		}
+	}
+	// 提权到其他用户、sudo 的 PAM 会话日志和 sshd 登录不计入
+	want := []string{
+		"sudo/alice/pts/0/success",
+		"sudo/bob/pts/1/failed",
+		"su/carol/su/success",
+		"su/dave/su/success",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("提权记录 = %v", got)
+	}
+
+	stats := lac.calculateStatistics(&protocol.LoginAssets{SuccessfulLogins: []protocol.LoginRecord{
+		{Username: "root", IP: "203.0.113.7", Terminal: "pts/0", Timestamp: 1000, Status: "success"},
+		{Username: "alice", IP: "203.0.113.7", Terminal: "pts/1", Timestamp: 2000, Status: "success"},
+	}})
+	if len(stats.RootLogins) != 1 || stats.RootLogins[0].Timestamp != 1000 {
+		t.Errorf("RootLogins = %+v", stats.RootLogins)
+	}
+}
+
+func TestForeignLogins(t *testing.T) {
+	config := DefaultConfig()
+	config.LoginConfig.ExpectedCountries = []string{"中国", "singapore"}
+	lac := NewLoginAssetsCollector(config, NewCommandExecutor(time.Second))
+
+	assets := &protocol.LoginAssets{
+		SuccessfulLogins: []protocol.LoginRecord{
+			{Username: "alice", IP: "1.2.3.4", Location: "中国-广东-深圳", Terminal: "pts/0", Timestamp: 1000, Status: "success"},
+			{Username: "bob", IP: "8.8.8.8", Location: "美国-加利福尼亚州", Terminal: "pts/1", Timestamp: 2000, Status: "success"},
+			{Username: "carol", IP: "10.0.0.5", Location: "内网IP", Terminal: "pts/2", Timestamp: 3000, Status: "success"},
+			{Username: "dave", IP: "203.0.113.9", Terminal: "pts/3", Timestamp: 4000, Status: "success"},
+			{Username: "erin", IP: "5.6.7.8", Location: "Singapore", Terminal: "pts/4", Timestamp: 5000, Status: "success"},
+		},
+	}
+	stats := lac.calculateStatistics(assets)
+
+	wantCountries := map[string]int{"中国": 1, "美国": 1, "Singapore": 1, protocol.CountryPrivate: 1, protocol.CountryUnknown: 1}
+	if !maps.Equal(stats.LoginsByCountry, wantCountries) {
+		t.Errorf("LoginsByCountry = %v", stats.LoginsByCountry)
+	}
+	// 内网IP和归属地未知的登录不告警，预期国家不区分大小写
+	if len(stats.ForeignLogins) != 1 || stats.ForeignLogins[0].Username != "bob" {
+		t.Fatalf("ForeignLogins = %+v", stats.ForeignLogins)
+	}
+
+	explanations := lac.Explain(assets, assets.SuccessfulLogins[2])
+	for _, explanation := range explanations {
+		if explanation.Analyzer == "foreign-login" && explanation.Fired {
+			t.Errorf("内网IP不应判定为异地登录: %s", explanation.Detail)
+		}
+	}
+
+	// 记录都没有归属地时不统计
+	if got := lac.calculateStatistics(&protocol.LoginAssets{SuccessfulLogins: assets.SuccessfulLogins[3:4]}).LoginsByCountry; got != nil {
+		t.Errorf("没有归属地时 LoginsByCountry 应为空: %v", got)
+	}
+}
+
+func TestParseLastlogOutput(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "lastlog.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries := parseLastlogOutput(string(data))
+	cst := time.FixedZone("CST", 8*3600)
+	want := []protocol.LastLoginEntry{
+		{Username: "root", Port: "pts/0", From: "192.168.1.10", Latest: time.Date(2024, 10, 14, 10, 22, 33, 0, cst).UnixMilli()},
+		{Username: "daemon", NeverLoggedIn: true},
+		{Username: "bin", NeverLoggedIn: true},
+		{Username: "alice", Port: "tty1", Latest: time.Date(2024, 10, 15, 8, 1, 2, 0, cst).UnixMilli()},
+		// 用户名超出列宽时后面的列右移
+		{Username: "deploy-automation", Port: "pts/3", From: "203.0.113.7", Latest: time.Date(2024, 10, 16, 23, 59, 59, 0, time.UTC).UnixMilli()},
+		{Username: "bob", From: "10.0.0.5", Latest: time.Date(2024, 10, 10, 12, 0, 0, 0, cst).UnixMilli()},
+	}
+	if !slices.Equal(entries, want) {
+		t.Fatalf("lastlog 解析结果:\n%+v\n期望:\n%+v", entries, want)
+	}
+}
+
+// fakeCommandRunner 按命令名返回固定输出的 CommandRunner
+type fakeCommandRunner struct {
+	mu sync.Mutex
+	// 命令名或完整命令行 -> 输出，完整命令行优先
+	outputs map[string]string
+	calls   []string
+
+	// 以非零状态退出的完整命令行 (如 "w -h")
+	failing []string
+}
+
+func (r *fakeCommandRunner) Execute(name string, args ...string) (string, error) {
+	command := strings.Join(append([]string{name}, args...), " ")
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls = append(r.calls, command)
+	if slices.Contains(r.failing, command) {
+		return "", fmt.Errorf("%s: exit status 1", command)
+	}
+	if output, ok := r.outputs[command]; ok {
+		return output, nil
+	}
+	output, ok := r.outputs[name]
+	if !ok {
+		return "", fmt.Errorf("%s: command not found", name)
+	}
+	return output, nil
+}
+
+func TestIncludeRotatedLogs(t *testing.T) {
+	dir := t.TempDir()
+	base := time.Unix(1700000000, 0)
+	entry := func(user string, offset time.Duration) []byte {
+		return encodeUtmpEntry(utmpTypeUserProcess, user, "pts/0", "203.0.113.7", base.Add(offset))
+	}
+
+	var gz bytes.Buffer
+	writer := gzip.NewWriter(&gz)
+	writer.Write(append(entry("dave", 0), entry("erin", time.Minute)...))
+	writer.Close()
+	for name, data := range map[string][]byte{
+		"wtmp":      entry("alice", 4*time.Minute),
+		"wtmp.1":    append(entry("bob", 2*time.Minute), entry("carol", 3*time.Minute)...),
+		"wtmp.2.gz": gz.Bytes(),
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	config := DefaultConfig()
+	config.LoginConfig.WtmpPath = filepath.Join(dir, "wtmp")
+	config.LoginConfig.BtmpPath = filepath.Join(dir, "btmp")
+	config.LoginConfig.UtmpPath = filepath.Join(dir, "utmp")
+	config.LoginConfig.PreferUtmpdump = false
+	config.LoginConfig.MaxLoginRecords = 10
+
+	// last 不可用，直接读取各文件
+	collect := func() []string {
+		runner := &fakeCommandRunner{}
+		records, err := NewLoginAssetsCollector(config, runner).collectSuccessfulLogins(time.Time{}, maxLoginRecords(config))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if config.LoginConfig.IncludeRotatedLogs && !slices.ContainsFunc(runner.calls, func(call string) bool {
+			return strings.HasPrefix(call, "last -f "+filepath.Join(dir, "wtmp.1")+" ")
+		}) {
+			t.Errorf("应以 last -f 读取轮转文件: %v", runner.calls)
+		}
+		var users []string
+		for _, record := range records {
+			users = append(users, record.Username)
+		}
+		return users
+	}
+
+	if got := collect(); !slices.Equal(got, []string{"alice"}) {
+		t.Errorf("未开启时只读取当前文件: %v", got)
+	}
+
+	config.LoginConfig.IncludeRotatedLogs = true
+	if got := collect(); !slices.Equal(got, []string{"alice", "carol", "bob", "erin", "dave"}) {
+		t.Errorf("合并轮转文件 = %v", got)
+	}
+
+	config.LoginConfig.MaxLoginRecords = 3
+	if got := collect(); !slices.Equal(got, []string{"alice", "carol", "bob"}) {
+		t.Errorf("超出上限时保留最新的记录 = %v", got)
+	}
+}
+
+func TestCollectWithErrors(t *testing.T) {
+	// 所有命令都执行失败，文件也不存在
+	dir := t.TempDir()
+	config := DefaultConfig()
+	config.LoginConfig.WtmpPath = filepath.Join(dir, "wtmp")
+	config.LoginConfig.BtmpPath = filepath.Join(dir, "btmp")
+	config.LoginConfig.UtmpPath = filepath.Join(dir, "utmp")
+	lac := NewLoginAssetsCollector(config, &fakeCommandRunner{})
+
+	assets, errs := lac.CollectWithErrors()
+	if assets == nil {
+		t.Fatal("有错误时仍应返回部分结果")
+	}
+	messages := make(map[string]string)
+	for _, err := range errs {
+		name, message, _ := strings.Cut(err.Error(), ": ")
+		messages[name] = message
+	}
+	if !strings.Contains(messages["current_sessions"], "w: ") {
+		t.Errorf("current_sessions 错误 = %q", messages["current_sessions"])
+	}
+	// 有认证日志时从日志读取，不一定失败
+	if findAuthLog() == "" {
+		if !strings.Contains(messages["failed_logins"], "需要root权限") {
+			t.Errorf("failed_logins 错误 = %q", messages["failed_logins"])
+		}
+		if !strings.Contains(messages["successful_logins"], "last: ") {
+			t.Errorf("successful_logins 错误 = %q", messages["successful_logins"])
+		}
+	}
+	if !slices.IsSortedFunc(errs, func(a, b error) int { return strings.Compare(a.Error(), b.Error()) }) {
+		t.Errorf("错误应按子收集器名称排序: %v", errs)
+	}
+}
+
+func TestCollectWithFakeCommandRunner(t *testing.T) {
+	last, err := os.ReadFile(filepath.Join("testdata", "last_named.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	runner := &fakeCommandRunner{outputs: map[string]string{
+		"last": string(last),
+		"lastb": "root     ssh:notty    45.148.10.81     Fri Mar  1 09:00:01 2024 - Fri Mar  1 09:00:01 2024  (00:00)\n" +
+			"admin    ssh:notty    203.0.113.7      Fri Mar  1 08:59:30 2024 - Fri Mar  1 08:59:30 2024  (00:00)\n" +
+			"\nbtmp begins Fri Mar  1 00:00:01 2024\n",
+		"w": "alice    pts/2    vpn.example.com  11:45    2:03m  0.10s  0.01s -bash\n" +
+			"root     pts/1    203.0.113.9      11:30    45.00s  0.20s  0.02s top\n",
+	}}
+
+	dir := t.TempDir()
+	config := DefaultConfig()
+	config.LoginConfig.PreferUtmpdump = false
+	config.LoginConfig.LastWithNumericIPs = false
+	config.LoginConfig.BtmpPath = filepath.Join(dir, "btmp")
+	config.LoginConfig.UtmpPath = filepath.Join(dir, "utmp")
+	lac := NewLoginAssetsCollector(config, runner)
+
+	successful, err := lac.collectSuccessfulLogins(time.Time{}, maxLoginRecords(config))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(successful) == 0 || successful[0].Username != "alice" || successful[0].IP != "vpn.example.com" {
+		t.Fatalf("成功登录 = %+v", successful)
+	}
+	if want := time.Date(2024, 3, 1, 11, 45, 0, 0, time.UTC).UnixMilli(); successful[0].Timestamp != want {
+		t.Errorf("登录时间 = %d, 期望 %d", successful[0].Timestamp, want)
+	}
+
+	failed, err := lac.collectFailedLogins(time.Time{}, maxLoginRecords(config))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(failed) != 2 || failed[0].Username != "root" || failed[0].IP != "45.148.10.81" || failed[1].Username != "admin" {
+		t.Fatalf("失败登录 = %+v", failed)
+	}
+
+	sessions, err := lac.collectCurrentSessions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 2 {
+		t.Fatalf("当前会话 = %+v", sessions)
+	}
+	if sessions[0].Username != "alice" || sessions[0].IdleTime != 2*3600+3*60 {
+		t.Errorf("会话 = %+v", sessions[0])
+	}
+	if sessions[1].Username != "root" || sessions[1].IdleTime != 45 {
+		t.Errorf("会话 = %+v", sessions[1])
+	}
+
+	if !slices.Contains(runner.calls, "w -h") {
+		t.Errorf("应通过 CommandRunner 执行命令: %v", runner.calls)
+	}
+}
+
+func TestExecuteContextKillsOnCancel(t *testing.T) {
+	if _, err := exec.LookPath("sleep"); err != nil {
+		t.Skip("sleep not available")
+	}
+	executor := NewCommandExecutor(time.Minute)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	start := time.Now()
+	if _, err := executor.ExecuteContext(ctx, "sleep", "10"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("取消后应返回 context.Canceled, 实际 %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("取消后应结束进程, 耗时 %v", elapsed)
+	}
+
+	// 登录命令使用 LoginConfig.CommandTimeout，而不是执行器的超时时间
+	config := DefaultConfig()
+	config.LoginConfig.CommandTimeout = 50 * time.Millisecond
+	lac := NewLoginAssetsCollector(config, executor)
+	start = time.Now()
+	if _, err := lac.execute("sleep", "10"); err == nil || !strings.Contains(err.Error(), "超时") {
+		t.Fatalf("超时后应返回超时错误, 实际 %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("超时后应结束进程, 耗时 %v", elapsed)
+	}
+
+	// Execute 使用执行器的超时时间
+	if _, err := NewCommandExecutor(50*time.Millisecond).Execute("sleep", "10"); err == nil {
+		t.Fatal("Execute 超时后应返回错误")
+	}
+}
+
+func TestCapabilities(t *testing.T) {
+	config := DefaultConfig()
+	caps := Capabilities(config)
+
+	if caps.SchemaVersion != protocol.AuditSchemaVersion {
+		t.Errorf("SchemaVersion = %d", caps.SchemaVersion)
+	}
+	for _, name := range []string{"successful_logins", "auth_methods", "log_tampering"} {
+		if !slices.Contains(caps.LoginCollectors, name) {
+			t.Errorf("LoginCollectors 缺少 %s: %v", name, caps.LoginCollectors)
+		}
+	}
+	if !slices.Contains(caps.Formats, protocol.AuditFormatProtobuf) || !slices.Contains(caps.Formats, protocol.AuditFormatJSON) {
+		t.Errorf("Formats = %v", caps.Formats)
+	}
+	if slices.Contains(caps.LoginAnalyzers, "key-only-auth") {
+		t.Errorf("未启用的分析器不应出现: %v", caps.LoginAnalyzers)
+	}
+
+	// 分析器列表随配置变化
+	config.LoginConfig.KeyOnlyAuth = true
+	if caps := Capabilities(config); !slices.Contains(caps.LoginAnalyzers, "key-only-auth") {
+		t.Errorf("启用后 LoginAnalyzers = %v", caps.LoginAnalyzers)
+	}
+}
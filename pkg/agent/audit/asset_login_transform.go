@@ -0,0 +1,97 @@
+package audit
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/dushixiang/pika/internal/protocol"
+)
+
+// 内置的记录转换
+const (
+	TransformLowercaseUser        = "lowercase-user"        // 用户名转小写
+	TransformStripRealm           = "strip-realm"           // 去除 user@REALM / DOMAIN\user 中的域
+	TransformCanonicalizeIP       = "canonicalize-ip"       // IP 规范化 (IPv6 压缩、IPv4 映射地址还原)
+	TransformCanonicalizeTerminal = "canonicalize-terminal" // 终端名称去除 /dev/ 前缀
+)
+
+// loginFields 记录和会话中可被转换的字段
+type loginFields struct {
+	Username *string
+	IP       *string
+	Terminal *string
+}
+
+// loginTransforms 全部可用的转换
+var loginTransforms = map[string]func(fields loginFields){
+	TransformLowercaseUser: func(fields loginFields) {
+		*fields.Username = strings.ToLower(*fields.Username)
+	},
+	TransformStripRealm: func(fields loginFields) {
+		username := *fields.Username
+		if idx := strings.LastIndex(username, "@"); idx > 0 {
+			username = username[:idx]
+		}
+		if idx := strings.LastIndex(username, `\`); idx != -1 && idx < len(username)-1 {
+			username = username[idx+1:]
+		}
+		*fields.Username = username
+	},
+	TransformCanonicalizeIP: func(fields loginFields) {
+		raw := strings.TrimSuffix(strings.TrimPrefix(*fields.IP, "["), "]")
+		if ip := net.ParseIP(raw); ip != nil {
+			*fields.IP = ip.String()
+		}
+	},
+	TransformCanonicalizeTerminal: func(fields loginFields) {
+		*fields.Terminal = strings.TrimPrefix(*fields.Terminal, "/dev/")
+	},
+}
+
+// loginTransformPipeline 按配置顺序依次执行的转换
+type loginTransformPipeline []func(fields loginFields)
+
+// newLoginTransformPipeline 根据转换名称列表构建转换流水线
+func newLoginTransformPipeline(names []string) (loginTransformPipeline, error) {
+	pipeline := make(loginTransformPipeline, 0, len(names))
+	for _, name := range names {
+		transform, ok := loginTransforms[name]
+		if !ok {
+			return nil, fmt.Errorf("未知的记录转换: %s", name)
+		}
+		pipeline = append(pipeline, transform)
+	}
+	return pipeline, nil
+}
+
+// Apply 对登录资产中的全部记录和会话执行转换
+func (p loginTransformPipeline) Apply(assets *protocol.LoginAssets) {
+	if len(p) == 0 || assets == nil {
+		return
+	}
+
+	for _, records := range [][]protocol.LoginRecord{assets.SuccessfulLogins, assets.FailedLogins} {
+		for i := range records {
+			p.apply(loginFields{
+				Username: &records[i].Username,
+				IP:       &records[i].IP,
+				Terminal: &records[i].Terminal,
+			})
+		}
+	}
+
+	for i := range assets.CurrentSessions {
+		p.apply(loginFields{
+			Username: &assets.CurrentSessions[i].Username,
+			IP:       &assets.CurrentSessions[i].IP,
+			Terminal: &assets.CurrentSessions[i].Terminal,
+		})
+	}
+}
+
+func (p loginTransformPipeline) apply(fields loginFields) {
+	for _, transform := range p {
+		transform(fields)
+	}
+}
@@ -0,0 +1,146 @@
+package audit
+
+import (
+	"encoding/json"
+	"sort"
+
+	"github.com/dushixiang/pika/internal/protocol"
+)
+
+// trimLoginAssets 将登录资产裁剪到 JSON 序列化后不超过 maxBytes，maxBytes<=0 时不裁剪
+// 裁剪顺序 (先丢弃的在前)：
+//  1. 成功登录记录，从最早的开始丢弃
+//  2. 失败登录记录，从最早的开始丢弃
+//  3. 当前会话，从登录最早的开始丢弃
+//
+// keepOldest 为 true 时 (按发送水位收集，见 CollectPending) 登录记录改为从最新的开始丢弃，
+// 被丢弃的记录晚于保留的记录，确认发送后水位不会越过它们。
+//
+// 统计信息 (计数和全部告警)、用户汇总、锁定事件、篡改迹象、sshd 策略、主机位置和主机环境始终保留；
+// 丢弃全部原始记录后仍超出上限时保留其余内容并标记 Exceeded。
+// 裁剪后的记录按时间从新到旧排列，裁剪情况写入 assets.Trimmed。
+// 返回被丢弃的登录记录中最早的时间 (毫秒)，没有丢弃登录记录时为 0
+func trimLoginAssets(assets *protocol.LoginAssets, maxBytes int, keepOldest bool) int64 {
+	if maxBytes <= 0 || assets == nil {
+		return 0
+	}
+	original := payloadSize(assets)
+	if original <= maxBytes {
+		return 0
+	}
+
+	// 标记本身也计入大小，查找时按最大可能的数值占位，填入实际数值后不会变大
+	trimming := &protocol.PayloadTrimming{
+		MaxBytes:                maxBytes,
+		OriginalBytes:           original,
+		TrimmedBytes:            original,
+		DroppedSuccessfulLogins: len(assets.SuccessfulLogins),
+		DroppedFailedLogins:     len(assets.FailedLogins),
+		DroppedSessions:         len(assets.CurrentSessions),
+		Exceeded:                true,
+	}
+	assets.Trimmed = trimming
+	successful, failed, sessions := len(assets.SuccessfulLogins), len(assets.FailedLogins), len(assets.CurrentSessions)
+
+	sortRecords := sortRecordsNewestFirst
+	if keepOldest {
+		sortRecords = sortRecordsOldestFirst
+	}
+	sortRecords(assets.SuccessfulLogins)
+	sortRecords(assets.FailedLogins)
+	sort.SliceStable(assets.CurrentSessions, func(i, j int) bool {
+		return assets.CurrentSessions[i].LoginTime > assets.CurrentSessions[j].LoginTime
+	})
+	allSuccessful, allFailed := assets.SuccessfulLogins, assets.FailedLogins
+
+	if keepLeading(assets, &assets.SuccessfulLogins, maxBytes) > 0 && len(assets.SuccessfulLogins) == 0 {
+		if keepLeading(assets, &assets.FailedLogins, maxBytes) > 0 && len(assets.FailedLogins) == 0 {
+			keepLeading(assets, &assets.CurrentSessions, maxBytes)
+		}
+	}
+	oldestDropped := oldestRecordTime(allSuccessful[len(assets.SuccessfulLogins):], allFailed[len(assets.FailedLogins):])
+	if keepOldest {
+		sortRecordsNewestFirst(assets.SuccessfulLogins)
+		sortRecordsNewestFirst(assets.FailedLogins)
+	}
+	trimming.DroppedSuccessfulLogins = successful - len(assets.SuccessfulLogins)
+	trimming.DroppedFailedLogins = failed - len(assets.FailedLogins)
+	trimming.DroppedSessions = sessions - len(assets.CurrentSessions)
+
+	// 裁剪后的大小包含该数值本身，计算到不再变化为止
+	for {
+		trimming.Exceeded = trimming.TrimmedBytes > maxBytes
+		size := payloadSize(assets)
+		if size == trimming.TrimmedBytes {
+			break
+		}
+		trimming.TrimmedBytes = size
+	}
+	globalLogger.Warn("登录资产超出大小上限 %d 字节 (%d 字节)，已丢弃 %d 条成功登录、%d 条失败登录、%d 个会话",
+		maxBytes, original, trimming.DroppedSuccessfulLogins, trimming.DroppedFailedLogins, trimming.DroppedSessions)
+	return oldestDropped
+}
+
+// keepLeading 保留 items 开头 (按裁剪顺序排在前面) 尽可能多的条目使 assets 不超过 maxBytes，返回丢弃的条数
+// 条目数过多时二分查找保留的条数
+func keepLeading[T any](assets *protocol.LoginAssets, items *[]T, maxBytes int) int {
+	all := *items
+	fits := func(n int) bool {
+		*items = all[:n]
+		return payloadSize(assets) <= maxBytes
+	}
+	if fits(len(all)) {
+		return 0
+	}
+
+	// fits(lo) 为真或 lo 为 0，fits(hi) 为假
+	lo, hi := 0, len(all)
+	for hi-lo > 1 {
+		mid := (lo + hi) / 2
+		if fits(mid) {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	if lo == 0 {
+		*items = nil
+	} else {
+		*items = all[:lo]
+	}
+	return len(all) - lo
+}
+
+func sortRecordsNewestFirst(records []protocol.LoginRecord) {
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].Timestamp > records[j].Timestamp
+	})
+}
+
+func sortRecordsOldestFirst(records []protocol.LoginRecord) {
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].Timestamp < records[j].Timestamp
+	})
+}
+
+// oldestRecordTime 记录中最早的时间 (毫秒)，没有记录时为 0
+func oldestRecordTime(groups ...[]protocol.LoginRecord) int64 {
+	var oldest int64
+	for _, records := range groups {
+		for _, record := range records {
+			if oldest == 0 || record.Timestamp < oldest {
+				oldest = record.Timestamp
+			}
+		}
+	}
+	return oldest
+}
+
+// payloadSize 登录资产 JSON 序列化后的大小
+func payloadSize(assets *protocol.LoginAssets) int {
+	data, err := json.Marshal(assets)
+	if err != nil {
+		return 0
+	}
+	return len(data)
+}
@@ -0,0 +1,71 @@
+package audit
+
+import (
+	"net/netip"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/idna"
+)
+
+// sanitizeUTF8 保证字段是合法的 UTF-8
+// utmp、sshd 日志中的字段有字节长度上限，截断可能落在多字节字符中间，不完整的尾部直接去掉；
+// 其余非法字节替换为 U+FFFD，避免 JSON/protobuf 编码时丢失或出错
+func sanitizeUTF8(s string) string {
+	if utf8.ValidString(s) {
+		return s
+	}
+	for i := len(s) - 1; i >= 0 && i >= len(s)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(s[i]) {
+			if !utf8.FullRuneInString(s[i:]) {
+				s = s[:i]
+			}
+			break
+		}
+	}
+	return strings.ToValidUTF8(s, "\uFFFD")
+}
+
+// normalizeHostname 主机名统一为小写的 ASCII (IDN 转换为 punycode)，去掉末尾的点
+// 反向解析结果本身就是 punycode，统一后同一主机在不同来源中的写法一致；无法转换时保留原值
+func normalizeHostname(name string) string {
+	name = strings.ToLower(strings.TrimSuffix(sanitizeUTF8(name), "."))
+	if ascii, err := idna.Lookup.ToASCII(name); err == nil {
+		return ascii
+	}
+	return name
+}
+
+// localSource 本地登录 (控制台、X 默认显示) 的来源
+const localSource = "localhost"
+
+// normalizeSource 规范化 last/lastb/w/utmp 中的登录来源，规则如下:
+//   - 空、"-" (没有远程来源) 以及 X 默认显示 ":0"、":0.0" 为 "localhost"
+//   - 其他 X 显示 ":N"、":N.M" 为 "localhost:N"，保留显示编号 (多个图形会话)，屏幕编号不区分会话，去掉
+//   - IP 地址保持原样 (包括 127.0.0.1 等回环地址)，由 parseSourceIP 进一步规范化
+//   - 其余按主机名由 normalizeHostname 处理
+//
+// 本地来源都以 "localhost" 开头，判断时使用 isLocalSource
+func normalizeSource(source string) string {
+	source = strings.TrimSpace(source)
+	if source == "" || source == "-" {
+		return localSource
+	}
+	// "::1" 等 IPv6 地址同样以冒号开头，先按 IP 地址解析
+	if _, err := netip.ParseAddr(strings.Trim(source, "[]")); err == nil {
+		return source
+	}
+	if display, ok := strings.CutPrefix(source, ":"); ok {
+		display, _, _ = strings.Cut(display, ".")
+		if display == "" || display == "0" {
+			return localSource
+		}
+		return localSource + ":" + display
+	}
+	return normalizeHostname(source)
+}
+
+// isLocalSource 是否为 normalizeSource 得到的本地来源
+func isLocalSource(source string) bool {
+	return source == localSource || strings.HasPrefix(source, localSource+":")
+}
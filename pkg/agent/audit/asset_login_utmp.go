@@ -0,0 +1,250 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"github.com/dushixiang/pika/internal/protocol"
+)
+
+// utmp/wtmp/btmp 记录布局 (glibc, Linux 上 32/64 位一致)
+const (
+	utmpRecordSize = 384
+
+	utmpOffsetType = 0
+	utmpOffsetPID  = 4
+	utmpOffsetLine = 8
+	utmpOffsetUser = 44
+	utmpOffsetHost = 76
+	utmpOffsetSec  = 340
+	utmpOffsetUsec = 344
+	utmpOffsetAddr = 348
+
+	utmpLineSize = 32
+	utmpUserSize = 32
+	utmpHostSize = 256
+
+	// 每次倒序读取的记录条数
+	utmpTailBatch = 64
+
+	// 从 utmp 读取的当前会话数量上限
+	maxUtmpSessions = 1024
+)
+
+// utmp 记录类型
+const (
+	utmpTypeBootTime     = 2
+	utmpTypeLoginProcess = 6
+	utmpTypeUserProcess  = 7
+	utmpTypeDeadProcess  = 8
+)
+
+// utmpEntry utmp 格式的单条记录
+type utmpEntry struct {
+	Type      int16
+	PID       int32
+	Line      string
+	User      string
+	Host      string
+	Addr      net.IP
+	Timestamp time.Time
+}
+
+// parseUtmpEntry 解析单条定长记录
+func parseUtmpEntry(buf []byte) (*utmpEntry, error) {
+	if len(buf) < utmpRecordSize {
+		return nil, fmt.Errorf("utmp记录长度不足: %d", len(buf))
+	}
+
+	le := binary.LittleEndian
+	entry := &utmpEntry{
+		Type: int16(le.Uint16(buf[utmpOffsetType:])),
+		PID:  int32(le.Uint32(buf[utmpOffsetPID:])),
+		Line: cString(buf[utmpOffsetLine : utmpOffsetLine+utmpLineSize]),
+		User: cString(buf[utmpOffsetUser : utmpOffsetUser+utmpUserSize]),
+		Host: cString(buf[utmpOffsetHost : utmpOffsetHost+utmpHostSize]),
+	}
+
+	sec := int64(int32(le.Uint32(buf[utmpOffsetSec:])))
+	usec := int64(int32(le.Uint32(buf[utmpOffsetUsec:])))
+	entry.Timestamp = time.Unix(sec, usec*1000)
+
+	// ut_addr_v6: IPv4 只占用第一个 int32，其余为 0
+	addr := buf[utmpOffsetAddr : utmpOffsetAddr+16]
+	if bytes.Equal(addr[4:], make([]byte, 12)) {
+		if !bytes.Equal(addr[:4], make([]byte, 4)) {
+			entry.Addr = net.IPv4(addr[0], addr[1], addr[2], addr[3])
+		}
+	} else {
+		entry.Addr = net.IP(append([]byte(nil), addr...))
+	}
+
+	return entry, nil
+}
+
+// cString 截取以 NUL 结尾的定长字符串
+func cString(b []byte) string {
+	if idx := bytes.IndexByte(b, 0); idx != -1 {
+		b = b[:idx]
+	}
+	return string(b)
+}
+
+// readUtmpTail 从文件尾部按定长记录倒序读取，返回最新的 n 条满足条件的记录 (新的在前)
+// 读取开销只与 n 相关，与文件大小无关。文件可能正在被追加写入：
+// 只读取开始时已完整写入的记录，末尾不完整的记录会被忽略。
+// since 不为零值时，遇到早于 since 的记录即停止读取。
+func readUtmpTail(path string, n int, since time.Time, accept func(*utmpEntry) bool) ([]utmpEntry, error) {
+	file, err := openLogFile(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	// 快照当前大小并对齐到记录边界
+	end := info.Size() - info.Size()%utmpRecordSize
+
+	var entries []utmpEntry
+	buf := make([]byte, utmpTailBatch*utmpRecordSize)
+	for end > 0 && len(entries) < n {
+		start := end - int64(len(buf))
+		if start < 0 {
+			start = 0
+		}
+		chunk := buf[:end-start]
+
+		read, err := file.ReadAt(chunk, start)
+		if err != nil && !errors.Is(err, io.EOF) {
+			return entries, err
+		}
+		if int64(read) < end-start {
+			// 读取过程中文件被截断 (如日志轮转)，已读取到的记录仍然有效
+			globalLogger.Debug("读取 %s 时文件被截断", path)
+			return entries, nil
+		}
+
+		for off := len(chunk) - utmpRecordSize; off >= 0 && len(entries) < n; off -= utmpRecordSize {
+			entry, err := parseUtmpEntry(chunk[off : off+utmpRecordSize])
+			if err != nil {
+				continue
+			}
+			if !since.IsZero() && entry.Timestamp.Before(since) {
+				return entries, nil
+			}
+			if accept != nil && !accept(entry) {
+				continue
+			}
+			entries = append(entries, *entry)
+		}
+
+		end = start
+	}
+
+	return entries, nil
+}
+
+// isUtmpLoginEntry 是否为登录相关记录
+func isUtmpLoginEntry(entry *utmpEntry) bool {
+	return (entry.Type == utmpTypeUserProcess || entry.Type == utmpTypeLoginProcess) && entry.User != ""
+}
+
+// toLoginRecord 转换为登录记录
+func (entry *utmpEntry) toLoginRecord(status string) protocol.LoginRecord {
+	ip := entry.Host
+	if ip == "" && entry.Addr != nil {
+		ip = entry.Addr.String()
+	}
+
+	return protocol.LoginRecord{
+		Username:  sanitizeUTF8(entry.User),
+		Terminal:  entry.Line,
+		IP:        normalizeSource(ip),
+		Timestamp: entry.Timestamp.UnixMilli(),
+		Status:    status,
+	}
+}
+
+// collectSuccessfulLoginsFromWtmp 从 wtmp 尾部直接读取最新的成功登录
+func (lac *LoginAssetsCollector) collectSuccessfulLoginsFromWtmp(limit int, since time.Time) ([]protocol.LoginRecord, error) {
+	entries, err := readUtmpTail(lac.config.LoginConfig.WtmpPath, limit, since, isUtmpUserProcess)
+	if err != nil {
+		return nil, err
+	}
+
+	records := make([]protocol.LoginRecord, 0, len(entries))
+	for i := range entries {
+		records = append(records, entries[i].toLoginRecord("success"))
+	}
+	return records, nil
+}
+
+// collectCurrentSessionsFromUtmp 直接读取 utmp 获取当前登录会话 (utmp 中没有空闲时间)
+func (lac *LoginAssetsCollector) collectCurrentSessionsFromUtmp() ([]protocol.LoginSession, error) {
+	entries, err := readUtmpTail(lac.config.LoginConfig.UtmpPath, maxUtmpSessions, time.Time{}, isUtmpUserProcess)
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := make([]protocol.LoginSession, 0, len(entries))
+	for i := len(entries) - 1; i >= 0; i-- {
+		record := entries[i].toLoginRecord("")
+		sessions = append(sessions, protocol.LoginSession{
+			Username:  record.Username,
+			Terminal:  record.Terminal,
+			IP:        record.IP,
+			LoginTime: record.Timestamp,
+		})
+	}
+	return sessions, nil
+}
+
+// applyUtmpLoginTimes 使用 utmp 中的实际登录时间替换 w 输出推算的登录时间
+// w 只能给出空闲时间，按终端和用户名匹配 utmp 会话，utmp 不可读时保留推算值
+func (lac *LoginAssetsCollector) applyUtmpLoginTimes(sessions []protocol.LoginSession) {
+	if len(sessions) == 0 {
+		return
+	}
+	utmpSessions, err := lac.collectCurrentSessionsFromUtmp()
+	if err != nil {
+		globalLogger.Debug("读取utmp登录时间失败: %v", err)
+		return
+	}
+
+	// utmpSessions 从新到旧排列，同一终端以最新的记录为准
+	loginTimes := make(map[string]int64, len(utmpSessions))
+	for _, session := range utmpSessions {
+		key := session.Username + "\x00" + session.Terminal
+		if _, ok := loginTimes[key]; !ok && session.LoginTime > 0 {
+			loginTimes[key] = session.LoginTime
+		}
+	}
+	for i := range sessions {
+		if loginTime, ok := loginTimes[sessions[i].Username+"\x00"+sessions[i].Terminal]; ok {
+			sessions[i].LoginTime = loginTime
+		}
+	}
+}
+
+// collectFailedLoginsFromBtmp 从 btmp 尾部直接读取最新的失败登录
+func (lac *LoginAssetsCollector) collectFailedLoginsFromBtmp(limit int, since time.Time) ([]protocol.LoginRecord, error) {
+	entries, err := readUtmpTail(lac.config.LoginConfig.BtmpPath, limit, since, isUtmpLoginEntry)
+	if err != nil {
+		return nil, err
+	}
+
+	records := make([]protocol.LoginRecord, 0, len(entries))
+	for i := range entries {
+		records = append(records, entries[i].toLoginRecord("failed"))
+	}
+	return records, nil
+}
@@ -0,0 +1,92 @@
+package audit
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// wLayout w 输出中各列的位置
+type wLayout struct {
+	from int // 来源列，超出字段数时来源为空 (本地会话)
+	idle int // 空闲时间列
+	what int // 正在运行的命令列，之后的字段都属于该列，<0 时没有该列
+
+	// BusyBox 的空闲时间格式为 "." (不到一分钟)、"时:分" 或 "old" (超过一天)
+	busybox bool
+}
+
+// procps 的列: USER TTY FROM LOGIN@ IDLE JCPU PCPU WHAT
+var procpsWLayout = wLayout{from: 2, idle: 4, what: 7}
+
+// isWBanner w 不带 -h 时输出的第一行 (与 uptime 相同)
+// 如 " 10:15:01 up 3 days,  2:10,  2 users,  load average: 0.00, 0.01, 0.05"，会话行的第二列是终端，不会是 up
+func isWBanner(fields []string) bool {
+	return len(fields) >= 2 && fields[1] == "up" && strings.Contains(fields[0], ":")
+}
+
+// parseWHeader 按标题行确定列的位置，fields 不是标题行时返回 false
+// BusyBox 的标题为 "USER TTY IDLE TIME HOST"，TIME 列 ("Jan  2 10:00:0") 占 3 个字段，HOST 列随之后移
+func parseWHeader(fields []string) (wLayout, bool) {
+	if len(fields) < 3 || fields[0] != "USER" || fields[1] != "TTY" {
+		return wLayout{}, false
+	}
+	if slices.Contains(fields, "FROM") {
+		layout := wLayout{from: slices.Index(fields, "FROM"), idle: slices.Index(fields, "IDLE"), what: slices.Index(fields, "WHAT")}
+		if layout.idle < 0 {
+			layout.idle = procpsWLayout.idle
+		}
+		return layout, true
+	}
+
+	layout := wLayout{from: slices.Index(fields, "HOST"), idle: slices.Index(fields, "IDLE"), what: -1, busybox: true}
+	if time := slices.Index(fields, "TIME"); time >= 0 && time < layout.from {
+		layout.from += 2
+	}
+	if layout.idle < 0 {
+		layout.idle = 2
+	}
+	return layout, true
+}
+
+// idleSeconds 按列位置解析一行的空闲时间
+func (l wLayout) idleSeconds(lac *LoginAssetsCollector, fields []string) int {
+	idx := l.idle
+	if idx >= len(fields) {
+		// 较早的 procps 没有 LOGIN@ 列
+		idx = len(fields) - 1
+	}
+	idleStr := fields[idx]
+	if !l.busybox {
+		return lac.parseIdleTime(idleStr)
+	}
+
+	switch idleStr {
+	case ".":
+		return 0
+	case "old":
+		return 86400
+	}
+	var hours, minutes int
+	if _, err := fmt.Sscanf(idleStr, "%d:%d", &hours, &minutes); err == nil {
+		return hours*3600 + minutes*60
+	}
+	globalLogger.Debug("无法识别的空闲时间: %s", idleStr)
+	return 0
+}
+
+// process 按列位置取一行正在运行的命令，命令带参数时包含空格，取该列之后的全部字段
+func (l wLayout) process(fields []string) string {
+	if l.what < 0 || l.what >= len(fields) {
+		return ""
+	}
+	return strings.Join(fields[l.what:], " ")
+}
+
+// source 按列位置取一行的来源，没有来源列时返回空
+func (l wLayout) source(fields []string) string {
+	if l.from < 0 || l.from >= len(fields) {
+		return ""
+	}
+	return fields[l.from]
+}
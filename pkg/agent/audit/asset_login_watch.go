@@ -0,0 +1,242 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"os"
+	"time"
+
+	"github.com/dushixiang/pika/internal/protocol"
+)
+
+// 去重窗口最多保留的日志行数
+const dedupRingSize = 1024
+
+// logFollower 跟踪追加写入的日志文件，处理 rename 和 copytruncate 两种轮转方式
+type logFollower struct {
+	path    string
+	file    *os.File
+	info    os.FileInfo
+	offset  int64
+	partial []byte
+}
+
+// openLogFollower 打开日志文件，fromStart 为 false 时只读取此后新增的内容
+func openLogFollower(path string, fromStart bool) (*logFollower, error) {
+	f := &logFollower{path: path}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	if !fromStart {
+		f.offset = f.info.Size()
+	}
+	return f, nil
+}
+
+func (f *logFollower) open() error {
+	file, err := openLogFile(f.path)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	f.file = file
+	f.info = info
+	f.offset = 0
+	f.partial = nil
+	return nil
+}
+
+// poll 读取自上次以来新增的完整行
+func (f *logFollower) poll() ([]string, error) {
+	// rename 轮转：先读完旧文件剩余内容，再从头读取新文件
+	if info, err := os.Stat(f.path); err == nil && !os.SameFile(info, f.info) {
+		lines, err := f.readLines()
+		if err != nil {
+			return lines, err
+		}
+		f.file.Close()
+		if err := f.open(); err != nil {
+			return lines, err
+		}
+		more, err := f.readLines()
+		return append(lines, more...), err
+	}
+
+	// copytruncate 轮转：文件被截断，从头读取
+	if info, err := f.file.Stat(); err == nil && info.Size() < f.offset {
+		f.offset = 0
+		f.partial = nil
+	}
+
+	return f.readLines()
+}
+
+// readLines 从当前位置读取到文件末尾，不完整的最后一行留到下次
+func (f *logFollower) readLines() ([]string, error) {
+	var lines []string
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := f.file.ReadAt(buf, f.offset)
+		if n > 0 {
+			f.offset += int64(n)
+			data := append(f.partial, buf[:n]...)
+			for {
+				idx := bytes.IndexByte(data, '\n')
+				if idx == -1 {
+					break
+				}
+				lines = append(lines, string(data[:idx]))
+				data = data[idx+1:]
+			}
+			f.partial = append([]byte(nil), data...)
+		}
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return lines, nil
+			}
+			return lines, err
+		}
+	}
+}
+
+func (f *logFollower) Close() error {
+	return f.file.Close()
+}
+
+// dedupWindow 最近出现过的日志行，用于过滤轮转时重复读取的内容
+type dedupWindow struct {
+	window  time.Duration
+	entries [dedupRingSize]dedupEntry
+	next    int
+}
+
+type dedupEntry struct {
+	hash uint64
+	seen time.Time
+}
+
+// seen 窗口内是否已经出现过该行，未出现时记录下来
+// 相隔超过窗口的相同行视为新的事件
+func (d *dedupWindow) seen(line string, now time.Time) bool {
+	if d.window <= 0 {
+		return false
+	}
+
+	h := fnv.New64a()
+	h.Write([]byte(line))
+	hash := h.Sum64()
+
+	for i := range d.entries {
+		entry := &d.entries[i]
+		if entry.hash == hash && !entry.seen.IsZero() && now.Sub(entry.seen) < d.window {
+			return true
+		}
+	}
+
+	d.entries[d.next] = dedupEntry{hash: hash, seen: now}
+	d.next = (d.next + 1) % dedupRingSize
+	return false
+}
+
+// failedLoginWatcher 实时跟踪认证日志中的失败登录
+type failedLoginWatcher struct {
+	lac      *LoginAssetsCollector
+	follower *logFollower
+	dedup    *dedupWindow
+}
+
+// step 处理一次新增的日志
+func (w *failedLoginWatcher) step(handler func(protocol.LoginRecord)) error {
+	lines, err := w.follower.poll()
+	for _, line := range lines {
+		if !isFailedLoginLine(line) || w.dedup.seen(line, w.lac.now()) {
+			continue
+		}
+		if record := w.lac.parseFailedLoginFromLog(line); record != nil {
+			record.RecordID = protocol.LoginRecordID(*record)
+			handler(*record)
+		}
+	}
+	return err
+}
+
+// WatchFailedLogins 实时跟踪认证日志，每出现一条失败登录调用一次 handler，直到 ctx 取消
+func (lac *LoginAssetsCollector) WatchFailedLogins(ctx context.Context, handler func(protocol.LoginRecord)) error {
+	w, err := lac.newFailedLoginWatcher()
+	if err != nil {
+		return err
+	}
+	defer w.follower.Close()
+	return w.run(ctx, handler)
+}
+
+// Watch 实时跟踪认证日志，通过 channel 输出新增的失败登录，用于近实时的暴力破解告警
+// 打开认证日志后从末尾开始读取，轮转 (inode 变化或截断) 后继续跟踪新文件；
+// 打开失败时返回错误，ctx 取消后关闭 channel。调用方需要持续读取 channel，否则跟踪会阻塞
+func (lac *LoginAssetsCollector) Watch(ctx context.Context) (<-chan protocol.LoginRecord, error) {
+	w, err := lac.newFailedLoginWatcher()
+	if err != nil {
+		return nil, err
+	}
+
+	records := make(chan protocol.LoginRecord)
+	go func() {
+		defer close(records)
+		defer w.follower.Close()
+		w.run(ctx, func(record protocol.LoginRecord) {
+			select {
+			case records <- record:
+			case <-ctx.Done():
+			}
+		})
+	}()
+	return records, nil
+}
+
+// newFailedLoginWatcher 打开认证日志 (配置了 AuthLogPaths 时为匹配的文件中最新的一个)，只跟踪此后新增的内容
+func (lac *LoginAssetsCollector) newFailedLoginWatcher() (*failedLoginWatcher, error) {
+	files := lac.authLogFiles()
+	if len(files) == 0 {
+		return nil, fmt.Errorf("未找到认证日志")
+	}
+
+	follower, err := openLogFollower(files[len(files)-1], false)
+	if err != nil {
+		return nil, err
+	}
+	return &failedLoginWatcher{
+		lac:      lac,
+		follower: follower,
+		dedup:    &dedupWindow{window: lac.config.LoginConfig.WatchDedupWindow},
+	}, nil
+}
+
+// run 按 WatchPollInterval 读取新增的日志，直到 ctx 取消
+func (w *failedLoginWatcher) run(ctx context.Context, handler func(protocol.LoginRecord)) error {
+	interval := w.lac.config.LoginConfig.WatchPollInterval
+	if interval <= 0 {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			if err := w.step(handler); err != nil {
+				globalLogger.Debug("读取认证日志失败: %v", err)
+			}
+		}
+	}
+}
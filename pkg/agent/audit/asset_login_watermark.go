@@ -0,0 +1,180 @@
+package audit
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/dushixiang/pika/internal/protocol"
+	"github.com/dushixiang/pika/pkg/agent/sysutil"
+)
+
+// transmissionWatermark 已确认发送的水位
+type transmissionWatermark struct {
+	Timestamp int64  `json:"timestamp"`          // 已确认发送的最新记录时间(毫秒)
+	RecordID  string `json:"recordId,omitempty"` // 确认时指定的记录
+}
+
+// watermarkTracker 跟踪已收集但尚未确认发送的记录
+// 水位只在宿主程序确认发送成功后前进，收集成功而发送失败时下一次收集仍会包含这些记录
+type watermarkTracker struct {
+	path string
+
+	mu      sync.Mutex
+	acked   transmissionWatermark
+	pending map[string]int64 // 记录标识 -> 记录时间(毫秒)
+
+	// 最近一次收集因条数或大小上限未返回的记录中最早的时间(毫秒)，为 0 时没有未返回的记录
+	// 水位最多前进到该时间 (收集的起点包含该时间，这些记录会在下一次收集中返回)
+	ceiling int64
+}
+
+func newWatermarkTracker(path string) *watermarkTracker {
+	t := &watermarkTracker{path: path, pending: make(map[string]int64)}
+	if path == "" {
+		return t
+	}
+	if err := t.load(); err != nil && !errors.Is(err, os.ErrNotExist) {
+		globalLogger.Warn("读取发送水位失败，将重新发送全部记录: %v", err)
+	}
+	return t
+}
+
+func (t *watermarkTracker) load() error {
+	file, err := sysutil.OpenNoFollow(t.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, &t.acked)
+}
+
+func (t *watermarkTracker) save() error {
+	if t.path == "" {
+		return nil
+	}
+	data, err := json.Marshal(t.acked)
+	if err != nil {
+		return err
+	}
+	return sysutil.WriteFileAtomic(t.path, data, 0600)
+}
+
+// since 下一次收集的起点
+func (t *watermarkTracker) since() time.Time {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.acked.Timestamp == 0 {
+		return time.Time{}
+	}
+	return time.UnixMilli(t.acked.Timestamp)
+}
+
+// track 记录本次收集中待确认的记录，ceiling 为本次收集未返回的记录中最早的时间 (毫秒)，0 表示全部返回
+func (t *watermarkTracker) track(assets *protocol.LoginAssets, ceiling int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.ceiling = ceiling
+
+	for _, records := range [][]protocol.LoginRecord{assets.SuccessfulLogins, assets.FailedLogins} {
+		for _, record := range records {
+			if record.RecordID != "" && record.Timestamp > t.acked.Timestamp {
+				t.pending[record.RecordID] = record.Timestamp
+			}
+		}
+	}
+}
+
+// ack 确认发送到 recordID 为止 (含与其同一时间及更早的全部记录)
+// 最近一次收集有未返回的记录时，水位最多前进到其中最早的时间
+func (t *watermarkTracker) ack(recordID string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	timestamp, ok := t.pending[recordID]
+	if !ok {
+		return fmt.Errorf("记录 %s 不在待确认的记录中", recordID)
+	}
+	if t.ceiling > 0 && timestamp > t.ceiling {
+		timestamp = t.ceiling
+	}
+	if timestamp <= t.acked.Timestamp {
+		return nil
+	}
+
+	previous := t.acked
+	t.acked = transmissionWatermark{Timestamp: timestamp, RecordID: recordID}
+	if err := t.save(); err != nil {
+		t.acked = previous
+		return fmt.Errorf("保存发送水位失败: %w", err)
+	}
+	for id, ts := range t.pending {
+		if ts <= timestamp {
+			delete(t.pending, id)
+		}
+	}
+	return nil
+}
+
+// CollectPending 收集尚未确认发送的登录记录 (已确认水位之后的记录)
+// 宿主程序发送成功后调用 AckTransmitted 推进水位；发送失败时不调用，下一次收集会重新包含这些记录。
+// 水位按记录时间推进，与水位同一时间的记录会再次出现，接收方应按 RecordID 去重。
+//
+// 已有水位时从最早的记录开始返回：超过 MaxLoginRecords 或 MaxPayloadBytes 时丢弃最新的记录，
+// 水位不会越过未返回的记录，它们在之后的收集中返回。尚未确认过时与 Collect 相同，只返回最新的记录
+func (lac *LoginAssetsCollector) CollectPending() *CollectResult {
+	result, ceiling := lac.collectSince(lac.watermark.since(), true)
+	lac.watermark.track(result.Assets, ceiling)
+	return result
+}
+
+// AckTransmitted 确认 CollectPending 返回的记录已发送到 upToID 为止，水位前进到该记录的时间并持久化
+// upToID 应为最近一次 CollectPending 已发送记录中最新的一条，不在待确认记录中时返回错误，水位不变
+func (lac *LoginAssetsCollector) AckTransmitted(upToID string) error {
+	return lac.watermark.ack(upToID)
+}
+
+// TransmittedWatermark 已确认发送的水位，尚未确认过时为零值
+func (lac *LoginAssetsCollector) TransmittedWatermark() time.Time {
+	return lac.watermark.since()
+}
+
+// unlimitedRecords 按水位收集时读取的条数不设上限 (读取量受水位之后的时间范围限制)
+const unlimitedRecords = math.MaxInt
+
+// limitArgs 构造 last/lastb 的 -n 参数，不限制条数时为空
+func limitArgs(limit int) []string {
+	if limit == unlimitedRecords {
+		return nil
+	}
+	return []string{"-n", strconv.Itoa(limit)}
+}
+
+// oldestLoginRecords 保留最早的 limit 条记录 (与第 limit 条同一时间的记录一并保留，使水位可以越过该时间)，
+// 返回保留的记录 (从新到旧) 和未保留的记录
+func oldestLoginRecords(records []protocol.LoginRecord, limit int) (kept, left []protocol.LoginRecord) {
+	if len(records) <= limit {
+		return records, nil
+	}
+	sortRecordsOldestFirst(records)
+	n := limit
+	for n < len(records) && records[n].Timestamp == records[limit-1].Timestamp {
+		n++
+	}
+	kept, left = records[:n:n], records[n:]
+	sortRecordsNewestFirst(kept)
+	return kept, left
+}
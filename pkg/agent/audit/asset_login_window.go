@@ -0,0 +1,77 @@
+package audit
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sinceTimeLayout last/lastb/journalctl 的 --since 均可接受的时间格式
+const sinceTimeLayout = "2006-01-02 15:04:05"
+
+// ParseRelativeWindow 解析相对时间窗口，如 "-1h"、"24h"、"7d"
+// 前导的 "-" 可省略，窗口总是指向过去
+func ParseRelativeWindow(window string) (time.Duration, error) {
+	raw := strings.TrimPrefix(strings.TrimSpace(window), "-")
+	if raw == "" {
+		return 0, fmt.Errorf("时间窗口为空")
+	}
+
+	var d time.Duration
+	if days, ok := strings.CutSuffix(raw, "d"); ok {
+		n, err := strconv.ParseFloat(days, 64)
+		if err != nil {
+			return 0, fmt.Errorf("无效的时间窗口: %s", window)
+		}
+		d = time.Duration(n * float64(24*time.Hour))
+	} else {
+		var err error
+		d, err = time.ParseDuration(raw)
+		if err != nil {
+			return 0, fmt.Errorf("无效的时间窗口: %s", window)
+		}
+	}
+
+	if d <= 0 {
+		return 0, fmt.Errorf("时间窗口必须大于0: %s", window)
+	}
+	return d, nil
+}
+
+// resolveWindow 将相对时间窗口换算为起始时间
+func (lac *LoginAssetsCollector) resolveWindow(window string) (time.Time, error) {
+	d, err := ParseRelativeWindow(window)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	cfg := lac.config.LoginConfig
+	if cfg.MaxQueryWindow > 0 && d > cfg.MaxQueryWindow && !cfg.AllowLongQueryWindow {
+		return time.Time{}, fmt.Errorf("时间窗口 %s 超过上限 %s", window, cfg.MaxQueryWindow)
+	}
+
+	return lac.now().Add(-d), nil
+}
+
+// CollectWithin 收集最近一段时间内的登录记录，window 如 "-1h"、"24h"
+func (lac *LoginAssetsCollector) CollectWithin(window string) (*CollectResult, error) {
+	since, err := lac.resolveWindow(window)
+	if err != nil {
+		return nil, err
+	}
+	return lac.CollectSince(since), nil
+}
+
+// sinceArgs 构造命令行 --since 参数，since 为零值时不限制
+func sinceArgs(since time.Time) []string {
+	if since.IsZero() {
+		return nil
+	}
+	return []string{"--since", since.Local().Format(sinceTimeLayout)}
+}
+
+// before 毫秒时间戳是否早于 since，since 为零值时不过滤
+func before(timestamp int64, since time.Time) bool {
+	return !since.IsZero() && timestamp < since.UnixMilli()
+}
@@ -4,7 +4,6 @@ import (
 	"fmt"
 	"os"
 	"runtime"
-	"sync"
 	"time"
 
 	"github.com/dushixiang/pika/internal/protocol"
@@ -42,6 +41,8 @@ func NewAuditor(config *Config) *Auditor {
 	// 初始化共享组件
 	cache := NewProcessCache(config.PerformanceConfig.ProcessCacheDuration)
 	executor := NewCommandExecutor(config.PerformanceConfig.CommandTimeout)
+	executor.SetNoExec(config.PerformanceConfig.NoExec)
+	executor.SetRetry(config.PerformanceConfig.CommandRetryAttempts, config.PerformanceConfig.CommandRetryBackoff)
 
 	// 初始化资产收集器
 	return &Auditor{
@@ -117,48 +118,40 @@ func (a *Auditor) RunAudit() (*protocol.VPSAuditResult, error) {
 func (a *Auditor) collectAssets() *protocol.AssetInventory {
 	inventory := &protocol.AssetInventory{}
 
-	// 并发收集各类资产
-	type assetTask struct {
-		name string
-		fn   func()
+	// 并发收集各类资产，禁用的收集器不运行
+	result := a.registry().Run()
+	for _, asset := range result.Assets {
+		switch asset := asset.(type) {
+		case *protocol.NetworkAssets:
+			inventory.NetworkAssets = asset
+		case *protocol.ProcessAssets:
+			inventory.ProcessAssets = asset
+		case *protocol.UserAssets:
+			inventory.UserAssets = asset
+		case *protocol.FileAssets:
+			inventory.FileAssets = asset
+		case *protocol.KernelAssets:
+			inventory.KernelAssets = asset
+		case *protocol.LoginAssets:
+			inventory.LoginAssets = asset
+		}
 	}
 
-	tasks := []assetTask{
-		{"网络资产", func() {
-			inventory.NetworkAssets = a.networkAssetsCollector.Collect()
-		}},
-		{"进程资产", func() {
-			inventory.ProcessAssets = a.processAssetsCollector.Collect()
-		}},
-		{"用户资产", func() {
-			inventory.UserAssets = a.userAssetsCollector.Collect()
-		}},
-		{"文件资产", func() {
-			inventory.FileAssets = a.fileAssetsCollector.Collect()
-		}},
-		{"内核资产", func() {
-			inventory.KernelAssets = a.kernelAssetsCollector.Collect()
-		}},
-		{"登录资产", func() {
-			inventory.LoginAssets = a.loginAssetsCollector.Collect()
-		}},
-	}
-
-	// 并发执行
-	var wg sync.WaitGroup
-	for _, task := range tasks {
-		wg.Add(1)
-		go func(t assetTask) {
-			defer wg.Done()
-			globalLogger.Debug("收集%s...", t.name)
-			t.fn()
-		}(task)
-	}
-	wg.Wait()
-
 	return inventory
 }
 
+// registry 按配置创建包含全部资产收集器的注册表
+func (a *Auditor) registry() *Registry {
+	registry := NewRegistry(a.config.DisabledCollectors)
+	registry.Register(a.networkAssetsCollector)
+	registry.Register(a.processAssetsCollector)
+	registry.Register(a.userAssetsCollector)
+	registry.Register(a.fileAssetsCollector)
+	registry.Register(a.kernelAssetsCollector)
+	registry.Register(a.loginAssetsCollector)
+	return registry
+}
+
 // calculateStatistics 计算统计信息
 func (a *Auditor) calculateStatistics(inventory *protocol.AssetInventory) *protocol.AuditStatistics {
 	stats := &protocol.AuditStatistics{}
@@ -186,9 +179,15 @@ func (a *Auditor) calculateStatistics(inventory *protocol.AssetInventory) *proto
 	return stats
 }
 
+// Close 释放收集器持有的资源
+func (a *Auditor) Close() error {
+	return a.loginAssetsCollector.Close()
+}
+
 // RunAuditWithConfig 使用自定义配置执行资产收集
 func RunAuditWithConfig(config *Config) (*protocol.VPSAuditResult, error) {
 	auditor := NewAuditor(config)
+	defer auditor.Close()
 	return auditor.RunAudit()
 }
 
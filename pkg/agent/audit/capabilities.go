@@ -0,0 +1,51 @@
+package audit
+
+import (
+	"time"
+
+	"github.com/dushixiang/pika/internal/protocol"
+)
+
+// assetCollectorNames 资产收集器名称，与 AssetInventory 中的字段对应
+var assetCollectorNames = []string{
+	"networkAssets",
+	"processAssets",
+	"userAssets",
+	"fileAssets",
+	"kernelAssets",
+	"loginAssets",
+}
+
+// Capabilities 当前构建和配置支持的收集器、分析器和输出格式
+// 不创建收集器、不读取文件也不执行命令，可以频繁调用
+func Capabilities(config *Config) protocol.AgentCapabilities {
+	if config == nil {
+		config = DefaultConfig()
+	}
+
+	// 只取名称，不会执行子收集器
+	var loginCollectors []string
+	for _, sub := range (&LoginAssetsCollector{}).subCollectors(time.Time{}, 0) {
+		loginCollectors = append(loginCollectors, sub.name)
+	}
+
+	var loginAnalyzers []string
+	for _, analyzer := range defaultLoginAnalyzers(config, time.Now) {
+		loginAnalyzers = append(loginAnalyzers, analyzer.Name())
+	}
+
+	return protocol.AgentCapabilities{
+		SchemaVersion:   protocol.AuditSchemaVersion,
+		Collectors:      append([]string(nil), assetCollectorNames...),
+		LoginCollectors: loginCollectors,
+		LoginAnalyzers:  loginAnalyzers,
+		Formats:         []string{protocol.AuditFormatJSON, protocol.AuditFormatProtobuf},
+		// 探针不加载补充数据库，归属地等由服务端补充
+		Databases: protocol.CapabilityDatabases{},
+	}
+}
+
+// Capabilities 审计器使用的配置对应的能力
+func (a *Auditor) Capabilities() protocol.AgentCapabilities {
+	return Capabilities(a.config)
+}
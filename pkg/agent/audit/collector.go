@@ -0,0 +1,150 @@
+package audit
+
+import (
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"slices"
+	"sync"
+)
+
+// 资产收集器名称，用于 Config.DisabledCollectors
+const (
+	CollectorNetwork = "network"
+	CollectorProcess = "process"
+	CollectorUser    = "user"
+	CollectorFile    = "file"
+	CollectorKernel  = "kernel"
+	CollectorLogin   = "login"
+)
+
+// Collector 资产收集器的统一接口
+// 各收集器的 Collect 返回具体的资产类型，CollectAsset 返回同样的结果以便统一调度
+type Collector interface {
+	// Name 收集器名称，在 Registry 中唯一
+	Name() string
+	// CollectAsset 收集资产，有错误时仍可返回部分结果
+	CollectAsset() (any, error)
+}
+
+// RegistryResult 一次运行全部收集器的结果
+type RegistryResult struct {
+	// 收集器名称 -> 资产
+	Assets map[string]any
+
+	// 收集器名称 -> 错误 (包括 panic)
+	Errors map[string]error
+}
+
+// Registry 资产收集器注册表，按注册顺序保存并发运行的收集器
+type Registry struct {
+	collectors []Collector
+	disabled   map[string]bool
+}
+
+// NewRegistry 创建注册表，disabled 中的收集器注册后不运行
+func NewRegistry(disabled []string) *Registry {
+	r := &Registry{disabled: make(map[string]bool)}
+	for _, name := range disabled {
+		r.disabled[name] = true
+	}
+	return r
+}
+
+// Register 注册收集器，名称已存在时替换原有的收集器
+func (r *Registry) Register(collector Collector) {
+	index := slices.IndexFunc(r.collectors, func(c Collector) bool {
+		return c.Name() == collector.Name()
+	})
+	if index >= 0 {
+		r.collectors[index] = collector
+		return
+	}
+	r.collectors = append(r.collectors, collector)
+}
+
+// Names 已注册且未禁用的收集器名称
+func (r *Registry) Names() []string {
+	var names []string
+	for _, collector := range r.collectors {
+		if !r.disabled[collector.Name()] {
+			names = append(names, collector.Name())
+		}
+	}
+	return names
+}
+
+// Run 并发运行未禁用的收集器，单个收集器失败或 panic 不影响其他收集器
+func (r *Registry) Run() *RegistryResult {
+	result := &RegistryResult{
+		Assets: make(map[string]any),
+		Errors: make(map[string]error),
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, collector := range r.collectors {
+		if r.disabled[collector.Name()] {
+			globalLogger.Debug("资产收集器 %s 已禁用", collector.Name())
+			continue
+		}
+		wg.Add(1)
+		go func(c Collector) {
+			defer wg.Done()
+			globalLogger.Debug("收集%s资产...", c.Name())
+			asset, err := runCollector(c)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if asset != nil {
+				result.Assets[c.Name()] = asset
+			}
+			if err != nil {
+				globalLogger.Warn("资产收集器 %s 失败: %v", c.Name(), err)
+				result.Errors[c.Name()] = err
+			}
+		}(collector)
+	}
+	wg.Wait()
+
+	return result
+}
+
+// runCollector 执行单个收集器，将 panic 转换为错误
+func runCollector(collector Collector) (asset any, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			globalLogger.Error("资产收集器 %s panic: %v\n%s", collector.Name(), r, debug.Stack())
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return collector.CollectAsset()
+}
+
+func (nac *NetworkAssetsCollector) Name() string { return CollectorNetwork }
+
+func (nac *NetworkAssetsCollector) CollectAsset() (any, error) { return nac.Collect(), nil }
+
+func (pac *ProcessAssetsCollector) Name() string { return CollectorProcess }
+
+func (pac *ProcessAssetsCollector) CollectAsset() (any, error) { return pac.Collect(), nil }
+
+func (uac *UserAssetsCollector) Name() string { return CollectorUser }
+
+func (uac *UserAssetsCollector) CollectAsset() (any, error) { return uac.Collect(), nil }
+
+func (fac *FileAssetsCollector) Name() string { return CollectorFile }
+
+func (fac *FileAssetsCollector) CollectAsset() (any, error) { return fac.Collect(), nil }
+
+func (kac *KernelAssetsCollector) Name() string { return CollectorKernel }
+
+func (kac *KernelAssetsCollector) CollectAsset() (any, error) { return kac.Collect(), nil }
+
+func (lac *LoginAssetsCollector) Name() string { return CollectorLogin }
+
+// CollectAsset 收集登录资产，子收集器的错误合并返回
+func (lac *LoginAssetsCollector) CollectAsset() (any, error) {
+	assets, errs := lac.CollectWithErrors()
+	return assets, errors.Join(errs...)
+}
@@ -0,0 +1,71 @@
+package audit
+
+import (
+	"errors"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/dushixiang/pika/internal/protocol"
+)
+
+// fakeCollector 返回固定结果的资产收集器
+type fakeCollector struct {
+	name  string
+	asset any
+	err   error
+	panic bool
+}
+
+func (c *fakeCollector) Name() string { return c.name }
+
+func (c *fakeCollector) CollectAsset() (any, error) {
+	if c.panic {
+		panic("boom")
+	}
+	return c.asset, c.err
+}
+
+func TestCollectorRegistry(t *testing.T) {
+	dir := t.TempDir()
+	config := DefaultConfig()
+	config.LoginConfig.WtmpPath = filepath.Join(dir, "wtmp")
+	config.LoginConfig.BtmpPath = filepath.Join(dir, "btmp")
+	config.LoginConfig.UtmpPath = filepath.Join(dir, "utmp")
+	login := NewLoginAssetsCollector(config, &fakeCommandRunner{outputs: map[string]string{}})
+
+	registry := NewRegistry([]string{"disabled"})
+	registry.Register(login)
+	registry.Register(&fakeCollector{name: "ok", asset: "first"})
+	registry.Register(&fakeCollector{name: "ok", asset: "second"})
+	registry.Register(&fakeCollector{name: "failing", asset: "partial", err: errors.New("denied")})
+	registry.Register(&fakeCollector{name: "crashing", panic: true})
+	registry.Register(&fakeCollector{name: "disabled", asset: "never"})
+
+	if got := registry.Names(); !slices.Equal(got, []string{CollectorLogin, "ok", "failing", "crashing"}) {
+		t.Errorf("Names = %v", got)
+	}
+
+	result := registry.Run()
+	if result.Assets["ok"] != "second" {
+		t.Errorf("同名收集器应被替换: %v", result.Assets["ok"])
+	}
+	if result.Assets["failing"] != "partial" || result.Errors["failing"] == nil {
+		t.Errorf("失败的收集器应保留部分结果和错误: %v, %v", result.Assets["failing"], result.Errors["failing"])
+	}
+	if _, ok := result.Assets["crashing"]; ok || result.Errors["crashing"] == nil {
+		t.Errorf("panic 应转换为错误: %v", result.Errors["crashing"])
+	}
+	if _, ok := result.Assets["disabled"]; ok {
+		t.Error("禁用的收集器不应运行")
+	}
+
+	// 登录资产的来源全部失败时返回部分结果和合并的错误
+	if _, ok := result.Assets[CollectorLogin].(*protocol.LoginAssets); !ok {
+		t.Errorf("登录资产 = %T", result.Assets[CollectorLogin])
+	}
+	if err := result.Errors[CollectorLogin]; err == nil || !strings.Contains(err.Error(), "current_sessions") {
+		t.Errorf("登录资产错误 = %v", err)
+	}
+}
@@ -1,6 +1,9 @@
 package audit
 
-import "time"
+import (
+	"maps"
+	"time"
+)
 
 // Config 审计配置
 type Config struct {
@@ -27,6 +30,9 @@ type Config struct {
 
 	// 性能相关
 	PerformanceConfig PerformanceConfig
+
+	// 禁用的资产收集器名称 (见 CollectorNetwork 等常量)
+	DisabledCollectors []string
 }
 
 // ProcessConfig 进程检查配置
@@ -115,7 +121,14 @@ type LoginConfig struct {
 	// 失败登录记录数量
 	FailedLoginCount int
 
-	// 高频 IP 阈值
+	// 成功和失败登录各自收集的最大记录数 (last/lastb -n 及直接读取日志时的上限)，为 0 时默认 100
+	MaxLoginRecords int
+
+	// 登录相关命令 (last/lastb/w/journalctl 等) 的超时时间，为 0 时默认 30 秒
+	// wtmp/btmp 很大或位于卡住的网络挂载上时命令可能长时间不返回
+	CommandTimeout time.Duration
+
+	// 高频 IP 阈值 (每小时成功登录次数)，按同一来源最早与最晚登录的跨度计算，跨度不足1小时按1小时计
 	HighFrequencyIPThreshold int
 
 	// 同一 IP 登录阈值
@@ -123,6 +136,213 @@ type LoginConfig struct {
 
 	// Root 不同 IP 阈值
 	RootDifferentIPThreshold int
+
+	// btmp 文件路径 (直接从尾部读取失败登录记录)
+	BtmpPath string
+
+	// wtmp 文件路径
+	WtmpPath string
+
+	// 同时读取 wtmp/btmp 的轮转文件 (wtmp.1、btmp.2.gz 等)，与当前文件的记录合并后按 MaxLoginRecords 截取最新的记录
+	// 轮转周期内的审计需要开启，gz 文件会解压到临时目录
+	IncludeRotatedLogs bool
+
+	// utmp 文件路径 (当前登录会话)
+	UtmpPath string
+
+	// 读取失败登录的认证日志路径，支持 glob (如 /var/log/auth.log* 同时匹配轮转文件，gz 文件自动解压)
+	// 为空时使用 /var/log/auth.log 或 /var/log/secure；匹配的文件按修改时间从旧到新读取
+	AuthLogPaths []string
+
+	// 优先使用 utmpdump 读取 wtmp (文本格式稳定，不受 locale 和列布局影响)
+	// btmp 总是先从文件尾部直接读取，避免全量解析，直接读取失败时才使用 utmpdump
+	PreferUtmpdump bool
+
+	// 使用 last 时再以 -i 运行一次，合并主机名和数字IP
+	LastWithNumericIPs bool
+
+	// Unix Socket 事件输出 (Path 为空时不启用)
+	SocketSink SocketSinkConfig
+
+	// 终端突发分配检测窗口
+	TerminalBurstWindow time.Duration
+
+	// 窗口内同一来源分配的终端数超过该值视为疑似自动化
+	TerminalBurstThreshold int
+
+	// 记录转换，填充归属地之后按顺序作用于每条记录和会话；IncludeUsers/ExcludeUsers 匹配转换后的用户名
+	// 可选: lowercase-user, strip-realm, canonicalize-ip, canonicalize-terminal
+	RecordTransforms []string
+
+	// 去除用户名、终端、IP和时间都相同的重复记录 (如 wtmp 在会话期间轮转导致 last 重复输出)，保留第一条
+	// 默认关闭，保持与原始日志一致的计数
+	DeduplicateRecords bool
+
+	// PAM 锁定模块名称 (各发行版不同)
+	PAMLockoutModules []string
+
+	// faillock 配置文件路径
+	FaillockConfPath string
+
+	// 相对时间查询窗口上限 (如 "-1h")，超出时拒绝查询
+	MaxQueryWindow time.Duration
+
+	// 允许超出 MaxQueryWindow 的查询窗口
+	AllowLongQueryWindow bool
+
+	// 实时跟踪认证日志的轮询间隔
+	WatchPollInterval time.Duration
+
+	// 实时跟踪的去重窗口，窗口内重复出现的同一日志行只输出一次 (如 copytruncate 轮转时)
+	WatchDedupWindow time.Duration
+
+	// 判定脚本化尝试所需的最少失败次数
+	ScriptedMinAttempts int
+
+	// 失败间隔的变异系数 (标准差/平均值) 低于该值视为脚本化尝试
+	ScriptedMaxCV float64
+
+	// 同一来源在 BruteForceWindow 内的失败次数达到 BruteForceThreshold 时视为暴力破解
+	BruteForceThreshold int
+	BruteForceWindow    time.Duration
+
+	// 主机位置，用于服务端构建来源 -> 目的地的地理流向
+	HostLocation HostLocationConfig
+
+	// 共享账户 (admin、deploy 等) 用户名 -> 来源广度阈值
+	SharedAccounts map[string]SharedAccountPolicy
+
+	// 共享账户来源广度统计窗口
+	SharedAccountWindow time.Duration
+
+	// 主机应仅允许公钥登录，出现密码认证成功的登录时告警
+	KeyOnlyAuth bool
+
+	// 当前会话空闲超过该时间视为空闲
+	SessionIdleThreshold time.Duration
+
+	// 当前会话空闲超过该时间视为长期空闲 (可能是被遗忘的会话)
+	SessionStaleThreshold time.Duration
+
+	// 节假日 (YYYY-MM-DD，本地时间)，用于识别集中在节假日的登录
+	Holidays []string
+
+	// 夜间时段 [OvernightStartHour, OvernightEndHour)，可跨越午夜，两者相等时不检测
+	OvernightStartHour int
+	OvernightEndHour   int
+
+	// 工作时间 [BusinessHoursStart, BusinessHoursEnd)，之外的成功登录列入 OffHoursLogins，两者相等时不检测
+	BusinessHoursStart int
+	BusinessHoursEnd   int
+
+	// 某时段的实际占比达到预期占比的该倍数时视为明显偏斜
+	TimingSkewThreshold float64
+
+	// 判断时段偏斜所需的最少记录数
+	TimingMinEvents int
+
+	// 按本地时间分析 (星期、小时、节假日) 时使用的时区 (IANA 名称)，为空时使用本机时区
+	// 在服务端重新分析其他主机的历史记录时应设置为该主机的时区
+	TimeZone string
+
+	// 汇聚模式读取的认证日志 (接收多台主机 syslog 的日志主机)，为空时使用本机认证日志
+	AggregateLogPath string
+
+	// 随登录资产附带的主机环境
+	HostContext HostContextConfig
+
+	// 允许的 SSH 来源 (堡垒机的 IP、CIDR 或主机名)，配置后来自其他来源的 SSH 登录视为绕过堡垒机
+	BastionSources []string
+
+	// 预期的登录来源国家，配置后来自其他国家的成功登录视为异地登录
+	// 名称需与归属地中的国家名称一致 (取决于 GeoIP 数据库语言，如 "中国" 或 "China")，不区分大小写
+	ExpectedCountries []string
+
+	// 同时检查历史登录记录中时间重叠且来源IP不同的会话 (默认只检查当前会话)
+	ConcurrentSessionHistory bool
+
+	// 当前会话的来源是主机名时 (w 的 FROM 列) 解析其 IP，默认只记录主机名
+	ResolveSessionHostnames bool
+
+	// 通过 loginctl 为当前会话补充首进程 PID，便于关联登录和进程；主机不是以 systemd 启动时跳过
+	ResolveSessionPIDs bool
+
+	// NAT 出口 (IP、CIDR 或主机名)，来自这些来源的记录标记为 BehindNAT
+	// 同一出口背后有多个用户，按来源IP判断的分析 (高频来源、终端突发分配等) 不再将其视为单一来源
+	NATEgressSources []string
+
+	// 只采集这些用户的登录记录、会话、最近登录、账户锁定和提权记录，支持通配符 (如 ops-*)；非空时为严格白名单，为空时不限制
+	IncludeUsers []string
+
+	// 不采集这些用户的上述记录 (如监控、备份等噪声账户)，支持通配符，优先于 IncludeUsers
+	ExcludeUsers []string
+
+	// 服务账户 (部署、备份等自动化使用的账户)，会话时长上限按服务账户计算
+	ServiceAccounts []string
+
+	// 各账户类别的会话时长上限，当前会话持续超过上限时告警
+	SessionMaxAge SessionMaxAgeConfig
+
+	// 已确认发送的水位文件 (见 AckTransmitted)，为空时水位只保存在内存中
+	WatermarkPath string
+
+	// 收集器状态文件 (各用户的历史来源)，创建收集器时读取，Close 时保存；增量收集的水位见 WatermarkPath
+	// 配置后自动跟踪历史来源并检测首次出现的来源 (见 SetKnownUserIPs)；为空时不保存状态
+	StatePath string
+
+	// 终端别名 (原始名称 -> 规范名称)，键以 * 结尾时按前缀匹配，值中的 * 替换为前缀之后的部分
+	// 规范化的终端及其类型与原始终端一同输出，默认包含常见的命名差异，为空时只去除 /dev/ 前缀
+	TerminalAliases map[string]string
+
+	// 登录后该时间内的敏感文件访问与登录关联 (见 SetFileAccessSource)
+	FileAccessWindow time.Duration
+
+	// 登录资产 JSON 序列化后的大小上限 (字节)，超出时按 trimLoginAssets 的顺序丢弃最早的原始记录
+	// (CollectPending 丢弃最新的记录，留到下一次收集)，统计信息和告警始终保留；0 表示不限制
+	MaxPayloadBytes int
+}
+
+// SessionMaxAgeConfig 各账户类别的会话时长上限，为 0 时不检查该类别
+type SessionMaxAgeConfig struct {
+	Root    time.Duration
+	Service time.Duration
+	Human   time.Duration
+}
+
+// HostContextConfig 主机环境配置，Enabled 为 false 时不附带，各字段可单独关闭
+type HostContextConfig struct {
+	Enabled bool
+
+	Hostname     bool
+	Distro       bool
+	Kernel       bool
+	AgentVersion bool
+	InstanceID   bool
+}
+
+// HostLocationConfig 主机位置配置
+type HostLocationConfig struct {
+	// 获取方式: 空 (不上报) / static (使用静态配置) / api (通过 HTTP 接口探测公网IP)
+	Method string
+
+	// 静态配置的公网IP和归属地 (static)
+	IP       string
+	Location string
+
+	// 返回调用方公网IP的 HTTP 接口 (api)，响应正文为 IP 地址
+	APIURL string
+
+	// 探测结果的刷新间隔
+	RefreshInterval time.Duration
+}
+
+// SharedAccountPolicy 共享账户来源广度阈值，0 表示不限制
+type SharedAccountPolicy struct {
+	// 窗口内允许的最大来源网段数 (IPv4 /24, IPv6 /48)
+	MaxNetworks int
+
+	// 窗口内允许的最大来源国家数 (需要记录带有归属地)
+	MaxCountries int
 }
 
 // ScoringConfig 风险评分配置
@@ -154,6 +374,15 @@ type PerformanceConfig struct {
 	// 命令执行超时时间
 	CommandTimeout time.Duration
 
+	// 禁止执行外部命令，只通过直接解析文件收集 (适用于限制进程执行的环境)
+	NoExec bool
+
+	// 命令因暂时性错误 (负载过高时 fork 返回 EAGAIN/ENOMEM 等) 失败时的最大执行次数，<=1 时不重试
+	CommandRetryAttempts int
+
+	// 重试的初始等待时间，之后每次加倍，为 0 时默认 100 毫秒；重试和等待都计入 CommandTimeout
+	CommandRetryBackoff time.Duration
+
 	// authorized_keys 读取限制 (KB)
 	AuthKeysReadLimitKB int64
 
@@ -264,9 +493,52 @@ func DefaultConfig() *Config {
 		LoginConfig: LoginConfig{
 			RecentLoginCount:         50,
 			FailedLoginCount:         100,
+			MaxLoginRecords:          100,
+			CommandTimeout:           30 * time.Second,
 			HighFrequencyIPThreshold: 10,
 			SameIPLoginThreshold:     30, // 降低到 30
 			RootDifferentIPThreshold: 3,
+			BtmpPath:                 "/var/log/btmp",
+			WtmpPath:                 "/var/log/wtmp",
+			UtmpPath:                 "/var/run/utmp",
+			PreferUtmpdump:           true,
+			TerminalBurstWindow:      time.Minute,
+			TerminalBurstThreshold:   8,
+			PAMLockoutModules:        []string{"pam_faillock", "pam_tally2", "pam_tally"},
+			FaillockConfPath:         "/etc/security/faillock.conf",
+			MaxQueryWindow:           90 * 24 * time.Hour,
+			SharedAccountWindow:      24 * time.Hour,
+			WatchPollInterval:        time.Second,
+			WatchDedupWindow:         30 * time.Second,
+			ScriptedMinAttempts:      6,
+			ScriptedMaxCV:            0.1,
+			BruteForceThreshold:      10,
+			BruteForceWindow:         time.Minute,
+			SessionIdleThreshold:     30 * time.Minute,
+			SessionStaleThreshold:    8 * time.Hour,
+			OvernightStartHour:       22,
+			OvernightEndHour:         6,
+			BusinessHoursStart:       8,
+			BusinessHoursEnd:         20,
+			TimingSkewThreshold:      2,
+			TimingMinEvents:          20,
+			TerminalAliases:          maps.Clone(defaultTerminalAliases),
+			FileAccessWindow:         5 * time.Minute,
+			HostLocation: HostLocationConfig{
+				RefreshInterval: 6 * time.Hour,
+			},
+			SessionMaxAge: SessionMaxAgeConfig{
+				Root:    24 * time.Hour,
+				Service: 24 * time.Hour,
+				Human:   7 * 24 * time.Hour,
+			},
+			HostContext: HostContextConfig{
+				Hostname:     true,
+				Distro:       true,
+				Kernel:       true,
+				AgentVersion: true,
+				InstanceID:   true,
+			},
 		},
 		ScoringConfig: ScoringConfig{
 			Weights: map[string]CheckWeight{
@@ -291,6 +563,8 @@ func DefaultConfig() *Config {
 		PerformanceConfig: PerformanceConfig{
 			ProcessCacheDuration:    1 * time.Second,
 			CommandTimeout:          15 * time.Second,
+			CommandRetryAttempts:    3,
+			CommandRetryBackoff:     100 * time.Millisecond,
 			AuthKeysReadLimitKB:     512,
 			IntegrityCheckBatchSize: 10,
 		},
@@ -0,0 +1,74 @@
+package audit
+
+import (
+	"path"
+	"strings"
+)
+
+// userFilter 按用户名过滤采集结果，条目支持 path.Match 通配符 (如 svc-*、backup?)
+// 白名单非空时只保留命中白名单的用户；黑名单优先于白名单
+// 各收集器共用，避免每个收集器各自解析过滤配置
+type userFilter struct {
+	include []string
+	exclude []string
+
+	// 配置了白名单 (即使条目全部无效)，此时未命中白名单的用户都被过滤
+	strict bool
+}
+
+// newUserFilter 创建用户过滤器，无效的通配符条目忽略并记录警告；两个列表都为空时返回 nil (不过滤)
+func newUserFilter(include, exclude []string) *userFilter {
+	f := &userFilter{
+		include: validUserPatterns(include),
+		exclude: validUserPatterns(exclude),
+	}
+	// 白名单条目全部无效时仍按白名单处理，避免配置错误时放行所有用户
+	for _, pattern := range include {
+		if strings.TrimSpace(pattern) != "" {
+			f.strict = true
+		}
+	}
+	if !f.strict && len(f.exclude) == 0 {
+		return nil
+	}
+	return f
+}
+
+func validUserPatterns(patterns []string) []string {
+	var valid []string
+	for _, pattern := range patterns {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "" {
+			continue
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			globalLogger.Warn("用户过滤条目无效，已忽略: %s: %v", pattern, err)
+			continue
+		}
+		valid = append(valid, pattern)
+	}
+	return valid
+}
+
+// Allows 用户是否保留；过滤器为 nil 时保留所有用户
+func (f *userFilter) Allows(username string) bool {
+	if f == nil {
+		return true
+	}
+	if matchUserPattern(f.exclude, username) {
+		return false
+	}
+	if f.strict {
+		return matchUserPattern(f.include, username)
+	}
+	return true
+}
+
+func matchUserPattern(patterns []string, username string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, username); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -5,6 +5,7 @@ import (
 	"context"
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -12,12 +13,13 @@ import (
 	"os/exec"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/shirou/gopsutil/v4/process"
 )
 
-// Logger 日志接口
+// Logger 日志接口，收集器会在多个 goroutine 中同时写日志，实现需要并发安全
 type Logger interface {
 	Debug(format string, args ...interface{})
 	Info(format string, args ...interface{})
@@ -46,7 +48,7 @@ func (l *defaultLogger) Error(format string, args ...interface{}) {
 
 var globalLogger Logger = &defaultLogger{}
 
-// SetLogger 设置全局日志器
+// SetLogger 设置全局日志器，应在开始收集前调用
 func SetLogger(logger Logger) {
 	if logger != nil {
 		globalLogger = logger
@@ -107,11 +109,42 @@ func (pc *ProcessCache) Clear() {
 	pc.timestamp = time.Time{}
 }
 
+// ErrNoExec 禁止执行外部命令
+var ErrNoExec = errors.New("unavailable in no-exec mode")
+
+// CommandRunner 外部命令执行接口，CommandExecutor 是其实现
+// 测试时可替换为返回固定输出的实现，不依赖主机上的登录历史
+type CommandRunner interface {
+	Execute(name string, args ...string) (string, error)
+}
+
+// contextCommandRunner 支持取消和覆盖环境变量的命令执行，CommandExecutor 实现了该接口
+// 只实现 CommandRunner 时不使用单独的超时时间，也不以其他 locale 重新执行
+type contextCommandRunner interface {
+	CommandRunner
+	ExecuteContextEnv(ctx context.Context, env []string, name string, args ...string) (string, error)
+}
+
 // CommandExecutor 命令执行器
 type CommandExecutor struct {
 	timeout time.Duration
+	noExec  bool
+
+	// 子进程的环境变量和工作目录，env 为 nil 时继承当前进程的环境变量，dir 为空时使用当前目录
+	env []string
+	dir string
+
+	// 暂时性错误的最大执行次数 (<=1 时不重试) 和初始等待时间
+	maxAttempts  int
+	retryBackoff time.Duration
+
+	// 执行一次命令，为 nil 时使用 cmd.Run，测试时替换
+	run func(cmd *exec.Cmd) error
 }
 
+// defaultCommandRetryBackoff 未设置重试等待时间时的初始等待时间
+const defaultCommandRetryBackoff = 100 * time.Millisecond
+
 // NewCommandExecutor 创建命令执行器
 func NewCommandExecutor(timeout time.Duration) *CommandExecutor {
 	return &CommandExecutor{
@@ -119,35 +152,158 @@ func NewCommandExecutor(timeout time.Duration) *CommandExecutor {
 	}
 }
 
-// Execute 执行命令
+// SetNoExec 设置是否禁止执行外部命令，禁止后 Execute 直接返回 ErrNoExec
+func (ce *CommandExecutor) SetNoExec(noExec bool) {
+	ce.noExec = noExec
+}
+
+// SetEnv 设置子进程的环境变量 (KEY=VALUE)，替换而不是追加到当前进程的环境变量，为 nil 时继承当前进程的环境变量
+// 如强制 LC_TIME=C 使时间格式稳定；应在开始执行命令前调用
+func (ce *CommandExecutor) SetEnv(env []string) {
+	ce.env = env
+}
+
+// SetDir 设置子进程的工作目录，为空时使用当前目录；应在开始执行命令前调用
+func (ce *CommandExecutor) SetDir(dir string) {
+	ce.dir = dir
+}
+
+// SetRetry 设置暂时性错误的重试：最多执行 maxAttempts 次，第一次重试前等待 backoff，之后每次加倍
+// maxAttempts<=1 时不重试，backoff 为 0 时默认 100 毫秒；只重试负载过高时 fork 失败等暂时性错误，
+// 命令不存在、权限不足、命令本身以非零状态退出和超时都不重试。重试和等待都计入同一个超时时间；应在开始执行命令前调用
+func (ce *CommandExecutor) SetRetry(maxAttempts int, backoff time.Duration) {
+	ce.maxAttempts = maxAttempts
+	ce.retryBackoff = backoff
+}
+
+// Execute 执行命令，超时时间为创建执行器时指定的时间
 func (ce *CommandExecutor) Execute(name string, args ...string) (string, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), ce.timeout)
-	defer cancel()
+	return ce.ExecuteContext(context.Background(), name, args...)
+}
+
+// ExecuteContext 执行命令，ctx 取消或超时后结束进程
+// ctx 没有截止时间时使用创建执行器时指定的超时时间
+func (ce *CommandExecutor) ExecuteContext(ctx context.Context, name string, args ...string) (string, error) {
+	return ce.ExecuteContextEnv(ctx, nil, name, args...)
+}
+
+// ExecuteContextEnv 与 ExecuteContext 相同，env 中的 KEY=VALUE 覆盖同名环境变量
+// (SetEnv 设置的环境变量，未设置时为当前进程的环境变量)
+func (ce *CommandExecutor) ExecuteContextEnv(ctx context.Context, env []string, name string, args ...string) (string, error) {
+	if ce.noExec {
+		return "", ErrNoExec
+	}
+
+	timeout := ce.timeout
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout = time.Until(deadline)
+	} else {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, ce.timeout)
+		defer cancel()
+	}
+
+	cmdEnv := ce.env
+	if len(env) > 0 {
+		base := ce.env
+		if base == nil {
+			base = os.Environ()
+		}
+		cmdEnv = overrideEnv(base, env)
+	}
 
-	cmd := exec.CommandContext(ctx, name, args...)
 	var stdout bytes.Buffer
 	var stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
+	var err error
+	attempts := 0
+	backoff := ce.retryBackoff
+	if backoff <= 0 {
+		backoff = defaultCommandRetryBackoff
+	}
+	for {
+		attempts++
+		stdout.Reset()
+		stderr.Reset()
+		// exec.Cmd 不能重复执行，每次重新创建
+		cmd := exec.CommandContext(ctx, name, args...)
+		cmd.Dir = ce.dir
+		cmd.Env = cmdEnv
+		cmd.Stdout = &stdout
+		cmd.Stderr = &stderr
+
+		err = ce.runCmd(cmd)
+		if err == nil || attempts >= ce.maxAttempts || !isTransientCommandError(err) {
+			break
+		}
+		globalLogger.Debug("命令执行失败 (第 %d 次)，%v 后重试: %s: %v", attempts, backoff, name, err)
+		select {
+		case <-ctx.Done():
+		case <-time.After(backoff):
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		backoff *= 2
+	}
 
-	err := cmd.Run()
 	if err != nil {
-		// 检查是否超时
-		if ctx.Err() == context.DeadlineExceeded {
-			globalLogger.Warn("命令执行超时(%v): %s %v", ce.timeout, name, args)
-			return "", fmt.Errorf("命令执行超时(%v): %s", ce.timeout, name)
+		// 检查是否超时或被取消
+		switch ctx.Err() {
+		case context.DeadlineExceeded:
+			globalLogger.Warn("命令执行超时(%v): %s %v", timeout.Round(time.Millisecond), name, args)
+			return "", fmt.Errorf("命令执行超时(%v): %s", timeout.Round(time.Millisecond), name)
+		case context.Canceled:
+			return "", fmt.Errorf("命令执行已取消: %s: %w", name, ctx.Err())
 		}
 
 		// 记录错误但返回输出
 		if stderr.Len() > 0 {
 			globalLogger.Debug("命令执行失败: %s %v, stderr: %s", name, args, stderr.String())
 		}
+		if attempts > 1 {
+			err = fmt.Errorf("%s 执行 %d 次后仍失败: %w", name, attempts, err)
+		}
 		return stdout.String(), err
 	}
 
 	return stdout.String(), nil
 }
 
+func (ce *CommandExecutor) runCmd(cmd *exec.Cmd) error {
+	if ce.run == nil {
+		return cmd.Run()
+	}
+	return ce.run(cmd)
+}
+
+// isTransientCommandError 是否为重试可能成功的暂时性错误
+// 负载过高时创建进程失败 (EAGAIN: 进程数或线程数达到上限，ENOMEM: 内存不足) 或被信号中断；
+// 命令不存在、权限不足及命令以非零状态退出 (*exec.ExitError) 都不是暂时性错误
+func isTransientCommandError(err error) bool {
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) || errors.Is(err, exec.ErrNotFound) || errors.Is(err, os.ErrPermission) {
+		return false
+	}
+	return errors.Is(err, syscall.EAGAIN) || errors.Is(err, syscall.ENOMEM) || errors.Is(err, syscall.EINTR)
+}
+
+// overrideEnv 用 overrides 中的 KEY=VALUE 替换 base 中的同名变量
+func overrideEnv(base, overrides []string) []string {
+	keys := make(map[string]bool, len(overrides))
+	for _, kv := range overrides {
+		key, _, _ := strings.Cut(kv, "=")
+		keys[key] = true
+	}
+	env := make([]string, 0, len(base)+len(overrides))
+	for _, kv := range base {
+		key, _, _ := strings.Cut(kv, "=")
+		if !keys[key] {
+			env = append(env, kv)
+		}
+	}
+	return append(env, overrides...)
+}
+
 // FileHashCache 文件哈希缓存
 type FileHashCache struct {
 	cache map[string]cachedHash
@@ -0,0 +1,93 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestCommandExecutorEnvAndDir(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not found")
+	}
+	t.Setenv("PIKA_TEST_ENV", "inherited")
+	dir, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	script := `echo "$PIKA_TEST_ENV|$PIKA_TEST_OTHER|$(pwd)"`
+
+	// 默认继承当前进程的环境变量
+	executor := NewCommandExecutor(5 * time.Second)
+	if output, err := executor.Execute("sh", "-c", script); err != nil || !strings.HasPrefix(output, "inherited||") {
+		t.Errorf("默认输出 = %q, %v", output, err)
+	}
+
+	// 设置后替换全部环境变量，并在指定目录中执行
+	executor.SetEnv([]string{"PIKA_TEST_OTHER=set", "PATH=" + os.Getenv("PATH")})
+	executor.SetDir(dir)
+	if output, err := executor.Execute("sh", "-c", script); err != nil || output != "|set|"+dir+"\n" {
+		t.Errorf("设置后输出 = %q, %v", output, err)
+	}
+
+	// 单次执行的覆盖在设置的环境变量之上生效
+	output, err := executor.ExecuteContextEnv(context.Background(), []string{"PIKA_TEST_ENV=override"}, "sh", "-c", script)
+	if err != nil || output != "override|set|"+dir+"\n" {
+		t.Errorf("覆盖后输出 = %q, %v", output, err)
+	}
+}
+
+func TestCommandExecutorRetry(t *testing.T) {
+	forkErr := &os.SyscallError{Syscall: "fork/exec", Err: syscall.EAGAIN}
+	newExecutor := func(failures int, err error) (*CommandExecutor, *int) {
+		executor := NewCommandExecutor(5 * time.Second)
+		executor.SetRetry(3, time.Millisecond)
+		calls := 0
+		executor.run = func(cmd *exec.Cmd) error {
+			calls++
+			if calls <= failures {
+				return err
+			}
+			_, _ = cmd.Stdout.Write([]byte("ok"))
+			return nil
+		}
+		return executor, &calls
+	}
+
+	// 暂时性错误重试后成功
+	executor, calls := newExecutor(2, forkErr)
+	if output, err := executor.Execute("last"); err != nil || output != "ok" || *calls != 3 {
+		t.Errorf("重试后 = %q, %v, 执行 %d 次", output, err, *calls)
+	}
+
+	// 超过最大次数时错误包含执行次数
+	executor, calls = newExecutor(5, forkErr)
+	_, err := executor.Execute("last")
+	if err == nil || !errors.Is(err, syscall.EAGAIN) || !strings.Contains(err.Error(), "执行 3 次") || *calls != 3 {
+		t.Errorf("多次失败 = %v, 执行 %d 次", err, *calls)
+	}
+
+	// 命令不存在和权限不足不重试
+	for _, permanent := range []error{
+		&exec.Error{Name: "last", Err: exec.ErrNotFound},
+		&os.PathError{Op: "fork/exec", Path: "/usr/bin/last", Err: syscall.EACCES},
+	} {
+		executor, calls = newExecutor(5, permanent)
+		if _, err := executor.Execute("last"); err == nil || strings.Contains(err.Error(), "次后仍失败") || *calls != 1 {
+			t.Errorf("%v: %v, 执行 %d 次", permanent, err, *calls)
+		}
+	}
+
+	// 未设置时不重试
+	executor, calls = newExecutor(1, forkErr)
+	executor.SetRetry(0, 0)
+	if _, err := executor.Execute("last"); err == nil || *calls != 1 {
+		t.Errorf("未设置重试 = %v, 执行 %d 次", err, *calls)
+	}
+}
@@ -46,6 +46,10 @@ type ServerConfig struct {
 type AgentConfig struct {
 	// Agent 名称（默认使用主机名）
 	Name string `yaml:"name"`
+
+	// 审计结果中登录资产的传输编码: json（默认）/ protobuf
+	// protobuf 体积更小，服务端不支持时自动使用 json
+	LoginAssetsEncoding string `yaml:"login_assets_encoding"`
 }
 
 // CollectorConfig 采集器配置
@@ -2,10 +2,12 @@ package id
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
 
+	"github.com/dushixiang/pika/pkg/agent/sysutil"
 	"github.com/google/uuid"
 )
 
@@ -55,7 +57,13 @@ func (m *Manager) Load() (string, error) {
 
 // read 读取 ID 文件
 func (m *Manager) read() (string, error) {
-	data, err := os.ReadFile(m.idFilePath)
+	file, err := sysutil.OpenNoFollow(m.idFilePath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
 	if err != nil {
 		return "", err
 	}
@@ -70,14 +78,8 @@ func (m *Manager) read() (string, error) {
 
 // save 保存 ID 到文件
 func (m *Manager) save(id string) error {
-	// 确保目录存在
-	dir := filepath.Dir(m.idFilePath)
-	if err := os.MkdirAll(dir, 0755); err != nil {
-		return fmt.Errorf("创建目录失败: %w", err)
-	}
-
-	// 写入 ID 文件
-	if err := os.WriteFile(m.idFilePath, []byte(id), 0644); err != nil {
+	// 写入 ID 文件，不跟随目录或文件位置的符号链接
+	if err := sysutil.WriteFileAtomic(m.idFilePath, []byte(id), 0644); err != nil {
 		return fmt.Errorf("写入文件失败: %w", err)
 	}
 
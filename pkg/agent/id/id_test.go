@@ -0,0 +1,53 @@
+package id
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestManagerRefusesSymlinks(t *testing.T) {
+	dir := t.TempDir()
+	secret := filepath.Join(dir, "secret")
+	if err := os.WriteFile(secret, []byte("do-not-touch"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// ID 文件被替换为符号链接: 不读取链接目标，重新生成的 ID 替换链接本身
+	stateDir := filepath.Join(dir, "state")
+	if err := os.Mkdir(stateDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	idPath := filepath.Join(stateDir, "agent.id")
+	if err := os.Symlink(secret, idPath); err != nil {
+		t.Fatal(err)
+	}
+
+	m := &Manager{idFilePath: idPath}
+	id, err := m.Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if id == "do-not-touch" {
+		t.Fatal("读取了符号链接指向的文件")
+	}
+	if data, _ := os.ReadFile(secret); string(data) != "do-not-touch" {
+		t.Fatalf("符号链接指向的文件被改写: %q", data)
+	}
+	if info, err := os.Lstat(idPath); err != nil || info.Mode()&os.ModeSymlink != 0 {
+		t.Fatalf("ID 文件仍是符号链接: %v", err)
+	}
+
+	// 状态目录是符号链接时拒绝写入
+	linkedDir := filepath.Join(dir, "linked")
+	if err := os.Symlink(stateDir, linkedDir); err != nil {
+		t.Fatal(err)
+	}
+	m = &Manager{idFilePath: filepath.Join(linkedDir, "other.id")}
+	if _, err := m.Load(); err == nil {
+		t.Fatal("状态目录是符号链接时应拒绝写入")
+	}
+	if _, err := os.Stat(filepath.Join(stateDir, "other.id")); !os.IsNotExist(err) {
+		t.Fatalf("通过符号链接目录写入了文件: %v", err)
+	}
+}
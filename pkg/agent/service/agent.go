@@ -9,7 +9,9 @@ import (
 	"log"
 	"os"
 	"runtime"
+	"slices"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/dushixiang/pika/internal/protocol"
@@ -69,6 +71,9 @@ type Agent struct {
 	collectorMu      sync.RWMutex
 	collectorManager *collector.Manager
 	tamperProtector  *tamper.Protector
+
+	// 当前连接的服务端支持的登录资产编码
+	serverEncodings atomic.Value
 }
 
 // New 创建 Agent 实例
@@ -351,6 +356,8 @@ func (a *Agent) registerAgent(conn *safeConn) error {
 		return fmt.Errorf("解析注册响应失败: %w", err)
 	}
 
+	a.serverEncodings.Store(registerResp.Encodings)
+
 	log.Printf("注册成功: AgentId=%s, Status=%s", registerResp.AgentID, registerResp.Status)
 	return nil
 }
@@ -538,6 +545,8 @@ func (a *Agent) handleCommand(data json.RawMessage) {
 	switch cmdReq.Type {
 	case "vps_audit":
 		a.handleVPSAudit(conn, cmdReq.ID)
+	case "capabilities":
+		a.handleCapabilities(conn, cmdReq.ID)
 	default:
 		log.Printf("⚠️  未知指令类型: %s", cmdReq.Type)
 		a.sendCommandResponse(conn, cmdReq.ID, cmdReq.Type, "error", "未知指令类型", "")
@@ -554,6 +563,13 @@ func (a *Agent) handleVPSAudit(conn *safeConn, cmdID string) {
 		return
 	}
 
+	// 与服务端协商使用 protobuf 编码登录资产
+	if a.useProtoLoginAssets() {
+		if err := result.AssetInventory.EncodeLoginAssetsProto(); err != nil {
+			log.Printf("⚠️  登录资产 protobuf 编码失败，使用 JSON: %v", err)
+		}
+	}
+
 	// 将结果序列化为JSON
 	resultJSON, err := json.Marshal(result)
 	if err != nil {
@@ -566,6 +582,25 @@ func (a *Agent) handleVPSAudit(conn *safeConn, cmdID string) {
 	a.sendCommandResponse(conn, cmdID, "vps_audit", "success", "", string(resultJSON))
 }
 
+// handleCapabilities 返回探针支持的收集器、分析器和输出格式，不执行任何收集
+func (a *Agent) handleCapabilities(conn *safeConn, cmdID string) {
+	resultJSON, err := json.Marshal(audit.Capabilities(nil))
+	if err != nil {
+		a.sendCommandResponse(conn, cmdID, "capabilities", "error", "序列化结果失败", "")
+		return
+	}
+	a.sendCommandResponse(conn, cmdID, "capabilities", "success", "", string(resultJSON))
+}
+
+// useProtoLoginAssets 配置要求且服务端支持时使用 protobuf 编码登录资产
+func (a *Agent) useProtoLoginAssets() bool {
+	if a.cfg.Agent.LoginAssetsEncoding != protocol.LoginAssetsEncodingProtobuf {
+		return false
+	}
+	encodings, _ := a.serverEncodings.Load().([]string)
+	return slices.Contains(encodings, protocol.LoginAssetsEncodingProtobuf)
+}
+
 // runVPSAudit 运行VPS安全审计
 func (a *Agent) runVPSAudit() (*protocol.VPSAuditResult, error) {
 	return audit.RunAudit()
@@ -0,0 +1,78 @@
+package sysutil
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// ErrSymlink 路径是符号链接，拒绝跟随
+var ErrSymlink = errors.New("refusing to follow symlink")
+
+// OpenNoFollow 只读打开普通文件，不跟随符号链接
+// 探针通常以 root 运行，路径被替换为符号链接时可能被诱导读取其他文件
+func OpenNoFollow(path string) (*os.File, error) {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.Mode()&os.ModeSymlink != 0 {
+		return nil, fmt.Errorf("%s: %w", path, ErrSymlink)
+	}
+
+	file, err := openNoFollow(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// 打开前后必须是同一个普通文件，避免检查后被替换
+	opened, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	if !opened.Mode().IsRegular() || !os.SameFile(info, opened) {
+		file.Close()
+		return nil, fmt.Errorf("%s: not the expected regular file", path)
+	}
+	return file, nil
+}
+
+// WriteFileAtomic 写入状态文件，所在目录不能是符号链接
+// 先写入同目录下的临时文件再重命名，目标位置即使是符号链接也只会被替换，不会被跟随
+func WriteFileAtomic(path string, data []byte, perm os.FileMode) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	info, err := os.Lstat(dir)
+	if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeSymlink != 0 {
+		return fmt.Errorf("%s: %w", dir, ErrSymlink)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s: not a directory", dir)
+	}
+
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,58 @@
+//go:build !windows
+
+package sysutil
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+func openNoFollow(path string) (*os.File, error) {
+	return os.OpenFile(path, os.O_RDONLY|syscall.O_NOFOLLOW, 0)
+}
+
+// CheckTrustedDir 检查目录及其全部上级目录不能被其他用户修改
+// 每一级 (包括路径中的符号链接本身) 的所有者必须是 root 或当前用户，
+// 目录不能对其他用户可写，除非设置了 sticky 位 (如 /tmp)
+func CheckTrustedDir(dir string) error {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	if err := checkTrustedChain(abs); err != nil {
+		return err
+	}
+
+	// 路径中的符号链接可信时，还要检查解析后的目录
+	resolved, err := filepath.EvalSymlinks(abs)
+	if err != nil {
+		return err
+	}
+	if resolved != abs {
+		return checkTrustedChain(resolved)
+	}
+	return nil
+}
+
+func checkTrustedChain(path string) error {
+	for {
+		info, err := os.Lstat(path)
+		if err != nil {
+			return err
+		}
+		if stat, ok := info.Sys().(*syscall.Stat_t); ok && stat.Uid != 0 && int(stat.Uid) != os.Geteuid() {
+			return fmt.Errorf("%s is owned by untrusted uid %d", path, stat.Uid)
+		}
+		if info.IsDir() && info.Mode().Perm()&0o002 != 0 && info.Mode()&os.ModeSticky == 0 {
+			return fmt.Errorf("%s is writable by other users", path)
+		}
+
+		parent := filepath.Dir(path)
+		if parent == path {
+			return nil
+		}
+		path = parent
+	}
+}